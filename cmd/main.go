@@ -1,65 +1,81 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
-	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
-	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
 )
 
 const prompt string = "my-db> "
 
 func main() {
-
-	t := table.NewTable()
-	defer t.DestroyTable()
-	fmt.Println("~ Started my db... ")
-
-	server, _ := net.Listen("tcp", "localhost:9988")
-
-	for {
-		ioProvider := ioprovider.NewSocketIOProvider(server)
-		go proccessRequests(ioProvider, t)
-		// ioProvider := ioprovider.NewStdIOProvider()
+	commitDelay := flag.Duration("commit-delay", 0, "how long a commit waits for others to share its log sync")
+	shadowPaging := flag.Bool("shadow-paging", false, "create the database without a log, writing changed pages into new places")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "how long running commands may take to finish on shutdown")
+	archiveDir := flag.String("archive-dir", "", "the directory to archive the log into at every checkpoint, for point-in-time recovery")
+	backupDir := flag.String("backup-dir", "", "the directory clients back up the database into with .backup and restore it from with .restore; without it, both are refused")
+	flag.Parse()
+
+	mode := paging.PAGER_LOG
+	if *shadowPaging {
+		mode = paging.PAGER_SHADOW
 	}
-
-}
-
-func proccessRequests(ioProvider ioprovider.IIOProvider, t *table.Table) {
-	for {
-		printPrompt()
-
-		input, err := ioProvider.GetInput()
-
+	db, err := database.NewDatabaseInMode("./db", mode)
+	if err != nil {
+		fmt.Println("Could not open the database:", err)
+		os.Exit(1)
+	}
+	db.Pager.SetCommitDelay(*commitDelay)
+	if *archiveDir != "" {
+		err := db.Pager.SetArchiveDir(*archiveDir)
 		if err != nil {
-			fmt.Printf("An error occurred while reading input! %v", err)
-			return
+			fmt.Println("Could not archive the log:", err)
+			db.Close()
+			os.Exit(1)
 		}
-
-		inputType := getCommandType(input)
-
-		if inputType == commands.NON_STATEMENT_COMMAND {
-			nonStatement := getNonStatementCommand(input)
-			nonStatement.PrintPreExecution()
-			nonStatement.Execute(t, ioProvider)
-		} else {
-			statement := getStatementCommand(input)
-			statement.PrintPreExecution()
-			switch statement.Execute(t, ioProvider) {
-			case commands.SUCCESS:
-				fmt.Println("Success")
-			case commands.FAILURE:
-				fmt.Println("Failure")
-			case commands.UNRECOGNIZED:
-				fmt.Println("Unrecognized")
-			}
-
+	}
+	if *backupDir != "" {
+		err := db.SetBackupDir(*backupDir)
+		if err != nil {
+			fmt.Println("Could not use the backup directory:", err)
+			db.Close()
+			os.Exit(1)
 		}
+	}
+	fmt.Println("~ Started my db... ")
 
+	listener, err := net.Listen("tcp", "localhost:9988")
+	if err != nil {
+		fmt.Println("Could not listen:", err)
+		db.Close()
+		os.Exit(1)
 	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	s := newServer(listener, db)
+	go s.serve()
+	// ioProvider := ioprovider.NewStdIOProvider()
+
+	received := <-signals
+	fmt.Println("~ Received", received, "shutting down...")
+	go func() {
+		<-signals
+		fmt.Println("~ Received another signal, exiting at once")
+		os.Exit(1)
+	}()
+	s.shutdown(*shutdownTimeout)
+	fmt.Println("~ Stopped my db")
 }
 
 func printPrompt() {
@@ -79,21 +95,19 @@ func getNonStatementCommand(input string) commands.Command {
 		return commands.NewNonStatementExit()
 	} else if input == ".print" {
 		return commands.NewNonStatementPrint()
+	} else if input == ".tables" {
+		return commands.NewNonStatementTables()
+	} else if input == ".stats" {
+		return commands.NewNonStatementStats()
+	} else if command, name, found := strings.Cut(input, " "); found && command == ".backup" {
+		return commands.NewNonStatementBackup(strings.TrimSpace(name))
+	} else if command, name, found := strings.Cut(input, " "); found && command == ".restore" {
+		return commands.NewNonStatementRestore(strings.TrimSpace(name))
 	} else {
 		return commands.NewNonStatementUnrecognized()
 	}
 }
 
-func getStatementCommand(input string) commands.Command {
-	inputParts := strings.Split(input, " ")
-
-	if inputParts[0] == "insert" {
-		return commands.NewStatementInsert(input)
-	} else if inputParts[0] == "select" {
-		return commands.NewStatementSelect(input)
-	} else if inputParts[0] == "selectOne" {
-		return commands.NewStatementSelectOne(input)
-	} else {
-		return commands.NewStatementUnrecognized(input)
-	}
+func getStatementCommand(input string, session *commands.Session) commands.Command {
+	return commands.NewStatementCommand(input, session)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+)
+
+/**
+ * Recovers a database to a point in time: starts from a base backup made
+ * by .backup and replays the commits of the archived log segments, and of
+ * the live log if given, up to the target. With -list, only lists the
+ * logged commits, to find the point to recover to.
+ */
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("recover", flag.ContinueOnError)
+	backup := flags.String("backup", "", "the base backup to start from")
+	archiveDir := flags.String("archive", "", "the directory the log was archived into")
+	liveLog := flags.String("log", "", "the log of the database, replayed after the archived segments")
+	target := flags.String("target", "", "where to create the recovered database")
+	untilTime := flags.String("until-time", "", "replay the commits made at or before this time (RFC 3339, or \"2006-01-02 15:04:05\" in local time)")
+	untilLSN := flags.Uint64("until-lsn", 0, "replay the commits ending at or before this LSN")
+	list := flags.Bool("list", false, "list the logged commits instead of recovering")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	logs := make([]string, 0)
+	if *archiveDir != "" {
+		segments, err := paging.ArchivedSegments(*archiveDir)
+		if err != nil {
+			return fmt.Errorf("Could not read the archive: %v", err)
+		}
+		logs = append(logs, segments...)
+	}
+	if *liveLog != "" {
+		logs = append(logs, *liveLog)
+	}
+
+	if *list {
+		commits, err := paging.ListLoggedCommits(logs)
+		if err != nil {
+			return fmt.Errorf("Could not read the log: %v", err)
+		}
+		for _, commit := range commits {
+			fmt.Fprintf(out, "%s  timeline %x  LSN %d-%d  %d pages  %s\n", commit.Time.Format(time.RFC3339Nano), commit.Timeline, commit.StartLSN, commit.EndLSN, commit.Pages, commit.Segment)
+		}
+		return nil
+	}
+
+	if *backup == "" || *target == "" {
+		return errors.New("Both -backup and -target are required")
+	}
+	recoveryTarget := paging.RecoveryTarget{LSN: *untilLSN}
+	if *untilTime != "" {
+		recoveryTarget.Time, err = parseTime(*untilTime)
+		if err != nil {
+			return fmt.Errorf("Invalid time: %v", err)
+		}
+	}
+
+	result, err := paging.RecoverToPoint(*backup, logs, *target, recoveryTarget)
+	if err != nil {
+		return fmt.Errorf("Could not recover: %v", err)
+	}
+	fmt.Fprintf(out, "Replayed %d commits after the backup at LSN %d in timeline %x\n", result.Replayed, result.BaseLSN, result.BaseTimeline)
+	fmt.Fprintf(out, "Recovered to LSN %d, committed at %s, starting timeline %x\n", result.LSN, result.Time.Format(time.RFC3339Nano), result.Timeline)
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+)
+
+/**
+ * Collects what the statements print.
+ */
+type output struct {
+	printed []string
+}
+
+func (o *output) GetInput() (string, error) {
+	return "", nil
+}
+
+func (o *output) Print(data string) {
+	o.printed = append(o.printed, data)
+}
+
+func mustRun(t *testing.T, db *database.Database, statement string) string {
+	t.Helper()
+	o := &output{}
+	code := commands.NewStatementCommand(statement, commands.NewSession()).Execute(db, o)
+	if code != commands.SUCCESS {
+		t.Fatalf("%s: %s", statement, strings.Join(o.printed, "\n"))
+	}
+	return strings.Join(o.printed, "\n")
+}
+
+/**
+ * Creates a database archiving its log, backs it up, and inserts the rows
+ * after the backup, each in a commit of its own, archiving the log after
+ * every two of them. Returns the backup and the archive directory.
+ */
+func archivedDatabase(t *testing.T, rows int) (string, string) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	archive := filepath.Join(dir, "archive")
+	err = db.Pager.SetArchiveDir(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustRun(t, db, "create table t (id int primary key)")
+	backup := filepath.Join(dir, "backup")
+	err = db.Backup(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= rows; i++ {
+		mustRun(t, db, fmt.Sprintf("insert into t values (%d)", i))
+		if i%2 == 0 {
+			err = db.Pager.Checkpoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return backup, archive
+}
+
+/**
+ * Returns the commits of the rows inserted after the backup.
+ */
+func insertCommits(t *testing.T, archive string, rows int) []paging.LoggedCommit {
+	segments, err := paging.ArchivedSegments(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := paging.ListLoggedCommits(segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commits[len(commits)-rows:]
+}
+
+func countRecovered(t *testing.T, filename string) string {
+	t.Helper()
+	db, err := database.NewDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	return mustRun(t, db, "select count(*) from t")
+}
+
+func TestRecover(t *testing.T) {
+	backup, archive := archivedDatabase(t, 6)
+	commits := insertCommits(t, archive, 6)
+
+	tests := []struct {
+		name  string
+		args  []string
+		count string
+	}{
+		{"everything", nil, `[{"count(*)":6}]`},
+		{"by LSN", []string{"-until-lsn", fmt.Sprint(commits[2].EndLSN)}, `[{"count(*)":3}]`},
+		{"by time", []string{"-until-time", commits[3].Time.Format(time.RFC3339Nano)}, `[{"count(*)":4}]`},
+		{"by time before the first commit", []string{"-until-time", commits[0].Time.Add(-time.Nanosecond).Format(time.RFC3339Nano)}, `[{"count(*)":0}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "recovered")
+			var out bytes.Buffer
+			err := run(append([]string{"-backup", backup, "-archive", archive, "-target", target}, test.args...), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), "Recovered to LSN") {
+				t.Errorf("printed %q", out.String())
+			}
+			if count := countRecovered(t, target); count != test.count {
+				t.Errorf("got %s, expected %s", count, test.count)
+			}
+		})
+	}
+}
+
+func TestRecoverWithGap(t *testing.T) {
+	backup, archive := archivedDatabase(t, 6)
+	segments, err := paging.ArchivedSegments(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(segments[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(t.TempDir(), "recovered")
+	err = run([]string{"-backup", backup, "-archive", archive, "-target", target}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "are missing") {
+		t.Fatalf("got %v, expected missing commits", err)
+	}
+	// Up to the gap, the database can be recovered
+	commits := insertCommits(t, archive, 4)
+	err = run([]string{"-backup", backup, "-archive", archive, "-target", target, "-until-lsn", fmt.Sprint(commits[0].StartLSN)}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := countRecovered(t, target); count != `[{"count(*)":0}]` {
+		t.Errorf("got %s", count)
+	}
+}
+
+func TestListCommits(t *testing.T) {
+	_, archive := archivedDatabase(t, 4)
+	var out bytes.Buffer
+	err := run([]string{"-archive", archive, "-list"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The catalog, the table and the rows
+	if lines := strings.Count(out.String(), "\n"); lines != 6 {
+		t.Errorf("listed %d commits, expected 6:\n%s", lines, out.String())
+	}
+}
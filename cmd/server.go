@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
+)
+
+/**
+ * A connected client, which is busy while one of its commands runs.
+ */
+type client struct {
+	connection net.Conn
+	busy       bool
+}
+
+/**
+ * Serves every client of the database in a session of its own. On shutdown,
+ * the server stops accepting clients and disconnects the idle ones, while
+ * the busy ones are disconnected once their command finishes. The database
+ * is flushed once every session has ended, or the timeout has passed.
+ */
+type server struct {
+	listener net.Listener
+	db       *database.Database
+	mu       sync.Mutex
+	clients  map[*client]bool
+	sessions sync.WaitGroup
+	closing  bool
+}
+
+func newServer(listener net.Listener, db *database.Database) *server {
+	s := &server{
+		listener: listener,
+		db:       db,
+		clients:  make(map[*client]bool),
+	}
+
+	return s
+}
+
+/**
+ * Accepts clients until the server is shut down.
+ */
+func (s *server) serve() {
+	for {
+		connection, err := s.listener.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			fmt.Println("Could not accept a client:", err)
+			continue
+		}
+
+		c := &client{connection: connection}
+		if !s.addClient(c) {
+			connection.Close()
+			return
+		}
+		go s.proccessRequests(c, ioprovider.NewSocketIOProvider(connection), s.db.Connect())
+	}
+}
+
+func (s *server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closing
+}
+
+func (s *server) addClient(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.clients[c] = true
+	s.sessions.Add(1)
+	return true
+}
+
+func (s *server) removeClient(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+
+	c.connection.Close()
+	s.sessions.Done()
+}
+
+/**
+ * Marks the client busy before running its command. Fails once the
+ * server is shutting down, so no new command is started.
+ */
+func (s *server) startCommand(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	c.busy = true
+	return true
+}
+
+/**
+ * Marks the client idle again, and reports whether it should be
+ * disconnected since the server is shutting down.
+ */
+func (s *server) endCommand(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.busy = false
+	return s.closing
+}
+
+func (s *server) proccessRequests(c *client, ioProvider ioprovider.IIOProvider, db *database.Database) {
+	session := commands.NewSession()
+	defer s.removeClient(c)
+	defer session.Close(db)
+	for {
+		printPrompt()
+
+		input, err := ioProvider.GetInput()
+
+		if err != nil {
+			if !s.isClosing() {
+				fmt.Printf("An error occurred while reading input! %v\n", err)
+			}
+			return
+		}
+		if !s.startCommand(c) {
+			return
+		}
+
+		var code commands.CommandExecutionStatusCode
+		inputType := getCommandType(input)
+
+		if inputType == commands.NON_STATEMENT_COMMAND {
+			nonStatement := getNonStatementCommand(input)
+			nonStatement.PrintPreExecution()
+			code = nonStatement.Execute(db, ioProvider)
+		} else {
+			statement := getStatementCommand(input, session)
+			statement.PrintPreExecution()
+			code = statement.Execute(db, ioProvider)
+			switch code {
+			case commands.SUCCESS:
+				fmt.Println("Success")
+			case commands.FAILURE:
+				fmt.Println("Failure")
+			case commands.UNRECOGNIZED:
+				fmt.Println("Unrecognized")
+			case commands.NOT_FOUND:
+				fmt.Println("Not found")
+			}
+
+		}
+
+		if s.endCommand(c) || code == commands.EXIT {
+			return
+		}
+	}
+}
+
+/**
+ * Stops accepting clients, waits for the running commands to finish, at
+ * most for the timeout, and flushes the database. The transactions left
+ * unfinished by the clients are rolled back, except for those already
+ * committing, which the database waits for before it is flushed.
+ */
+func (s *server) shutdown(timeout time.Duration) {
+	s.mu.Lock()
+	s.closing = true
+	s.listener.Close()
+	for c := range s.clients {
+		if !c.busy {
+			c.connection.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(ended)
+	}()
+
+	select {
+	case <-ended:
+	case <-time.After(timeout):
+		fmt.Println("Some commands did not finish in time, disconnecting their clients")
+		s.mu.Lock()
+		for c := range s.clients {
+			c.connection.Close()
+		}
+		s.mu.Unlock()
+	}
+
+	s.db.Close()
+}
@@ -0,0 +1,68 @@
+package commands_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+)
+
+func TestBackupWithoutBackupDir(t *testing.T) {
+	db := openDatabase(t)
+	for _, command := range []commands.Command{commands.NewNonStatementBackup("b"), commands.NewNonStatementRestore("b")} {
+		o := &output{}
+		code := command.Execute(db, o)
+		if printed := strings.Join(o.printed, "\n"); code != commands.FAILURE || !strings.Contains(printed, "backups are disabled") {
+			t.Errorf("got %d %s", code, printed)
+		}
+	}
+}
+
+func TestBackupNames(t *testing.T) {
+	db := openDatabase(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+	err := db.SetBackupDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside")
+
+	tests := []struct {
+		name string
+		code commands.CommandExecutionStatusCode
+	}{
+		{"", commands.FAILURE},
+		{".", commands.FAILURE},
+		{"..", commands.FAILURE},
+		{"../b", commands.FAILURE},
+		{"sub/b", commands.FAILURE},
+		{outside, commands.FAILURE},
+		{"b", commands.SUCCESS},
+		{"b.db", commands.SUCCESS},
+	}
+	for _, test := range tests {
+		o := &output{}
+		code := commands.NewNonStatementBackup(test.name).Execute(db, o)
+		if code != test.code {
+			t.Errorf("backup '%s': got %d %s", test.name, code, strings.Join(o.printed, "\n"))
+		}
+		o = &output{}
+		code = commands.NewNonStatementRestore(test.name).Execute(db, o)
+		if code != test.code {
+			t.Errorf("restore '%s': got %d %s", test.name, code, strings.Join(o.printed, "\n"))
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("the backup directory holds %d files, expected 2", len(entries))
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("a backup was written outside of the backup directory")
+	}
+}
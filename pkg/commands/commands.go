@@ -1,8 +1,8 @@
 package commands
 
 import (
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
 	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
-	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
 )
 
 type CommandType int8
@@ -18,9 +18,13 @@ const (
 	SUCCESS CommandExecutionStatusCode = iota
 	FAILURE
 	UNRECOGNIZED
+	// A lookup by primary key found no row with the key
+	NOT_FOUND
+	// The client ended its session
+	EXIT
 )
 
 type Command interface {
-	Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode
+	Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode
 	PrintPreExecution()
 }
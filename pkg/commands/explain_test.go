@@ -0,0 +1,165 @@
+package commands_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
+)
+
+/**
+ * A scan reads every page of the table once, however many rows the pages
+ * hold, and the pages read by other connections meanwhile are not its own.
+ */
+func TestExplainAnalyzeCountsPagesOfTheQuery(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	statements := []string{"create table t (id int primary key, note text)"}
+	for i := 1; i <= 2000; i++ {
+		statements = append(statements, fmt.Sprintf("insert into t values (%d, '%s')", i, strings.Repeat("x", 40)))
+	}
+	for _, statement := range statements {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+	pages := uint64(db.Pager.PageCount())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		other, otherSession := db.Connect(), commands.NewSession()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				run(other, otherSession, "select count(*) from t")
+			}
+		}
+	}()
+
+	code, printed := run(db, session, "explain analyze select * from t")
+	close(done)
+	wg.Wait()
+	if code != commands.SUCCESS {
+		t.Fatal(printed)
+	}
+
+	var plan struct {
+		Operator       string `json:"operator"`
+		ActualRows     int64  `json:"actual_rows"`
+		PagesFromDisk  uint64 `json:"pages_from_disk"`
+		PagesFromCache uint64 `json:"pages_from_cache"`
+		Children       []json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(printed), &plan); err != nil {
+		t.Fatalf("%v: %s", err, printed)
+	}
+	for plan.Operator != "TableScan" && len(plan.Children) == 1 {
+		if err := json.Unmarshal(plan.Children[0], &plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if plan.Operator != "TableScan" || plan.ActualRows != 2000 {
+		t.Fatalf("no scan of the table in %s", printed)
+	}
+	if read := plan.PagesFromDisk + plan.PagesFromCache; read == 0 || read > pages {
+		t.Fatalf("the scan read %d pages, the database has %d", read, pages)
+	}
+}
+
+/**
+ * Returns the operator at the bottom of the plan, which reads the table,
+ * and the index it reads, if any.
+ */
+func accessPath(t *testing.T, printed string) (string, string) {
+	t.Helper()
+	var plan executor.PlanNode
+	if err := json.Unmarshal([]byte(printed), &plan); err != nil {
+		t.Fatalf("%v: %s", err, printed)
+	}
+	node := &plan
+	for len(node.Children) == 1 {
+		node = node.Children[0]
+	}
+	if len(node.Children) > 0 {
+		t.Fatalf("the plan reads more than one table: %s", printed)
+	}
+	return node.Operator, node.Details["index"]
+}
+
+/**
+ * Once the table is analyzed, a condition matching few rows is looked up in
+ * the index, and one matching most of them is checked while scanning the
+ * table, which reads every page once instead of looking each row up.
+ */
+func TestAccessPathByStatistics(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	statements := []string{
+		"create table t (id int primary key, category int, flag int)",
+		"create index t_category on t (category)",
+		"create index t_flag on t (flag)",
+	}
+	for i := 0; i < 2000; i += 100 {
+		values := make([]string, 0, 100)
+		for j := i; j < i+100; j++ {
+			values = append(values, fmt.Sprintf("(%d, %d, %d)", j, j%500, j%2))
+		}
+		statements = append(statements, "insert into t values "+strings.Join(values, ", "))
+	}
+	for _, statement := range statements {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+
+	// Without statistics, a third of the rows is assumed to be in a range
+	explain := func(condition string) (string, string) {
+		statement := "explain select * from t where " + condition
+		code, printed := run(db, session, statement)
+		if code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+		return accessPath(t, printed)
+	}
+	if operator, index := explain("category < 5"); operator != "TableScan" {
+		t.Errorf("before analyze, category < 5: read by %s %q, expected a scan of the table", operator, index)
+	}
+	if code, printed := run(db, session, "analyze t"); code != commands.SUCCESS {
+		t.Fatal(printed)
+	}
+
+	tests := []struct {
+		condition string
+		operator  string
+		index     string
+	}{
+		{"category = 7", "IndexScan", "t_category"},
+		{"category between 10 and 12", "IndexScan", "t_category"},
+		{"category < 5", "IndexScan", "t_category"},
+		{"category > 5", "TableScan", ""},
+		{"flag = 1", "TableScan", ""},
+		{"flag = 1 and category = 7", "IndexScan", "t_category"},
+		{"flag = 1 or category = 7", "TableScan", ""},
+		{"id between 100 and 110", "RangeScan", executor.PRIMARY_KEY_INDEX},
+		{"id between 100 and 110 and category = 7", "RangeScan", executor.PRIMARY_KEY_INDEX},
+		{"id between 100 and 1900 and category = 7", "IndexScan", "t_category"},
+		{"id > 10 and category < 5", "IndexScan", "t_category"},
+	}
+	for _, test := range tests {
+		operator, index := explain(test.condition)
+		if operator != test.operator || index != test.index {
+			t.Errorf("%s: read by %s %q, expected %s %q", test.condition, operator, index, test.operator, test.index)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package commands_test
+
+import (
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+)
+
+/**
+ * Runs the joins first without an index on the joined column of orders,
+ * which makes them hash joins, and then with one, which makes them index
+ * nested-loop joins. Both must return the same rows.
+ */
+func TestJoins(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+	setup := []string{
+		"create table users (id int primary key, name text)",
+		"create table orders (id int primary key, user_id int, total int)",
+		"insert into users values (1, 'ann')",
+		"insert into users values (2, 'bob')",
+		"insert into users values (3, 'cid')",
+		"insert into orders values (10, 1, 5)",
+		"insert into orders values (11, 1, 7)",
+		"insert into orders values (12, 2, 3)",
+		"insert into orders values (13, null, 9)",
+		"insert into orders values (14, null, 1)",
+		"insert into orders values (15, 4, 2)",
+	}
+	for _, statement := range setup {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		statement string
+		expected  string
+	}{
+		{
+			"inner",
+			"select u.name, o.total from users u join orders o on u.id = o.user_id order by o.id",
+			`[{"name":"ann","total":5},{"name":"ann","total":7},{"name":"bob","total":3}]`,
+		},
+		{
+			"inner with the tables swapped",
+			"select o.id, u.name from orders o inner join users u on o.user_id = u.id order by o.id",
+			`[{"id":10,"name":"ann"},{"id":11,"name":"ann"},{"id":12,"name":"bob"}]`,
+		},
+		{
+			"left",
+			"select u.name, o.id from users u left join orders o on u.id = o.user_id order by u.id, o.id",
+			`[{"name":"ann","id":10},{"name":"ann","id":11},{"name":"bob","id":12},{"name":"cid","id":null}]`,
+		},
+		{
+			"left keeping the rows with NULL keys",
+			"select o.id, u.name from orders o left join users u on o.user_id = u.id order by o.id",
+			`[{"id":10,"name":"ann"},{"id":11,"name":"ann"},{"id":12,"name":"bob"},{"id":13,"name":null},{"id":14,"name":null},{"id":15,"name":null}]`,
+		},
+		{
+			"left with a condition on the inner table",
+			"select u.name, o.id from users u left join orders o on u.id = o.user_id and o.total > 5 order by u.id",
+			`[{"name":"ann","id":11},{"name":"bob","id":null},{"name":"cid","id":null}]`,
+		},
+		{
+			"cross",
+			"select count(*) from users cross join orders",
+			`[{"count(*)":18}]`,
+		},
+		{
+			"comma",
+			"select u.id, o.id from users u, orders o where o.total = u.id order by u.id",
+			`[{"u.id":1,"o.id":14},{"u.id":2,"o.id":15},{"u.id":3,"o.id":12}]`,
+		},
+		{
+			"NULL keys never match",
+			"select a.id, b.id from orders a join orders b on a.user_id = b.user_id where a.id <> b.id order by a.id",
+			`[{"a.id":10,"b.id":11},{"a.id":11,"b.id":10}]`,
+		},
+		{
+			"star",
+			"select * from users u join orders o on u.id = o.user_id where o.id = 12",
+			`[{"u.id":2,"name":"bob","o.id":12,"user_id":2,"total":3}]`,
+		},
+		{
+			"star of one table",
+			"select o.*, u.name from users u join orders o on u.id = o.user_id where o.id = 12",
+			`[{"id":12,"user_id":2,"total":3,"name":"bob"}]`,
+		},
+		{
+			"a repeated column and an alias",
+			"select u.id, u.id, o.id as id from users u join orders o on u.id = o.user_id where o.id = 12",
+			`[{"u.id":2,"u.id_2":2,"id":12}]`,
+		},
+	}
+
+	for _, index := range []string{"", "create index orders_user_id on orders (user_id)"} {
+		if index != "" {
+			if code, printed := run(db, session, index); code != commands.SUCCESS {
+				t.Fatalf("%s: %s", index, printed)
+			}
+		}
+		for _, test := range tests {
+			code, printed := run(db, session, test.statement)
+			if code != commands.SUCCESS || printed != test.expected {
+				t.Errorf("%s, index %v: got %d %s, expected %s", test.name, index != "", code, printed, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package commands_test
+
+import (
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+)
+
+func TestLookupByPrimaryKey(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	setup := []string{
+		"create table t (id int primary key, name text)",
+		"insert into t values (1, 'a')",
+		"insert into t values (2, 'b')",
+		"prepare p as select * from t where id = $1",
+	}
+	for _, statement := range setup {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+
+	tests := []struct {
+		statement string
+		code      commands.CommandExecutionStatusCode
+		printed   string
+	}{
+		{"select * from t where id = 1", commands.SUCCESS, `[{"id":1,"name":"a"}]`},
+		{"select * from t where id = 3", commands.NOT_FOUND, `{"error":"not found","key":"3"}`},
+		{"select * from t where id = 1 and name = 'b'", commands.SUCCESS, `[]`},
+		{"select * from t where id = 2 limit 0", commands.SUCCESS, `[]`},
+		{"select count(*) from t where id = 3", commands.SUCCESS, `[{"count(*)":0}]`},
+		{"select * from t where id > 2", commands.SUCCESS, `[]`},
+		{"execute p(2)", commands.SUCCESS, `[{"id":2,"name":"b"}]`},
+		{"execute p(7)", commands.NOT_FOUND, `{"error":"not found","key":"7"}`},
+	}
+	for _, test := range tests {
+		code, printed := run(db, session, test.statement)
+		if code != test.code || printed != test.printed {
+			t.Errorf("%s: got %d %s, expected %d %s", test.statement, code, printed, test.code, test.printed)
+		}
+	}
+}
+
+func TestLookupNotFoundInTransaction(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	statements := []struct {
+		statement string
+		code      commands.CommandExecutionStatusCode
+	}{
+		{"create table t (id int primary key)", commands.SUCCESS},
+		{"begin", commands.SUCCESS},
+		{"insert into t values (1)", commands.SUCCESS},
+		{"select * from t where id = 2", commands.NOT_FOUND},
+		{"commit", commands.SUCCESS},
+		{"select * from t where id = 1", commands.SUCCESS},
+	}
+	for _, test := range statements {
+		if code, printed := run(db, session, test.statement); code != test.code {
+			t.Fatalf("%s: got %d %s, expected %d", test.statement, code, printed, test.code)
+		}
+	}
+}
+
+/**
+ * -0.0 equals 0.0, so an index finds either one by the other, and a unique
+ * index does not hold both.
+ */
+func TestIndexedNegativeZero(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	setup := []string{
+		"create table t (id int primary key, f float)",
+		"create index t_f on t (f)",
+		"create table u (id int primary key, f float)",
+		"create unique index u_f on u (f)",
+		"insert into t values (1, -0.0)",
+		"insert into t values (2, 0.0)",
+		"insert into t values (3, -1.5)",
+		"insert into t values (4, 1.5)",
+		"insert into u values (1, -0.0)",
+	}
+	for _, statement := range setup {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+
+	tests := []struct {
+		statement string
+		code      commands.CommandExecutionStatusCode
+		printed   string
+	}{
+		{"select id from t where f = 0", commands.SUCCESS, `[{"id":1},{"id":2}]`},
+		{"select id from t where f = -0.0", commands.SUCCESS, `[{"id":1},{"id":2}]`},
+		{"select id from t where f >= 0", commands.SUCCESS, `[{"id":1},{"id":2},{"id":4}]`},
+		{"select id from t where f < 0", commands.SUCCESS, `[{"id":3}]`},
+		{"select id from t where f <= -0.0", commands.SUCCESS, `[{"id":1},{"id":2},{"id":3}]`},
+		{"select id from t where f between -0.0 and 0", commands.SUCCESS, `[{"id":1},{"id":2}]`},
+		{"select id from u where f = 0", commands.SUCCESS, `[{"id":1}]`},
+		{"insert into u values (2, 0.0)", commands.FAILURE, `{"error":"duplicate value of (f) in unique index u_f"}`},
+	}
+	for _, test := range tests {
+		code, printed := run(db, session, test.statement)
+		if code != test.code || printed != test.printed {
+			t.Errorf("%s: got %d %s, expected %d %s", test.statement, code, printed, test.code, test.printed)
+		}
+	}
+}
@@ -2,10 +2,9 @@ package commands
 
 import (
 	"fmt"
-	"os"
 
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
 	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
-	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
 )
 
 type NonStatementCommandType int8
@@ -13,6 +12,10 @@ type NonStatementCommandType int8
 const (
 	NS_EXIT NonStatementCommandType = iota
 	NS_PRINT
+	NS_TABLES
+	NS_STATS
+	NS_BACKUP
+	NS_RESTORE
 	NS_UNRECOGNIZED
 )
 
@@ -25,10 +28,12 @@ type NonStatementExit struct {
 	NonStatementBase
 }
 
-func (ns *NonStatementExit) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
-	ns.code = SUCCESS
-	t.DestroyTable()
-	os.Exit(0)
+/**
+ * Ends the session of the client. The database is flushed when
+ * the server shuts down.
+ */
+func (ns *NonStatementExit) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	ns.code = EXIT
 	return ns.code
 }
 
@@ -51,8 +56,8 @@ type NonStatementPrint struct {
 	NonStatementBase
 }
 
-func (ns *NonStatementPrint) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
-	t.PrintInternalStructure()
+func (ns *NonStatementPrint) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	db.PrintInternalStructure()
 	ns.code = SUCCESS
 	return ns.code
 }
@@ -71,11 +76,143 @@ func NewNonStatementPrint() *NonStatementPrint {
 	return nonStatement
 }
 
+type NonStatementTables struct {
+	NonStatementBase
+}
+
+func (ns *NonStatementTables) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	printJSON(ip, db.TableNames())
+	ns.code = SUCCESS
+	return ns.code
+}
+
+func (ns *NonStatementTables) PrintPreExecution() {
+	fmt.Println("Listing tables")
+}
+
+func NewNonStatementTables() *NonStatementTables {
+	nonStatement := &NonStatementTables{
+		NonStatementBase: NonStatementBase{
+			nonStatementType: NS_TABLES,
+		},
+	}
+
+	return nonStatement
+}
+
+type NonStatementStats struct {
+	NonStatementBase
+}
+
+/**
+ * Reports the commits made durable so far: how long they waited
+ * for the log, and how many were synced together.
+ */
+func (ns *NonStatementStats) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	printJSON(ip, newCommitStatsDTO(db.Pager.CommitStats()))
+	ns.code = SUCCESS
+	return ns.code
+}
+
+func (ns *NonStatementStats) PrintPreExecution() {
+	fmt.Println("Showing commit statistics")
+}
+
+func NewNonStatementStats() *NonStatementStats {
+	nonStatement := &NonStatementStats{
+		NonStatementBase: NonStatementBase{
+			nonStatementType: NS_STATS,
+		},
+	}
+
+	return nonStatement
+}
+
+type NonStatementBackup struct {
+	NonStatementBase
+	name string
+}
+
+/**
+ * Backs up the database into the file with the name, in the backup
+ * directory of the server.
+ */
+func (ns *NonStatementBackup) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	path, err := db.BackupPath(ns.name)
+	if err == nil {
+		err = db.Backup(path)
+	}
+	if err != nil {
+		printError(ip, fmt.Errorf("could not back up the database: %v", err))
+		ns.code = FAILURE
+		return ns.code
+	}
+
+	printJSON(ip, &BackupDTO{Backup: ns.name})
+	ns.code = SUCCESS
+	return ns.code
+}
+
+func (ns *NonStatementBackup) PrintPreExecution() {
+	fmt.Println("Backing up the database to", ns.name)
+}
+
+func NewNonStatementBackup(name string) *NonStatementBackup {
+	nonStatement := &NonStatementBackup{
+		NonStatementBase: NonStatementBase{
+			nonStatementType: NS_BACKUP,
+		},
+		name: name,
+	}
+
+	return nonStatement
+}
+
+type NonStatementRestore struct {
+	NonStatementBase
+	name string
+}
+
+/**
+ * Restores the database from the backup with the name, in the backup
+ * directory of the server.
+ */
+func (ns *NonStatementRestore) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	path, err := db.BackupPath(ns.name)
+	if err == nil {
+		err = db.Restore(path)
+	}
+	if err != nil {
+		printError(ip, fmt.Errorf("could not restore the database: %v", err))
+		ns.code = FAILURE
+		return ns.code
+	}
+
+	printJSON(ip, &RestoreDTO{Restored: ns.name})
+	ns.code = SUCCESS
+	return ns.code
+}
+
+func (ns *NonStatementRestore) PrintPreExecution() {
+	fmt.Println("Restoring the database from", ns.name)
+}
+
+func NewNonStatementRestore(name string) *NonStatementRestore {
+	nonStatement := &NonStatementRestore{
+		NonStatementBase: NonStatementBase{
+			nonStatementType: NS_RESTORE,
+		},
+		name: name,
+	}
+
+	return nonStatement
+}
+
 type NonStatementUnrecognized struct {
 	NonStatementBase
 }
 
-func (ns *NonStatementUnrecognized) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+func (ns *NonStatementUnrecognized) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
 	ns.code = UNRECOGNIZED
 	return ns.code
 }
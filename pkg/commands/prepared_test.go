@@ -0,0 +1,84 @@
+package commands_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+)
+
+type output struct {
+	printed []string
+}
+
+func (o *output) GetInput() (string, error) {
+	return "", nil
+}
+
+func (o *output) Print(data string) {
+	o.printed = append(o.printed, data)
+}
+
+/**
+ * Runs the statement in the session and returns its status code and what it printed.
+ */
+func run(db *database.Database, session *commands.Session, statement string) (commands.CommandExecutionStatusCode, string) {
+	o := &output{}
+	code := commands.NewStatementCommand(statement, session).Execute(db, o)
+	return code, strings.Join(o.printed, "\n")
+}
+
+func openDatabase(t *testing.T) *database.Database {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestPreparedLimitAndOffset(t *testing.T) {
+	db := openDatabase(t)
+	session := commands.NewSession()
+
+	setup := []string{
+		"create table t (id int primary key, n int)",
+		"prepare p as select id from t order by id limit $1 offset $2",
+	}
+	for i := 1; i <= 5; i++ {
+		setup = append(setup, fmt.Sprintf("insert into t values (%d, %d)", i, i))
+	}
+	for _, statement := range setup {
+		if code, printed := run(db, session, statement); code != commands.SUCCESS {
+			t.Fatalf("%s: %s", statement, printed)
+		}
+	}
+
+	tests := []struct {
+		execute  string
+		code     commands.CommandExecutionStatusCode
+		expected string
+	}{
+		{"execute p(2, 0)", commands.SUCCESS, `[{"id":1},{"id":2}]`},
+		// The plan is reused, with the new values bound
+		{"execute p(3, 1)", commands.SUCCESS, `[{"id":2},{"id":3},{"id":4}]`},
+		{"execute p(0, 0)", commands.SUCCESS, `[]`},
+		{"execute p(10, 4)", commands.SUCCESS, `[{"id":5}]`},
+		{"execute p(-1, 0)", commands.FAILURE, "LIMIT must be a non-negative integer, got -1"},
+		{"execute p(1, -2)", commands.FAILURE, "OFFSET must be a non-negative integer, got -2"},
+	}
+
+	for _, test := range tests {
+		code, printed := run(db, session, test.execute)
+		matches := printed == test.expected
+		if test.code == commands.FAILURE {
+			matches = strings.Contains(printed, test.expected)
+		}
+		if code != test.code || !matches {
+			t.Errorf("%s: code %v, got %s, expected %s", test.execute, code, printed, test.expected)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+const ERROR_NOT_FOUND string = "not found"
+
+type ErrorResponseDTO struct {
+	Error  string `json:"error"`
+	Key    string `json:"key,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+type RowsAffectedDTO struct {
+	RowsAffected int `json:"rows_affected"`
+}
+
+type AnalyzedTableDTO struct {
+	Table       string `json:"table"`
+	Rows        int64  `json:"rows"`
+	SampledRows int    `json:"sampled_rows"`
+}
+
+type BackupDTO struct {
+	Backup string `json:"backup"`
+}
+
+type RestoreDTO struct {
+	Restored string `json:"restored"`
+}
+
+type HistogramBucketDTO struct {
+	// The inclusive upper bound of the bucket, absent for the last one
+	UpTo  *uint64 `json:"up_to,omitempty"`
+	Count uint64  `json:"count"`
+}
+
+type HistogramDTO struct {
+	Total   uint64               `json:"total"`
+	Sum     uint64               `json:"sum"`
+	Buckets []HistogramBucketDTO `json:"buckets"`
+}
+
+type CommitStatsDTO struct {
+	Commits       uint64       `json:"commits"`
+	Syncs         uint64       `json:"syncs"`
+	LatencyMicros HistogramDTO `json:"latency_us"`
+	BatchSize     HistogramDTO `json:"batch_size"`
+}
+
+func newHistogramDTO(histogram paging.Histogram) HistogramDTO {
+	dto := HistogramDTO{
+		Total:   histogram.Total,
+		Sum:     histogram.Sum,
+		Buckets: make([]HistogramBucketDTO, len(histogram.Counts)),
+	}
+	for i, count := range histogram.Counts {
+		dto.Buckets[i].Count = count
+		if i < len(histogram.Bounds) {
+			dto.Buckets[i].UpTo = &histogram.Bounds[i]
+		}
+	}
+	return dto
+}
+
+func newCommitStatsDTO(stats paging.CommitStats) *CommitStatsDTO {
+	return &CommitStatsDTO{
+		Commits:       stats.Commits,
+		Syncs:         stats.Syncs,
+		LatencyMicros: newHistogramDTO(stats.Latency),
+		BatchSize:     newHistogramDTO(stats.BatchSize),
+	}
+}
+
+/**
+ * Sends the error to the client; syntax errors also carry their position.
+ */
+func printError(ip ioprovider.IIOProvider, err error) {
+	response := &ErrorResponseDTO{
+		Error: err.Error(),
+	}
+
+	var syntaxError *sql.SyntaxError
+	if errors.As(err, &syntaxError) {
+		response.Line = syntaxError.Line
+		response.Column = syntaxError.Column
+	}
+
+	printJSON(ip, response)
+}
+
+func printNotFound(ip ioprovider.IIOProvider, key row.Value) {
+	printJSON(ip, &ErrorResponseDTO{Error: ERROR_NOT_FOUND, Key: key.ToString()})
+}
+
+func printRowsAffected(ip ioprovider.IIOProvider, rowsAffected int) {
+	printJSON(ip, &RowsAffectedDTO{RowsAffected: rowsAffected})
+}
+
+/**
+ * Sends the value to the client as JSON. HTML characters are not escaped,
+ * since responses are never embedded in HTML.
+ */
+func printJSON(ip ioprovider.IIOProvider, value any) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	ip.Print(string(bytes.TrimRight(b.Bytes(), "\n")))
+}
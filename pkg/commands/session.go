@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/planner"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * The state of a client connection: the statements it prepared
+ * and whether it is in a transaction.
+ */
+type Session struct {
+	prepared      map[string]*PreparedStatement
+	inTransaction bool
+	aborted       bool
+}
+
+func NewSession() *Session {
+	session := &Session{
+		prepared: make(map[string]*PreparedStatement),
+	}
+
+	return session
+}
+
+/**
+ * Ends the session, rolling back the transaction left unfinished by the client.
+ */
+func (s *Session) Close(db *database.Database) {
+	if s.inTransaction {
+		s.inTransaction = false
+		s.aborted = false
+		db.Rollback()
+	}
+}
+
+/**
+ * A statement parsed once and executed with different values of its parameters.
+ * The plan of a select is kept until the schema version of the database changes.
+ */
+type PreparedStatement struct {
+	Name          string
+	Statement     sql.Statement
+	Types         []row.ColumnType
+	plan          *planner.Plan
+	schemaVersion uint64
+}
+
+func NewPreparedStatement(name string, statement sql.Statement, types []row.ColumnType) *PreparedStatement {
+	prepared := &PreparedStatement{
+		Name:      name,
+		Statement: statement,
+		Types:     types,
+	}
+
+	return prepared
+}
+
+/**
+ * Evaluates the arguments of an execution and binds them to the parameters,
+ * converted to the types of the parameters.
+ */
+func (ps *PreparedStatement) bind(args []sql.Expr) error {
+	if len(args) != len(ps.Types) {
+		return fmt.Errorf("prepared statement %s expects %d parameters, got %d", ps.Name, len(ps.Types), len(args))
+	}
+
+	values := make([]row.Value, len(args))
+	for i, arg := range args {
+		value, err := eval.EvaluateConstant(arg)
+		if err != nil {
+			return err
+		}
+
+		if ps.Types[i] != row.TYPE_NULL {
+			value, err = row.CoerceValue(value, ps.Types[i])
+			if err != nil {
+				return fmt.Errorf("parameter $%d: %v", i+1, err)
+			}
+		}
+		values[i] = value
+	}
+
+	sql.BindParameters(ps.Statement, values)
+	return nil
+}
+
+/**
+ * Returns the plan of the prepared select, planning it again
+ * if the schema changed since it was planned.
+ */
+func (ps *PreparedStatement) selectPlan(db *database.Database, statement *sql.SelectStatement) (*planner.Plan, error) {
+	if ps.plan != nil && ps.schemaVersion == db.SchemaVersion() {
+		return ps.plan, nil
+	}
+
+	plan, err := planner.PlanSelect(db, statement, planner.Options{})
+	if err != nil {
+		return nil, err
+	}
+	ps.plan = plan
+	ps.schemaVersion = db.SchemaVersion()
+
+	return plan, nil
+}
@@ -1,16 +1,16 @@
 package commands
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
 	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/planner"
 	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
-	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/statistics"
 	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
 )
 
@@ -19,42 +19,162 @@ type StatementCommandType int8
 const (
 	STATEMENT_INSERT StatementCommandType = iota
 	STATEMENT_SELECT
-	STATEMENT_SELECT_ONE
+	STATEMENT_UPDATE
+	STATEMENT_DELETE
+	STATEMENT_CREATE_TABLE
+	STATEMENT_DROP_TABLE
+	STATEMENT_CREATE_INDEX
+	STATEMENT_DROP_INDEX
+	STATEMENT_EXPLAIN
+	STATEMENT_ANALYZE
+	STATEMENT_PREPARE
+	STATEMENT_EXECUTE
+	STATEMENT_DEALLOCATE
+	STATEMENT_BEGIN
+	STATEMENT_COMMIT
+	STATEMENT_ROLLBACK
+	STATEMENT_SAVEPOINT
+	STATEMENT_RELEASE
+	STATEMENT_TRANSACTIONAL
+	STATEMENT_INVALID
 	STATEMENT_UNRECOGNIZED
 )
 
+/**
+ * Parses the input and returns the command executing the parsed statement
+ * in the session of the client. Apart from the transaction control
+ * statements, every statement runs within the transaction of the session.
+ */
+func NewStatementCommand(input string, session *Session) Command {
+	statement, err := sql.Parse(input)
+	if err != nil {
+		return NewStatementInvalid(err)
+	}
+
+	switch s := statement.(type) {
+	case *sql.BeginStatement:
+		return NewStatementBegin(session)
+	case *sql.CommitStatement:
+		return NewStatementCommit(session)
+	case *sql.RollbackStatement:
+		return NewStatementRollback(s, session)
+	case *sql.SavepointStatement:
+		return NewStatementSavepoint(s, session)
+	case *sql.ReleaseStatement:
+		return NewStatementRelease(s, session)
+	}
+
+	command := newStatementCommand(statement, input, session)
+	if _, unrecognized := command.(*StatementUnrecognized); unrecognized {
+		return command
+	}
+	return NewStatementTransactional(statement, command, session)
+}
+
+func newStatementCommand(statement sql.Statement, input string, session *Session) Command {
+	switch s := statement.(type) {
+	case *sql.SelectStatement:
+		return NewStatementSelect(s)
+	case *sql.InsertStatement:
+		return NewStatementInsert(s)
+	case *sql.UpdateStatement:
+		return NewStatementUpdate(s)
+	case *sql.DeleteStatement:
+		return NewStatementDelete(s)
+	case *sql.CreateTableStatement:
+		return NewStatementCreateTable(s)
+	case *sql.DropTableStatement:
+		return NewStatementDropTable(s)
+	case *sql.CreateIndexStatement:
+		return NewStatementCreateIndex(s)
+	case *sql.DropIndexStatement:
+		return NewStatementDropIndex(s)
+	case *sql.ExplainStatement:
+		return NewStatementExplain(s)
+	case *sql.AnalyzeStatement:
+		return NewStatementAnalyze(s)
+	case *sql.PrepareStatement:
+		return NewStatementPrepare(s, session)
+	case *sql.ExecuteStatement:
+		return NewStatementExecute(s, session)
+	case *sql.DeallocateStatement:
+		return NewStatementDeallocate(s, session)
+	default:
+		return NewStatementUnrecognized(input)
+	}
+}
+
+/**
+ * Collects the rows matched by the where clause.
+ */
+func selectRows(db *database.Database, t *table.Table, where sql.Expr) ([]*row.Row, error) {
+	plan, err := planner.PlanRows(db, t, where)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := executor.Collect(plan.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*row.Row, len(values))
+	for i, rowValues := range values {
+		rows[i] = row.NewRow(rowValues)
+	}
+
+	return rows, nil
+}
+
 type StatementSelect struct {
 	code          CommandExecutionStatusCode
 	statementType StatementCommandType
+	statement     *sql.SelectStatement
 }
 
-func (s *StatementSelect) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
-	s.code = SUCCESS
+func (s *StatementSelect) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	plan, err := planner.PlanSelect(db, s.statement, planner.Options{})
+	if err != nil {
+		return s.fail(ip, err)
+	}
 
-	values := t.Select()
-	if len(values) <= 0 {
-		return s.code
+	s.code, err = printPlanRows(ip, plan)
+	if err != nil {
+		return s.fail(ip, err)
 	}
 
-	rows := make([]*row.RowDTO, 0)
+	return s.code
+}
 
-	b := bytes.NewBuffer(values)
-	for {
-		r := &row.Row{}
-		err := serialization.Deserialize(b, r)
-		if err != nil {
-			break
-		}
-		rows = append(rows, r.ToRowDTO())
-		// forPrinting := r.ToString()
-		// ip.Print(forPrinting)
+/**
+ * Runs the plan and sends the rows it produces to the client. A lookup by
+ * primary key finding no row is answered with a not found error carrying
+ * the key instead of an empty list.
+ */
+func printPlanRows(ip ioprovider.IIOProvider, plan *planner.Plan) (CommandExecutionStatusCode, error) {
+	rowDTOs := make([]*row.RowDTO, 0)
+	err := executor.Run(plan.Root, func(values []row.Value) bool {
+		rowDTOs = append(rowDTOs, row.NewRowDTO(plan.Columns, values))
+		return true
+	})
+	if err != nil {
+		return FAILURE, err
 	}
 
-	jsonBytes, _ := json.Marshal(rows)
-	ip.Print(string(jsonBytes))
+	if len(rowDTOs) == 0 && plan.Lookup != nil {
+		if key := plan.Lookup.SoughtKey(); key.Type == row.TYPE_INT {
+			printNotFound(ip, key)
+			return NOT_FOUND, nil
+		}
+	}
 
-	// ip.Print("end")
+	printJSON(ip, rowDTOs)
+	return SUCCESS, nil
+}
 
+func (s *StatementSelect) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
 	return s.code
 }
 
@@ -62,109 +182,706 @@ func (s *StatementSelect) PrintPreExecution() {
 	fmt.Println("Executing select statement")
 }
 
-func NewStatementSelect(input string) *StatementSelect {
-	statement := &StatementSelect{
+func NewStatementSelect(statement *sql.SelectStatement) *StatementSelect {
+	return &StatementSelect{
 		statementType: STATEMENT_SELECT,
+		statement:     statement,
 	}
+}
 
-	return statement
+type StatementInsert struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.InsertStatement
 }
 
-type StatementSelectOne struct {
+func (s *StatementInsert) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	t, err := db.GetTable(s.statement.Table)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	columnIndexes, err := s.columnIndexes(t.Schema)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	rows := make([]*row.Row, 0, len(s.statement.Rows))
+	for _, exprs := range s.statement.Rows {
+		if len(exprs) != len(columnIndexes) {
+			return s.fail(ip, fmt.Errorf("expected %d values, got %d", len(columnIndexes), len(exprs)))
+		}
+
+		values := make([]row.Value, len(t.Schema.Columns))
+		for i := range values {
+			values[i] = row.NewNullValue()
+		}
+
+		for i, expr := range exprs {
+			column := t.Schema.Columns[columnIndexes[i]]
+			value, err := eval.EvaluateConstant(expr)
+			if err != nil {
+				return s.fail(ip, err)
+			}
+
+			values[columnIndexes[i]], err = row.CoerceValue(value, column.Type)
+			if err != nil {
+				return s.fail(ip, fmt.Errorf("column %s: %v", column.Name, err))
+			}
+		}
+
+		r := row.NewRow(values)
+		err = t.Schema.Validate(r)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+		rows = append(rows, r)
+	}
+
+	for _, r := range rows {
+		err = t.Insert(r)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+
+	printRowsAffected(ip, len(rows))
+	s.code = SUCCESS
+	return s.code
+}
+
+/**
+ * Maps the position of every inserted value to the index of its column.
+ */
+func (s *StatementInsert) columnIndexes(schema *row.Schema) ([]int, error) {
+	indexes := make([]int, 0, len(schema.Columns))
+	if s.statement.Columns == nil {
+		for i := range schema.Columns {
+			indexes = append(indexes, i)
+		}
+		return indexes, nil
+	}
+
+	seen := make(map[int]bool)
+	for _, name := range s.statement.Columns {
+		ind, ok := schema.ColumnIndex(name)
+		if !ok {
+			return nil, fmt.Errorf("column %s does not exist", name)
+		}
+		if seen[ind] {
+			return nil, fmt.Errorf("column %s specified more than once", name)
+		}
+		seen[ind] = true
+		indexes = append(indexes, ind)
+	}
+
+	return indexes, nil
+}
+
+func (s *StatementInsert) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementInsert) PrintPreExecution() {
+	fmt.Println("Executing insert statement")
+}
+
+func NewStatementInsert(statement *sql.InsertStatement) *StatementInsert {
+	return &StatementInsert{
+		statementType: STATEMENT_INSERT,
+		statement:     statement,
+	}
+}
+
+type StatementUpdate struct {
 	code          CommandExecutionStatusCode
 	statementType StatementCommandType
-	key           string
+	statement     *sql.UpdateStatement
 }
 
-func (s *StatementSelectOne) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+func (s *StatementUpdate) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	t, err := db.GetTable(s.statement.Table)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	scope := eval.NewTableScope(t.Name, t.Schema)
+	columnIndexes := make([]int, len(s.statement.Assignments))
+	evaluators := make([]eval.Evaluator, len(s.statement.Assignments))
+	for i, assignment := range s.statement.Assignments {
+		ind, ok := t.Schema.ColumnIndex(assignment.Column)
+		if !ok {
+			return s.fail(ip, fmt.Errorf("column %s does not exist", assignment.Column))
+		}
+
+		evaluators[i], err = eval.Compile(assignment.Value, scope)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+		columnIndexes[i] = ind
+	}
+
+	rows, err := selectRows(db, t, s.statement.Where)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	for _, r := range rows {
+		key := r.Values[t.Schema.PrimaryKeyIndex].Int
+
+		// every assignment sees the values the row had before the update
+		newValues := make([]row.Value, len(r.Values))
+		copy(newValues, r.Values)
+		for i, ind := range columnIndexes {
+			column := t.Schema.Columns[ind]
+			value, err := evaluators[i](r.Values)
+			if err != nil {
+				return s.fail(ip, err)
+			}
+
+			newValues[ind], err = row.CoerceValue(value, column.Type)
+			if err != nil {
+				return s.fail(ip, fmt.Errorf("column %s: %v", column.Name, err))
+			}
+		}
+
+		err = t.Update(key, row.NewRow(newValues))
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+
+	printRowsAffected(ip, len(rows))
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementUpdate) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementUpdate) PrintPreExecution() {
+	fmt.Println("Executing update statement")
+}
+
+func NewStatementUpdate(statement *sql.UpdateStatement) *StatementUpdate {
+	return &StatementUpdate{
+		statementType: STATEMENT_UPDATE,
+		statement:     statement,
+	}
+}
+
+type StatementDelete struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.DeleteStatement
+}
+
+func (s *StatementDelete) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	t, err := db.GetTable(s.statement.Table)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	rows, err := selectRows(db, t, s.statement.Where)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	for _, r := range rows {
+		_, err = t.Delete(r.Values[t.Schema.PrimaryKeyIndex].Int)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+
+	printRowsAffected(ip, len(rows))
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementDelete) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementDelete) PrintPreExecution() {
+	fmt.Println("Executing delete statement")
+}
+
+func NewStatementDelete(statement *sql.DeleteStatement) *StatementDelete {
+	return &StatementDelete{
+		statementType: STATEMENT_DELETE,
+		statement:     statement,
+	}
+}
+
+type StatementCreateTable struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.CreateTableStatement
+}
+
+func (s *StatementCreateTable) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.statement.IfNotExists {
+		if _, err := db.GetTable(s.statement.Name); err == nil {
+			s.code = SUCCESS
+			return s.code
+		}
+	}
+
+	schema, err := row.NewSchema(s.statement.Columns)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	_, err = db.CreateTable(s.statement.Name, schema)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
 	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementCreateTable) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementCreateTable) PrintPreExecution() {
+	fmt.Println("Executing create table statement")
+}
+
+func NewStatementCreateTable(statement *sql.CreateTableStatement) *StatementCreateTable {
+	return &StatementCreateTable{
+		statementType: STATEMENT_CREATE_TABLE,
+		statement:     statement,
+	}
+}
 
-	id, err := strconv.Atoi(s.key)
+type StatementDropTable struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.DropTableStatement
+}
+
+func (s *StatementDropTable) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.statement.IfExists {
+		if _, err := db.GetTable(s.statement.Name); err != nil {
+			s.code = SUCCESS
+			return s.code
+		}
+	}
+
+	err := db.DropTable(s.statement.Name)
 	if err != nil {
+		printError(ip, err)
 		s.code = FAILURE
 		return s.code
 	}
 
-	keyBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(keyBytes, uint32(id))
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementDropTable) PrintPreExecution() {
+	fmt.Println("Executing drop table statement")
+}
+
+func NewStatementDropTable(statement *sql.DropTableStatement) *StatementDropTable {
+	return &StatementDropTable{
+		statementType: STATEMENT_DROP_TABLE,
+		statement:     statement,
+	}
+}
+
+type StatementCreateIndex struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.CreateIndexStatement
+}
+
+func (s *StatementCreateIndex) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.statement.IfNotExists && db.IndexExists(s.statement.Name) {
+		s.code = SUCCESS
+		return s.code
+	}
 
-	value := t.SelectOne(keyBytes)
-	if len(value) <= 0 {
+	_, err := db.CreateIndex(s.statement.Name, s.statement.Table, s.statement.Columns, s.statement.Unique)
+	if err != nil {
+		printError(ip, err)
+		s.code = FAILURE
 		return s.code
 	}
 
-	b := bytes.NewBuffer(value)
-	var r *row.Row
+	s.code = SUCCESS
+	return s.code
+}
 
-	r = &row.Row{}
-	err = serialization.Deserialize(b, r)
+func (s *StatementCreateIndex) PrintPreExecution() {
+	fmt.Println("Executing create index statement")
+}
 
-	jsonBytes, _ := json.Marshal(r.ToRowDTO())
-	ip.Print(string(jsonBytes))
+func NewStatementCreateIndex(statement *sql.CreateIndexStatement) *StatementCreateIndex {
+	return &StatementCreateIndex{
+		statementType: STATEMENT_CREATE_INDEX,
+		statement:     statement,
+	}
+}
+
+type StatementDropIndex struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.DropIndexStatement
+}
+
+func (s *StatementDropIndex) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.statement.IfExists && !db.IndexExists(s.statement.Name) {
+		s.code = SUCCESS
+		return s.code
+	}
+
+	err := db.DropIndex(s.statement.Name)
+	if err != nil {
+		printError(ip, err)
+		s.code = FAILURE
+		return s.code
+	}
+
+	s.code = SUCCESS
 	return s.code
 }
 
-func (s *StatementSelectOne) PrintPreExecution() {
-	fmt.Println("Executing select statement")
+func (s *StatementDropIndex) PrintPreExecution() {
+	fmt.Println("Executing drop index statement")
 }
 
-func NewStatementSelectOne(input string) *StatementSelectOne {
-	statement := &StatementSelectOne{
-		statementType: STATEMENT_SELECT_ONE,
+func NewStatementDropIndex(statement *sql.DropIndexStatement) *StatementDropIndex {
+	return &StatementDropIndex{
+		statementType: STATEMENT_DROP_INDEX,
+		statement:     statement,
 	}
+}
 
-	inputParts := strings.Split(input, " ")
-	statement.key = inputParts[1]
+type StatementExplain struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.ExplainStatement
+}
 
-	return statement
+/**
+ * Shows the operator tree of a select, or of the search for the rows an update
+ * or delete modifies. EXPLAIN ANALYZE runs the select and discards its rows,
+ * so the plan shows what every operator actually did.
+ */
+func (s *StatementExplain) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	var plan *planner.Plan
+	var err error
+	switch statement := s.statement.Statement.(type) {
+	case *sql.SelectStatement:
+		plan, err = planner.PlanSelect(db, statement, planner.Options{Instrument: s.statement.Analyze})
+	case *sql.UpdateStatement:
+		plan, err = s.planRows(db, statement.Table, statement.Where)
+	case *sql.DeleteStatement:
+		plan, err = s.planRows(db, statement.Table, statement.Where)
+	default:
+		err = fmt.Errorf("EXPLAIN supports only SELECT, UPDATE and DELETE statements")
+	}
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	if s.statement.Analyze {
+		err = executor.Run(plan.Root, func(values []row.Value) bool {
+			return true
+		})
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+
+	printJSON(ip, executor.Describe(plan.Root, plan.Estimates))
+
+	s.code = SUCCESS
+	return s.code
 }
 
-type StatementInsert struct {
+func (s *StatementExplain) planRows(db *database.Database, tableName string, where sql.Expr) (*planner.Plan, error) {
+	if s.statement.Analyze {
+		return nil, fmt.Errorf("EXPLAIN ANALYZE supports only SELECT statements")
+	}
+
+	t, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	return planner.PlanRows(db, t, where)
+}
+
+func (s *StatementExplain) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementExplain) PrintPreExecution() {
+	fmt.Println("Executing explain statement")
+}
+
+func NewStatementExplain(statement *sql.ExplainStatement) *StatementExplain {
+	return &StatementExplain{
+		statementType: STATEMENT_EXPLAIN,
+		statement:     statement,
+	}
+}
+
+type StatementAnalyze struct {
 	code          CommandExecutionStatusCode
 	statementType StatementCommandType
-	args          []string
+	statement     *sql.AnalyzeStatement
 }
 
-func (s *StatementInsert) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
-	if len(s.args) != 3 {
-		s.code = FAILURE
-	} else {
-		newRow := &row.Row{}
-		id, err := strconv.Atoi(s.args[0])
+/**
+ * Collects the statistics the planner estimates the rows of plans with,
+ * and stores them in the catalog.
+ */
+func (s *StatementAnalyze) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	names := db.TableNames()
+	if s.statement.Table != "" {
+		names = []string{s.statement.Table}
+	}
+
+	analyzed := make([]*AnalyzedTableDTO, 0, len(names))
+	for _, name := range names {
+		t, err := db.GetTable(name)
 		if err != nil {
-			s.code = FAILURE
-			return s.code
+			return s.fail(ip, err)
+		}
+
+		stats, err := statistics.Collect(t)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+
+		err = db.SetStatistics(name, stats)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+
+		analyzed = append(analyzed, &AnalyzedTableDTO{
+			Table:       name,
+			Rows:        int64(stats.RowCount),
+			SampledRows: stats.SampleSize,
+		})
+	}
+
+	printJSON(ip, analyzed)
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementAnalyze) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementAnalyze) PrintPreExecution() {
+	fmt.Println("Executing analyze statement")
+}
+
+func NewStatementAnalyze(statement *sql.AnalyzeStatement) *StatementAnalyze {
+	return &StatementAnalyze{
+		statementType: STATEMENT_ANALYZE,
+		statement:     statement,
+	}
+}
+
+type StatementPrepare struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.PrepareStatement
+	session       *Session
+}
+
+/**
+ * Infers the types of the parameters and stores the statement in the session.
+ * A select is also planned, so that errors in it are reported right away.
+ */
+func (s *StatementPrepare) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if _, exists := s.session.prepared[s.statement.Name]; exists {
+		return s.fail(ip, fmt.Errorf("prepared statement %s already exists", s.statement.Name))
+	}
+
+	types, err := planner.ParameterTypes(db, s.statement.Statement, s.statement.NumParameters, s.statement.Types)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	prepared := NewPreparedStatement(s.statement.Name, s.statement.Statement, types)
+	if statement, ok := s.statement.Statement.(*sql.SelectStatement); ok {
+		_, err = prepared.selectPlan(db, statement)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+	s.session.prepared[s.statement.Name] = prepared
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementPrepare) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementPrepare) PrintPreExecution() {
+	fmt.Println("Executing prepare statement")
+}
+
+func NewStatementPrepare(statement *sql.PrepareStatement, session *Session) *StatementPrepare {
+	return &StatementPrepare{
+		statementType: STATEMENT_PREPARE,
+		statement:     statement,
+		session:       session,
+	}
+}
+
+type StatementExecute struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.ExecuteStatement
+	session       *Session
+}
+
+/**
+ * Binds the arguments to the parameters of the prepared statement and executes
+ * it. A select reuses its plan; other statements are executed as if parsed anew.
+ */
+func (s *StatementExecute) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	prepared, exists := s.session.prepared[s.statement.Name]
+	if !exists {
+		return s.fail(ip, fmt.Errorf("prepared statement %s does not exist", s.statement.Name))
+	}
+
+	err := prepared.bind(s.statement.Args)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	switch statement := prepared.Statement.(type) {
+	case *sql.SelectStatement:
+		plan, err := prepared.selectPlan(db, statement)
+		if err != nil {
+			return s.fail(ip, err)
 		}
+		s.code, err = printPlanRows(ip, plan)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+		return s.code
+	case *sql.InsertStatement:
+		s.code = NewStatementInsert(statement).Execute(db, ip)
+		return s.code
+	case *sql.UpdateStatement:
+		s.code = NewStatementUpdate(statement).Execute(db, ip)
+		return s.code
+	case *sql.DeleteStatement:
+		s.code = NewStatementDelete(statement).Execute(db, ip)
+		return s.code
+	}
+
+	s.code = SUCCESS
+	return s.code
+}
 
-		newRow.Id = uint32(id)
-		copy(newRow.Username[:], []byte(s.args[1]))
-		copy(newRow.Email[:], []byte(s.args[2]))
+func (s *StatementExecute) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
 
-		rowBytes := serialization.Serialize(newRow)
+func (s *StatementExecute) PrintPreExecution() {
+	fmt.Println("Executing execute statement")
+}
 
-		keyBytes := make([]byte, 4)
-		binary.LittleEndian.PutUint32(keyBytes, newRow.Id)
-		t.Insert(keyBytes, rowBytes)
+func NewStatementExecute(statement *sql.ExecuteStatement, session *Session) *StatementExecute {
+	return &StatementExecute{
+		statementType: STATEMENT_EXECUTE,
+		statement:     statement,
+		session:       session,
+	}
+}
 
+type StatementDeallocate struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.DeallocateStatement
+	session       *Session
+}
+
+func (s *StatementDeallocate) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.statement.All {
+		s.session.prepared = make(map[string]*PreparedStatement)
 		s.code = SUCCESS
+		return s.code
+	}
+
+	if _, exists := s.session.prepared[s.statement.Name]; !exists {
+		printError(ip, fmt.Errorf("prepared statement %s does not exist", s.statement.Name))
+		s.code = FAILURE
+		return s.code
 	}
+	delete(s.session.prepared, s.statement.Name)
 
+	s.code = SUCCESS
 	return s.code
 }
 
-func (s *StatementInsert) PrintPreExecution() {
-	fmt.Println("Executing insert statement")
+func (s *StatementDeallocate) PrintPreExecution() {
+	fmt.Println("Executing deallocate statement")
 }
 
-func NewStatementInsert(input string) *StatementInsert {
-	statement := &StatementInsert{
-		statementType: STATEMENT_INSERT,
+func NewStatementDeallocate(statement *sql.DeallocateStatement, session *Session) *StatementDeallocate {
+	return &StatementDeallocate{
+		statementType: STATEMENT_DEALLOCATE,
+		statement:     statement,
+		session:       session,
 	}
+}
 
-	inputParts := strings.Split(input, " ")
-	statement.args = inputParts[1:]
+type StatementInvalid struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	err           error
+}
 
-	return statement
+func (s *StatementInvalid) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	printError(ip, s.err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementInvalid) PrintPreExecution() {
+	fmt.Println("Invalid statement")
+}
+
+func NewStatementInvalid(err error) *StatementInvalid {
+	return &StatementInvalid{
+		statementType: STATEMENT_INVALID,
+		err:           err,
+	}
 }
 
 type StatementUnrecognized struct {
@@ -172,7 +889,7 @@ type StatementUnrecognized struct {
 	statementType StatementCommandType
 }
 
-func (s *StatementUnrecognized) Execute(t *table.Table, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+func (s *StatementUnrecognized) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
 	s.code = UNRECOGNIZED
 	return s.code
 }
@@ -0,0 +1,377 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/ioprovider"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/locking"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Reports whether executing the statement can change the database.
+ */
+func isWriteStatement(statement sql.Statement, session *Session) bool {
+	switch s := statement.(type) {
+	case *sql.InsertStatement, *sql.UpdateStatement, *sql.DeleteStatement,
+		*sql.CreateTableStatement, *sql.DropTableStatement,
+		*sql.CreateIndexStatement, *sql.DropIndexStatement, *sql.AnalyzeStatement:
+		return true
+	case *sql.ExecuteStatement:
+		prepared, exists := session.prepared[s.Name]
+		return exists && isWriteStatement(prepared.Statement, session)
+	default:
+		return false
+	}
+}
+
+/**
+ * Reports whether executing the statement changes the schema or the statistics.
+ */
+func isSchemaStatement(statement sql.Statement, session *Session) bool {
+	switch s := statement.(type) {
+	case *sql.CreateTableStatement, *sql.DropTableStatement,
+		*sql.CreateIndexStatement, *sql.DropIndexStatement, *sql.AnalyzeStatement:
+		return true
+	case *sql.ExecuteStatement:
+		prepared, exists := session.prepared[s.Name]
+		return exists && isSchemaStatement(prepared.Statement, session)
+	default:
+		return false
+	}
+}
+
+/**
+ * Returns the locks the statement takes on the rows it reads.
+ */
+func rowLocking(statement sql.Statement, session *Session) sql.RowLocking {
+	switch s := statement.(type) {
+	case *sql.SelectStatement:
+		return s.Locking
+	case *sql.ExecuteStatement:
+		if prepared, exists := session.prepared[s.Name]; exists {
+			return rowLocking(prepared.Statement, session)
+		}
+	}
+	return sql.LOCKING_NONE
+}
+
+/**
+ * Runs a statement within the transaction of the session. Outside of an
+ * explicit transaction, a statement runs in a transaction of its own: a
+ * statement that changes the database is committed if it succeeds and rolled
+ * back otherwise (autocommit), and any other statement reads a snapshot
+ * taken when it starts. Inside a transaction, every statement reads the
+ * snapshot taken by its first statement. A failed statement may have
+ * applied only a part of its changes, so the transaction is aborted: it
+ * is rolled back at once, releasing its locks, but only a rollback
+ * is accepted from the client. A transaction with savepoints is kept
+ * instead, so the client can roll back to one of them.
+ */
+type StatementTransactional struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     sql.Statement
+	command       Command
+	writes        bool
+	schema        bool
+	session       *Session
+}
+
+func (s *StatementTransactional) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.session.inTransaction {
+		if s.session.aborted {
+			return s.fail(ip, errors.New("the transaction is aborted, commands are ignored until ROLLBACK"))
+		}
+
+		s.code = s.execute(db, ip)
+		if s.code == FAILURE {
+			s.session.aborted = true
+			if !db.HasSavepoints() {
+				db.Rollback()
+			}
+		}
+		return s.code
+	}
+
+	s.code = s.execute(db, ip)
+	if s.code != SUCCESS && s.code != NOT_FOUND {
+		db.Rollback()
+		return s.code
+	}
+
+	err := db.Commit()
+	if err != nil {
+		return s.fail(ip, err)
+	}
+	return s.code
+}
+
+func (s *StatementTransactional) execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if !s.writes {
+		db.BeginRead()
+		err := db.WaitReadsDurable()
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	} else if s.schema {
+		err := db.BeginSchemaChange()
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	} else {
+		err := db.BeginWrite()
+		if err != nil {
+			return s.fail(ip, err)
+		}
+	}
+
+	switch rowLocking(s.statement, s.session) {
+	case sql.LOCKING_FOR_SHARE:
+		db.LockReads(locking.LOCK_SHARED)
+	case sql.LOCKING_FOR_UPDATE:
+		db.LockReads(locking.LOCK_EXCLUSIVE)
+	}
+	defer db.StopLockingReads()
+
+	return s.command.Execute(db, ip)
+}
+
+func (s *StatementTransactional) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementTransactional) PrintPreExecution() {
+	s.command.PrintPreExecution()
+}
+
+func NewStatementTransactional(statement sql.Statement, command Command, session *Session) *StatementTransactional {
+	return &StatementTransactional{
+		statementType: STATEMENT_TRANSACTIONAL,
+		statement:     statement,
+		command:       command,
+		writes:        isWriteStatement(statement, session),
+		schema:        isSchemaStatement(statement, session),
+		session:       session,
+	}
+}
+
+type StatementBegin struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	session       *Session
+}
+
+func (s *StatementBegin) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if s.session.inTransaction {
+		printError(ip, errors.New("a transaction is already in progress"))
+		s.code = FAILURE
+		return s.code
+	}
+
+	// The snapshot of the transaction is taken by its first statement
+	s.session.inTransaction = true
+	s.session.aborted = false
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementBegin) PrintPreExecution() {
+	fmt.Println("Executing begin statement")
+}
+
+func NewStatementBegin(session *Session) *StatementBegin {
+	return &StatementBegin{
+		statementType: STATEMENT_BEGIN,
+		session:       session,
+	}
+}
+
+type StatementCommit struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	session       *Session
+}
+
+/**
+ * Commits the transaction of the session. An aborted transaction
+ * cannot be committed, so it is rolled back instead.
+ */
+func (s *StatementCommit) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if !s.session.inTransaction {
+		return s.fail(ip, errors.New("there is no transaction in progress"))
+	}
+
+	aborted := s.session.aborted
+	s.session.inTransaction = false
+	s.session.aborted = false
+
+	if aborted {
+		db.Rollback()
+		return s.fail(ip, errors.New("the transaction was aborted, so it has been rolled back"))
+	}
+
+	err := db.Commit()
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementCommit) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementCommit) PrintPreExecution() {
+	fmt.Println("Executing commit statement")
+}
+
+func NewStatementCommit(session *Session) *StatementCommit {
+	return &StatementCommit{
+		statementType: STATEMENT_COMMIT,
+		session:       session,
+	}
+}
+
+type StatementRollback struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.RollbackStatement
+	session       *Session
+}
+
+/**
+ * Rolls back the transaction of the session, or only the changes made
+ * since a savepoint, which also recovers an aborted transaction.
+ */
+func (s *StatementRollback) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if !s.session.inTransaction {
+		return s.fail(ip, errors.New("there is no transaction in progress"))
+	}
+
+	if s.statement.Savepoint != "" {
+		err := db.RollbackToSavepoint(s.statement.Savepoint)
+		if err != nil {
+			return s.fail(ip, err)
+		}
+		s.session.aborted = false
+
+		s.code = SUCCESS
+		return s.code
+	}
+
+	s.session.inTransaction = false
+	s.session.aborted = false
+	db.Rollback()
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementRollback) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementRollback) PrintPreExecution() {
+	fmt.Println("Executing rollback statement")
+}
+
+func NewStatementRollback(statement *sql.RollbackStatement, session *Session) *StatementRollback {
+	return &StatementRollback{
+		statementType: STATEMENT_ROLLBACK,
+		statement:     statement,
+		session:       session,
+	}
+}
+
+type StatementSavepoint struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.SavepointStatement
+	session       *Session
+}
+
+func (s *StatementSavepoint) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if !s.session.inTransaction {
+		return s.fail(ip, errors.New("savepoints can only be used in transactions"))
+	}
+	if s.session.aborted {
+		return s.fail(ip, errors.New("the transaction is aborted, commands are ignored until ROLLBACK"))
+	}
+
+	db.Savepoint(s.statement.Name)
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementSavepoint) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementSavepoint) PrintPreExecution() {
+	fmt.Println("Executing savepoint statement")
+}
+
+func NewStatementSavepoint(statement *sql.SavepointStatement, session *Session) *StatementSavepoint {
+	return &StatementSavepoint{
+		statementType: STATEMENT_SAVEPOINT,
+		statement:     statement,
+		session:       session,
+	}
+}
+
+type StatementRelease struct {
+	code          CommandExecutionStatusCode
+	statementType StatementCommandType
+	statement     *sql.ReleaseStatement
+	session       *Session
+}
+
+func (s *StatementRelease) Execute(db *database.Database, ip ioprovider.IIOProvider) CommandExecutionStatusCode {
+	if !s.session.inTransaction {
+		return s.fail(ip, errors.New("savepoints can only be used in transactions"))
+	}
+	if s.session.aborted {
+		return s.fail(ip, errors.New("the transaction is aborted, commands are ignored until ROLLBACK"))
+	}
+
+	err := db.ReleaseSavepoint(s.statement.Savepoint)
+	if err != nil {
+		return s.fail(ip, err)
+	}
+
+	s.code = SUCCESS
+	return s.code
+}
+
+func (s *StatementRelease) fail(ip ioprovider.IIOProvider, err error) CommandExecutionStatusCode {
+	printError(ip, err)
+	s.code = FAILURE
+	return s.code
+}
+
+func (s *StatementRelease) PrintPreExecution() {
+	fmt.Println("Executing release statement")
+}
+
+func NewStatementRelease(statement *sql.ReleaseStatement, session *Session) *StatementRelease {
+	return &StatementRelease{
+		statementType: STATEMENT_RELEASE,
+		statement:     statement,
+		session:       session,
+	}
+}
@@ -0,0 +1,99 @@
+package database_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+)
+
+/**
+ * Backs up the database while clients keep inserting rows, each client its
+ * own rows in order, and restores the backup. The restored database holds
+ * a consistent version: for every client, all of its rows committed before
+ * the backup started and none of the rows committed after it ended, with
+ * nothing missing in between, and its index agrees with its table.
+ */
+func TestBackupDuringWritesRestores(t *testing.T) {
+	db := openDatabase(t)
+	err := db.SetBackupDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := newClient(t, db)
+	setup.mustRun("create table t (id int primary key, writer int, n int)")
+	setup.mustRun("create index t_writer on t (writer)")
+
+	committed := make([]atomic.Int64, STRESS_CLIENTS)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < STRESS_CLIENTS; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			c := newConcurrentClient(t, db.Connect())
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c.mustRun(fmt.Sprintf("insert into t values (%d, %d, %d)", w*1000000+n, w, n))
+				committed[w].Store(int64(n + 1))
+			}
+		}(w)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	before := make([]int64, STRESS_CLIENTS)
+	for w := range before {
+		before[w] = committed[w].Load()
+	}
+	backup := newClient(t, db.Connect())
+	if code := commands.NewNonStatementBackup("during-writes").Execute(backup.db, backup); code != commands.SUCCESS {
+		t.Fatalf("backup: %v", backup.output)
+	}
+	after := make([]int64, STRESS_CLIENTS)
+	for w := range after {
+		after[w] = committed[w].Load()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	total := setup.number("select count(*) from t")
+	if code := commands.NewNonStatementRestore("during-writes").Execute(setup.db, setup); code != commands.SUCCESS {
+		t.Fatalf("restore: %v", setup.output)
+	}
+	restored := int64(0)
+	for w := 0; w < STRESS_CLIENTS; w++ {
+		count := setup.number(fmt.Sprintf("select count(*) from t where id >= %d and id < %d", w*1000000, (w+1)*1000000))
+		if count < before[w] || count > after[w] {
+			t.Errorf("client %d: the backup holds %d rows, committed %d before it and %d after it", w, count, before[w], after[w])
+		}
+		if indexed := setup.number(fmt.Sprintf("select count(*) from t where writer = %d", w)); indexed != count {
+			t.Errorf("client %d: the index holds %d rows, the table %d", w, indexed, count)
+		}
+		if count > 0 {
+			if last := setup.number(fmt.Sprintf("select max(n) from t where writer = %d", w)); last != count-1 {
+				t.Errorf("client %d: the backup holds %d rows, the last one is %d", w, count, last)
+			}
+		}
+		restored += count
+	}
+	if restored > total {
+		t.Errorf("the backup holds %d rows, the database held %d", restored, total)
+	}
+
+	// The restored database takes new commits
+	setup.mustRun("insert into t values (-1, -1, 0)")
+	if count := setup.number("select count(*) from t"); count != restored+1 {
+		t.Errorf("got %d rows after an insert into %d restored rows", count, restored)
+	}
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/statistics"
+)
+
+type IndexEntry struct {
+	Name     string
+	Columns  []string
+	RootPage uint32
+	Unique   bool
+}
+
+/**
+ * Describes a single table. Each entry is stored in the catalog tree,
+ * under the table id.
+ */
+type CatalogEntry struct {
+	Id       uint32
+	Name     string
+	RootPage uint32
+	Columns  []row.Column
+	Indexes  []IndexEntry
+}
+
+/**
+ * A part of the statistics of a table: the table level statistics if Column
+ * is -1, and the statistics of a single column otherwise. The statistics are
+ * split by column, since all of them would not fit into a single cell.
+ */
+type statisticsRecord struct {
+	TableId uint32
+	Column  int
+	Table   *statistics.TableStats
+	Values  *statistics.ColumnStats
+}
+
+/**
+ * The system catalog is a B-tree whose root page is recorded in the pager
+ * metadata. Table entries are stored under their (positive) table ids, and
+ * the statistics records under negative keys. All entries and statistics are
+ * also cached in memory, indexed by table name and table id.
+ * A committed catalog is shared by the connections and never changed:
+ * a transaction changes its own copy. Every version of the catalog
+ * is numbered uniquely.
+ */
+type Catalog struct {
+	tree       *paging.Tree
+	entries    map[string]*CatalogEntry
+	statistics map[uint32]*statistics.TableStats
+	nextId     uint32
+	version    uint64
+}
+
+var catalogVersions uint64
+
+func nextCatalogVersion() uint64 {
+	return atomic.AddUint64(&catalogVersions, 1)
+}
+
+/**
+ * Reads the catalog stored in the tree.
+ */
+func NewCatalog(tree *paging.Tree) *Catalog {
+	catalog := &Catalog{
+		tree:       tree,
+		entries:    make(map[string]*CatalogEntry),
+		statistics: make(map[uint32]*statistics.TableStats),
+		nextId:     1,
+		version:    nextCatalogVersion(),
+	}
+
+	records := make([]*statisticsRecord, 0)
+	tree.Scan(func(key []byte, value []byte) bool {
+		if row.DecodeKey(key) < 0 {
+			record := &statisticsRecord{}
+			if serialization.Deserialize(bytes.NewBuffer(value), record) == nil {
+				records = append(records, record)
+			}
+			return true
+		}
+
+		entry := &CatalogEntry{}
+		err := serialization.Deserialize(bytes.NewBuffer(value), entry)
+		if err != nil {
+			return true
+		}
+
+		catalog.entries[entry.Name] = entry
+		if entry.Id >= catalog.nextId {
+			catalog.nextId = entry.Id + 1
+		}
+		return true
+	})
+
+	// the table records have the largest keys of their tables, so they come last
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.Column < 0 {
+			catalog.statistics[record.TableId] = record.Table
+			continue
+		}
+
+		stats, ok := catalog.statistics[record.TableId]
+		if !ok {
+			continue
+		}
+		for len(stats.Columns) <= record.Column {
+			stats.Columns = append(stats.Columns, nil)
+		}
+		stats.Columns[record.Column] = record.Values
+	}
+
+	return catalog
+}
+
+/**
+ * Returns a copy of the catalog which can be changed through the given tree,
+ * the catalog tree as seen by a transaction.
+ */
+func (c *Catalog) clone(tree *paging.Tree) *Catalog {
+	catalog := &Catalog{
+		tree:       tree,
+		entries:    make(map[string]*CatalogEntry, len(c.entries)),
+		statistics: make(map[uint32]*statistics.TableStats, len(c.statistics)),
+		nextId:     c.nextId,
+		version:    c.version,
+	}
+
+	for name, entry := range c.entries {
+		entryCopy := *entry
+		entryCopy.Indexes = append([]IndexEntry(nil), entry.Indexes...)
+		catalog.entries[name] = &entryCopy
+	}
+	for id, stats := range c.statistics {
+		catalog.statistics[id] = stats
+	}
+
+	return catalog
+}
+
+func catalogKey(id uint32) []byte {
+	return row.EncodeKey(int64(id))
+}
+
+/**
+ * Statistics records are keyed by the table id and the column, in the
+ * negative half of the key space.
+ */
+func statisticsKey(id uint32, column int) []byte {
+	return row.EncodeKey(-(int64(id)<<16 | int64(column+1)) - 1)
+}
+
+func (c *Catalog) getEntry(name string) (*CatalogEntry, bool) {
+	entry, ok := c.entries[name]
+	return entry, ok
+}
+
+/**
+ * Serializes the entry, which is stored in a single cell, so a table with
+ * too many columns or indexes cannot be described.
+ */
+func encodeEntry(entry *CatalogEntry) ([]byte, error) {
+	data := serialization.Serialize(entry)
+	if len(data) > paging.MAX_DATA_SIZE {
+		return nil, fmt.Errorf("the definition of table %s is too large: %d bytes, at most %d allowed", entry.Name, len(data), paging.MAX_DATA_SIZE)
+	}
+	return data, nil
+}
+
+func (c *Catalog) addEntry(entry *CatalogEntry) error {
+	entry.Id = c.nextId
+	data, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	c.nextId++
+
+	c.tree.AddNewData(catalogKey(entry.Id), data)
+	c.entries[entry.Name] = entry
+	return nil
+}
+
+/**
+ * Rewrites the stored entry after it was changed, e.g. by adding an index.
+ */
+func (c *Catalog) updateEntry(entry *CatalogEntry) error {
+	data, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.tree.DeleteData(catalogKey(entry.Id))
+	if err != nil {
+		return err
+	}
+
+	c.tree.AddNewData(catalogKey(entry.Id), data)
+	return nil
+}
+
+/**
+ * Returns the entry of the table the index with the given name belongs to.
+ */
+func (c *Catalog) findIndex(name string) (*CatalogEntry, int, bool) {
+	for _, entry := range c.entries {
+		for i, index := range entry.Indexes {
+			if index.Name == name {
+				return entry, i, true
+			}
+		}
+	}
+	return nil, -1, false
+}
+
+func (c *Catalog) removeEntry(entry *CatalogEntry) error {
+	err := c.removeStatistics(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.tree.DeleteData(catalogKey(entry.Id))
+	if err != nil {
+		return err
+	}
+
+	delete(c.entries, entry.Name)
+	return nil
+}
+
+func (c *Catalog) getStatistics(entry *CatalogEntry) (*statistics.TableStats, bool) {
+	stats, ok := c.statistics[entry.Id]
+	return stats, ok
+}
+
+/**
+ * Replaces the statistics of the table. A column histogram is made coarser
+ * until its record fits into a cell, and dropped if even that does not help.
+ */
+func (c *Catalog) setStatistics(entry *CatalogEntry, stats *statistics.TableStats) error {
+	err := c.removeStatistics(entry)
+	if err != nil {
+		return err
+	}
+
+	tableStats := *stats
+	tableStats.Columns = nil
+	c.tree.AddNewData(statisticsKey(entry.Id, -1), serialization.Serialize(&statisticsRecord{
+		TableId: entry.Id,
+		Column:  -1,
+		Table:   &tableStats,
+	}))
+
+	for i, columnStats := range stats.Columns {
+		record := &statisticsRecord{TableId: entry.Id, Column: i, Values: columnStats}
+		data := serialization.Serialize(record)
+		for len(data) > paging.MAX_DATA_SIZE {
+			if !columnStats.Coarsen() {
+				columnStats.Histogram = nil
+			}
+			data = serialization.Serialize(record)
+		}
+		c.tree.AddNewData(statisticsKey(entry.Id, i), data)
+	}
+
+	c.statistics[entry.Id] = stats
+	return nil
+}
+
+func (c *Catalog) removeStatistics(entry *CatalogEntry) error {
+	stats, ok := c.statistics[entry.Id]
+	if !ok {
+		return nil
+	}
+
+	for i := -1; i < len(stats.Columns); i++ {
+		_, err := c.tree.DeleteData(statisticsKey(entry.Id, i))
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(c.statistics, entry.Id)
+	return nil
+}
@@ -0,0 +1,746 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/locking"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/statistics"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * The state shared by all connections to a database: the pager, the lock
+ * manager and the latest committed catalog, which is published together
+ * with the pages of the transaction that changed it. Changes are made in
+ * transactions, which hold the database lock from their first change until
+ * they are committed or rolled back: any number of them can change rows
+ * at once, under the locks of the rows, while a transaction changing the
+ * schema is the only one changing the database. A commit holds
+ * the commit mutex from writing its log record until it is published, so
+ * the database is never closed in between.
+ */
+type engine struct {
+	pager      *paging.Pager
+	locks      *locking.LockManager
+	catalog    *Catalog
+	published  sync.RWMutex
+	committing sync.Mutex
+	closed     bool
+	// The only directory clients may back up into and restore from
+	backupDir string
+}
+
+/**
+ * A connection to a database, which is a single file holding the system
+ * catalog and an independent B-tree for every table. Every connection reads
+ * a snapshot of the database taken at the start of its statement, or of its
+ * transaction, so it never sees the changes of transactions which have not
+ * committed, or committed later. A transaction changes its own copies of
+ * the pages and of the catalog, which become visible to the statements
+ * started after it commits. The schema version is the version of the
+ * catalog seen by the connection, which changes whenever a table or an
+ * index is created or dropped, or statistics are collected, and thus
+ * invalidates the plans built before.
+ * The rows a transaction changes are locked until it ends, as are the rows
+ * it reads once it asks for read locks. A transaction cannot lock rows
+ * changed since its snapshot was taken, nor change the schema once anything
+ * was committed since, so it never overwrites changes it has not seen, and
+ * keeps reading the version it started with. Its changes are made again on
+ * top of the changes committed meanwhile when it commits.
+ * A connection must be used by one goroutine at a time.
+ */
+type Database struct {
+	Pager    *paging.Pager
+	engine   *engine
+	context  *paging.Context
+	snapshot *paging.Snapshot
+	txn      *paging.Transaction
+	// The id of the transaction in the lock manager, 0 outside of transactions
+	owner     uint64
+	lockReads bool
+	readMode  locking.LockMode
+	catalog   *Catalog
+	// The savepoints of the transaction, oldest first
+	savepoints []*savepoint
+	tables     map[string]*table.Table
+	// The catalog the tables were opened for
+	tablesCatalog *Catalog
+}
+
+var errClosed = errors.New("the database is closed")
+
+func NewDatabase(filename string) (*Database, error) {
+	return NewDatabaseInMode(filename, paging.PAGER_LOG)
+}
+
+/**
+ * Opens the database, creating it with the pager in the given mode
+ * if it does not exist yet.
+ */
+func NewDatabaseInMode(filename string, mode paging.PagerMode) (*Database, error) {
+	pager, err := paging.NewPagerInMode(filename, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	context := paging.NewContext()
+	if pager.NumPages == 0 {
+		txn, err := pager.Begin()
+		if err != nil {
+			pager.ClearPager()
+			return nil, err
+		}
+		context.SetView(txn)
+		tree := paging.CreateTree(pager, context)
+		txn.SetCatalogRootPage(tree.RootPage)
+		err = txn.Commit()
+		if err == nil {
+			err = txn.WaitDurable()
+		}
+		if err != nil {
+			pager.ClearPager()
+			return nil, fmt.Errorf("could not create the catalog: %v", err)
+		}
+		context.SetView(nil)
+	}
+
+	e := &engine{
+		pager:   pager,
+		locks:   locking.NewLockManager(),
+		catalog: NewCatalog(paging.NewTree(pager, context, pager.CatalogRootPage)),
+	}
+
+	return e.connect(context), nil
+}
+
+/**
+ * Opens another connection to the same database.
+ */
+func (db *Database) Connect() *Database {
+	return db.engine.connect(paging.NewContext())
+}
+
+func (e *engine) connect(context *paging.Context) *Database {
+	db := &Database{
+		Pager:   e.pager,
+		engine:  e,
+		context: context,
+		tables:  make(map[string]*table.Table),
+	}
+
+	return db
+}
+
+func (e *engine) committedCatalog() *Catalog {
+	e.published.RLock()
+	defer e.published.RUnlock()
+
+	return e.catalog
+}
+
+/**
+ * Takes a snapshot for reading, unless the connection already reads
+ * a snapshot or writes in a transaction.
+ */
+func (db *Database) BeginRead() {
+	if db.snapshot != nil || db.txn != nil {
+		return
+	}
+
+	db.takeSnapshot()
+	db.context.SetView(db.snapshot)
+}
+
+func (db *Database) takeSnapshot() {
+	// The snapshot and the catalog are taken together, so they match
+	db.engine.published.RLock()
+	defer db.engine.published.RUnlock()
+
+	db.snapshot = db.Pager.Snapshot()
+	db.catalog = db.engine.catalog
+	if db.owner == 0 {
+		db.owner = db.engine.locks.BeginSnapshot(db.snapshot.Version())
+	} else {
+		db.engine.locks.SetSnapshot(db.owner, db.snapshot.Version())
+	}
+}
+
+/**
+ * Starts the transaction which changes the database, on top of the snapshot
+ * the connection already reads, or of the latest committed version, once
+ * no other connection changes the schema. The transaction keeps reading
+ * that version, with its own changes, until it ends. The database lock
+ * is shared with the other transactions changing rows.
+ */
+func (db *Database) BeginWrite() error {
+	return db.beginWrite(locking.LOCK_SHARED)
+}
+
+/**
+ * Starts the transaction like BeginWrite, but locks the database exclusively,
+ * so the schema can be changed. Without a snapshot yet, the transaction
+ * starts on the version committed once the lock is granted.
+ */
+func (db *Database) BeginSchemaChange() error {
+	return db.beginWrite(locking.LOCK_EXCLUSIVE)
+}
+
+func (db *Database) beginWrite(mode locking.LockMode) error {
+	if db.txn != nil {
+		return nil
+	}
+	if db.engine.isClosed() {
+		return errClosed
+	}
+
+	if db.owner == 0 {
+		db.owner = db.engine.locks.Begin()
+	}
+	err := db.engine.locks.Lock(db.owner, locking.DatabaseResource(), mode)
+	if err != nil {
+		return err
+	}
+	if db.snapshot == nil {
+		db.takeSnapshot()
+	}
+
+	txn, err := db.Pager.BeginOn(db.snapshot)
+	if err != nil {
+		return err
+	}
+	// The transaction releases the snapshot
+	db.snapshot = nil
+
+	db.txn = txn
+	db.context.SetView(txn)
+	return nil
+}
+
+/**
+ * Makes the changes of the transaction durable and visible to the statements
+ * started afterwards. If they cannot be written to the log, the transaction
+ * is rolled back instead. The locks are released once the changes are
+ * visible, so the next transaction can commit while this one waits for
+ * the log to be synced; readers of the changes wait for it as well, see
+ * WaitReadsDurable. A connection which only read simply releases its
+ * snapshot.
+ */
+func (db *Database) Commit() error {
+	if db.txn == nil {
+		db.end()
+		return nil
+	}
+
+	txn := db.txn
+	db.engine.committing.Lock()
+	if db.engine.closed {
+		db.engine.committing.Unlock()
+		db.Rollback()
+		return errClosed
+	}
+	err := txn.Prepare()
+	if err != nil {
+		db.engine.committing.Unlock()
+		db.Rollback()
+		return err
+	}
+
+	// The locks are released only once the commit is visible
+	db.engine.published.Lock()
+	err = txn.Commit()
+	if err == nil {
+		db.engine.catalog = db.catalog
+		db.engine.locks.Commit(db.owner, txn.Version())
+		db.owner = 0
+	}
+	db.engine.published.Unlock()
+	db.engine.committing.Unlock()
+
+	db.end()
+	if err != nil {
+		return err
+	}
+	return txn.WaitDurable()
+}
+
+/**
+ * Returns the context the trees of the connection read pages through.
+ */
+func (db *Database) Context() *paging.Context {
+	return db.context
+}
+
+/**
+ * Waits until the commits the connection reads are durable. Commits are
+ * visible before their log records are synced, so statements which only
+ * read wait for them before returning rows, which a crash could lose.
+ */
+func (db *Database) WaitReadsDurable() error {
+	if db.txn != nil {
+		return db.txn.WaitBaseDurable()
+	}
+	if db.snapshot != nil {
+		return db.snapshot.WaitDurable()
+	}
+	return nil
+}
+
+/**
+ * Drops every change of the transaction, including changes to the schema.
+ */
+func (db *Database) Rollback() {
+	if db.txn != nil {
+		db.txn.Rollback()
+	}
+	db.end()
+}
+
+func (db *Database) end() {
+	db.txn = nil
+	if db.owner != 0 {
+		db.engine.locks.Release(db.owner)
+		db.owner = 0
+	}
+	db.lockReads = false
+	db.savepoints = nil
+	db.releaseSnapshot()
+	db.catalog = nil
+	db.context.SetView(nil)
+}
+
+func (db *Database) releaseSnapshot() {
+	if db.snapshot != nil {
+		db.snapshot.Release()
+		db.snapshot = nil
+	}
+}
+
+/**
+ * Makes the following reads of the transaction lock the rows they read
+ * in the given mode, until StopLockingReads.
+ */
+func (db *Database) LockReads(mode locking.LockMode) {
+	db.lockReads = true
+	db.readMode = mode
+}
+
+func (db *Database) StopLockingReads() {
+	db.lockReads = false
+}
+
+/**
+ * Locks the rows of the table for the transaction. Rows are always
+ * locked exclusively for writing, and for reading only when asked to.
+ */
+func (db *Database) LockRows(name string, low int64, high int64, write bool) error {
+	mode := locking.LOCK_EXCLUSIVE
+	if !write {
+		if !db.lockReads {
+			return nil
+		}
+		mode = db.readMode
+	}
+	return db.lock(locking.NewRangeResource(name, low, high), mode)
+}
+
+func (db *Database) lock(resource locking.Resource, mode locking.LockMode) error {
+	if db.owner == 0 {
+		return nil
+	}
+	return db.engine.locks.Lock(db.owner, resource, mode)
+}
+
+/**
+ * Locks every row of the table exclusively, before its schema is changed.
+ */
+func (db *Database) lockTable(name string) error {
+	return db.lock(locking.NewSpaceResource(name), locking.LOCK_EXCLUSIVE)
+}
+
+/**
+ * Returns the catalog seen by the connection: the catalog of its snapshot
+ * or transaction, or the latest committed one outside of them.
+ */
+func (db *Database) currentCatalog() *Catalog {
+	if db.catalog != nil {
+		return db.catalog
+	}
+	return db.engine.committedCatalog()
+}
+
+/**
+ * Returns the catalog of the transaction for a change, copying the committed
+ * catalog on the first change, and gives it a new version. The database is
+ * locked exclusively first, and the transaction must have seen every commit,
+ * so no other transaction changes the database until it ends.
+ */
+func (db *Database) writableCatalog() (*Catalog, error) {
+	if db.txn == nil {
+		panic("The catalog is changed outside of a transaction!")
+	}
+	err := db.lock(locking.DatabaseResource(), locking.LOCK_EXCLUSIVE)
+	if err != nil {
+		return nil, err
+	}
+	if db.txn.BaseVersion() != db.Pager.Version() {
+		return nil, errors.New("could not serialize access: the database was changed by another transaction since this one started")
+	}
+
+	if db.catalog == db.engine.committedCatalog() {
+		db.catalog = db.catalog.clone(paging.NewTree(db.Pager, db.context, db.catalog.tree.RootPage))
+	}
+	db.catalog.version = nextCatalogVersion()
+	return db.catalog, nil
+}
+
+func (db *Database) CreateTable(name string, schema *row.Schema) (*table.Table, error) {
+	err := db.lockTable(name)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := db.writableCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := catalog.getEntry(name); exists {
+		return nil, fmt.Errorf("table %s already exists", name)
+	}
+
+	tree := paging.CreateTree(db.Pager, db.context)
+	entry := &CatalogEntry{
+		Name:     name,
+		RootPage: tree.RootPage,
+		Columns:  schema.Columns,
+		Indexes:  make([]IndexEntry, 0),
+	}
+	err = catalog.addEntry(entry)
+	if err != nil {
+		tree.Destroy()
+		return nil, err
+	}
+
+	t := table.NewTable(entry.Id, entry.Name, schema, tree)
+	t.Locker = db
+	db.openTables()[name] = t
+	return t, nil
+}
+
+func (db *Database) DropTable(name string) error {
+	err := db.lockTable(name)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := db.writableCatalog()
+	if err != nil {
+		return err
+	}
+	t, err := db.GetTable(name)
+	if err != nil {
+		return err
+	}
+
+	entry, _ := catalog.getEntry(name)
+	err = catalog.removeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	for _, ix := range t.Indexes {
+		ix.Tree.Destroy()
+	}
+	t.Tree.Destroy()
+	delete(db.openTables(), name)
+	return nil
+}
+
+/**
+ * Creates an index on the columns of the table and fills it with the entries
+ * of the existing rows. Index names are unique in the whole database.
+ */
+func (db *Database) CreateIndex(name string, tableName string, columns []string, unique bool) (*table.Index, error) {
+	catalog, err := db.writableCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, exists := catalog.findIndex(name); exists {
+		return nil, fmt.Errorf("index %s already exists", name)
+	}
+
+	err = db.lockTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	t, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := indexColumns(t.Schema, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := paging.CreateTreeWithKeySize(db.Pager, db.context, table.IndexKeySize(len(positions)))
+	ix := table.NewIndex(name, positions, unique, t.Schema, tree)
+	err = t.AddIndex(ix)
+	if err != nil {
+		tree.Destroy()
+		return nil, err
+	}
+
+	entry, _ := catalog.getEntry(tableName)
+	entry.Indexes = append(entry.Indexes, IndexEntry{
+		Name:     name,
+		Columns:  columns,
+		RootPage: tree.RootPage,
+		Unique:   unique,
+	})
+	err = catalog.updateEntry(entry)
+	if err != nil {
+		entry.Indexes = entry.Indexes[:len(entry.Indexes)-1]
+		t.RemoveIndex(name)
+		tree.Destroy()
+		return nil, err
+	}
+
+	return ix, nil
+}
+
+/**
+ * Returns the positions of the named columns in the schema.
+ */
+func indexColumns(schema *row.Schema, columns []string) ([]int, error) {
+	positions := make([]int, len(columns))
+	seen := make(map[string]bool)
+	for i, column := range columns {
+		ind, ok := schema.ColumnIndex(column)
+		if !ok {
+			return nil, fmt.Errorf("column %s does not exist", column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("column %s is indexed more than once", column)
+		}
+		seen[column] = true
+		positions[i] = ind
+	}
+	return positions, nil
+}
+
+func (db *Database) IndexExists(name string) bool {
+	_, _, exists := db.currentCatalog().findIndex(name)
+	return exists
+}
+
+func (db *Database) DropIndex(name string) error {
+	catalog, err := db.writableCatalog()
+	if err != nil {
+		return err
+	}
+	entry, ind, exists := catalog.findIndex(name)
+	if !exists {
+		return fmt.Errorf("index %s does not exist", name)
+	}
+
+	err = db.lockTable(entry.Name)
+	if err != nil {
+		return err
+	}
+	t, err := db.GetTable(entry.Name)
+	if err != nil {
+		return err
+	}
+
+	entry.Indexes = append(entry.Indexes[:ind], entry.Indexes[ind+1:]...)
+	err = catalog.updateEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	if ix, ok := t.RemoveIndex(name); ok {
+		ix.Tree.Destroy()
+	}
+	return nil
+}
+
+/**
+ * Returns the tables opened by the connection for the catalog it sees.
+ * The tables opened for another catalog may have a different schema
+ * or indexes, so they are dropped.
+ */
+func (db *Database) openTables() map[string]*table.Table {
+	catalog := db.currentCatalog()
+	if db.tablesCatalog != catalog {
+		db.tables = make(map[string]*table.Table)
+		db.tablesCatalog = catalog
+	}
+	return db.tables
+}
+
+func (db *Database) GetTable(name string) (*table.Table, error) {
+	tables := db.openTables()
+	if t, ok := tables[name]; ok {
+		return t, nil
+	}
+
+	entry, exists := db.tablesCatalog.getEntry(name)
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", name)
+	}
+
+	schema, err := row.NewSchema(entry.Columns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema of table %s: %v", name, err)
+	}
+
+	t := table.NewTable(entry.Id, entry.Name, schema, paging.NewTree(db.Pager, db.context, entry.RootPage))
+	t.Locker = db
+	for _, indexEntry := range entry.Indexes {
+		positions, err := indexColumns(schema, indexEntry.Columns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index %s of table %s: %v", indexEntry.Name, name, err)
+		}
+		tree := paging.NewTree(db.Pager, db.context, indexEntry.RootPage)
+		t.Indexes = append(t.Indexes, table.NewIndex(indexEntry.Name, positions, indexEntry.Unique, schema, tree))
+	}
+
+	tables[name] = t
+	return t, nil
+}
+
+/**
+ * Returns the statistics last collected for the table by ANALYZE.
+ */
+func (db *Database) Statistics(name string) (*statistics.TableStats, bool) {
+	catalog := db.currentCatalog()
+	entry, exists := catalog.getEntry(name)
+	if !exists {
+		return nil, false
+	}
+	return catalog.getStatistics(entry)
+}
+
+func (db *Database) SetStatistics(name string, stats *statistics.TableStats) error {
+	catalog, err := db.writableCatalog()
+	if err != nil {
+		return err
+	}
+	entry, exists := catalog.getEntry(name)
+	if !exists {
+		return fmt.Errorf("table %s does not exist", name)
+	}
+	return catalog.setStatistics(entry, stats)
+}
+
+func (db *Database) SchemaVersion() uint64 {
+	return db.currentCatalog().version
+}
+
+func (db *Database) TableNames() []string {
+	catalog := db.currentCatalog()
+	names := make([]string, 0, len(catalog.entries))
+	for name := range catalog.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (db *Database) PrintInternalStructure() {
+	db.Pager.PrintPages()
+}
+
+/**
+ * Lets clients back up the database into the directory, and restore it from
+ * the backups there, naming only the file. Without it, clients can do
+ * neither, since the paths they name would be files of the server. Must be
+ * called before the database is shared between connections.
+ */
+func (db *Database) SetBackupDir(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	db.engine.backupDir = dir
+	return nil
+}
+
+/**
+ * Returns the path of the backup of a client, with the name, in the backup
+ * directory. The name must be a plain file name, so the backup cannot be
+ * written or read outside of the directory.
+ */
+func (db *Database) BackupPath(name string) (string, error) {
+	if db.engine.backupDir == "" {
+		return "", errors.New("backups are disabled, since the server has no backup directory")
+	}
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid backup name '%s': it must be a file name, without a directory", name)
+	}
+	return filepath.Join(db.engine.backupDir, name), nil
+}
+
+/**
+ * Writes a consistent copy of the latest committed version of the database
+ * into a new file, while other connections keep reading and writing.
+ */
+func (db *Database) Backup(path string) error {
+	return db.engine.pager.Backup(path)
+}
+
+/**
+ * Replaces the database with a backup, once it is validated. Fails if any
+ * connection, this one included, is running a transaction.
+ */
+func (db *Database) Restore(path string) error {
+	if db.snapshot != nil || db.txn != nil {
+		return errors.New("a backup cannot be restored within a transaction")
+	}
+
+	// No snapshot can be taken and no transaction can commit meanwhile
+	e := db.engine
+	e.published.Lock()
+	defer e.published.Unlock()
+
+	err := e.pager.Restore(path)
+	if err != nil {
+		return err
+	}
+	e.catalog = NewCatalog(paging.NewTree(e.pager, paging.NewContext(), e.pager.CatalogRootPage))
+	return nil
+}
+
+/**
+ * Rolls back the transaction of the connection and writes every committed
+ * page into the file. A commit in progress on another connection is waited
+ * for, while the transactions which have not started committing yet are
+ * lost: they fail to commit. The database must not be used afterwards.
+ */
+func (db *Database) Close() {
+	db.Rollback()
+
+	e := db.engine
+	e.committing.Lock()
+	defer e.committing.Unlock()
+
+	if e.closed {
+		return
+	}
+	e.closed = true
+	e.pager.ClearPager()
+}
+
+func (e *engine) isClosed() bool {
+	e.committing.Lock()
+	defer e.committing.Unlock()
+
+	return e.closed
+}
@@ -0,0 +1,512 @@
+package database_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+)
+
+/**
+ * A client of a connection, which runs statements in its own session
+ * and collects what they print.
+ */
+type client struct {
+	t       *testing.T
+	db      *database.Database
+	session *commands.Session
+	output  []string
+	// Reports a failed statement; clients of other goroutines cannot stop the test
+	fail func(format string, args ...any)
+}
+
+func newClient(t *testing.T, db *database.Database) *client {
+	return &client{
+		t:       t,
+		db:      db,
+		session: commands.NewSession(),
+		fail:    t.Fatalf,
+	}
+}
+
+/**
+ * Returns a client for a goroutine other than the one of the test.
+ */
+func newConcurrentClient(t *testing.T, db *database.Database) *client {
+	c := newClient(t, db)
+	c.fail = t.Errorf
+	return c
+}
+
+func (c *client) GetInput() (string, error) {
+	return "", nil
+}
+
+func (c *client) Print(data string) {
+	c.output = append(c.output, data)
+}
+
+/**
+ * Runs the statement and returns its status code and its last output.
+ */
+func (c *client) run(statement string) (commands.CommandExecutionStatusCode, string) {
+	c.output = nil
+	code := commands.NewStatementCommand(statement, c.session).Execute(c.db, c)
+	return code, strings.Join(c.output, "\n")
+}
+
+/**
+ * Runs the statement, failing the test if it fails.
+ */
+func (c *client) mustRun(statement string) string {
+	c.t.Helper()
+	code, output := c.run(statement)
+	if code != commands.SUCCESS {
+		c.fail("%s: %s", statement, output)
+	}
+	return output
+}
+
+func openDatabase(t *testing.T) *database.Database {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestTransactionKeepsItsSnapshotWhenItStartsWriting(t *testing.T) {
+	tests := []struct {
+		name string
+		// Committed by another client between the reads of the transaction
+		concurrent     string
+		change         string
+		changeSucceeds bool
+		countInside    string
+		countAfter     string
+	}{
+		{
+			name:           "nothing committed since the snapshot",
+			change:         "insert into t values (5, 5)",
+			changeSucceeds: true,
+			countInside:    `[{"count(*)":4}]`,
+			countAfter:     `[{"count(*)":4}]`,
+		},
+		{
+			name:           "another row committed since the snapshot",
+			concurrent:     "insert into t values (4, 4)",
+			change:         "insert into t values (5, 5)",
+			changeSucceeds: true,
+			countInside:    `[{"count(*)":4}]`,
+			countAfter:     `[{"count(*)":5}]`,
+		},
+		{
+			name:           "the same row committed since the snapshot",
+			concurrent:     "insert into t values (5, 5)",
+			change:         "insert into t values (5, 6)",
+			changeSucceeds: false,
+			countAfter:     `[{"count(*)":4}]`,
+		},
+		{
+			name:           "the changed row updated since the snapshot",
+			concurrent:     "update t set n = 10 where id = 1",
+			change:         "update t set n = n + 1 where id = 1",
+			changeSucceeds: false,
+			countAfter:     `[{"count(*)":3}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openDatabase(t)
+			a, b := newClient(t, db), newClient(t, db.Connect())
+			a.mustRun("create table t (id int primary key, n int)")
+			for _, statement := range []string{
+				"insert into t values (1, 1)",
+				"insert into t values (2, 2)",
+				"insert into t values (3, 3)",
+			} {
+				a.mustRun(statement)
+			}
+
+			a.mustRun("begin")
+			if count := a.mustRun("select count(*) from t"); count != `[{"count(*)":3}]` {
+				t.Fatalf("count at the start: %s", count)
+			}
+			if test.concurrent != "" {
+				b.mustRun(test.concurrent)
+				if count := a.mustRun("select count(*) from t"); count != `[{"count(*)":3}]` {
+					t.Fatalf("count after the other commit: %s", count)
+				}
+			}
+
+			code, output := a.run(test.change)
+			if (code == commands.SUCCESS) != test.changeSucceeds {
+				t.Fatalf("%s: code %v, %s", test.change, code, output)
+			}
+			if test.changeSucceeds {
+				if count := a.mustRun("select count(*) from t"); count != test.countInside {
+					t.Fatalf("count after the change: %s", count)
+				}
+				a.mustRun("commit")
+			} else {
+				if !strings.Contains(output, "could not serialize access") {
+					t.Fatalf("%s failed with %s", test.change, output)
+				}
+				a.mustRun("rollback")
+			}
+
+			if count := b.mustRun("select count(*) from t"); count != test.countAfter {
+				t.Fatalf("count after the transaction: %s", count)
+			}
+		})
+	}
+}
+
+/**
+ * A commit is visible before its log record is synced, so a statement
+ * which reads it must not return its rows before then.
+ */
+func TestReadsReturnOnlyDurableCommits(t *testing.T) {
+	db := openDatabase(t)
+	a, b := newClient(t, db), newClient(t, db.Connect())
+	a.mustRun("create table t (id int primary key, n int)")
+	db.Pager.SetCommitDelay(200 * time.Millisecond)
+	syncs := db.Pager.CommitStats().Syncs
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newConcurrentClient(t, db.Connect()).mustRun("insert into t values (1, 1)")
+	}()
+
+	for {
+		count := b.mustRun("select count(*) from t")
+		if count == `[{"count(*)":1}]` {
+			if db.Pager.CommitStats().Syncs == syncs {
+				t.Fatal("the row was read before its commit was synced")
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+}
+
+/**
+ * The definition of a table is stored in a single cell of the catalog,
+ * so a table too wide for it is rejected, and the database stays usable.
+ */
+func TestCreateTooWideTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns int
+		created bool
+	}{
+		{"a few columns", 5, true},
+		{"150 columns", 150, false},
+		{"1000 columns", 1000, false},
+	}
+
+	db := openDatabase(t)
+	c := newClient(t, db)
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			columns := []string{"id int primary key"}
+			for j := 1; j < test.columns; j++ {
+				columns = append(columns, fmt.Sprintf("column_number_%d text", j))
+			}
+			name := fmt.Sprintf("t%d", i)
+
+			code, output := c.run(fmt.Sprintf("create table %s (%s)", name, strings.Join(columns, ", ")))
+			if (code == commands.SUCCESS) != test.created {
+				t.Fatalf("create table: code %v, %s", code, output)
+			}
+			if !test.created && !strings.Contains(output, "too large") {
+				t.Fatalf("create table failed with %s", output)
+			}
+
+			code, output = c.run(fmt.Sprintf("select count(*) from %s", name))
+			if (code == commands.SUCCESS) != test.created {
+				t.Fatalf("select: code %v, %s", code, output)
+			}
+		})
+	}
+
+	// Every index makes the definition larger, until it no longer fits
+	failed := false
+	for i := 0; i < 100 && !failed; i++ {
+		code, output := c.run(fmt.Sprintf("create index index_number_%d on t0 (column_number_%d)", i, i%4+1))
+		if code != commands.SUCCESS {
+			if !strings.Contains(output, "too large") {
+				t.Fatalf("create index failed with %s", output)
+			}
+			failed = true
+		}
+	}
+	if !failed {
+		t.Fatal("every index was created")
+	}
+
+	c.mustRun("insert into t0 values (1, 'a', 'b', 'c', 'd')")
+	if count := c.mustRun("select count(*) from t0 where column_number_1 = 'a'"); count != `[{"count(*)":1}]` {
+		t.Fatalf("count after the failed statements: %s", count)
+	}
+}
+
+func TestOpenDatabaseFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(dir string) string
+	}{
+		{"missing directory", func(dir string) string {
+			return filepath.Join(dir, "missing", "db")
+		}},
+		{"the file is a directory", func(dir string) string {
+			return dir
+		}},
+		{"the log cannot be opened", func(dir string) string {
+			path := filepath.Join(dir, "db")
+			if err := os.Mkdir(path+".log", 0777); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := database.NewDatabase(test.setup(t.TempDir()))
+			if err == nil {
+				db.Close()
+				t.Fatal("the database was opened")
+			}
+		})
+	}
+}
+
+/**
+ * Once the database is closed, a transaction left running by another
+ * connection cannot commit, and the rows committed before are kept.
+ */
+func TestCloseRefusesLaterCommits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "db")
+	db, err := database.NewDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newClient(t, db), newClient(t, db.Connect())
+	a.mustRun("create table t (id int primary key)")
+	a.mustRun("insert into t values (1)")
+	b.mustRun("begin")
+	b.mustRun("insert into t values (2)")
+
+	db.Close()
+	code, output := b.run("commit")
+	if code != commands.FAILURE || !strings.Contains(output, "the database is closed") {
+		t.Errorf("commit after close: got %d %s", code, output)
+	}
+	if code, output := b.run("insert into t values (3)"); code != commands.FAILURE {
+		t.Errorf("insert after close: got %d %s", code, output)
+	}
+
+	db, err = database.NewDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if rows := newClient(t, db).mustRun("select id from t"); rows != `[{"id":1}]` {
+		t.Errorf("got %s after reopening", rows)
+	}
+}
+
+/**
+ * Closes the database while clients keep inserting rows. Every insert
+ * reported as committed must be in the database when it is reopened.
+ */
+func TestCloseDuringCommits(t *testing.T) {
+	for round := 0; round < 10; round++ {
+		filename := filepath.Join(t.TempDir(), "db")
+		db, err := database.NewDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newClient(t, db).mustRun("create table t (id int primary key)")
+
+		committed := make([][]int, STRESS_CLIENTS)
+		var wg sync.WaitGroup
+		for i := 0; i < STRESS_CLIENTS; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := newConcurrentClient(t, db.Connect())
+				for n := 0; ; n++ {
+					id := n*STRESS_CLIENTS + i
+					if code, _ := c.run(fmt.Sprintf("insert into t values (%d)", id)); code != commands.SUCCESS {
+						return
+					}
+					committed[i] = append(committed[i], id)
+				}
+			}(i)
+		}
+		time.Sleep(time.Duration(round) * time.Millisecond)
+		db.Close()
+		wg.Wait()
+
+		db, err = database.NewDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newClient(t, db)
+		for _, ids := range committed {
+			for _, id := range ids {
+				if rows := c.mustRun(fmt.Sprintf("select id from t where id = %d", id)); rows != fmt.Sprintf(`[{"id":%d}]`, id) {
+					t.Errorf("round %d: the committed row %d is lost: %s", round, id, rows)
+				}
+			}
+		}
+		db.Close()
+	}
+}
+
+/**
+ * Runs the statement in another goroutine, and returns the channel its
+ * output is sent to once it ends.
+ */
+func (c *client) runAsync(statement string) chan string {
+	result := make(chan string, 1)
+	go func() {
+		code, output := c.run(statement)
+		if code != commands.SUCCESS {
+			output = "failed: " + output
+		}
+		result <- output
+	}()
+	return result
+}
+
+func expectWaiting(t *testing.T, result chan string, what string) {
+	t.Helper()
+	select {
+	case output := <-result:
+		t.Fatalf("%s did not wait: %s", what, output)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectDone(t *testing.T, result chan string, what string) string {
+	t.Helper()
+	select {
+	case output := <-result:
+		return output
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s is still waiting", what)
+		return ""
+	}
+}
+
+func TestWritersOfOtherRowsDoNotWait(t *testing.T) {
+	db := openDatabase(t)
+	a, b := newClient(t, db), newClient(t, db.Connect())
+	a.mustRun("create table t (id int primary key, n int)")
+	a.mustRun("insert into t values (1, 1)")
+	a.mustRun("begin")
+	a.mustRun("insert into t values (2, 2)")
+	a.mustRun("update t set n = 10 where id = 1")
+
+	result := b.runAsync("insert into t values (3, 3)")
+	if output := expectDone(t, result, "the insert of another row"); strings.HasPrefix(output, "failed") {
+		t.Fatal(output)
+	}
+	a.mustRun("commit")
+
+	if rows := a.mustRun("select * from t"); rows != `[{"id":1,"n":10},{"id":2,"n":2},{"id":3,"n":3}]` {
+		t.Errorf("got %s", rows)
+	}
+}
+
+func TestWritersOfTheSameRowWait(t *testing.T) {
+	tests := []struct {
+		name string
+		// Run by the second writer while the first one holds its change
+		statement string
+		end       string
+		expected  string
+	}{
+		{"the same key committed", "insert into t values (2, 'b')", "commit", "failed"},
+		{"the same key rolled back", "insert into t values (2, 'b')", "rollback", ""},
+		{"the same unique value committed", "insert into t values (3, 'x')", "commit", "failed"},
+		{"the same unique value rolled back", "insert into t values (3, 'x')", "rollback", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openDatabase(t)
+			a, b := newClient(t, db), newClient(t, db.Connect())
+			a.mustRun("create table t (id int primary key, email text)")
+			a.mustRun("create unique index t_email on t (email)")
+			a.mustRun("insert into t values (1, 'a')")
+			a.mustRun("begin")
+			a.mustRun("insert into t values (2, 'x')")
+
+			result := b.runAsync(test.statement)
+			expectWaiting(t, result, "the second writer")
+			a.mustRun(test.end)
+
+			output := expectDone(t, result, "the second writer")
+			if failed := strings.HasPrefix(output, "failed"); failed != (test.expected == "failed") {
+				t.Errorf("got %s", output)
+			}
+		})
+	}
+}
+
+/**
+ * -0.0 equals 0.0, so a writer of one waits for the writer of the other
+ * in a unique index.
+ */
+func TestWritersOfNegativeZeroWait(t *testing.T) {
+	db := openDatabase(t)
+	a, b := newClient(t, db), newClient(t, db.Connect())
+	a.mustRun("create table t (id int primary key, f float)")
+	a.mustRun("create unique index t_f on t (f)")
+	a.mustRun("begin")
+	a.mustRun("insert into t values (1, 0.0)")
+
+	result := b.runAsync("insert into t values (2, -0.0)")
+	expectWaiting(t, result, "the writer of -0.0")
+	a.mustRun("commit")
+	if output := expectDone(t, result, "the writer of -0.0"); !strings.HasPrefix(output, "failed") {
+		t.Errorf("got %s", output)
+	}
+}
+
+func TestSchemaChangeWaitsForWriters(t *testing.T) {
+	db := openDatabase(t)
+	a, b := newClient(t, db), newClient(t, db.Connect())
+	a.mustRun("create table t (id int primary key)")
+	a.mustRun("begin")
+	a.mustRun("insert into t values (1)")
+
+	result := b.runAsync("create table u (id int primary key)")
+	expectWaiting(t, result, "the schema change")
+	a.mustRun("commit")
+	if output := expectDone(t, result, "the schema change"); strings.HasPrefix(output, "failed") {
+		t.Fatal(output)
+	}
+
+	// A transaction with a snapshot older than the schema change cannot write
+	b.mustRun("begin")
+	b.mustRun("select * from t")
+	a.mustRun("create table v (id int primary key)")
+	if code, output := b.run("insert into t values (2)"); code != commands.FAILURE || !strings.Contains(output, "could not serialize access") {
+		t.Errorf("got %d %s", code, output)
+	}
+}
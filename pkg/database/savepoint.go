@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+)
+
+/**
+ * A named state of the transaction, which it can return to. Savepoints
+ * made before the transaction changed anything hold no pages, and
+ * return it to its start.
+ */
+type savepoint struct {
+	name    string
+	pages   *paging.Savepoint
+	catalog *Catalog
+}
+
+/**
+ * Marks the current state of the transaction with the given name. A name
+ * can be used more than once; the latest savepoint with the name is used.
+ */
+func (db *Database) Savepoint(name string) {
+	sp := &savepoint{name: name, catalog: db.catalog}
+	if db.txn != nil {
+		sp.pages = db.txn.Savepoint()
+		if db.catalog != db.engine.committedCatalog() {
+			// The catalog of the transaction is changed in place
+			sp.catalog = db.catalog.clone(db.catalog.tree)
+		}
+	}
+	db.savepoints = append(db.savepoints, sp)
+}
+
+/**
+ * Drops the changes made since the savepoint, including changes to the
+ * schema, and the savepoints made after it. The savepoint itself is kept,
+ * so the transaction can return to it again. The locks taken since the
+ * savepoint are kept until the transaction ends.
+ */
+func (db *Database) RollbackToSavepoint(name string) error {
+	ind, err := db.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+
+	sp := db.savepoints[ind]
+	db.savepoints = db.savepoints[:ind+1]
+	if db.txn == nil {
+		return nil
+	}
+
+	db.txn.RollbackTo(sp.pages)
+	if sp.pages == nil || sp.catalog == db.engine.committedCatalog() {
+		db.catalog = db.engine.committedCatalog()
+		return nil
+	}
+
+	db.catalog = sp.catalog.clone(paging.NewTree(db.Pager, db.context, sp.catalog.tree.RootPage))
+	db.catalog.version = nextCatalogVersion()
+	return nil
+}
+
+/**
+ * Forgets the savepoint and the savepoints made after it,
+ * keeping the changes made since.
+ */
+func (db *Database) ReleaseSavepoint(name string) error {
+	ind, err := db.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+
+	db.savepoints = db.savepoints[:ind]
+	return nil
+}
+
+/**
+ * Reports whether the transaction can return to a savepoint.
+ */
+func (db *Database) HasSavepoints() bool {
+	return len(db.savepoints) > 0
+}
+
+func (db *Database) findSavepoint(name string) (int, error) {
+	for i := len(db.savepoints) - 1; i >= 0; i-- {
+		if db.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint %s does not exist", name)
+}
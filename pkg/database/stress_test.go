@@ -0,0 +1,180 @@
+package database_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/commands"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+)
+
+const STRESS_CLIENTS = 8
+const STRESS_ROUNDS = 60
+
+/**
+ * Runs the statement and returns the single number it selects.
+ */
+func (c *client) number(statement string) int64 {
+	c.t.Helper()
+	output := c.mustRun(statement)
+
+	var rows []map[string]any
+	err := json.Unmarshal([]byte(output), &rows)
+	if err != nil || len(rows) != 1 || len(rows[0]) != 1 {
+		c.fail("%s: %s", statement, output)
+		return 0
+	}
+	for _, value := range rows[0] {
+		if value == nil {
+			return 0
+		}
+		return int64(value.(float64))
+	}
+	return 0
+}
+
+/**
+ * Runs the statements in a transaction and reports whether it committed.
+ * A failed transaction is rolled back.
+ */
+func (c *client) transaction(statements ...string) bool {
+	c.mustRun("begin")
+	for _, statement := range statements {
+		if code, _ := c.run(statement); code != commands.SUCCESS {
+			c.mustRun("rollback")
+			return false
+		}
+	}
+	code, _ := c.run("commit")
+	return code == commands.SUCCESS
+}
+
+/**
+ * Every client inserts, updates and reads its own rows, in statements of
+ * their own and in transactions, and reads the rows of everyone, while
+ * another client takes backups. Run with -race, so any unsynchronized
+ * access to the pager, the trees or the catalog fails the test.
+ */
+func TestConcurrentClients(t *testing.T) {
+	dir := t.TempDir()
+	db := openDatabase(t)
+	err := db.SetBackupDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := newClient(t, db)
+	setup.mustRun("create table t (id int primary key, owner int, n int, note text)")
+	setup.mustRun("create index t_owner on t (owner)")
+
+	inserted := make([]int64, STRESS_CLIENTS)
+	updated := make([]int64, STRESS_CLIENTS)
+	var wg sync.WaitGroup
+	for w := 0; w < STRESS_CLIENTS; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			c := newConcurrentClient(t, db.Connect())
+			first := int64(w * 1000000)
+			next := first
+
+			for i := 0; i < STRESS_ROUNDS; i++ {
+				switch i % 6 {
+				case 0, 1:
+					c.mustRun(fmt.Sprintf("insert into t values (%d, %d, 0, 'row %d of client %d')", next, w, i, w))
+					next++
+					inserted[w]++
+				case 2:
+					if next > first {
+						id := first + int64(i)%(next-first)
+						if output := c.mustRun(fmt.Sprintf("update t set n = n + 1 where id = %d", id)); output != `{"rows_affected":1}` {
+							t.Errorf("client %d: updating row %d: %s", w, id, output)
+						}
+						updated[w]++
+					}
+				case 3:
+					// Both changes are kept, or neither
+					committed := c.transaction(
+						fmt.Sprintf("insert into t values (%d, %d, 1, 'in a transaction')", next, w),
+						fmt.Sprintf("update t set n = n + 1 where id = %d", first),
+					)
+					if committed {
+						next++
+						inserted[w]++
+						updated[w] += 2
+					}
+				case 4:
+					c.mustRun("begin")
+					c.mustRun(fmt.Sprintf("insert into t values (%d, %d, 0, 'rolled back')", next, w))
+					c.mustRun("rollback")
+				case 5:
+					c.number("select count(*) from t")
+					c.number(fmt.Sprintf("select count(*) from t where owner = %d", w))
+					// A transaction reads the same rows until it ends
+					c.mustRun("begin")
+					before := c.number("select count(*) from t")
+					c.number("select sum(n) from t")
+					after := c.number("select count(*) from t")
+					c.mustRun("commit")
+					if before != after {
+						t.Errorf("client %d: a transaction read %d and then %d rows", w, before, after)
+					}
+				}
+			}
+		}(w)
+	}
+
+	backups := make([]string, 0)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c := newConcurrentClient(t, db.Connect())
+		for i := 0; i < 4; i++ {
+			name := fmt.Sprintf("backup%d", i)
+			code := commands.NewNonStatementBackup(name).Execute(c.db, c)
+			if code != commands.SUCCESS {
+				t.Errorf("backup: %v", c.output)
+				return
+			}
+			backups = append(backups, filepath.Join(dir, name))
+			c.number("select count(*) from t")
+		}
+	}()
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	total := int64(0)
+	for w := 0; w < STRESS_CLIENTS; w++ {
+		total += inserted[w]
+		if count := setup.number(fmt.Sprintf("select count(*) from t where owner = %d", w)); count != inserted[w] {
+			t.Errorf("client %d inserted %d rows, %d are kept", w, inserted[w], count)
+		}
+		if sum := setup.number(fmt.Sprintf("select sum(n) from t where owner = %d", w)); sum != updated[w] {
+			t.Errorf("client %d added %d, the sum is %d", w, updated[w], sum)
+		}
+	}
+	if count := setup.number("select count(*) from t where note = 'rolled back'"); count != 0 {
+		t.Errorf("%d rolled back rows are kept", count)
+	}
+
+	for _, path := range backups {
+		err := paging.ValidateDatabaseFile(path)
+		if err != nil {
+			t.Fatalf("backup %s: %v", path, err)
+		}
+		backup, err := database.NewDatabase(path)
+		if err != nil {
+			t.Fatalf("backup %s: %v", path, err)
+		}
+		count := newClient(t, backup).number("select count(*) from t")
+		backup.Close()
+		if count < 0 || count > total {
+			t.Errorf("backup %s holds %d rows", path, count)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+const (
+	AGGREGATE_COUNT string = "count"
+	AGGREGATE_SUM   string = "sum"
+	AGGREGATE_AVG   string = "avg"
+	AGGREGATE_MIN   string = "min"
+	AGGREGATE_MAX   string = "max"
+)
+
+var aggregateFunctions = map[string]bool{
+	AGGREGATE_COUNT: true,
+	AGGREGATE_SUM:   true,
+	AGGREGATE_AVG:   true,
+	AGGREGATE_MIN:   true,
+	AGGREGATE_MAX:   true,
+}
+
+func IsAggregateFunction(name string) bool {
+	return aggregateFunctions[name]
+}
+
+/**
+ * Reports whether the expression calls an aggregate function.
+ */
+func ContainsAggregate(expr sql.Expr) bool {
+	found := false
+	sql.WalkExpr(expr, func(e sql.Expr) bool {
+		if call, ok := e.(*sql.FunctionCall); ok && IsAggregateFunction(call.Name) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+/**
+ * The accumulated value of an aggregate function over the rows of one group.
+ */
+type AggregateState interface {
+	Add(values []row.Value) error
+	Result() row.Value
+}
+
+/**
+ * A compiled aggregate function call.
+ */
+type Aggregate struct {
+	Call     *sql.FunctionCall
+	argument Evaluator
+}
+
+func CompileAggregate(call *sql.FunctionCall, scope *Scope) (*Aggregate, error) {
+	if call.Star {
+		if call.Name != AGGREGATE_COUNT {
+			return nil, fmt.Errorf("%s does not accept *", call.Name)
+		}
+		return &Aggregate{Call: call}, nil
+	}
+
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument, got %d", call.Name, len(call.Args))
+	}
+	if ContainsAggregate(call.Args[0]) {
+		return nil, fmt.Errorf("aggregate function calls cannot be nested: %s", call)
+	}
+
+	argument, err := Compile(call.Args[0], scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Aggregate{Call: call, argument: argument}, nil
+}
+
+func (a *Aggregate) NewState() AggregateState {
+	switch a.Call.Name {
+	case AGGREGATE_COUNT:
+		return &countState{aggregate: a}
+	case AGGREGATE_SUM:
+		return &sumState{aggregate: a}
+	case AGGREGATE_AVG:
+		return &avgState{aggregate: a}
+	case AGGREGATE_MIN:
+		return &extremeState{aggregate: a, sign: -1}
+	default:
+		return &extremeState{aggregate: a, sign: 1}
+	}
+}
+
+/**
+ * Evaluates the argument of the aggregate; the second return value
+ * is false when the value is NULL and should be skipped.
+ */
+func (a *Aggregate) argumentValue(values []row.Value) (row.Value, bool, error) {
+	value, err := a.argument(values)
+	if err != nil {
+		return row.Value{}, false, err
+	}
+	return value, !value.IsNull(), nil
+}
+
+type countState struct {
+	aggregate *Aggregate
+	count     int64
+}
+
+func (st *countState) Add(values []row.Value) error {
+	if st.aggregate.Call.Star {
+		st.count++
+		return nil
+	}
+
+	_, ok, err := st.aggregate.argumentValue(values)
+	if ok {
+		st.count++
+	}
+	return err
+}
+
+func (st *countState) Result() row.Value {
+	return row.NewIntValue(st.count)
+}
+
+/**
+ * Sums ints as ints, switching to floats once a float is added.
+ */
+type sumState struct {
+	aggregate *Aggregate
+	started   bool
+	isFloat   bool
+	intSum    int64
+	floatSum  float64
+}
+
+func (st *sumState) Add(values []row.Value) error {
+	value, ok, err := st.aggregate.argumentValue(values)
+	if err != nil || !ok {
+		return err
+	}
+	st.started = true
+
+	switch value.Type {
+	case row.TYPE_INT:
+		if st.isFloat {
+			st.floatSum += float64(value.Int)
+			return nil
+		}
+		sum := st.intSum + value.Int
+		if (value.Int > 0 && sum < st.intSum) || (value.Int < 0 && sum > st.intSum) {
+			return fmt.Errorf("integer overflow in %s", st.aggregate.Call)
+		}
+		st.intSum = sum
+	case row.TYPE_FLOAT:
+		if !st.isFloat {
+			st.isFloat = true
+			st.floatSum = float64(st.intSum)
+		}
+		st.floatSum += value.Float
+	default:
+		return fmt.Errorf("%s cannot add %s values", st.aggregate.Call.Name, value.Type)
+	}
+
+	return nil
+}
+
+func (st *sumState) Result() row.Value {
+	if !st.started {
+		return row.NewNullValue()
+	}
+	if st.isFloat {
+		return row.NewFloatValue(st.floatSum)
+	}
+	return row.NewIntValue(st.intSum)
+}
+
+type avgState struct {
+	aggregate *Aggregate
+	count     int64
+	sum       float64
+}
+
+func (st *avgState) Add(values []row.Value) error {
+	value, ok, err := st.aggregate.argumentValue(values)
+	if err != nil || !ok {
+		return err
+	}
+
+	switch value.Type {
+	case row.TYPE_INT:
+		st.sum += float64(value.Int)
+	case row.TYPE_FLOAT:
+		st.sum += value.Float
+	default:
+		return fmt.Errorf("%s cannot average %s values", st.aggregate.Call.Name, value.Type)
+	}
+	st.count++
+
+	return nil
+}
+
+func (st *avgState) Result() row.Value {
+	if st.count == 0 {
+		return row.NewNullValue()
+	}
+	return row.NewFloatValue(st.sum / float64(st.count))
+}
+
+/**
+ * Keeps the smallest (sign -1) or the largest (sign 1) value.
+ */
+type extremeState struct {
+	aggregate *Aggregate
+	sign      int
+	value     row.Value
+}
+
+func (st *extremeState) Add(values []row.Value) error {
+	value, ok, err := st.aggregate.argumentValue(values)
+	if err != nil || !ok {
+		return err
+	}
+
+	if st.value.IsNull() {
+		st.value = value
+		return nil
+	}
+
+	cmp, err := row.CompareValues(value, st.value)
+	if err != nil {
+		return err
+	}
+	if cmp == st.sign {
+		st.value = value
+	}
+
+	return nil
+}
+
+func (st *extremeState) Result() row.Value {
+	return st.value
+}
+
+/**
+ * Groups rows by the values of the group by expressions in a hash table and
+ * accumulates the aggregates of every group. Every result row holds the group
+ * by values followed by the aggregate results. Without group by expressions,
+ * all rows form a single group, which exists even if no rows were added.
+ */
+type HashAggregation struct {
+	groupBy    []Evaluator
+	aggregates []*Aggregate
+	groups     map[string]int
+	keys       [][]row.Value
+	states     [][]AggregateState
+	keyValues  []row.Value
+	keyBytes   []byte
+}
+
+func NewHashAggregation(groupBy []Evaluator, aggregates []*Aggregate) *HashAggregation {
+	h := &HashAggregation{
+		groupBy:    groupBy,
+		aggregates: aggregates,
+		groups:     make(map[string]int),
+		keys:       make([][]row.Value, 0),
+		states:     make([][]AggregateState, 0),
+		keyValues:  make([]row.Value, len(groupBy)),
+	}
+
+	if len(groupBy) == 0 {
+		h.addGroup(string(serialization.AppendTuple(nil, nil)), nil)
+	}
+
+	return h
+}
+
+func (h *HashAggregation) addGroup(key string, values []row.Value) int {
+	states := make([]AggregateState, len(h.aggregates))
+	for i, aggregate := range h.aggregates {
+		states[i] = aggregate.NewState()
+	}
+
+	h.groups[key] = len(h.keys)
+	h.keys = append(h.keys, values)
+	h.states = append(h.states, states)
+	return len(h.keys) - 1
+}
+
+func (h *HashAggregation) Add(values []row.Value) error {
+	for i, evaluator := range h.groupBy {
+		var err error
+		h.keyValues[i], err = evaluator(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	// NULLs are encoded like any other value, so they all fall into one group
+	h.keyBytes = serialization.AppendTuple(h.keyBytes[:0], h.keyValues)
+	group, exists := h.groups[string(h.keyBytes)]
+	if !exists {
+		groupValues := make([]row.Value, len(h.keyValues))
+		copy(groupValues, h.keyValues)
+		group = h.addGroup(string(h.keyBytes), groupValues)
+	}
+
+	for _, state := range h.states[group] {
+		err := state.Add(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/**
+ * Returns the aggregated rows, in the order in which their groups were first seen.
+ */
+func (h *HashAggregation) Results() [][]row.Value {
+	results := make([][]row.Value, len(h.keys))
+	for i, key := range h.keys {
+		result := make([]row.Value, 0, len(key)+len(h.aggregates))
+		result = append(result, key...)
+		for _, state := range h.states[i] {
+			result = append(result, state.Result())
+		}
+		results[i] = result
+	}
+
+	return results
+}
+
+/**
+ * Rewrites the expressions evaluated after grouping (the select list, having
+ * and order by) so that they read the aggregated rows: group by expressions
+ * and aggregate calls are replaced with references to the columns of the
+ * aggregated rows. Aggregate calls are collected while rewriting.
+ * The columns of the aggregated rows are named after the expressions they
+ * hold, so rewritten expressions still read like the original ones.
+ */
+type Grouping struct {
+	scope          *Scope
+	GroupBy        []sql.Expr
+	Aggregates     []*sql.FunctionCall
+	groupByColumns []int
+}
+
+func NewGrouping(groupBy []sql.Expr, scope *Scope) (*Grouping, error) {
+	g := &Grouping{
+		scope:          scope,
+		GroupBy:        make([]sql.Expr, 0, len(groupBy)),
+		Aggregates:     make([]*sql.FunctionCall, 0),
+		groupByColumns: make([]int, 0, len(groupBy)),
+	}
+
+	for _, expr := range groupBy {
+		if ContainsAggregate(expr) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in GROUP BY: %s", expr)
+		}
+
+		// grouping by the same expression twice does not change the groups
+		i, err := g.groupByIndex(expr)
+		if err != nil {
+			return nil, err
+		}
+		if i >= 0 {
+			continue
+		}
+
+		column := -1
+		if ref, ok := expr.(*sql.ColumnRef); ok {
+			column, err = scope.Resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+		}
+		g.GroupBy = append(g.GroupBy, expr)
+		g.groupByColumns = append(g.groupByColumns, column)
+	}
+
+	return g, nil
+}
+
+/**
+ * A grouped column keeps its name and table; any other
+ * group by expression is named after the expression.
+ */
+func (g *Grouping) groupColumn(i int) *sql.ColumnRef {
+	if column := g.groupByColumns[i]; column >= 0 {
+		return &sql.ColumnRef{Table: g.scope.Columns[column].Table, Name: g.scope.Columns[column].Name}
+	}
+	return &sql.ColumnRef{Name: g.GroupBy[i].String()}
+}
+
+func (g *Grouping) aggregateColumn(i int) *sql.ColumnRef {
+	return &sql.ColumnRef{Name: g.Aggregates[i].String()}
+}
+
+func (g *Grouping) groupByIndex(expr sql.Expr) (int, error) {
+	if ref, ok := expr.(*sql.ColumnRef); ok {
+		ind, err := g.scope.Resolve(ref)
+		if err != nil {
+			return -1, err
+		}
+		for i, column := range g.groupByColumns {
+			if column == ind {
+				return i, nil
+			}
+		}
+		return -1, nil
+	}
+
+	for i, groupExpr := range g.GroupBy {
+		if groupExpr.String() == expr.String() {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (g *Grouping) Rewrite(expr sql.Expr) (sql.Expr, error) {
+	return sql.TransformExpr(expr, func(e sql.Expr) (sql.Expr, bool, error) {
+		i, err := g.groupByIndex(e)
+		if err != nil {
+			return nil, false, err
+		}
+		if i >= 0 {
+			return g.groupColumn(i), true, nil
+		}
+
+		switch e := e.(type) {
+		case *sql.FunctionCall:
+			if !IsAggregateFunction(e.Name) {
+				return nil, false, nil
+			}
+			for j, aggregate := range g.Aggregates {
+				if aggregate.String() == e.String() {
+					return g.aggregateColumn(j), true, nil
+				}
+			}
+			g.Aggregates = append(g.Aggregates, e)
+			return g.aggregateColumn(len(g.Aggregates) - 1), true, nil
+		case *sql.ColumnRef:
+			return nil, false, fmt.Errorf("column %s must appear in the GROUP BY clause or be used in an aggregate function", e)
+		}
+
+		return nil, false, nil
+	})
+}
+
+/**
+ * The scope of the aggregated rows. Only expressions returned by Rewrite
+ * can be resolved in it.
+ */
+func (g *Grouping) Scope() *Scope {
+	columns := make([]ColumnBinding, 0, len(g.GroupBy)+len(g.Aggregates))
+	for i, column := range g.groupByColumns {
+		ref := g.groupColumn(i)
+		binding := ColumnBinding{Table: ref.Table, Name: ref.Name, Type: row.TYPE_NULL}
+		if column >= 0 {
+			binding.Type = g.scope.Columns[column].Type
+		}
+		columns = append(columns, binding)
+	}
+	for i := range g.Aggregates {
+		columns = append(columns, ColumnBinding{Name: g.aggregateColumn(i).Name, Type: row.TYPE_NULL})
+	}
+
+	return NewScope(columns)
+}
+
+/**
+ * Compiles the aggregation of the grouping against its input scope.
+ * Must be called after all the expressions have been rewritten.
+ */
+func (g *Grouping) NewHashAggregation() (*HashAggregation, error) {
+	groupBy := make([]Evaluator, len(g.GroupBy))
+	for i, expr := range g.GroupBy {
+		var err error
+		groupBy[i], err = Compile(expr, g.scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aggregates := make([]*Aggregate, len(g.Aggregates))
+	for i, call := range g.Aggregates {
+		var err error
+		aggregates[i], err = CompileAggregate(call, g.scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewHashAggregation(groupBy, aggregates), nil
+}
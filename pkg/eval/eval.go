@@ -0,0 +1,507 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * A compiled expression. Column references are resolved at compile time,
+ * so evaluating only indexes into the given values.
+ */
+type Evaluator func(values []row.Value) (row.Value, error)
+
+/**
+ * Resolves the column references of the expression against the scope
+ * and returns its evaluator. NULL propagates through all operators
+ * following SQL three-valued logic.
+ */
+func Compile(expr sql.Expr, scope *Scope) (Evaluator, error) {
+	switch e := expr.(type) {
+	case *sql.Literal:
+		value := e.Value
+		return func(values []row.Value) (row.Value, error) {
+			return value, nil
+		}, nil
+	case *sql.Parameter:
+		// the value is read when evaluated, to see the latest binding
+		return func(values []row.Value) (row.Value, error) {
+			return e.Value, nil
+		}, nil
+	case *sql.ColumnRef:
+		ind, err := scope.Resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		return func(values []row.Value) (row.Value, error) {
+			return values[ind], nil
+		}, nil
+	case *sql.UnaryExpr:
+		return compileUnary(e, scope)
+	case *sql.BinaryExpr:
+		return compileBinary(e, scope)
+	case *sql.IsNullExpr:
+		return compileIsNull(e, scope)
+	case *sql.LikeExpr:
+		return compileLike(e, scope)
+	case *sql.InExpr:
+		return compileIn(e, scope)
+	case *sql.BetweenExpr:
+		return compileBetween(e, scope)
+	case *sql.FunctionCall:
+		if IsAggregateFunction(e.Name) {
+			return nil, fmt.Errorf("aggregate function %s is not allowed here", e)
+		}
+		return nil, fmt.Errorf("unknown function %s", e.Name)
+	default:
+		return nil, fmt.Errorf("unsupported expression %s", expr)
+	}
+}
+
+/**
+ * Compiles an expression used as a condition, e.g. in a where clause.
+ */
+func CompilePredicate(expr sql.Expr, scope *Scope) (func(values []row.Value) (bool, error), error) {
+	evaluator, err := Compile(expr, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values []row.Value) (bool, error) {
+		value, err := evaluator(values)
+		if err != nil {
+			return false, err
+		}
+		if !value.IsNull() && value.Type != row.TYPE_BOOL {
+			return false, fmt.Errorf("condition %s is not a boolean", expr)
+		}
+		return IsTrue(value), nil
+	}, nil
+}
+
+/**
+ * Evaluates an expression which does not reference any column.
+ */
+func EvaluateConstant(expr sql.Expr) (row.Value, error) {
+	evaluator, err := Compile(expr, NewScope(nil))
+	if err != nil {
+		return row.Value{}, err
+	}
+
+	return evaluator(nil)
+}
+
+func IsTrue(v row.Value) bool {
+	return v.Type == row.TYPE_BOOL && v.Bool
+}
+
+func toBool(v row.Value, expr sql.Expr) (row.Value, error) {
+	if !v.IsNull() && v.Type != row.TYPE_BOOL {
+		return row.Value{}, fmt.Errorf("%s is not a boolean", expr)
+	}
+	return v, nil
+}
+
+func compileUnary(e *sql.UnaryExpr, scope *Scope) (Evaluator, error) {
+	operand, err := Compile(e.Operand, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		v, err := operand(values)
+		if err != nil || v.IsNull() {
+			return v, err
+		}
+
+		switch e.Operator {
+		case "NOT":
+			v, err = toBool(v, e.Operand)
+			if err != nil {
+				return v, err
+			}
+			return row.NewBoolValue(!v.Bool), nil
+		case "-":
+			if v.Type == row.TYPE_INT {
+				return row.NewIntValue(-v.Int), nil
+			} else if v.Type == row.TYPE_FLOAT {
+				return row.NewFloatValue(-v.Float), nil
+			}
+		case "+":
+			if v.Type == row.TYPE_INT || v.Type == row.TYPE_FLOAT {
+				return v, nil
+			}
+		}
+
+		return row.Value{}, fmt.Errorf("operator %s cannot be applied to a %s value", e.Operator, v.Type)
+	}, nil
+}
+
+func compileBinary(e *sql.BinaryExpr, scope *Scope) (Evaluator, error) {
+	left, err := Compile(e.Left, scope)
+	if err != nil {
+		return nil, err
+	}
+	right, err := Compile(e.Right, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Operator {
+	case "AND":
+		return func(values []row.Value) (row.Value, error) {
+			l, err := left(values)
+			if err != nil {
+				return l, err
+			}
+			if l, err = toBool(l, e.Left); err != nil {
+				return l, err
+			}
+			// false AND anything is false, even if the right side is NULL
+			if !l.IsNull() && !l.Bool {
+				return l, nil
+			}
+
+			r, err := right(values)
+			if err != nil {
+				return r, err
+			}
+			if r, err = toBool(r, e.Right); err != nil {
+				return r, err
+			}
+			if !r.IsNull() && !r.Bool {
+				return r, nil
+			}
+			if l.IsNull() || r.IsNull() {
+				return row.NewNullValue(), nil
+			}
+			return row.NewBoolValue(true), nil
+		}, nil
+	case "OR":
+		return func(values []row.Value) (row.Value, error) {
+			l, err := left(values)
+			if err != nil {
+				return l, err
+			}
+			if l, err = toBool(l, e.Left); err != nil {
+				return l, err
+			}
+			// true OR anything is true, even if the right side is NULL
+			if IsTrue(l) {
+				return l, nil
+			}
+
+			r, err := right(values)
+			if err != nil {
+				return r, err
+			}
+			if r, err = toBool(r, e.Right); err != nil {
+				return r, err
+			}
+			if IsTrue(r) {
+				return r, nil
+			}
+			if l.IsNull() || r.IsNull() {
+				return row.NewNullValue(), nil
+			}
+			return row.NewBoolValue(false), nil
+		}, nil
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		l, err := left(values)
+		if err != nil {
+			return l, err
+		}
+		r, err := right(values)
+		if err != nil {
+			return r, err
+		}
+		if l.IsNull() || r.IsNull() {
+			return row.NewNullValue(), nil
+		}
+
+		return applyBinaryOperator(e.Operator, l, r)
+	}, nil
+}
+
+func applyBinaryOperator(operator string, l row.Value, r row.Value) (row.Value, error) {
+	switch operator {
+	case "=", "<>", "<", "<=", ">", ">=":
+		cmp, err := row.CompareValues(l, r)
+		if err != nil {
+			return row.Value{}, err
+		}
+		return row.NewBoolValue(comparisonHolds(operator, cmp)), nil
+	case "||":
+		if l.Type != row.TYPE_TEXT || r.Type != row.TYPE_TEXT {
+			return row.Value{}, fmt.Errorf("operator || cannot be applied to %s and %s values", l.Type, r.Type)
+		}
+		return row.NewTextValue(l.Text + r.Text), nil
+	default:
+		return applyArithmeticOperator(operator, l, r)
+	}
+}
+
+func comparisonHolds(operator string, cmp int) bool {
+	switch operator {
+	case "=":
+		return cmp == 0
+	case "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func applyArithmeticOperator(operator string, l row.Value, r row.Value) (row.Value, error) {
+	isNumeric := func(v row.Value) bool {
+		return v.Type == row.TYPE_INT || v.Type == row.TYPE_FLOAT
+	}
+	if !isNumeric(l) || !isNumeric(r) {
+		return row.Value{}, fmt.Errorf("operator %s cannot be applied to %s and %s values", operator, l.Type, r.Type)
+	}
+
+	if l.Type == row.TYPE_INT && r.Type == row.TYPE_INT {
+		switch operator {
+		case "+":
+			return row.NewIntValue(l.Int + r.Int), nil
+		case "-":
+			return row.NewIntValue(l.Int - r.Int), nil
+		case "*":
+			return row.NewIntValue(l.Int * r.Int), nil
+		case "/", "%":
+			if r.Int == 0 {
+				return row.Value{}, fmt.Errorf("division by zero")
+			}
+			if operator == "/" {
+				return row.NewIntValue(l.Int / r.Int), nil
+			}
+			return row.NewIntValue(l.Int % r.Int), nil
+		}
+	}
+
+	lf, rf := toFloat(l), toFloat(r)
+	switch operator {
+	case "+":
+		return row.NewFloatValue(lf + rf), nil
+	case "-":
+		return row.NewFloatValue(lf - rf), nil
+	case "*":
+		return row.NewFloatValue(lf * rf), nil
+	case "/":
+		if rf == 0 {
+			return row.Value{}, fmt.Errorf("division by zero")
+		}
+		return row.NewFloatValue(lf / rf), nil
+	case "%":
+		if rf == 0 {
+			return row.Value{}, fmt.Errorf("division by zero")
+		}
+		return row.NewFloatValue(math.Mod(lf, rf)), nil
+	}
+
+	return row.Value{}, fmt.Errorf("unknown operator %s", operator)
+}
+
+func toFloat(v row.Value) float64 {
+	if v.Type == row.TYPE_INT {
+		return float64(v.Int)
+	}
+	return v.Float
+}
+
+func compileIsNull(e *sql.IsNullExpr, scope *Scope) (Evaluator, error) {
+	operand, err := Compile(e.Operand, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		v, err := operand(values)
+		if err != nil {
+			return v, err
+		}
+		return row.NewBoolValue(v.IsNull() != e.Not), nil
+	}, nil
+}
+
+func compileLike(e *sql.LikeExpr, scope *Scope) (Evaluator, error) {
+	operand, err := Compile(e.Operand, scope)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := Compile(e.Pattern, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		v, err := operand(values)
+		if err != nil {
+			return v, err
+		}
+		p, err := pattern(values)
+		if err != nil {
+			return p, err
+		}
+		if v.IsNull() || p.IsNull() {
+			return row.NewNullValue(), nil
+		}
+		if v.Type != row.TYPE_TEXT || p.Type != row.TYPE_TEXT {
+			return row.Value{}, fmt.Errorf("LIKE can only be applied to text values")
+		}
+
+		return row.NewBoolValue(MatchLike(v.Text, p.Text) != e.Not), nil
+	}, nil
+}
+
+/**
+ * Matches text against a LIKE pattern, where % matches any sequence
+ * of characters and _ matches a single character.
+ */
+func MatchLike(text string, pattern string) bool {
+	t := []rune(text)
+	p := []rune(pattern)
+
+	// position in the text and the pattern after the last %, for backtracking
+	starT, starP := -1, -1
+	i, j := 0, 0
+	for i < len(t) {
+		if j < len(p) && (p[j] == '_' || p[j] == t[i]) {
+			i++
+			j++
+		} else if j < len(p) && p[j] == '%' {
+			starP = j
+			starT = i
+			j++
+		} else if starP >= 0 {
+			starT++
+			i = starT
+			j = starP + 1
+		} else {
+			return false
+		}
+	}
+
+	for j < len(p) && p[j] == '%' {
+		j++
+	}
+	return j == len(p)
+}
+
+func compileIn(e *sql.InExpr, scope *Scope) (Evaluator, error) {
+	operand, err := Compile(e.Operand, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Evaluator, len(e.List))
+	for i, item := range e.List {
+		list[i], err = Compile(item, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		v, err := operand(values)
+		if err != nil || v.IsNull() {
+			return row.NewNullValue(), err
+		}
+
+		sawNull := false
+		for _, item := range list {
+			itemValue, err := item(values)
+			if err != nil {
+				return itemValue, err
+			}
+			if itemValue.IsNull() {
+				sawNull = true
+				continue
+			}
+
+			cmp, err := row.CompareValues(v, itemValue)
+			if err != nil {
+				return row.Value{}, err
+			}
+			if cmp == 0 {
+				return row.NewBoolValue(!e.Not), nil
+			}
+		}
+
+		// x IN (..., NULL) is NULL rather than false when there is no match
+		if sawNull {
+			return row.NewNullValue(), nil
+		}
+		return row.NewBoolValue(e.Not), nil
+	}, nil
+}
+
+func compileBetween(e *sql.BetweenExpr, scope *Scope) (Evaluator, error) {
+	operand, err := Compile(e.Operand, scope)
+	if err != nil {
+		return nil, err
+	}
+	low, err := Compile(e.Low, scope)
+	if err != nil {
+		return nil, err
+	}
+	high, err := Compile(e.High, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(values []row.Value) (row.Value, error) {
+		v, err := operand(values)
+		if err != nil {
+			return v, err
+		}
+		l, err := low(values)
+		if err != nil {
+			return l, err
+		}
+		h, err := high(values)
+		if err != nil {
+			return h, err
+		}
+		if v.IsNull() {
+			return row.NewNullValue(), nil
+		}
+
+		// x BETWEEN l AND h is (x >= l AND x <= h), so a NULL bound
+		// only makes the result NULL if the other bound holds
+		aboveLow, err := holdsOrNull(">=", v, l)
+		if err != nil {
+			return row.Value{}, err
+		}
+		belowHigh, err := holdsOrNull("<=", v, h)
+		if err != nil {
+			return row.Value{}, err
+		}
+
+		if (!aboveLow.IsNull() && !aboveLow.Bool) || (!belowHigh.IsNull() && !belowHigh.Bool) {
+			return row.NewBoolValue(e.Not), nil
+		}
+		if aboveLow.IsNull() || belowHigh.IsNull() {
+			return row.NewNullValue(), nil
+		}
+		return row.NewBoolValue(!e.Not), nil
+	}, nil
+}
+
+func holdsOrNull(operator string, l row.Value, r row.Value) (row.Value, error) {
+	if l.IsNull() || r.IsNull() {
+		return row.NewNullValue(), nil
+	}
+	return applyBinaryOperator(operator, l, r)
+}
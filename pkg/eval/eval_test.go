@@ -0,0 +1,153 @@
+package eval_test
+
+import (
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+var (
+	TRUE    = row.NewBoolValue(true)
+	FALSE   = row.NewBoolValue(false)
+	UNKNOWN = row.NewNullValue()
+)
+
+/**
+ * The row the expressions are evaluated against: a is 1, s is 'abc',
+ * and n and z are NULL.
+ */
+var testScope = eval.NewScope([]eval.ColumnBinding{
+	{Table: "t", Name: "a", Type: row.TYPE_INT},
+	{Table: "t", Name: "n", Type: row.TYPE_INT},
+	{Table: "t", Name: "s", Type: row.TYPE_TEXT},
+	{Table: "t", Name: "z", Type: row.TYPE_TEXT},
+})
+
+var testValues = []row.Value{
+	row.NewIntValue(1),
+	row.NewNullValue(),
+	row.NewTextValue("abc"),
+	row.NewNullValue(),
+}
+
+/**
+ * Parses the expression as the where clause of a select.
+ */
+func parseExpr(t *testing.T, input string) sql.Expr {
+	statement, err := sql.Parse("select * from t where " + input)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return statement.(*sql.SelectStatement).Where
+}
+
+func sameValue(a row.Value, b row.Value) bool {
+	if a.IsNull() || b.IsNull() {
+		return a.IsNull() && b.IsNull()
+	}
+	compared, err := row.CompareValues(a, b)
+	return err == nil && a.Type == b.Type && compared == 0
+}
+
+func TestThreeValuedLogic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected row.Value
+	}{
+		{"a = 1", TRUE},
+		{"n = 1", UNKNOWN},
+		{"n = n", UNKNOWN},
+		{"n <> 1", UNKNOWN},
+		{"n < 1", UNKNOWN},
+		{"1 >= n", UNKNOWN},
+		{"z = 'abc'", UNKNOWN},
+		{"n is null", TRUE},
+		{"n is not null", FALSE},
+		{"a is null", FALSE},
+		{"not n = 1", UNKNOWN},
+		{"not a = 1", FALSE},
+
+		{"n = 1 and false", FALSE},
+		{"false and n = 1", FALSE},
+		{"n = 1 and true", UNKNOWN},
+		{"n = 1 and n = 2", UNKNOWN},
+		{"n = 1 or true", TRUE},
+		{"true or n = 1", TRUE},
+		{"n = 1 or false", UNKNOWN},
+		{"n = 1 or n = 2", UNKNOWN},
+
+		{"a in (1, null)", TRUE},
+		{"a in (2, null)", UNKNOWN},
+		{"a in (2, 3)", FALSE},
+		{"a not in (1, null)", FALSE},
+		{"a not in (2, null)", UNKNOWN},
+		{"a not in (2, 3)", TRUE},
+		{"n in (1, 2)", UNKNOWN},
+		{"n not in (1, 2)", UNKNOWN},
+		{"n in (null)", UNKNOWN},
+
+		{"a between 0 and 2", TRUE},
+		{"a between n and 2", UNKNOWN},
+		{"a between 2 and n", FALSE},
+		{"a not between 2 and n", TRUE},
+		{"a not between n and 2", UNKNOWN},
+		{"n between 0 and 2", UNKNOWN},
+
+		{"s like 'a%'", TRUE},
+		{"z like 'a%'", UNKNOWN},
+		{"z not like 'a%'", UNKNOWN},
+
+		{"n + 1", UNKNOWN},
+		{"-n", UNKNOWN},
+		{"s || z", UNKNOWN},
+		{"(n + 1) * 0 = 0", UNKNOWN},
+	}
+
+	for _, test := range tests {
+		evaluator, err := eval.Compile(parseExpr(t, test.input), testScope)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		value, err := evaluator(testValues)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if !sameValue(value, test.expected) {
+			t.Errorf("%s: got %s, expected %s", test.input, value.ToString(), test.expected.ToString())
+		}
+	}
+}
+
+/**
+ * A condition holds only when it is true: a row for which it is unknown
+ * is filtered out, whether the condition is negated or not.
+ */
+func TestPredicateOfUnknown(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"a = 1", true},
+		{"n = 1", false},
+		{"not n = 1", false},
+		{"a not in (2, null)", false},
+		{"not a in (2, null)", false},
+		{"n is null", true},
+	}
+
+	for _, test := range tests {
+		predicate, err := eval.CompilePredicate(parseExpr(t, test.input), testScope)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		holds, err := predicate(testValues)
+		if err != nil || holds != test.expected {
+			t.Errorf("%s: got %v %v, expected %v", test.input, holds, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+type ColumnBinding struct {
+	Table string
+	Name  string
+	Type  row.ColumnType
+}
+
+/**
+ * The columns visible to an expression, in the order of the values
+ * the expression is evaluated against.
+ */
+type Scope struct {
+	Columns []ColumnBinding
+}
+
+func NewScope(columns []ColumnBinding) *Scope {
+	return &Scope{
+		Columns: columns,
+	}
+}
+
+func NewTableScope(tableName string, schema *row.Schema) *Scope {
+	columns := make([]ColumnBinding, len(schema.Columns))
+	for i, column := range schema.Columns {
+		columns[i] = ColumnBinding{
+			Table: tableName,
+			Name:  column.Name,
+			Type:  column.Type,
+		}
+	}
+
+	return NewScope(columns)
+}
+
+/**
+ * Returns the index of the referenced column. Unqualified names must
+ * match exactly one column.
+ */
+func (s *Scope) Resolve(ref *sql.ColumnRef) (int, error) {
+	found := -1
+	for i, column := range s.Columns {
+		if column.Name != ref.Name || (ref.Table != "" && column.Table != ref.Table) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("column reference %s is ambiguous", ref)
+		}
+		found = i
+	}
+
+	if found < 0 {
+		return -1, fmt.Errorf("column %s does not exist", ref)
+	}
+
+	return found, nil
+}
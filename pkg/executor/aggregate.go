@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Groups the rows of its child with a hash aggregation. Every returned row
+ * holds the group by values followed by the aggregate results, as described
+ * by the scope of the grouping.
+ */
+type Aggregate struct {
+	Child    Operator
+	Grouping *eval.Grouping
+	results  [][]row.Value
+	pos      int
+}
+
+/**
+ * The grouping must have been created over the scope of the child,
+ * and all the expressions reading the groups already rewritten by it.
+ */
+func NewAggregate(child Operator, grouping *eval.Grouping) *Aggregate {
+	aggregate := &Aggregate{
+		Child:    child,
+		Grouping: grouping,
+	}
+
+	return aggregate
+}
+
+/**
+ * Consumes all the rows of the child.
+ */
+func (a *Aggregate) Open() error {
+	aggregation, err := a.Grouping.NewHashAggregation()
+	if err != nil {
+		return err
+	}
+
+	err = a.Child.Open()
+	if err != nil {
+		return err
+	}
+
+	for {
+		values, ok, err := a.Child.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		err = aggregation.Add(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.results = aggregation.Results()
+	a.pos = 0
+	return nil
+}
+
+func (a *Aggregate) Next() ([]row.Value, bool, error) {
+	if a.pos >= len(a.results) {
+		return nil, false, nil
+	}
+	a.pos++
+	return a.results[a.pos-1], true, nil
+}
+
+func (a *Aggregate) Close() error {
+	a.results = nil
+	return a.Child.Close()
+}
+
+func (a *Aggregate) Scope() *eval.Scope {
+	return a.Grouping.Scope()
+}
+
+func (a *Aggregate) Explain() Explanation {
+	details := map[string]string{}
+	if len(a.Grouping.GroupBy) > 0 {
+		details["group_by"] = joinExprs(a.Grouping.GroupBy)
+	}
+	aggregates := make([]sql.Expr, len(a.Grouping.Aggregates))
+	for i, call := range a.Grouping.Aggregates {
+		aggregates[i] = call
+	}
+	if len(aggregates) > 0 {
+		details["aggregates"] = joinExprs(aggregates)
+	}
+	return Explanation{Name: "HashAggregate", Details: details, Children: []Operator{a.Child}}
+}
@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * What EXPLAIN shows about an operator: its name, the details of what it
+ * does (e.g. the table and key range of a scan), and its child operators.
+ */
+type Explanation struct {
+	Name     string
+	Details  map[string]string
+	Children []Operator
+}
+
+func joinExprs(exprs []sql.Expr) string {
+	parts := make([]string, len(exprs))
+	for i, expr := range exprs {
+		parts[i] = expr.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+/**
+ * Wraps an operator to measure its execution for EXPLAIN ANALYZE: how many
+ * times it was opened, how many rows it produced, and the time spent and
+ * pages read in its calls. The time and pages include those of its children.
+ * The pages are counted by the context the plan reads through, so reads
+ * of other connections are not included.
+ */
+type Instrumented struct {
+	Operator
+	Loops   int64
+	Rows    int64
+	Elapsed time.Duration
+	Pages   paging.PageReadStats
+	context *paging.Context
+}
+
+func NewInstrumented(op Operator, context *paging.Context) *Instrumented {
+	instrumented := &Instrumented{
+		Operator: op,
+		context:  context,
+	}
+
+	return instrumented
+}
+
+func (i *Instrumented) measure(call func()) {
+	pagesBefore := i.context.ReadStats()
+	start := time.Now()
+
+	call()
+
+	i.Elapsed += time.Since(start)
+	pagesAfter := i.context.ReadStats()
+	i.Pages.DiskReads += pagesAfter.DiskReads - pagesBefore.DiskReads
+	i.Pages.CacheHits += pagesAfter.CacheHits - pagesBefore.CacheHits
+}
+
+func (i *Instrumented) SetOuter(values []row.Value) {
+	if correlated, ok := i.Operator.(Correlated); ok {
+		correlated.SetOuter(values)
+	}
+}
+
+func (i *Instrumented) Open() error {
+	var err error
+	i.measure(func() {
+		err = i.Operator.Open()
+	})
+	i.Loops++
+	return err
+}
+
+func (i *Instrumented) Next() ([]row.Value, bool, error) {
+	var values []row.Value
+	var ok bool
+	var err error
+	i.measure(func() {
+		values, ok, err = i.Operator.Next()
+	})
+	if ok {
+		i.Rows++
+	}
+	return values, ok, err
+}
+
+func (i *Instrumented) Close() error {
+	var err error
+	i.measure(func() {
+		err = i.Operator.Close()
+	})
+	return err
+}
+
+/**
+ * The measured execution of an operator, shown by EXPLAIN ANALYZE.
+ */
+type ActualStats struct {
+	ActualRows     int64   `json:"actual_rows"`
+	Loops          int64   `json:"loops"`
+	PagesFromDisk  uint64  `json:"pages_from_disk"`
+	PagesFromCache uint64  `json:"pages_from_cache"`
+	TimeMs         float64 `json:"time_ms"`
+}
+
+/**
+ * What the planner expects of an operator: the number of rows it produces,
+ * and the cost of producing them, including the cost of its children.
+ * Costs are in units of reading a page.
+ */
+type Estimate struct {
+	Rows float64
+	Cost float64
+}
+
+/**
+ * A node of the operator tree shown by EXPLAIN. The actual stats are
+ * only present for instrumented operators.
+ */
+type PlanNode struct {
+	Operator      string            `json:"operator"`
+	Details       map[string]string `json:"details,omitempty"`
+	EstimatedRows int64             `json:"estimated_rows"`
+	EstimatedCost float64           `json:"estimated_cost"`
+	*ActualStats
+	Children []*PlanNode `json:"children,omitempty"`
+}
+
+/**
+ * Describes the operator tree, with the numbers of rows the planner
+ * expected each operator to produce and at what cost.
+ */
+func Describe(op Operator, estimates map[Operator]Estimate) *PlanNode {
+	explanation := op.Explain()
+	node := &PlanNode{
+		Operator:      explanation.Name,
+		Details:       explanation.Details,
+		EstimatedRows: int64(math.Round(estimates[op].Rows)),
+		EstimatedCost: math.Round(estimates[op].Cost*100) / 100,
+		Children:      make([]*PlanNode, len(explanation.Children)),
+	}
+
+	if instrumented, ok := op.(*Instrumented); ok {
+		node.ActualStats = &ActualStats{
+			ActualRows:     instrumented.Rows,
+			Loops:          instrumented.Loops,
+			PagesFromDisk:  instrumented.Pages.DiskReads,
+			PagesFromCache: instrumented.Pages.CacheHits,
+			TimeMs:         math.Round(float64(instrumented.Elapsed.Microseconds())) / 1000,
+		}
+	}
+
+	for i, child := range explanation.Children {
+		node.Children[i] = Describe(child, estimates)
+	}
+
+	return node
+}
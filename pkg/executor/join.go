@@ -0,0 +1,340 @@
+package executor
+
+import (
+	"math"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+func joinScope(left Operator, right Operator) *eval.Scope {
+	columns := make([]eval.ColumnBinding, 0, len(left.Scope().Columns)+len(right.Scope().Columns))
+	columns = append(columns, left.Scope().Columns...)
+	columns = append(columns, right.Scope().Columns...)
+	return eval.NewScope(columns)
+}
+
+func joinType(leftOuter bool) string {
+	if leftOuter {
+		return "left"
+	}
+	return "inner"
+}
+
+/**
+ * Joins every row of the left (outer) side with the rows of the right (inner)
+ * side, which is reopened for every outer row. If the inner side is Correlated,
+ * it is given the outer row first, e.g. to seek the matching rows by key.
+ * A nil condition joins every pair of rows. A left outer join also returns
+ * every outer row without a match, padded with NULLs.
+ */
+type NestedLoopJoin struct {
+	Left      Operator
+	Right     Operator
+	Condition sql.Expr
+	LeftOuter bool
+	predicate func(values []row.Value) (bool, error)
+	scope     *eval.Scope
+	outer     []row.Value
+	innerOpen bool
+	matched   bool
+	values    []row.Value
+}
+
+func NewNestedLoopJoin(left Operator, right Operator, condition sql.Expr, leftOuter bool) (*NestedLoopJoin, error) {
+	join := &NestedLoopJoin{
+		Left:      left,
+		Right:     right,
+		Condition: condition,
+		LeftOuter: leftOuter,
+		scope:     joinScope(left, right),
+	}
+
+	if condition != nil {
+		var err error
+		join.predicate, err = eval.CompilePredicate(condition, join.scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return join, nil
+}
+
+func (j *NestedLoopJoin) Open() error {
+	j.innerOpen = false
+	return j.Left.Open()
+}
+
+func (j *NestedLoopJoin) Next() ([]row.Value, bool, error) {
+	for {
+		if !j.innerOpen {
+			outer, ok, err := j.Left.Next()
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			j.outer = outer
+
+			if correlated, ok := j.Right.(Correlated); ok {
+				correlated.SetOuter(outer)
+			}
+			err = j.Right.Open()
+			if err != nil {
+				return nil, false, err
+			}
+			j.innerOpen = true
+			j.matched = false
+		}
+
+		inner, ok, err := j.Right.Next()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !ok {
+			j.innerOpen = false
+			err = j.Right.Close()
+			if err != nil {
+				return nil, false, err
+			}
+			if j.LeftOuter && !j.matched {
+				return j.combine(j.outer, nullValues(len(j.Right.Scope().Columns))), true, nil
+			}
+			continue
+		}
+
+		values := j.combine(j.outer, inner)
+		if j.predicate != nil {
+			matches, err := j.predicate(values)
+			if err != nil {
+				return nil, false, err
+			}
+			if !matches {
+				continue
+			}
+		}
+
+		j.matched = true
+		return values, true, nil
+	}
+}
+
+func (j *NestedLoopJoin) combine(outer []row.Value, inner []row.Value) []row.Value {
+	j.values = append(append(j.values[:0], outer...), inner...)
+	return j.values
+}
+
+func (j *NestedLoopJoin) Close() error {
+	if j.innerOpen {
+		j.innerOpen = false
+		j.Right.Close()
+	}
+	return j.Left.Close()
+}
+
+func (j *NestedLoopJoin) Scope() *eval.Scope {
+	return j.scope
+}
+
+func (j *NestedLoopJoin) Explain() Explanation {
+	details := map[string]string{"join_type": joinType(j.LeftOuter)}
+	if j.Condition != nil {
+		details["condition"] = j.Condition.String()
+	}
+	return Explanation{Name: "NestedLoopJoin", Details: details, Children: []Operator{j.Left, j.Right}}
+}
+
+/**
+ * Joins the rows of both sides whose key expressions are equal. The right side
+ * is read into a hash table first, and the left side is then probed against it.
+ * Rows with a NULL key never match. Residual is an additional condition over
+ * the joined row, or nil. A left outer join also returns every left row
+ * without a match, padded with NULLs.
+ */
+type HashJoin struct {
+	Left      Operator
+	Right     Operator
+	LeftKeys  []sql.Expr
+	RightKeys []sql.Expr
+	Residual  sql.Expr
+	LeftOuter bool
+	leftKeys  []eval.Evaluator
+	rightKeys []eval.Evaluator
+	residual  func(values []row.Value) (bool, error)
+	scope     *eval.Scope
+	buckets   map[string][][]row.Value
+	keyBytes  []byte
+	outer     []row.Value
+	matches   [][]row.Value
+	matchPos  int
+	matched   bool
+	values    []row.Value
+}
+
+func NewHashJoin(left Operator, right Operator, leftKeys []sql.Expr, rightKeys []sql.Expr, residual sql.Expr, leftOuter bool) (*HashJoin, error) {
+	join := &HashJoin{
+		Left:      left,
+		Right:     right,
+		LeftKeys:  leftKeys,
+		RightKeys: rightKeys,
+		Residual:  residual,
+		LeftOuter: leftOuter,
+		leftKeys:  make([]eval.Evaluator, len(leftKeys)),
+		rightKeys: make([]eval.Evaluator, len(rightKeys)),
+		scope:     joinScope(left, right),
+	}
+
+	for i := range leftKeys {
+		var err error
+		join.leftKeys[i], err = eval.Compile(leftKeys[i], left.Scope())
+		if err != nil {
+			return nil, err
+		}
+		join.rightKeys[i], err = eval.Compile(rightKeys[i], right.Scope())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if residual != nil {
+		var err error
+		join.residual, err = eval.CompilePredicate(residual, join.scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return join, nil
+}
+
+/**
+ * Encodes the key of a row for the hash table. Integral floats are encoded as
+ * ints, so that keys which compare equal also hash equally. The second return
+ * value is false if any part of the key is NULL.
+ */
+func (j *HashJoin) encodeKey(evaluators []eval.Evaluator, values []row.Value) (string, bool, error) {
+	key := make([]row.Value, len(evaluators))
+	for i, evaluator := range evaluators {
+		value, err := evaluator(values)
+		if err != nil {
+			return "", false, err
+		}
+		if value.IsNull() {
+			return "", false, nil
+		}
+		if value.Type == row.TYPE_FLOAT && value.Float == math.Trunc(value.Float) && math.Abs(value.Float) < math.MaxInt64 {
+			value = row.NewIntValue(int64(value.Float))
+		}
+		key[i] = value
+	}
+
+	j.keyBytes = serialization.AppendTuple(j.keyBytes[:0], key)
+	return string(j.keyBytes), true, nil
+}
+
+/**
+ * Builds the hash table from all the rows of the right side.
+ */
+func (j *HashJoin) Open() error {
+	j.buckets = make(map[string][][]row.Value)
+
+	var keyErr error
+	err := Run(j.Right, func(values []row.Value) bool {
+		key, ok, err := j.encodeKey(j.rightKeys, values)
+		if err != nil {
+			keyErr = err
+			return false
+		}
+		if ok {
+			j.buckets[key] = append(j.buckets[key], copyValues(values))
+		}
+		return true
+	})
+	if err == nil {
+		err = keyErr
+	}
+	if err != nil {
+		return err
+	}
+
+	j.outer = nil
+	j.matches = nil
+	return j.Left.Open()
+}
+
+func (j *HashJoin) Next() ([]row.Value, bool, error) {
+	for {
+		if j.outer != nil && j.matchPos < len(j.matches) {
+			inner := j.matches[j.matchPos]
+			j.matchPos++
+
+			j.values = append(append(j.values[:0], j.outer...), inner...)
+			if j.residual != nil {
+				matches, err := j.residual(j.values)
+				if err != nil {
+					return nil, false, err
+				}
+				if !matches {
+					continue
+				}
+			}
+
+			j.matched = true
+			return j.values, true, nil
+		}
+
+		if j.outer != nil && j.LeftOuter && !j.matched {
+			j.matched = true
+			j.values = append(append(j.values[:0], j.outer...), nullValues(len(j.Right.Scope().Columns))...)
+			return j.values, true, nil
+		}
+
+		outer, ok, err := j.Left.Next()
+		if err != nil || !ok {
+			j.outer = nil
+			return nil, false, err
+		}
+
+		key, hasKey, err := j.encodeKey(j.leftKeys, outer)
+		if err != nil {
+			return nil, false, err
+		}
+
+		j.outer = outer
+		j.matches = nil
+		if hasKey {
+			j.matches = j.buckets[key]
+		}
+		j.matchPos = 0
+		j.matched = false
+	}
+}
+
+func (j *HashJoin) Close() error {
+	j.buckets = nil
+	j.matches = nil
+	return j.Left.Close()
+}
+
+func (j *HashJoin) Scope() *eval.Scope {
+	return j.scope
+}
+
+func (j *HashJoin) Explain() Explanation {
+	keys := make([]string, len(j.LeftKeys))
+	for i := range j.LeftKeys {
+		keys[i] = j.LeftKeys[i].String() + " = " + j.RightKeys[i].String()
+	}
+
+	details := map[string]string{
+		"join_type": joinType(j.LeftOuter),
+		"keys":      strings.Join(keys, ", "),
+	}
+	if j.Residual != nil {
+		details["condition"] = j.Residual.String()
+	}
+	return Explanation{Name: "HashJoin", Details: details, Children: []Operator{j.Left, j.Right}}
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+/**
+ * A physical operator of a query plan. Operators form a tree which is pulled
+ * from its root: Open prepares an operator (and its children), every Next
+ * returns one row, and Close releases the resources. An operator can be
+ * opened again after it was closed.
+ * The values returned by Next are only valid until the next call of Next or
+ * Close, so an operator which keeps rows must copy them.
+ * Explain describes the operator and its children for EXPLAIN.
+ */
+type Operator interface {
+	Open() error
+	Next() ([]row.Value, bool, error)
+	Close() error
+	Scope() *eval.Scope
+	Explain() Explanation
+}
+
+/**
+ * An operator whose rows depend on the current row of an outer operator,
+ * e.g. the inner side of a nested loop join seeking by a value of the outer row.
+ * SetOuter is called before every Open.
+ */
+type Correlated interface {
+	SetOuter(values []row.Value)
+}
+
+/**
+ * Opens the operator and calls fn for every row it produces, until fn returns false.
+ */
+func Run(op Operator, fn func(values []row.Value) bool) error {
+	err := op.Open()
+	if err != nil {
+		op.Close()
+		return err
+	}
+
+	for {
+		values, ok, err := op.Next()
+		if err != nil {
+			op.Close()
+			return err
+		}
+		if !ok || !fn(values) {
+			break
+		}
+	}
+
+	return op.Close()
+}
+
+/**
+ * Runs the operator and returns copies of all the rows it produces.
+ */
+func Collect(op Operator) ([][]row.Value, error) {
+	rows := make([][]row.Value, 0)
+	err := Run(op, func(values []row.Value) bool {
+		rows = append(rows, copyValues(values))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func copyValues(values []row.Value) []row.Value {
+	copied := make([]row.Value, len(values))
+	copy(copied, values)
+	return copied
+}
+
+func nullValues(n int) []row.Value {
+	values := make([]row.Value, n)
+	for i := range values {
+		values[i] = row.NewNullValue()
+	}
+	return values
+}
@@ -0,0 +1,278 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Passes on the rows of its child for which the condition holds.
+ */
+type Filter struct {
+	Child     Operator
+	Condition sql.Expr
+	predicate func(values []row.Value) (bool, error)
+}
+
+func NewFilter(child Operator, condition sql.Expr) (*Filter, error) {
+	predicate, err := eval.CompilePredicate(condition, child.Scope())
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &Filter{
+		Child:     child,
+		Condition: condition,
+		predicate: predicate,
+	}
+
+	return filter, nil
+}
+
+/**
+ * Passes the outer row on to a correlated child, so a filter
+ * can be placed above the inner side of a nested loop join.
+ */
+func (f *Filter) SetOuter(values []row.Value) {
+	if correlated, ok := f.Child.(Correlated); ok {
+		correlated.SetOuter(values)
+	}
+}
+
+func (f *Filter) Open() error {
+	return f.Child.Open()
+}
+
+func (f *Filter) Next() ([]row.Value, bool, error) {
+	for {
+		values, ok, err := f.Child.Next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		matches, err := f.predicate(values)
+		if err != nil {
+			return nil, false, err
+		}
+		if matches {
+			return values, true, nil
+		}
+	}
+}
+
+func (f *Filter) Close() error {
+	return f.Child.Close()
+}
+
+func (f *Filter) Scope() *eval.Scope {
+	return f.Child.Scope()
+}
+
+func (f *Filter) Explain() Explanation {
+	details := map[string]string{"condition": f.Condition.String()}
+	return Explanation{Name: "Filter", Details: details, Children: []Operator{f.Child}}
+}
+
+/**
+ * Computes the output columns from the rows of its child.
+ */
+type Project struct {
+	Child      Operator
+	Exprs      []sql.Expr
+	Names      []string
+	evaluators []eval.Evaluator
+	scope      *eval.Scope
+	values     []row.Value
+}
+
+func NewProject(child Operator, exprs []sql.Expr, names []string) (*Project, error) {
+	evaluators := make([]eval.Evaluator, len(exprs))
+	columns := make([]eval.ColumnBinding, len(exprs))
+	for i, expr := range exprs {
+		var err error
+		evaluators[i], err = eval.Compile(expr, child.Scope())
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = eval.ColumnBinding{Name: names[i], Type: row.TYPE_NULL}
+	}
+
+	project := &Project{
+		Child:      child,
+		Exprs:      exprs,
+		Names:      names,
+		evaluators: evaluators,
+		scope:      eval.NewScope(columns),
+		values:     make([]row.Value, len(exprs)),
+	}
+
+	return project, nil
+}
+
+func (p *Project) Open() error {
+	return p.Child.Open()
+}
+
+func (p *Project) Next() ([]row.Value, bool, error) {
+	values, ok, err := p.Child.Next()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	for i, evaluator := range p.evaluators {
+		p.values[i], err = evaluator(values)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return p.values, true, nil
+}
+
+func (p *Project) Close() error {
+	return p.Child.Close()
+}
+
+func (p *Project) Scope() *eval.Scope {
+	return p.scope
+}
+
+func (p *Project) Explain() Explanation {
+	columns := make([]string, len(p.Exprs))
+	for i, expr := range p.Exprs {
+		columns[i] = expr.String()
+		if ref, ok := expr.(*sql.ColumnRef); !ok || ref.Name != p.Names[i] {
+			if columns[i] != p.Names[i] {
+				columns[i] += " as " + p.Names[i]
+			}
+		}
+	}
+
+	details := map[string]string{"columns": strings.Join(columns, ", ")}
+	return Explanation{Name: "Project", Details: details, Children: []Operator{p.Child}}
+}
+
+/**
+ * Skips the first Offset rows of its child and passes on at most Limit
+ * of the following ones; without a limit, it passes on all of them.
+ * Both are evaluated when the operator is opened, so they can be
+ * parameters bound anew for every execution of a prepared statement.
+ * Stops pulling from the child once the limit is reached.
+ */
+type Limit struct {
+	Child    Operator
+	Limit    sql.Expr
+	Offset   sql.Expr
+	limit    eval.Evaluator
+	offset   eval.Evaluator
+	max      int64
+	skip     int64
+	returned int64
+	skipped  int64
+}
+
+/**
+ * Creates the operator; a nil limit or offset is missing.
+ */
+func NewLimit(child Operator, limit sql.Expr, offset sql.Expr) (*Limit, error) {
+	l := &Limit{
+		Child:  child,
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	var err error
+	if limit != nil {
+		l.limit, err = eval.Compile(limit, eval.NewScope(nil))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if offset != nil {
+		l.offset, err = eval.Compile(offset, eval.NewScope(nil))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+/**
+ * Evaluates the limit or the offset, which must be a non-negative integer.
+ */
+func EvaluateCount(clause string, evaluator eval.Evaluator) (int64, error) {
+	value, err := evaluator(nil)
+	if err != nil {
+		return 0, err
+	}
+	if value.Type != row.TYPE_INT || value.Int < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %s", clause, value.ToString())
+	}
+	return value.Int, nil
+}
+
+func (l *Limit) Open() error {
+	l.max, l.skip = -1, 0
+	var err error
+	if l.limit != nil {
+		l.max, err = EvaluateCount("LIMIT", l.limit)
+		if err != nil {
+			return err
+		}
+	}
+	if l.offset != nil {
+		l.skip, err = EvaluateCount("OFFSET", l.offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	l.returned = 0
+	l.skipped = 0
+	return l.Child.Open()
+}
+
+func (l *Limit) Next() ([]row.Value, bool, error) {
+	if l.max >= 0 && l.returned >= l.max {
+		return nil, false, nil
+	}
+
+	for {
+		values, ok, err := l.Child.Next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		if l.skipped < l.skip {
+			l.skipped++
+			continue
+		}
+
+		l.returned++
+		return values, true, nil
+	}
+}
+
+func (l *Limit) Close() error {
+	return l.Child.Close()
+}
+
+func (l *Limit) Scope() *eval.Scope {
+	return l.Child.Scope()
+}
+
+func (l *Limit) Explain() Explanation {
+	details := map[string]string{}
+	if l.Limit != nil {
+		details["limit"] = l.Limit.String()
+	}
+	if l.Offset != nil {
+		details["offset"] = l.Offset.String()
+	}
+	return Explanation{Name: "Limit", Details: details, Children: []Operator{l.Child}}
+}
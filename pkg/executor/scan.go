@@ -0,0 +1,533 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * The name under which plans refer to the tree of the table itself.
+ */
+const PRIMARY_KEY_INDEX = "primary key"
+
+/**
+ * An inclusive range of primary keys.
+ */
+type KeyRange struct {
+	Low  int64
+	High int64
+}
+
+func NewFullKeyRange() KeyRange {
+	return KeyRange{Low: math.MinInt64, High: math.MaxInt64}
+}
+
+func (r KeyRange) IsFull() bool {
+	return r.Low == math.MinInt64 && r.High == math.MaxInt64
+}
+
+func (r KeyRange) IsEmpty() bool {
+	return r.Low > r.High
+}
+
+func (r KeyRange) Contains(key int64) bool {
+	return key >= r.Low && key <= r.High
+}
+
+func (r KeyRange) String() string {
+	low, high := "-inf", "+inf"
+	if r.Low != math.MinInt64 {
+		low = fmt.Sprint(r.Low)
+	}
+	if r.High != math.MaxInt64 {
+		high = fmt.Sprint(r.High)
+	}
+	return "[" + low + ", " + high + "]"
+}
+
+/**
+ * Names the table read by a scan, and its alias if it has one.
+ */
+func tableDetails(t *table.Table, scope *eval.Scope) map[string]string {
+	details := map[string]string{"table": t.Name}
+	if len(scope.Columns) > 0 && scope.Columns[0].Table != t.Name {
+		details["alias"] = scope.Columns[0].Table
+	}
+	return details
+}
+
+/**
+ * Reads the rows of a table whose primary keys fall into a key range, in
+ * primary key order (descending if reverse is set), by positioning a cursor
+ * at one end of the range and walking the leaves to the other.
+ */
+type RangeScan struct {
+	Table    *table.Table
+	Range    KeyRange
+	Reverse  bool
+	scope    *eval.Scope
+	cursor   *paging.Cursor
+	record   *serialization.Record
+	current  row.Row
+	started  bool
+	finished bool
+}
+
+func NewRangeScan(t *table.Table, alias string, keyRange KeyRange, reverse bool) *RangeScan {
+	scan := &RangeScan{
+		Table:   t,
+		Range:   keyRange,
+		Reverse: reverse,
+		scope:   eval.NewTableScope(alias, t.Schema),
+		record:  serialization.NewRecord(t.Schema),
+	}
+
+	return scan
+}
+
+/**
+ * A full scan of the table is a range scan over all keys.
+ */
+func NewTableScan(t *table.Table, alias string, reverse bool) *RangeScan {
+	return NewRangeScan(t, alias, NewFullKeyRange(), reverse)
+}
+
+func (s *RangeScan) Open() error {
+	s.cursor = s.Table.Tree.NewCursor()
+	s.started = false
+	s.finished = s.Range.IsEmpty()
+	if s.finished {
+		return nil
+	}
+	return s.Table.LockRange(s.Range.Low, s.Range.High)
+}
+
+func (s *RangeScan) Next() ([]row.Value, bool, error) {
+	if s.finished {
+		return nil, false, nil
+	}
+
+	var ok bool
+	switch {
+	case s.started && s.Reverse:
+		ok = s.cursor.Prev()
+	case s.started:
+		ok = s.cursor.Next()
+	case s.Reverse:
+		ok = s.cursor.SeekLast(row.EncodeKey(s.Range.High))
+	default:
+		ok = s.cursor.Seek(row.EncodeKey(s.Range.Low))
+	}
+	s.started = true
+
+	if !ok || !s.Range.Contains(row.DecodeKey(s.cursor.Key())) {
+		s.finished = true
+		return nil, false, nil
+	}
+
+	err := s.record.Reset(s.cursor.Data())
+	if err != nil {
+		return nil, false, err
+	}
+	s.record.DecodeInto(&s.current)
+
+	return s.current.Values, true, nil
+}
+
+func (s *RangeScan) Close() error {
+	s.cursor = nil
+	return nil
+}
+
+func (s *RangeScan) Scope() *eval.Scope {
+	return s.scope
+}
+
+/**
+ * A scan over all keys is explained as a table scan.
+ */
+func (s *RangeScan) Explain() Explanation {
+	explanation := Explanation{Name: "RangeScan", Details: tableDetails(s.Table, s.scope)}
+	if s.Range.IsFull() {
+		explanation.Name = "TableScan"
+	} else {
+		explanation.Details["index"] = PRIMARY_KEY_INDEX
+		explanation.Details["key_range"] = s.Range.String()
+	}
+	if s.Reverse {
+		explanation.Details["direction"] = "backward"
+	}
+	return explanation
+}
+
+/**
+ * Looks up a single row by its primary key. The key expression is evaluated
+ * over the outer row, so the seek can be the inner side of a nested loop join;
+ * without an outer scope the key must be a constant.
+ */
+type IndexSeek struct {
+	Table *table.Table
+	Key   sql.Expr
+	key   eval.Evaluator
+	scope *eval.Scope
+	outer []row.Value
+	// The key the seek looked up when it was last opened
+	sought row.Value
+	row    *row.Row
+	done   bool
+}
+
+func NewIndexSeek(t *table.Table, alias string, key sql.Expr, outerScope *eval.Scope) (*IndexSeek, error) {
+	if outerScope == nil {
+		outerScope = eval.NewScope(nil)
+	}
+
+	keyEvaluator, err := eval.Compile(key, outerScope)
+	if err != nil {
+		return nil, err
+	}
+
+	seek := &IndexSeek{
+		Table: t,
+		Key:   key,
+		key:   keyEvaluator,
+		scope: eval.NewTableScope(alias, t.Schema),
+	}
+
+	return seek, nil
+}
+
+func (s *IndexSeek) SetOuter(values []row.Value) {
+	s.outer = values
+}
+
+func (s *IndexSeek) Open() error {
+	s.row = nil
+	s.done = false
+
+	key, err := s.key(s.outer)
+	if err != nil {
+		return err
+	}
+	if key.IsNull() {
+		return nil
+	}
+	if key.Type == row.TYPE_FLOAT && key.Float == math.Trunc(key.Float) {
+		key = row.NewIntValue(int64(key.Float))
+	}
+	s.sought = key
+	if key.Type != row.TYPE_INT {
+		return nil
+	}
+
+	err = s.Table.LockRange(key.Int, key.Int)
+	if err != nil {
+		return err
+	}
+	r, found, err := s.Table.SelectOne(key.Int)
+	if err != nil {
+		return err
+	}
+	if found {
+		s.row = r
+	}
+	return nil
+}
+
+/**
+ * Returns the key the seek looked up when it was last opened, or NULL if it
+ * has not looked up one.
+ */
+func (s *IndexSeek) SoughtKey() row.Value {
+	return s.sought
+}
+
+func (s *IndexSeek) Next() ([]row.Value, bool, error) {
+	if s.row == nil || s.done {
+		return nil, false, nil
+	}
+	s.done = true
+	return s.row.Values, true, nil
+}
+
+func (s *IndexSeek) Close() error {
+	s.row = nil
+	return nil
+}
+
+func (s *IndexSeek) Scope() *eval.Scope {
+	return s.scope
+}
+
+func (s *IndexSeek) Explain() Explanation {
+	details := tableDetails(s.Table, s.scope)
+	details["index"] = PRIMARY_KEY_INDEX
+	details["key"] = s.Key.String()
+	return Explanation{Name: "IndexSeek", Details: details}
+}
+
+/**
+ * A bound of the range read by an index scan.
+ */
+type IndexBound struct {
+	Expr      sql.Expr
+	Inclusive bool
+}
+
+/**
+ * Reads the rows of a table through a secondary index: the rows whose values
+ * of the leading indexed columns equal the Equal expressions, and whose value
+ * of the next column lies between the bounds (nil bounds are open). The rows
+ * come in the order of the index. Like the key of an index seek, the expressions
+ * are evaluated over the outer row, so the scan can be the inner side of a
+ * nested loop join.
+ */
+type IndexScan struct {
+	Table  *table.Table
+	Index  *table.Index
+	Equal  []sql.Expr
+	Low    *IndexBound
+	High   *IndexBound
+	equal  []eval.Evaluator
+	low    eval.Evaluator
+	high   eval.Evaluator
+	scope  *eval.Scope
+	outer  []row.Value
+	keys   []int64
+	next   int
+	record *serialization.Record
+	row    row.Row
+}
+
+func NewIndexScan(t *table.Table, alias string, index *table.Index, equal []sql.Expr, low *IndexBound, high *IndexBound, outerScope *eval.Scope) (*IndexScan, error) {
+	if outerScope == nil {
+		outerScope = eval.NewScope(nil)
+	}
+
+	scan := &IndexScan{
+		Table:  t,
+		Index:  index,
+		Equal:  equal,
+		Low:    low,
+		High:   high,
+		equal:  make([]eval.Evaluator, len(equal)),
+		scope:  eval.NewTableScope(alias, t.Schema),
+		record: serialization.NewRecord(t.Schema),
+	}
+
+	var err error
+	for i, expr := range equal {
+		scan.equal[i], err = eval.Compile(expr, outerScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if low != nil {
+		scan.low, err = eval.Compile(low.Expr, outerScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if high != nil {
+		scan.high, err = eval.Compile(high.Expr, outerScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return scan, nil
+}
+
+func (s *IndexScan) SetOuter(values []row.Value) {
+	s.outer = values
+}
+
+/**
+ * Collects the primary keys of the matching rows, so that the rows
+ * can be read without holding a cursor over the index. Ranges of index
+ * values are not locked on their own, so the whole table is locked instead.
+ */
+func (s *IndexScan) Open() error {
+	s.keys = s.keys[:0]
+	s.next = 0
+
+	err := s.Table.LockRange(math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+
+	equal := make([]row.Value, len(s.equal))
+	for i, evaluator := range s.equal {
+		value, err := evaluator(s.outer)
+		if err != nil {
+			return err
+		}
+		equal[i] = value
+	}
+
+	var low, high *table.Bound
+	if s.low != nil {
+		value, err := s.low(s.outer)
+		if err != nil {
+			return err
+		}
+		low = &table.Bound{Value: value, Inclusive: s.Low.Inclusive}
+	}
+	if s.high != nil {
+		value, err := s.high(s.outer)
+		if err != nil {
+			return err
+		}
+		high = &table.Bound{Value: value, Inclusive: s.High.Inclusive}
+	}
+
+	return s.Index.Scan(equal, low, high, func(pk int64) bool {
+		s.keys = append(s.keys, pk)
+		return true
+	})
+}
+
+func (s *IndexScan) Next() ([]row.Value, bool, error) {
+	for s.next < len(s.keys) {
+		key := s.keys[s.next]
+		s.next++
+
+		data, found, err := s.Table.Tree.ReadDataByKey(row.EncodeKey(key))
+		if err != nil {
+			return nil, false, err
+		}
+		if !found {
+			continue
+		}
+
+		err = s.record.Reset(data)
+		if err != nil {
+			return nil, false, err
+		}
+		s.record.DecodeInto(&s.row)
+		return s.row.Values, true, nil
+	}
+
+	return nil, false, nil
+}
+
+func (s *IndexScan) Close() error {
+	s.keys = s.keys[:0]
+	return nil
+}
+
+func (s *IndexScan) Scope() *eval.Scope {
+	return s.scope
+}
+
+/**
+ * Shows the conditions the index enforces, over the indexed columns.
+ */
+func (s *IndexScan) Explain() Explanation {
+	details := tableDetails(s.Table, s.scope)
+	details["index"] = s.Index.Name
+	details["columns"] = s.Index.ColumnNames()
+
+	binding := s.scope.Columns[0].Table
+	column := func(i int) sql.Expr {
+		return &sql.ColumnRef{Table: binding, Name: s.Table.Schema.Columns[s.Index.Columns[i]].Name}
+	}
+	conditions := make([]sql.Expr, 0, len(s.Equal)+2)
+	for i, expr := range s.Equal {
+		conditions = append(conditions, &sql.BinaryExpr{Operator: "=", Left: column(i), Right: expr})
+	}
+	if s.Low != nil {
+		operator := ">"
+		if s.Low.Inclusive {
+			operator = ">="
+		}
+		conditions = append(conditions, &sql.BinaryExpr{Operator: operator, Left: column(len(s.Equal)), Right: s.Low.Expr})
+	}
+	if s.High != nil {
+		operator := "<"
+		if s.High.Inclusive {
+			operator = "<="
+		}
+		conditions = append(conditions, &sql.BinaryExpr{Operator: operator, Left: column(len(s.Equal)), Right: s.High.Expr})
+	}
+	details["index_condition"] = joinExprs(conditions)
+
+	return Explanation{Name: "IndexScan", Details: details}
+}
+
+/**
+ * Answers an aggregation consisting only of min and max of the primary key over
+ * the whole table, reading the keys from the leftmost and rightmost leaves of
+ * the tree instead of scanning it. Produces a single row shaped like the result
+ * of the aggregation it replaces.
+ */
+type KeyExtremes struct {
+	Table     *table.Table
+	Functions []string
+	scope     *eval.Scope
+	done      bool
+}
+
+func NewKeyExtremes(t *table.Table, functions []string, scope *eval.Scope) *KeyExtremes {
+	extremes := &KeyExtremes{
+		Table:     t,
+		Functions: functions,
+		scope:     scope,
+	}
+
+	return extremes
+}
+
+func (k *KeyExtremes) Open() error {
+	k.done = false
+	return k.Table.LockRange(math.MinInt64, math.MaxInt64)
+}
+
+func (k *KeyExtremes) Next() ([]row.Value, bool, error) {
+	if k.done {
+		return nil, false, nil
+	}
+	k.done = true
+
+	values := make([]row.Value, len(k.Functions))
+	for i, function := range k.Functions {
+		extreme := k.Table.MinKey
+		if function == eval.AGGREGATE_MAX {
+			extreme = k.Table.MaxKey
+		}
+
+		key, ok := extreme()
+		if ok {
+			values[i] = row.NewIntValue(key)
+		} else {
+			values[i] = row.NewNullValue()
+		}
+	}
+
+	return values, true, nil
+}
+
+func (k *KeyExtremes) Close() error {
+	return nil
+}
+
+func (k *KeyExtremes) Scope() *eval.Scope {
+	return k.scope
+}
+
+func (k *KeyExtremes) Explain() Explanation {
+	details := map[string]string{
+		"table":     k.Table.Name,
+		"index":     PRIMARY_KEY_INDEX,
+		"functions": strings.Join(k.Functions, ", "),
+	}
+	return Explanation{Name: "KeyExtremes", Details: details}
+}
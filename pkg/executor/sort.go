@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sorting"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Sorts the rows of its child by the order by items with an external sort.
+ * Every sorted tuple holds the row followed by the values of the order by
+ * expressions, which are stripped again when the rows are returned.
+ */
+type Sort struct {
+	Child        Operator
+	OrderBy      []sql.OrderItem
+	MemoryBudget int
+	evaluators   []eval.Evaluator
+	sorter       *sorting.Sorter
+	iterator     *sorting.Iterator
+	width        int
+	spilledRuns  int
+}
+
+func NewSort(child Operator, orderBy []sql.OrderItem, memoryBudget int) (*Sort, error) {
+	evaluators := make([]eval.Evaluator, len(orderBy))
+	for i, item := range orderBy {
+		var err error
+		evaluators[i], err = eval.Compile(item.Expr, child.Scope())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Sort{
+		Child:        child,
+		OrderBy:      orderBy,
+		MemoryBudget: memoryBudget,
+		evaluators:   evaluators,
+		width:        len(child.Scope().Columns),
+	}
+
+	return s, nil
+}
+
+/**
+ * Consumes all the rows of the child, so the first row is only
+ * available after the whole input has been sorted.
+ */
+func (s *Sort) Open() error {
+	keys := make([]sorting.SortKey, len(s.OrderBy))
+	for i, item := range s.OrderBy {
+		keys[i] = sorting.SortKey{Index: s.width + i, Desc: item.Desc}
+	}
+	s.sorter = sorting.NewSorter(keys, s.MemoryBudget)
+
+	err := s.Child.Open()
+	if err != nil {
+		return err
+	}
+
+	for {
+		values, ok, err := s.Child.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		tuple := make([]row.Value, 0, s.width+len(s.evaluators))
+		tuple = append(tuple, values...)
+		for _, evaluator := range s.evaluators {
+			value, err := evaluator(values)
+			if err != nil {
+				return err
+			}
+			tuple = append(tuple, value)
+		}
+
+		err = s.sorter.Add(tuple)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.iterator, err = s.sorter.Sort()
+	return err
+}
+
+func (s *Sort) Next() ([]row.Value, bool, error) {
+	tuple, ok, err := s.iterator.Next()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return tuple[:s.width], true, nil
+}
+
+func (s *Sort) Close() error {
+	if s.iterator != nil {
+		s.iterator.Close()
+		s.iterator = nil
+	}
+	if s.sorter != nil {
+		s.spilledRuns = s.sorter.SpilledRuns()
+		s.sorter.Close()
+		s.sorter = nil
+	}
+	return s.Child.Close()
+}
+
+/**
+ * The number of sorted runs spilled to disk by the last sort.
+ */
+func (s *Sort) SpilledRuns() int {
+	if s.sorter != nil {
+		return s.sorter.SpilledRuns()
+	}
+	return s.spilledRuns
+}
+
+func (s *Sort) Scope() *eval.Scope {
+	return s.Child.Scope()
+}
+
+func (s *Sort) Explain() Explanation {
+	keys := make([]string, len(s.OrderBy))
+	for i, item := range s.OrderBy {
+		keys[i] = item.Expr.String()
+		if item.Desc {
+			keys[i] += " desc"
+		}
+	}
+
+	details := map[string]string{"order_by": strings.Join(keys, ", ")}
+	return Explanation{Name: "Sort", Details: details, Children: []Operator{s.Child}}
+}
@@ -9,19 +9,11 @@ type SocketIOProvider struct {
 	hostName   string
 	port       string
 	protocol   string
-	server     net.Listener
 	connection net.Conn
 }
 
-func NewSocketIOProvider(server net.Listener) *SocketIOProvider {
-	// server, _ := net.Listen(protocol, hostName+":"+port)
-	connection, _ := server.Accept()
-
+func NewSocketIOProvider(connection net.Conn) *SocketIOProvider {
 	socketInputProvider := &SocketIOProvider{
-		// hostName:   hostName,
-		// port:       port,
-		// protocol:   protocol,
-		server:     server,
 		connection: connection,
 	}
 
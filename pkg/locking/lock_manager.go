@@ -0,0 +1,381 @@
+package locking
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+type LockMode int8
+
+const (
+	LOCK_SHARED LockMode = iota
+	LOCK_EXCLUSIVE
+)
+
+func (m LockMode) String() string {
+	if m == LOCK_EXCLUSIVE {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+var ErrDeadlock = errors.New("deadlock detected: the transaction was chosen as the victim")
+
+/**
+ * An inclusive range of keys in a key space, e.g. of the primary keys of
+ * a table. A single key is a range holding only that key. Locking a range
+ * also covers the keys which do not exist yet, so a transaction reading
+ * a range under a lock cannot see new rows appear in it (phantoms).
+ * The database resource lives in a key space of its own.
+ */
+type Resource struct {
+	Space string
+	Low   int64
+	High  int64
+}
+
+func NewKeyResource(space string, key int64) Resource {
+	return Resource{Space: space, Low: key, High: key}
+}
+
+func NewRangeResource(space string, low int64, high int64) Resource {
+	return Resource{Space: space, Low: low, High: high}
+}
+
+/**
+ * Every key of the space.
+ */
+func NewSpaceResource(space string) Resource {
+	return Resource{Space: space, Low: math.MinInt64, High: math.MaxInt64}
+}
+
+/**
+ * The resource every transaction changing the database holds: shared to
+ * change rows, and exclusive to change the schema, so no other transaction
+ * changes the database meanwhile.
+ */
+func DatabaseResource() Resource {
+	return NewSpaceResource("")
+}
+
+func (r Resource) isDatabase() bool {
+	return r.Space == ""
+}
+
+func (r Resource) overlaps(other Resource) bool {
+	return r.Space == other.Space && r.Low <= other.High && other.Low <= r.High
+}
+
+func (r Resource) covers(other Resource) bool {
+	return r.Space == other.Space && r.Low <= other.Low && other.High <= r.High
+}
+
+func (r Resource) String() string {
+	if r.isDatabase() {
+		return "the database"
+	}
+	if r.Low == r.High {
+		return fmt.Sprintf("key %d of %s", r.Low, r.Space)
+	}
+	low, high := "-inf", "+inf"
+	if r.Low != math.MinInt64 {
+		low = fmt.Sprint(r.Low)
+	}
+	if r.High != math.MaxInt64 {
+		high = fmt.Sprint(r.High)
+	}
+	return fmt.Sprintf("keys [%s, %s] of %s", low, high, r.Space)
+}
+
+type lock struct {
+	resource Resource
+	mode     LockMode
+}
+
+/**
+ * A transaction known to the lock manager. A transaction reading a snapshot
+ * cannot lock keys changed by the transactions committed after the snapshot
+ * was taken, since it has not seen those changes.
+ */
+type owner struct {
+	id          uint64
+	snapshot    uint64
+	hasSnapshot bool
+	locks       []lock
+	// The transactions the owner waits for, while it waits
+	waitsFor []uint64
+	victim   bool
+}
+
+/**
+ * The keys changed by a committed transaction, which are kept while
+ * transactions with older snapshots are running.
+ */
+type commitRecord struct {
+	version uint64
+	writes  []Resource
+}
+
+/**
+ * Grants shared and exclusive locks on key ranges to transactions, which hold
+ * them until they end (two-phase locking). A transaction whose lock conflicts
+ * with the locks of others waits for them. The waits form the wait-for graph:
+ * a wait which closes a cycle in it would never end, so the youngest
+ * transaction of the cycle is chosen as the victim and fails its lock.
+ */
+type LockManager struct {
+	mu        sync.Mutex
+	changed   *sync.Cond
+	owners    map[uint64]*owner
+	nextOwner uint64
+	commits   []commitRecord
+}
+
+func NewLockManager() *LockManager {
+	lm := &LockManager{
+		owners:    make(map[uint64]*owner),
+		nextOwner: 1,
+	}
+	lm.changed = sync.NewCond(&lm.mu)
+
+	return lm
+}
+
+/**
+ * Registers a transaction and returns its id. Transactions started
+ * later get higher ids.
+ */
+func (lm *LockManager) Begin() uint64 {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return lm.begin().id
+}
+
+/**
+ * Registers a transaction reading the snapshot with the given version.
+ * No transaction may commit between taking the snapshot and registering it.
+ */
+func (lm *LockManager) BeginSnapshot(version uint64) uint64 {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	o := lm.begin()
+	o.snapshot = version
+	o.hasSnapshot = true
+	return o.id
+}
+
+/**
+ * Records that the transaction reads the snapshot with the given version
+ * from now on. No transaction may commit between taking the snapshot and
+ * recording it.
+ */
+func (lm *LockManager) SetSnapshot(id uint64, version uint64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	o := lm.owners[id]
+	o.snapshot = version
+	o.hasSnapshot = true
+}
+
+func (lm *LockManager) begin() *owner {
+	o := &owner{id: lm.nextOwner}
+	lm.nextOwner++
+	lm.owners[o.id] = o
+	return o
+}
+
+/**
+ * Locks the resource for the transaction, waiting until no other transaction
+ * holds a conflicting lock. Fails with ErrDeadlock if the transaction is
+ * chosen as the victim of a deadlock, and if the keys were changed by
+ * a transaction committed after the snapshot of this one.
+ */
+func (lm *LockManager) Lock(id uint64, resource Resource, mode LockMode) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	o := lm.owners[id]
+	for _, held := range o.locks {
+		if held.mode >= mode && held.resource.covers(resource) {
+			return nil
+		}
+	}
+
+	for {
+		if o.victim {
+			o.victim = false
+			o.waitsFor = nil
+			return ErrDeadlock
+		}
+
+		blockers := lm.conflicts(o, resource, mode)
+		if len(blockers) == 0 {
+			break
+		}
+
+		o.waitsFor = blockers
+		if victim := lm.findDeadlockVictim(o); victim != nil {
+			if victim == o {
+				o.waitsFor = nil
+				return ErrDeadlock
+			}
+			victim.victim = true
+			lm.changed.Broadcast()
+		}
+		lm.changed.Wait()
+	}
+	o.waitsFor = nil
+
+	if o.hasSnapshot {
+		for _, commit := range lm.commits {
+			if commit.version <= o.snapshot {
+				continue
+			}
+			for _, write := range commit.writes {
+				if write.overlaps(resource) {
+					return fmt.Errorf("could not serialize access: %s was changed by another transaction since this one started", resource)
+				}
+			}
+		}
+	}
+
+	o.locks = append(o.locks, lock{resource: resource, mode: mode})
+	return nil
+}
+
+/**
+ * Returns the transactions holding locks which conflict with the requested one.
+ */
+func (lm *LockManager) conflicts(o *owner, resource Resource, mode LockMode) []uint64 {
+	blockers := make([]uint64, 0)
+	for _, other := range lm.owners {
+		if other == o {
+			continue
+		}
+		for _, held := range other.locks {
+			if (mode == LOCK_EXCLUSIVE || held.mode == LOCK_EXCLUSIVE) && held.resource.overlaps(resource) {
+				blockers = append(blockers, other.id)
+				break
+			}
+		}
+	}
+	return blockers
+}
+
+/**
+ * Looks for a cycle of waits through the transaction, and returns
+ * the youngest transaction of the first one found.
+ */
+func (lm *LockManager) findDeadlockVictim(start *owner) *owner {
+	path := make([]*owner, 0)
+	visited := make(map[uint64]bool)
+
+	var visit func(o *owner) []*owner
+	visit = func(o *owner) []*owner {
+		path = append(path, o)
+		visited[o.id] = true
+		for _, id := range o.waitsFor {
+			next, exists := lm.owners[id]
+			if !exists {
+				continue
+			}
+			if next == start {
+				return path
+			}
+			if !visited[id] {
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return nil
+	}
+
+	cycle := visit(start)
+	if cycle == nil {
+		return nil
+	}
+
+	victim := cycle[0]
+	for _, o := range cycle {
+		if o.id > victim.id {
+			victim = o
+		}
+	}
+	return victim
+}
+
+/**
+ * Records the keys the transaction locked exclusively as changed by the
+ * commit with the given version, and releases its locks.
+ */
+func (lm *LockManager) Commit(id uint64, version uint64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	o := lm.owners[id]
+	writes := make([]Resource, 0)
+	for _, held := range o.locks {
+		if held.mode == LOCK_EXCLUSIVE {
+			writes = append(writes, held.resource)
+		}
+	}
+	if len(writes) > 0 {
+		lm.commits = append(lm.commits, commitRecord{version: version, writes: writes})
+	}
+
+	lm.release(o)
+}
+
+/**
+ * Releases every lock of the transaction and forgets it.
+ */
+func (lm *LockManager) Release(id uint64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.release(lm.owners[id])
+}
+
+func (lm *LockManager) release(o *owner) {
+	delete(lm.owners, o.id)
+	lm.collectCommits()
+	lm.changed.Broadcast()
+}
+
+/**
+ * Drops the records of the commits every running transaction has seen.
+ */
+func (lm *LockManager) collectCommits() {
+	oldest := uint64(math.MaxUint64)
+	for _, o := range lm.owners {
+		if o.hasSnapshot && o.snapshot < oldest {
+			oldest = o.snapshot
+		}
+	}
+
+	kept := 0
+	for kept < len(lm.commits) && lm.commits[kept].version <= oldest {
+		kept++
+	}
+	lm.commits = lm.commits[kept:]
+}
+
+/**
+ * Returns the number of locks held by the transaction.
+ */
+func (lm *LockManager) LockCount(id uint64) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if o, exists := lm.owners[id]; exists {
+		return len(o.locks)
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package locking_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/locking"
+)
+
+/**
+ * How long a lock is expected to wait before it is considered blocked.
+ */
+const BLOCKED_AFTER = 50 * time.Millisecond
+
+/**
+ * Requests the lock in another goroutine, and returns the channel its
+ * result is sent to once it is granted or fails.
+ */
+func lockAsync(lm *locking.LockManager, id uint64, resource locking.Resource, mode locking.LockMode) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- lm.Lock(id, resource, mode)
+	}()
+	return result
+}
+
+func expectBlocked(t *testing.T, result chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-result:
+		t.Fatalf("%s was not blocked: %v", what, err)
+	case <-time.After(BLOCKED_AFTER):
+	}
+}
+
+func expectGranted(t *testing.T, result chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("%s failed: %v", what, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s is still blocked", what)
+	}
+}
+
+func TestLockConflicts(t *testing.T) {
+	key := locking.NewKeyResource("t", 1)
+	tests := []struct {
+		name     string
+		held     locking.Resource
+		heldMode locking.LockMode
+		wanted   locking.Resource
+		mode     locking.LockMode
+		blocked  bool
+	}{
+		{"shared and shared", key, locking.LOCK_SHARED, key, locking.LOCK_SHARED, false},
+		{"shared and exclusive", key, locking.LOCK_SHARED, key, locking.LOCK_EXCLUSIVE, true},
+		{"exclusive and shared", key, locking.LOCK_EXCLUSIVE, key, locking.LOCK_SHARED, true},
+		{"exclusive and exclusive", key, locking.LOCK_EXCLUSIVE, key, locking.LOCK_EXCLUSIVE, true},
+		{"other keys", key, locking.LOCK_EXCLUSIVE, locking.NewKeyResource("t", 2), locking.LOCK_EXCLUSIVE, false},
+		{"other spaces", key, locking.LOCK_EXCLUSIVE, locking.NewKeyResource("u", 1), locking.LOCK_EXCLUSIVE, false},
+		{"a key in a range", locking.NewRangeResource("t", 0, 10), locking.LOCK_SHARED, key, locking.LOCK_EXCLUSIVE, true},
+		{"overlapping ranges", locking.NewRangeResource("t", 0, 10), locking.LOCK_EXCLUSIVE, locking.NewRangeResource("t", 10, 20), locking.LOCK_SHARED, true},
+		{"adjacent ranges", locking.NewRangeResource("t", 0, 10), locking.LOCK_EXCLUSIVE, locking.NewRangeResource("t", 11, 20), locking.LOCK_EXCLUSIVE, false},
+		{"the whole space", locking.NewSpaceResource("t"), locking.LOCK_EXCLUSIVE, key, locking.LOCK_SHARED, true},
+		{"the database shared", locking.DatabaseResource(), locking.LOCK_SHARED, locking.DatabaseResource(), locking.LOCK_SHARED, false},
+		{"the database exclusive", locking.DatabaseResource(), locking.LOCK_SHARED, locking.DatabaseResource(), locking.LOCK_EXCLUSIVE, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lm := locking.NewLockManager()
+			holder, waiter := lm.Begin(), lm.Begin()
+			err := lm.Lock(holder, test.held, test.heldMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := lockAsync(lm, waiter, test.wanted, test.mode)
+			if test.blocked {
+				expectBlocked(t, result, "the conflicting lock")
+				lm.Release(holder)
+			}
+			expectGranted(t, result, "the lock")
+		})
+	}
+}
+
+func TestLockUpgrade(t *testing.T) {
+	lm := locking.NewLockManager()
+	a, b := lm.Begin(), lm.Begin()
+	key := locking.NewKeyResource("t", 1)
+	for _, id := range []uint64{a, b} {
+		if err := lm.Lock(id, key, locking.LOCK_SHARED); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := lockAsync(lm, a, key, locking.LOCK_EXCLUSIVE)
+	expectBlocked(t, result, "the upgrade while another transaction shares the key")
+	lm.Release(b)
+	expectGranted(t, result, "the upgrade")
+
+	// The exclusive lock covers the shared one
+	if err := lm.Lock(a, key, locking.LOCK_SHARED); err != nil {
+		t.Fatal(err)
+	}
+	if count := lm.LockCount(a); count != 2 {
+		t.Errorf("a holds %d locks, expected 2", count)
+	}
+}
+
+/**
+ * Two transactions each hold a key the other one waits for. The younger
+ * one is the victim: its lock fails, and once it releases its locks,
+ * the older one gets its lock.
+ */
+func TestDeadlockVictim(t *testing.T) {
+	lm := locking.NewLockManager()
+	older, younger := lm.Begin(), lm.Begin()
+	first, second := locking.NewKeyResource("t", 1), locking.NewKeyResource("t", 2)
+	if err := lm.Lock(older, first, locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := lm.Lock(younger, second, locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+
+	olderResult := lockAsync(lm, older, second, locking.LOCK_EXCLUSIVE)
+	expectBlocked(t, olderResult, "the lock of the older transaction")
+
+	err := lm.Lock(younger, first, locking.LOCK_EXCLUSIVE)
+	if !errors.Is(err, locking.ErrDeadlock) {
+		t.Fatalf("the younger transaction got %v, expected a deadlock", err)
+	}
+	expectBlocked(t, olderResult, "the lock of the older transaction before the victim ends")
+
+	lm.Release(younger)
+	expectGranted(t, olderResult, "the lock of the older transaction")
+}
+
+/**
+ * The cycle closes with the wait of the older transaction, so the younger
+ * one, already waiting, is woken up as the victim.
+ */
+func TestDeadlockVictimWaiting(t *testing.T) {
+	lm := locking.NewLockManager()
+	ids := []uint64{lm.Begin(), lm.Begin(), lm.Begin()}
+	keys := []locking.Resource{
+		locking.NewKeyResource("t", 1),
+		locking.NewKeyResource("t", 2),
+		locking.NewKeyResource("t", 3),
+	}
+	for i, id := range ids {
+		if err := lm.Lock(id, keys[i], locking.LOCK_EXCLUSIVE); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The youngest waits for the middle one, which waits for the oldest
+	youngest := lockAsync(lm, ids[2], keys[1], locking.LOCK_EXCLUSIVE)
+	expectBlocked(t, youngest, "the lock of the youngest transaction")
+	middle := lockAsync(lm, ids[1], keys[0], locking.LOCK_EXCLUSIVE)
+	expectBlocked(t, middle, "the lock of the middle transaction")
+
+	oldest := lockAsync(lm, ids[0], keys[2], locking.LOCK_EXCLUSIVE)
+	select {
+	case err := <-youngest:
+		if !errors.Is(err, locking.ErrDeadlock) {
+			t.Fatalf("the youngest transaction got %v, expected a deadlock", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no victim was chosen")
+	}
+
+	lm.Release(ids[2])
+	expectGranted(t, oldest, "the lock of the oldest transaction")
+	lm.Release(ids[0])
+	expectGranted(t, middle, "the lock of the middle transaction")
+}
+
+/**
+ * A transaction which read a range under a lock keeps seeing the same rows:
+ * a key cannot be inserted into the range until the reader ends.
+ */
+func TestRangeLockPreventsPhantoms(t *testing.T) {
+	lm := locking.NewLockManager()
+	reader, writer := lm.Begin(), lm.Begin()
+	if err := lm.Lock(reader, locking.NewRangeResource("t", 10, 20), locking.LOCK_SHARED); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lm.Lock(writer, locking.NewKeyResource("t", 21), locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatalf("a key outside the range: %v", err)
+	}
+	result := lockAsync(lm, writer, locking.NewKeyResource("t", 15), locking.LOCK_EXCLUSIVE)
+	expectBlocked(t, result, "the insert into the locked range")
+
+	lm.Release(reader)
+	expectGranted(t, result, "the insert once the reader ended")
+}
+
+/**
+ * A transaction cannot lock keys changed by commits its snapshot does not
+ * see, and the failed lock is not held.
+ */
+func TestLockChangedSinceSnapshot(t *testing.T) {
+	lm := locking.NewLockManager()
+	reader := lm.BeginSnapshot(1)
+	writer := lm.Begin()
+	if err := lm.Lock(writer, locking.NewKeyResource("t", 5), locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+	lm.Commit(writer, 2)
+
+	if err := lm.Lock(reader, locking.NewKeyResource("t", 4), locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatalf("a key not changed: %v", err)
+	}
+	err := lm.Lock(reader, locking.NewRangeResource("t", 0, 10), locking.LOCK_SHARED)
+	if err == nil || !strings.Contains(err.Error(), "could not serialize access") {
+		t.Fatalf("got %v, expected a serialization failure", err)
+	}
+	if count := lm.LockCount(reader); count != 1 {
+		t.Errorf("the reader holds %d locks, expected 1", count)
+	}
+
+	// The failed lock does not block others
+	other := lm.Begin()
+	if err := lm.Lock(other, locking.NewKeyResource("t", 6), locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/**
+ * A schema change commits an exclusive lock of the database, so
+ * a transaction with an older snapshot cannot start changing rows.
+ */
+func TestDatabaseChangedSinceSnapshot(t *testing.T) {
+	lm := locking.NewLockManager()
+	reader := lm.BeginSnapshot(1)
+	writer := lm.Begin()
+	if err := lm.Lock(writer, locking.DatabaseResource(), locking.LOCK_EXCLUSIVE); err != nil {
+		t.Fatal(err)
+	}
+	lm.Commit(writer, 2)
+
+	err := lm.Lock(reader, locking.DatabaseResource(), locking.LOCK_SHARED)
+	if err == nil || !strings.Contains(err.Error(), "could not serialize access") {
+		t.Fatalf("got %v, expected a serialization failure", err)
+	}
+}
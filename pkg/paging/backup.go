@@ -0,0 +1,288 @@
+package paging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * Writes a copy of the latest committed version of the database into a new
+ * file at the path, in the mode of the database. The pages are read from
+ * a snapshot, so transactions keep committing while the copy is made, and
+ * the copy holds none of their changes. The copy holds only durable commits,
+ * so the log it continues from is never lost. The file appears at the path
+ * only once it is complete and synced.
+ */
+func (p *Pager) Backup(path string) error {
+	snapshot := p.Snapshot()
+	defer snapshot.Release()
+
+	err := snapshot.WaitDurable()
+	if err != nil {
+		return err
+	}
+
+	free := make(map[uint32]bool, len(snapshot.freePages))
+	for _, ind := range snapshot.freePages {
+		free[ind] = true
+	}
+	pages := make(map[uint32]IPage, snapshot.numPages)
+	for ind := uint32(0); ind < snapshot.numPages; ind++ {
+		if !free[ind] {
+			pages[ind] = snapshot.getPage(ind, nil)
+		}
+	}
+	metadata := serializeMetadata(snapshot.numPages, snapshot.catalogRootPage, snapshot.freePages)
+
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if p.shadow != nil {
+		backup := &Pager{File: file, shadow: newShadowState(), timeline: snapshot.timeline}
+		_, err = backup.writeShadow(metadata, pages, snapshot.numPages, snapshot.commitTime)
+	} else {
+		metadataPage := make([]byte, PAGE_SIZE)
+		copy(metadataPage, metadata)
+		stampMetadata(metadataPage, snapshot.timeline, snapshot.commitTime, snapshot.lsn)
+		err = writeDatabaseFile(file, metadataPage, pages)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return renameSynced(temp, path)
+}
+
+/**
+ * Writes the metadata page and the pages into their places in a database
+ * file in the log mode, and syncs it.
+ */
+func writeDatabaseFile(file *os.File, metadata []byte, pages map[uint32]IPage) error {
+	_, err := file.WriteAt(metadata, 0)
+	if err != nil {
+		return err
+	}
+
+	numPages, _, _ := deserializeMetadata(metadata)
+	err = file.Truncate(pageOffset(numPages))
+	if err != nil {
+		return err
+	}
+	for ind, page := range pages {
+		_, err = file.WriteAt(encodePage(page), pageOffset(ind))
+		if err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+/**
+ * Renames the file and syncs the directory, so the rename survives a crash.
+ */
+func renameSynced(from string, to string) error {
+	err := os.Rename(from, to)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(to))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+/**
+ * Checks that the file holds a whole database, in either mode: that its
+ * metadata is consistent, and that every page it uses is a tree node.
+ */
+func ValidateDatabaseFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+
+	var table *shadowTable
+	metadata := make([]byte, PAGE_SIZE)
+	if table = readSuperblocks(file); table != nil {
+		if slotOffset(table.metadataSlot+1) > size {
+			return errors.New("the metadata page is missing")
+		}
+		for _, slot := range table.tableSlots {
+			if slot < FIRST_PAGE_SLOT || slotOffset(slot+1) > size {
+				return errors.New("a page of the page table is missing")
+			}
+		}
+		_, metadata, err = openShadow(file, table)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err = file.ReadAt(metadata, 0)
+		if err != nil {
+			return errors.New("the file is not a database")
+		}
+	}
+
+	numPages, catalogRootPage, freePages := deserializeMetadata(metadata)
+	if numPages == 0 {
+		return errors.New("the database is empty")
+	}
+	if catalogRootPage >= numPages {
+		return fmt.Errorf("the catalog root page %d is out of range", catalogRootPage)
+	}
+	free := make(map[uint32]bool, len(freePages))
+	for _, ind := range freePages {
+		if ind >= numPages {
+			return fmt.Errorf("the free page %d is out of range", ind)
+		}
+		free[ind] = true
+	}
+	if free[catalogRootPage] {
+		return errors.New("the catalog root page is free")
+	}
+
+	pageBytes := make([]byte, PAGE_SIZE)
+	for ind := uint32(0); ind < numPages; ind++ {
+		if free[ind] {
+			continue
+		}
+
+		offset := pageOffset(ind)
+		if table != nil {
+			if int(ind) >= len(table.slots) || table.slots[ind] < FIRST_PAGE_SLOT {
+				return fmt.Errorf("page %d is missing", ind)
+			}
+			offset = slotOffset(table.slots[ind])
+		}
+		_, err = file.ReadAt(pageBytes, offset)
+		if err == io.EOF {
+			return fmt.Errorf("page %d is missing", ind)
+		}
+		if err != nil {
+			return err
+		}
+
+		header := &NodeHeader{}
+		header.Deserialize(pageBytes)
+		if (header.nodeType != LEAF_NODE && header.nodeType != INTERNAL_NODE) ||
+			int(header.totalBodySize) > PAGE_SIZE-NODE_HEADER_SIZE {
+			return fmt.Errorf("page %d is not a tree node", ind)
+		}
+		if ind == catalogRootPage && !header.isRoot {
+			return errors.New("the catalog root page is not a root")
+		}
+	}
+	return nil
+}
+
+/**
+ * Replaces the database with the backup at the path, once it is validated.
+ * No transaction may be running: their snapshots could not be kept.
+ * The backup is copied next to the database file first, and then renamed
+ * over it, so a crash leaves either the old or the restored database.
+ * The log is emptied by a checkpoint before the rename, since its records
+ * belong to the old database. The restored database starts a new timeline,
+ * so its log is never replayed on top of the old one.
+ */
+func (p *Pager) Restore(path string) error {
+	temp := p.filename + ".restore"
+	err := copyFile(path, temp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+
+	err = ValidateDatabaseFile(temp)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writers > 0 || len(p.snapshots) > 0 {
+		return errors.New("the database is in use by other transactions")
+	}
+	err = p.checkpoint()
+	if err != nil {
+		return err
+	}
+	err = renameSynced(temp, p.filename)
+	if err != nil {
+		return err
+	}
+
+	restored, err := openPager(p.filename, PAGER_LOG)
+	if err != nil {
+		return err
+	}
+	p.File.Close()
+	if p.log != nil {
+		p.log.Close()
+	}
+
+	p.File = restored.File
+	p.log = restored.log
+	p.logSize = 0
+	p.shadow = restored.shadow
+	p.Pages = restored.Pages
+	p.NumPages = restored.NumPages
+	p.CatalogRootPage = restored.CatalogRootPage
+	p.FreePages = restored.FreePages
+	p.dirty = make(map[uint32]bool)
+	p.history = make(map[uint32][]pageVersion)
+	p.version++
+	p.timeline = newTimeline(p.timeline)
+
+	// The LSNs go on from the current one, in the new timeline
+	if p.shadow == nil {
+		err = p.writeMetadata()
+		if err == nil {
+			err = p.File.Sync()
+		}
+	}
+	return err
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(to, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if err == nil {
+		err = target.Sync()
+	}
+	closeErr := target.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package paging
+
+/**
+ * A page on the path of the cursor, kept so the key and the data at the
+ * cursor are read without fetching the page again.
+ */
+type cursorFrame struct {
+	page  IPage
+	index int
+}
+
+/**
+ * A position in a tree, which can be moved over the keys in either order.
+ * The cursor keeps the path from the root to its leaf, so moving to a
+ * neighbouring leaf does not restart from the root. A cursor is invalidated
+ * by any modification of the tree.
+ */
+type Cursor struct {
+	tree  *Tree
+	stack []cursorFrame
+	valid bool
+}
+
+func (t *Tree) NewCursor() *Cursor {
+	cursor := &Cursor{
+		tree:  t,
+		stack: make([]cursorFrame, 0, 8),
+	}
+
+	return cursor
+}
+
+func (c *Cursor) top() *cursorFrame {
+	return &c.stack[len(c.stack)-1]
+}
+
+func (c *Cursor) push(ind uint32) {
+	c.stack = append(c.stack, cursorFrame{page: c.tree.page(ind)})
+}
+
+/**
+ * Descends from the page at the top of the stack to a leaf, always taking the
+ * leftmost (or the rightmost) child, and positions the cursor at the first (or
+ * the last) cell of that leaf.
+ */
+func (c *Cursor) descend(rightmost bool) {
+	for {
+		frame := c.top()
+		page := frame.page
+		numCells := int(page.getNumCells())
+
+		if page.getType() == LEAF_NODE {
+			if rightmost {
+				frame.index = numCells - 1
+			} else {
+				frame.index = 0
+			}
+			return
+		}
+
+		if rightmost {
+			frame.index = numCells
+		} else {
+			frame.index = 0
+		}
+		c.push(page.(*InternalPage).getPointer(uint16(frame.index)))
+	}
+}
+
+func (c *Cursor) leafHasCell() bool {
+	frame := c.top()
+	return frame.index >= 0 && frame.index < int(frame.page.getNumCells())
+}
+
+/**
+ * Positions the cursor at the smallest key. Returns false if the tree is empty.
+ */
+func (c *Cursor) First() bool {
+	c.stack = c.stack[:0]
+	c.push(c.tree.RootPage)
+	c.descend(false)
+	c.valid = c.leafHasCell() || c.advance(1)
+	return c.valid
+}
+
+/**
+ * Positions the cursor at the largest key. Returns false if the tree is empty.
+ */
+func (c *Cursor) Last() bool {
+	c.stack = c.stack[:0]
+	c.push(c.tree.RootPage)
+	c.descend(true)
+	c.valid = c.leafHasCell() || c.advance(-1)
+	return c.valid
+}
+
+/**
+ * Positions the cursor at the smallest key greater than or equal to the
+ * given key. Returns false if there is no such key.
+ */
+func (c *Cursor) Seek(key []byte) bool {
+	c.stack = c.stack[:0]
+	c.push(c.tree.RootPage)
+	for {
+		frame := c.top()
+		page := frame.page
+		ind, exists := page.findIndexForKey(key)
+
+		if page.getType() == LEAF_NODE {
+			frame.index = int(ind)
+			break
+		}
+
+		// equal keys are stored in the right subtree of the separator
+		if exists {
+			ind++
+		}
+		frame.index = int(ind)
+		c.push(page.(*InternalPage).getPointer(ind))
+	}
+
+	c.valid = c.leafHasCell() || c.advance(1)
+	return c.valid
+}
+
+/**
+ * Positions the cursor at the largest key less than or equal to the
+ * given key. Returns false if there is no such key.
+ */
+func (c *Cursor) SeekLast(key []byte) bool {
+	if !c.Seek(key) {
+		return c.Last()
+	}
+	if string(c.Key()) == string(key) {
+		return true
+	}
+	return c.Prev()
+}
+
+/**
+ * Moves the cursor to the next key. Returns false when it moves past the last key.
+ */
+func (c *Cursor) Next() bool {
+	if !c.valid {
+		return false
+	}
+	c.top().index++
+	c.valid = c.leafHasCell() || c.advance(1)
+	return c.valid
+}
+
+/**
+ * Moves the cursor to the previous key. Returns false when it moves past the first key.
+ */
+func (c *Cursor) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	c.top().index--
+	c.valid = c.leafHasCell() || c.advance(-1)
+	return c.valid
+}
+
+/**
+ * Moves to the first cell of the next non-empty leaf (direction 1),
+ * or to the last cell of the previous one (direction -1).
+ */
+func (c *Cursor) advance(direction int) bool {
+	for {
+		// climb until there is a sibling subtree in the given direction
+		for {
+			if len(c.stack) == 1 {
+				return false
+			}
+			c.stack = c.stack[:len(c.stack)-1]
+
+			frame := c.top()
+			frame.index += direction
+			if frame.index >= 0 && frame.index <= int(frame.page.getNumCells()) {
+				break
+			}
+		}
+
+		frame := c.top()
+		c.push(frame.page.(*InternalPage).getPointer(uint16(frame.index)))
+		c.descend(direction < 0)
+
+		if c.leafHasCell() {
+			return true
+		}
+	}
+}
+
+func (c *Cursor) Valid() bool {
+	return c.valid
+}
+
+/**
+ * The key at the cursor. The slice points into the page.
+ */
+func (c *Cursor) Key() []byte {
+	frame := c.top()
+	return frame.page.(*LeafPage).getKey(uint16(frame.index))
+}
+
+/**
+ * The data at the cursor. The slice points into the page.
+ */
+func (c *Cursor) Data() []byte {
+	frame := c.top()
+	return frame.page.(*LeafPage).getData(uint16(frame.index))
+}
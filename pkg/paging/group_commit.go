@@ -0,0 +1,215 @@
+package paging
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * The upper bounds of the buckets of the commit latency histogram, in
+ * microseconds, and of the batch size histogram, in log records.
+ */
+var COMMIT_LATENCY_BUCKETS = []uint64{100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000}
+var BATCH_SIZE_BUCKETS = []uint64{1, 2, 4, 8, 16, 32, 64, 128}
+
+/**
+ * Counts values by buckets. Bucket i counts the values not greater than
+ * Bounds[i] and greater than the previous bound; the last bucket counts
+ * the values greater than every bound.
+ */
+type Histogram struct {
+	Bounds []uint64
+	Counts []uint64
+	Total  uint64
+	Sum    uint64
+}
+
+func NewHistogram(bounds []uint64) Histogram {
+	return Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Add(value uint64) {
+	bucket := len(h.Bounds)
+	for i, bound := range h.Bounds {
+		if value <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.Counts[bucket]++
+	h.Total++
+	h.Sum += value
+}
+
+func (h Histogram) copy() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+/**
+ * Commit latency is measured from the start of the prepare until
+ * the log record of the transaction is synced.
+ */
+type CommitStats struct {
+	Commits   uint64
+	Syncs     uint64
+	Latency   Histogram
+	BatchSize Histogram
+}
+
+/**
+ * Batches the syncs of the log. A committing transaction writes its record
+ * and publishes its changes without waiting, so the next transaction can
+ * write its own record while the first one waits for the sync. The first
+ * waiter becomes the leader: it waits up to the commit delay for more
+ * records and syncs all of them at once, while the others wait for it.
+ * Positions in the log are log sequence numbers (LSNs), which keep growing
+ * when the log is emptied by a checkpoint.
+ */
+type groupCommit struct {
+	mu      sync.Mutex
+	flushed *sync.Cond
+	// The LSN of the start of the log file
+	logStart uint64
+	written  uint64
+	synced   uint64
+	// The number of records written and synced so far
+	records       uint64
+	syncedRecords uint64
+	syncing       bool
+	delay         time.Duration
+	stats         CommitStats
+}
+
+func newGroupCommit() *groupCommit {
+	gc := &groupCommit{
+		stats: CommitStats{
+			Latency:   NewHistogram(COMMIT_LATENCY_BUCKETS),
+			BatchSize: NewHistogram(BATCH_SIZE_BUCKETS),
+		},
+	}
+	gc.flushed = sync.NewCond(&gc.mu)
+
+	return gc
+}
+
+/**
+ * Starts the LSNs at the given one, which is the end of the log file of the given size.
+ */
+func (gc *groupCommit) start(lsn uint64, logSize int64) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.logStart = lsn - uint64(logSize)
+	gc.written = lsn
+	gc.synced = lsn
+}
+
+/**
+ * Returns the LSN of the offset of the log file.
+ */
+func (gc *groupCommit) lsnAt(offset int64) uint64 {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	return gc.logStart + uint64(offset)
+}
+
+/**
+ * Records a log record ending at the given offset of the log file,
+ * and returns the LSN of its end.
+ */
+func (gc *groupCommit) recordWritten(end int64) uint64 {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.written = gc.logStart + uint64(end)
+	gc.records++
+	return gc.written
+}
+
+/**
+ * Records the log emptied by a checkpoint: its records are all in
+ * the database file, so they are durable.
+ */
+func (gc *groupCommit) logTruncated(size int64) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.logStart += uint64(size)
+	gc.written = gc.logStart
+	gc.synced = gc.logStart
+	gc.syncedRecords = gc.records
+	gc.flushed.Broadcast()
+}
+
+/**
+ * Sets how long the leader of a batch waits for more records before
+ * syncing the log. Without a delay, the records written while the log
+ * is being synced still form the next batch.
+ */
+func (p *Pager) SetCommitDelay(delay time.Duration) {
+	p.commits.mu.Lock()
+	defer p.commits.mu.Unlock()
+
+	p.commits.delay = delay
+}
+
+func (p *Pager) CommitStats() CommitStats {
+	p.commits.mu.Lock()
+	defer p.commits.mu.Unlock()
+
+	stats := p.commits.stats
+	stats.Latency = stats.Latency.copy()
+	stats.BatchSize = stats.BatchSize.copy()
+	return stats
+}
+
+/**
+ * Waits until the log is synced up to the LSN, syncing it if no other
+ * transaction is doing so.
+ */
+func (p *Pager) waitSynced(lsn uint64) error {
+	gc := p.commits
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	for gc.synced < lsn {
+		if gc.syncing {
+			gc.flushed.Wait()
+			continue
+		}
+
+		gc.syncing = true
+		if gc.delay > 0 {
+			gc.mu.Unlock()
+			time.Sleep(gc.delay)
+			gc.mu.Lock()
+		}
+		target, records := gc.written, gc.records
+
+		gc.mu.Unlock()
+		err := p.log.Sync()
+		gc.mu.Lock()
+
+		gc.syncing = false
+		gc.flushed.Broadcast()
+		if err != nil {
+			// The record is durable nonetheless if a checkpoint wrote it into the database file meanwhile
+			if gc.synced >= lsn {
+				return nil
+			}
+			return err
+		}
+		gc.stats.Syncs++
+		if target > gc.synced {
+			gc.stats.BatchSize.Add(records - gc.syncedRecords)
+			gc.synced = target
+			gc.syncedRecords = records
+		}
+	}
+	return nil
+}
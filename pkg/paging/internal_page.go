@@ -9,7 +9,7 @@ type InternalPage struct {
 	PageBase
 }
 
-func NewInternalPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16) *InternalPage {
+func NewInternalPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16, keySize uint16) *InternalPage {
 	p := &InternalPage{
 		PageBase: PageBase{
 			nodeHeader: NodeHeader{
@@ -18,7 +18,7 @@ func NewInternalPageWithParams(nodeType NodeType, isRoot bool, parent uint32, nu
 				parent:        parent,
 				numCells:      numCells,
 				totalBodySize: totalBodySize,
-				keySize:       KEY_SIZE,
+				keySize:       keySize,
 			},
 		},
 	}
@@ -28,10 +28,10 @@ type PageBase struct {
 	nodeBody   [PAGE_SIZE - NODE_HEADER_SIZE]byte
 }
 
-func NewIPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16) IPage {
+func NewIPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16, keySize uint16) IPage {
 	if nodeType == LEAF_NODE {
-		return NewLeafPageWithParams(nodeType, isRoot, parent, numCells, totalBodySize)
+		return NewLeafPageWithParams(nodeType, isRoot, parent, numCells, totalBodySize, keySize)
 	} else {
-		return NewInternalPageWithParams(nodeType, isRoot, parent, numCells, totalBodySize)
+		return NewInternalPageWithParams(nodeType, isRoot, parent, numCells, totalBodySize, keySize)
 	}
 }
@@ -9,7 +9,7 @@ type LeafPage struct {
 	PageBase
 }
 
-func NewLeafPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16) *LeafPage {
+func NewLeafPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCells uint16, totalBodySize uint16, keySize uint16) *LeafPage {
 	p := &LeafPage{
 		PageBase: PageBase{
 			nodeHeader: NodeHeader{
@@ -18,7 +18,7 @@ func NewLeafPageWithParams(nodeType NodeType, isRoot bool, parent uint32, numCel
 				parent:        parent,
 				numCells:      numCells,
 				totalBodySize: totalBodySize,
-				keySize:       KEY_SIZE,
+				keySize:       keySize,
 			},
 		},
 	}
@@ -186,7 +186,7 @@ func (lp *LeafPage) transferCellsNotRoot(newParentInd uint32, oldChildInd uint32
 		dest.getNumCells()*OFFSET_SIZE)
 
 	// for the existing node, just shift data left, since the number of offsets is decreased
-	copy(lp.nodeBody[lp.nodeHeader.numCells*OFFSET_SIZE:], lp.nodeBody[oldStartOfCells:lp.nodeHeader.totalBodySize])
+	copy(lp.nodeBody[lp.nodeHeader.numCells*OFFSET_SIZE:], lp.nodeBody[oldStartOfCells:oldStartOfCells+middleElementOffset])
 }
 
 func (lp *LeafPage) transferCells(newParentInd uint32, oldChildInd uint32, newChildInd uint32, newParent IPage, dest IPage) {
@@ -251,13 +251,13 @@ func (lp *LeafPage) transferCells(newParentInd uint32, oldChildInd uint32, newCh
 		dest.getNumCells()*OFFSET_SIZE)
 
 	// for the existing node, just shift data left, since the number of offsets is decreased
-	copy(lp.nodeBody[lp.nodeHeader.numCells*OFFSET_SIZE:], lp.nodeBody[oldStartOfCells:lp.nodeHeader.totalBodySize])
+	copy(lp.nodeBody[lp.nodeHeader.numCells*OFFSET_SIZE:], lp.nodeBody[oldStartOfCells:oldStartOfCells+middleElementOffset])
 }
 
 func (lp *LeafPage) hasSufficientSpace(addedSize uint16) bool {
-	// TODO: check if there is enough space for new data
+	// a new cell takes its key, data size and data, plus an entry in the offset list
 	oldSize := NODE_HEADER_SIZE + lp.nodeHeader.totalBodySize
-	newSize := oldSize + addedSize + lp.nodeHeader.keySize + DATA_SIZE_SIZE
+	newSize := oldSize + addedSize + lp.nodeHeader.keySize + DATA_SIZE_SIZE + OFFSET_SIZE
 	return newSize <= PAGE_SIZE
 }
 
@@ -326,3 +326,40 @@ func (lp *LeafPage) getData(ind uint16) []byte {
 	dataSize := binary.LittleEndian.Uint16(cellStart[lp.nodeHeader.keySize:])
 	return cellStart[lp.nodeHeader.keySize+DATA_SIZE_SIZE : lp.nodeHeader.keySize+DATA_SIZE_SIZE+dataSize]
 }
+
+func (lp *LeafPage) removeDataAtIndex(ind uint16) {
+	startOfCells := lp.getStartOfCells()
+	keySize := lp.nodeHeader.keySize
+	totalBodySize := lp.nodeHeader.totalBodySize
+
+	removedOffset := lp.getOffset(ind)
+	cellStart := startOfCells + removedOffset
+	dataSize := binary.LittleEndian.Uint16(lp.nodeBody[cellStart+keySize:])
+	cellSize := keySize + DATA_SIZE_SIZE + dataSize
+
+	/**
+	 * Drop the offset of the removed cell, and move the offsets of all cells
+	 * placed after it to the left by the size of the removed cell
+	 */
+	offsets := make([]byte, 0, (lp.nodeHeader.numCells-1)*OFFSET_SIZE)
+	for i := uint16(0); i < lp.nodeHeader.numCells; i++ {
+		if i == ind {
+			continue
+		}
+
+		offset := lp.getOffset(i)
+		if offset > removedOffset {
+			offset -= cellSize
+		}
+		offsets = binary.LittleEndian.AppendUint16(offsets, offset)
+	}
+
+	cells := make([]byte, 0, totalBodySize-startOfCells-cellSize)
+	cells = append(cells, lp.nodeBody[startOfCells:cellStart]...)
+	cells = append(cells, lp.nodeBody[cellStart+cellSize:totalBodySize]...)
+
+	lp.nodeHeader.numCells--
+	lp.nodeHeader.totalBodySize -= cellSize + OFFSET_SIZE
+	copy(lp.nodeBody[:], offsets)
+	copy(lp.nodeBody[len(offsets):], cells)
+}
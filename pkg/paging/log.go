@@ -0,0 +1,340 @@
+package paging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * Once the log grows beyond this size, the committed pages are written
+ * into the database file and the log is emptied.
+ */
+const CHECKPOINT_LOG_SIZE = 256 * PAGE_SIZE
+
+/**
+ * Log record outline (one record per committed transaction):
+ * | payload size (4B) | payload crc32 (4B) | metadata page (PAGE_SIZE) | num pages (4B) | (page index (4B) | page (PAGE_SIZE)) * num pages |
+ * A record that is cut short or fails its checksum was never committed,
+ * so replay stops at it. The metadata page of a record holds the timeline,
+ * the time of the commit and the LSN of the end of the record, so the
+ * records can be replayed from archived log segments.
+ */
+const LOG_RECORD_HEADER_SIZE = 4 + 4
+
+func logFilename(filename string) string {
+	return filename + ".log"
+}
+
+/**
+ * Appends a record with the pages and the metadata to the log, and returns
+ * the LSN of its end. The record is durable once the log is synced up to it.
+ * The mutex is held, since a checkpoint may empty the log meanwhile.
+ */
+func (p *Pager) appendLogRecord(metadata []byte, pages map[uint32]IPage, commitTime int64) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payload := make([]byte, PAGE_SIZE+4, PAGE_SIZE+4+len(pages)*(4+PAGE_SIZE))
+	copy(payload, metadata)
+	binary.LittleEndian.PutUint32(payload[PAGE_SIZE:], uint32(len(pages)))
+	for ind, page := range pages {
+		payload = binary.LittleEndian.AppendUint32(payload, ind)
+		payload = append(payload, encodePage(page)...)
+	}
+	end := p.logSize + LOG_RECORD_HEADER_SIZE + int64(len(payload))
+	stampMetadata(payload, p.timeline, commitTime, p.commits.lsnAt(end))
+
+	record := make([]byte, LOG_RECORD_HEADER_SIZE, LOG_RECORD_HEADER_SIZE+len(payload))
+	binary.LittleEndian.PutUint32(record, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	_, err := p.log.WriteAt(record, p.logSize)
+	if err != nil {
+		return 0, err
+	}
+	p.logSize = end
+	return p.commits.recordWritten(p.logSize), nil
+}
+
+/**
+ * Writes the pages changed by the committed transactions and the metadata
+ * into the database file and empties the log.
+ */
+func (p *Pager) Checkpoint() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.checkpoint()
+}
+
+func (p *Pager) checkpoint() error {
+	if p.shadow != nil {
+		return nil
+	}
+	for ind := range p.dirty {
+		if ind < p.NumPages && p.Pages[ind] != nil {
+			_, err := p.File.WriteAt(encodePage(p.Pages[ind]), pageOffset(ind))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := p.writeMetadata()
+	if err != nil {
+		return err
+	}
+	err = p.File.Sync()
+	if err != nil {
+		return err
+	}
+
+	p.dirty = make(map[uint32]bool)
+	if !p.logPublished() {
+		// The log is emptied by a checkpoint after the commit
+		return nil
+	}
+	return p.truncateLog()
+}
+
+/**
+ * Reports whether every record in the log is of a published commit. The
+ * record of a prepared transaction is the only copy of its changes until
+ * they are published, so the log must not be emptied before then.
+ */
+func (p *Pager) logPublished() bool {
+	return p.commits.lsnAt(p.logSize) == p.lsn
+}
+
+/**
+ * Makes every checkpoint copy the log into the directory before emptying
+ * it, so the log is kept as a sequence of segments, each named by the
+ * LSN it starts at. The database file can then be recovered from a backup
+ * to any point in time covered by the segments.
+ */
+func (p *Pager) SetArchiveDir(dir string) error {
+	if p.shadow != nil {
+		return errors.New("the database is in the shadow mode, which has no log")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.archiveDir = dir
+	return nil
+}
+
+/**
+ * Empties the log once the database file holds every record of it,
+ * archiving it first if the pager archives the log.
+ */
+func (p *Pager) truncateLog() error {
+	if p.archiveDir != "" && p.logSize > 0 {
+		err := p.archiveLog()
+		if err != nil {
+			return fmt.Errorf("could not archive the log: %v", err)
+		}
+	}
+
+	err := p.log.Truncate(0)
+	if err != nil {
+		return err
+	}
+	p.commits.logTruncated(p.logSize)
+	p.logSize = 0
+	return p.log.Sync()
+}
+
+const SEGMENT_EXTENSION = ".log"
+
+/**
+ * Archived segment outline:
+ * | zero (4B) | magic (4B) | timeline (8B) | start LSN (8B) | log records |
+ * A log record never starts with a zero payload size, so a segment is told
+ * apart from a log by its header.
+ */
+const SEGMENT_HEADER_SIZE = 4 + 4 + 8 + 8
+const SEGMENT_MAGIC uint32 = 0x4d474553
+
+/**
+ * Returns the name of the segment, made of the timeline and the LSN it
+ * starts at, so the names sort by both.
+ */
+func segmentFilename(dir string, timeline uint64, startLSN uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x%016x%s", timeline, startLSN, SEGMENT_EXTENSION))
+}
+
+/**
+ * Reads the header of the archived segment. Returns false if the file
+ * has no header, as a log does not.
+ */
+func readSegmentHeader(file *os.File) (timeline uint64, startLSN uint64, ok bool) {
+	header := make([]byte, SEGMENT_HEADER_SIZE)
+	_, err := file.ReadAt(header, 0)
+	if err != nil || binary.LittleEndian.Uint32(header) != 0 || binary.LittleEndian.Uint32(header[4:]) != SEGMENT_MAGIC {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint64(header[8:]), binary.LittleEndian.Uint64(header[16:]), true
+}
+
+func (p *Pager) archiveLog() error {
+	startLSN := p.commits.lsnAt(0)
+	target := segmentFilename(p.archiveDir, p.timeline, startLSN)
+	temp := target + ".tmp"
+	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, SEGMENT_HEADER_SIZE)
+	binary.LittleEndian.PutUint32(header[4:], SEGMENT_MAGIC)
+	binary.LittleEndian.PutUint64(header[8:], p.timeline)
+	binary.LittleEndian.PutUint64(header[16:], startLSN)
+	_, err = file.Write(header)
+	if err == nil {
+		_, err = io.Copy(file, io.NewSectionReader(p.log, 0, p.logSize))
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return renameSynced(temp, target)
+}
+
+/**
+ * A complete record of the log: its offset in the log file, the metadata
+ * page and the pages, which are still encoded.
+ */
+type logRecord struct {
+	offset  int64
+	size    int64
+	payload []byte
+}
+
+func (r *logRecord) metadata() []byte {
+	return r.payload[:PAGE_SIZE]
+}
+
+/**
+ * Returns the LSN of the start of the record, and the time and the LSN of the end.
+ */
+func (r *logRecord) stamp() (startLSN uint64, commitTime int64, endLSN uint64) {
+	_, commitTime, endLSN = readMetadataStamp(r.metadata())
+	return endLSN - uint64(r.size), commitTime, endLSN
+}
+
+func (r *logRecord) timeline() uint64 {
+	timeline, _, _ := readMetadataStamp(r.metadata())
+	return timeline
+}
+
+func (r *logRecord) numPages() uint32 {
+	return binary.LittleEndian.Uint32(r.payload[PAGE_SIZE:])
+}
+
+/**
+ * Writes the pages and the metadata of the record into the database file.
+ */
+func (r *logRecord) apply(file *os.File) error {
+	for i := uint32(0); i < r.numPages(); i++ {
+		start := PAGE_SIZE + 4 + i*(4+PAGE_SIZE)
+		ind := binary.LittleEndian.Uint32(r.payload[start:])
+		_, err := file.WriteAt(r.payload[start+4:start+4+PAGE_SIZE], pageOffset(ind))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := file.WriteAt(r.metadata(), 0)
+	return err
+}
+
+/**
+ * Calls the function with the complete records of the log starting at the
+ * offset, in order, until it returns false. Returns the offset of the end
+ * of the last complete record.
+ */
+func readLogRecords(log *os.File, offset int64, fn func(record *logRecord) (bool, error)) (int64, error) {
+	header := make([]byte, LOG_RECORD_HEADER_SIZE)
+	for {
+		_, err := log.ReadAt(header, offset)
+		if err != nil {
+			break
+		}
+		size := binary.LittleEndian.Uint32(header)
+		if size < PAGE_SIZE+4 {
+			break
+		}
+		payload := make([]byte, size)
+		_, err = log.ReadAt(payload, offset+LOG_RECORD_HEADER_SIZE)
+		if err != nil || crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			break
+		}
+
+		numPages := binary.LittleEndian.Uint32(payload[PAGE_SIZE:])
+		if uint64(size) != PAGE_SIZE+4+uint64(numPages)*(4+PAGE_SIZE) {
+			break
+		}
+
+		record := &logRecord{
+			offset:  offset,
+			size:    LOG_RECORD_HEADER_SIZE + int64(size),
+			payload: payload,
+		}
+		more, err := fn(record)
+		if err != nil {
+			return offset, err
+		}
+		if !more {
+			break
+		}
+		offset += record.size
+	}
+	return offset, nil
+}
+
+/**
+ * Applies the complete records of the log to the database file, so the file
+ * holds every committed transaction, and cuts off the incomplete record at
+ * the end of the log, if any. The records are kept in the log until the next
+ * checkpoint, so they are archived along with the later ones. Returns the
+ * size of the log.
+ */
+func replayLog(file *os.File, log *os.File) (int64, error) {
+	replayed := 0
+	size, err := readLogRecords(log, 0, func(record *logRecord) (bool, error) {
+		replayed++
+		return true, record.apply(file)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if replayed > 0 {
+		fmt.Println("Replayed", replayed, "committed transactions from the log")
+		err := file.Sync()
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = log.Truncate(size)
+	if err != nil {
+		return 0, err
+	}
+	return size, log.Sync()
+}
@@ -0,0 +1,169 @@
+package paging
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+/**
+ * Commits a new empty tree and returns its root page.
+ */
+func commitTestTree(t *testing.T, pager *Pager) uint32 {
+	txn, err := pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := NewContext()
+	context.SetView(txn)
+	root := CreateTree(pager, context).RootPage
+	err = txn.Commit()
+	if err == nil {
+		err = txn.WaitDurable()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+/**
+ * Inserts the keys into the tree in a transaction, and returns it prepared
+ * but not yet committed.
+ */
+func prepareTestKeys(t *testing.T, pager *Pager, root uint32, keys []uint64) *Transaction {
+	txn, err := pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := NewContext()
+	context.SetView(txn)
+	insertKeys(NewTree(pager, context, root), keys)
+	err = txn.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+func commitTestKeys(t *testing.T, pager *Pager, root uint32, keys []uint64) {
+	txn := prepareTestKeys(t, pager, root, keys)
+	err := txn.Commit()
+	if err == nil {
+		err = txn.WaitDurable()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/**
+ * Checks that the latest committed version of the tree holds exactly the keys.
+ */
+func checkTestKeys(t *testing.T, pager *Pager, root uint32, keys []uint64) {
+	t.Helper()
+	snapshot := pager.Snapshot()
+	defer snapshot.Release()
+	context := NewContext()
+	context.SetView(snapshot)
+	tree := NewTree(pager, context, root)
+
+	count := 0
+	tree.Scan(func(key []byte, data []byte) bool {
+		count++
+		return true
+	})
+	if count != len(keys) {
+		t.Errorf("the tree holds %d keys, expected %d", count, len(keys))
+	}
+	for _, key := range keys {
+		data, found, err := tree.ReadDataByKey(testKey(key))
+		if err != nil || !found || string(data) != string(testData(key)) {
+			t.Errorf("key %d: found %v, err %v", key, found, err)
+			return
+		}
+	}
+}
+
+/**
+ * Closes the files of the pager without writing anything, as a crash would.
+ */
+func crashPager(pager *Pager) {
+	pager.File.Close()
+	if pager.log != nil {
+		pager.log.Close()
+	}
+}
+
+func TestCheckpointDuringCommits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "db")
+	pager, err := NewPagerInMode(filename, PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commitTestTree(t, pager)
+
+	keys := keyRange(1, 300, 1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			err := pager.Checkpoint()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for _, key := range keys {
+		commitTestKeys(t, pager, root, []uint64{key})
+	}
+	close(done)
+	wg.Wait()
+
+	crashPager(pager)
+	pager, err = NewPagerInMode(filename, PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	checkTestKeys(t, pager, root, keys)
+}
+
+func TestCheckpointKeepsPreparedRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "db")
+	pager, err := NewPagerInMode(filename, PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commitTestTree(t, pager)
+	commitTestKeys(t, pager, root, []uint64{1})
+
+	txn := prepareTestKeys(t, pager, root, []uint64{2})
+	err = pager.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Commit()
+	if err == nil {
+		err = txn.WaitDurable()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crashPager(pager)
+	pager, err = NewPagerInMode(filename, PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	checkTestKeys(t, pager, root, []uint64{1, 2})
+}
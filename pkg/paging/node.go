@@ -3,7 +3,6 @@ package paging
 import (
 	"encoding/binary"
 	"fmt"
-	"unsafe"
 )
 
 type NodeType uint8
@@ -37,7 +36,6 @@ func (nh *NodeHeader) Serialize() []byte {
 	keySizeBytes := make([]byte, 2)
 	binary.LittleEndian.PutUint16(keySizeBytes, nh.keySize)
 
-	fmt.Println(unsafe.Sizeof(*nh))
 	nodeTypeBytes := byte(nh.nodeType)
 
 	isRootUint8 := uint8(0)
@@ -47,17 +45,11 @@ func (nh *NodeHeader) Serialize() []byte {
 	isRootBytes := byte(isRootUint8)
 
 	nodeHeaderBytes := make([]byte, 0, NODE_HEADER_SIZE)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 	nodeHeaderBytes = append(nodeHeaderBytes, parentBytes...)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 	nodeHeaderBytes = append(nodeHeaderBytes, numCellsBytes...)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 	nodeHeaderBytes = append(nodeHeaderBytes, totalBodySizeBytes...)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 	nodeHeaderBytes = append(nodeHeaderBytes, keySizeBytes...)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 	nodeHeaderBytes = append(nodeHeaderBytes, nodeTypeBytes, isRootBytes)
-	fmt.Println("Header byte len:", len(nodeHeaderBytes))
 
 	return nodeHeaderBytes
 }
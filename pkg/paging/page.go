@@ -6,9 +6,12 @@ import (
 )
 
 const PAGE_SIZE = 4096
-const KEY_SIZE uint16 = 4
+const KEY_SIZE uint16 = 8
 const DATA_SIZE_SIZE uint16 = 2
 
+// Largest data that can be stored under a single key, so that every leaf can hold at least four cells
+const MAX_DATA_SIZE = (PAGE_SIZE-NODE_HEADER_SIZE)/4 - int(KEY_SIZE) - int(DATA_SIZE_SIZE) - OFFSET_SIZE
+
 /**
  * Leaf node body outline:
  * - first a list of offsets; each offset is 2 bytes; each value represents
@@ -1,296 +1,389 @@
 package paging
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 )
 
 const MAX_PAGES_PER_TABLE uint32 = 100
 
+/**
+ * Metadata page outline (always the first page of the file):
+ * | num pages (4B) | catalog root page (4B) | num free pages (4B) | free page list (num free pages * 4B) | ... | timeline (8B) | last commit time (8B) | last commit LSN (8B) |
+ * The last commit is the latest one the pages include: its time, in
+ * nanoseconds since the epoch, and the LSN of the end of its log record.
+ * The timeline identifies the history of the database: a new one starts
+ * whenever the database is restored from a backup or recovered to a point,
+ * since its LSNs then go on from a different past.
+ */
+const METADATA_HEADER_SIZE = 4 + 4 + 4
+const METADATA_TRAILER_SIZE = 8 + 8 + 8
+const MAX_FREE_PAGES = (PAGE_SIZE - METADATA_HEADER_SIZE - METADATA_TRAILER_SIZE) / 4
+
+/**
+ * Counts the page requests served by the pager, by whether the page was
+ * already in memory or had to be read from the file.
+ */
+type PageReadStats struct {
+	DiskReads uint64
+	CacheHits uint64
+}
+
+func (s *PageReadStats) countCacheHit() {
+	if s != nil {
+		s.CacheHits++
+	}
+}
+
+func (s *PageReadStats) countDiskRead() {
+	if s != nil {
+		s.DiskReads++
+	}
+}
+
+/**
+ * The pager keeps every page it has read or created in memory. Changes made
+ * in a transaction are made durable by the log at commit, where the syncs
+ * of concurrent commits are batched (group commit), and the changed
+ * (dirty) pages reach the database file itself only at a checkpoint.
+ * Committed pages are never changed: each commit replaces them with new
+ * ones and bumps the version, keeping the replaced pages in the history
+ * for the snapshots of older versions. The mutex guards the page list,
+ * the history and the metadata, so any number of connections can read
+ * the pages while one of them writes. In the shadow mode, there is no log
+ * and no checkpoint: commits write the pages into new places in the file.
+ */
 type Pager struct {
-	Pages             []IPage
-	File              *os.File
-	SizesWritten      []uint32
-	CurrentValueIndex uint32
-	NumPages          uint32
-	RootPage          uint32
+	mu              sync.Mutex
+	filename        string
+	Pages           []IPage
+	File            *os.File
+	NumPages        uint32
+	CatalogRootPage uint32
+	FreePages       []uint32
+	readStats       PageReadStats
+	log             *os.File
+	logSize         int64
+	commits         *groupCommit
+	// Set in the shadow mode, which has no log
+	shadow *shadowState
+	dirty  map[uint32]bool
+	// The time and the LSN of the latest commit
+	commitTime int64
+	lsn        uint64
+	timeline   uint64
+	archiveDir string
+	version    uint64
+	history    map[uint32][]pageVersion
+	snapshots  map[uint64]int
+	// The number of transactions running
+	writers int
 }
 
 func NewPager(filename string) *Pager {
-
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
-	file.Chmod(0666)
+	pager, err := NewPagerInMode(filename, PAGER_LOG)
 	if err != nil {
 		fmt.Println(err)
 		return nil
 	}
 
-	stat, _ := file.Stat()
-	size := stat.Size()
-
-	numPages := uint32(size / PAGE_SIZE)
-	rootPage := uint32(0)
-	tempBytes := make([]byte, PAGE_SIZE)
-	if size > 20480 {
-		file.ReadAt(tempBytes, 0)
-		numPages = binary.LittleEndian.Uint32(tempBytes)
-		rootPage = binary.LittleEndian.Uint32(tempBytes[4:])
-	}
-	fmt.Println("Num pages:", numPages)
-
-	pager := &Pager{
-		Pages:             make([]IPage, numPages, MAX_PAGES_PER_TABLE),
-		File:              file,
-		SizesWritten:      make([]uint32, 0),
-		CurrentValueIndex: 0,
-		NumPages:          uint32(numPages),
-		RootPage:          rootPage,
-	}
-
 	return pager
 }
 
-func (p *Pager) getNextPageInd() uint32 {
-	return p.NumPages
+/**
+ * Opens the database file, creating it in the given mode if it holds no
+ * database yet. An existing database is opened in the mode it was
+ * created in. Fails if the file cannot be opened or its log cannot be
+ * replayed.
+ */
+func NewPagerInMode(filename string, mode PagerMode) (*Pager, error) {
+	return openPager(filename, mode)
 }
 
-func (p *Pager) insertNewPage(page IPage, ind uint32) {
-	if ind == p.NumPages {
-		p.Pages = append(p.Pages, page)
-	} else {
-		p.Pages[ind] = page
+func openPager(filename string, mode PagerMode) (*Pager, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
 	}
-	p.NumPages++
-}
+	file.Chmod(0666)
 
-func (p *Pager) findNodeToInsert(currentPageInd uint32, key []byte) uint32 {
-	currentPage := p.GetPage(currentPageInd)
-	if currentPage.getType() != LEAF_NODE {
-		if !currentPage.hasSufficientSpace(uint16(4 + len(key))) {
-			newPage := NewIPageWithParams(INTERNAL_NODE, false, 0, 0, 0)
-			var parent IPage
-			var parentInd uint32
-
-			if currentPage.getIsRoot() {
-				parent = NewIPageWithParams(INTERNAL_NODE, true, 0, 0, 0)
-				parentInd = p.getNextPageInd()
-				p.insertNewPage(parent, parentInd)
-				p.RootPage = parentInd
-			} else {
-				parentInd = currentPage.getParent()
-				parent = p.GetPage(parentInd)
+	var shadow *shadowState
+	var log *os.File
+	var logSize int64
+	metadata := make([]byte, PAGE_SIZE)
+	if table := readSuperblocks(file); table != nil {
+		shadow, metadata, err = openShadow(file, table)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not read the page table: %v", err)
+		}
+	} else {
+		file.ReadAt(metadata, 0)
+		if mode == PAGER_SHADOW && binary.LittleEndian.Uint32(metadata) == 0 {
+			shadow = newShadowState()
+		} else {
+			log, err = os.OpenFile(logFilename(filename), os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				file.Close()
+				return nil, err
 			}
-
-			newRightChildInd := p.getNextPageInd()
-			p.insertNewPage(newPage, newRightChildInd)
-
-			if currentPage.getIsRoot() {
-				currentPage.transferCells(parentInd, currentPageInd, newRightChildInd, parent, newPage)
-			} else {
-				currentPage.transferCellsNotRoot(parentInd, currentPageInd, newRightChildInd, parent, newPage)
+			logSize, err = replayLog(file, log)
+			if err != nil {
+				file.Close()
+				log.Close()
+				return nil, fmt.Errorf("could not replay the log: %v", err)
 			}
-
-			p.updateParentOfChildren(newRightChildInd)
-			currentPage = parent
+			file.ReadAt(metadata, 0)
 		}
+	}
 
-		internalPage := currentPage.(*InternalPage)
-		keyInd, _ := internalPage.findIndexForKey(key)
-		nextPageInd := internalPage.getPointer(keyInd)
-		return p.findNodeToInsert(nextPageInd, key)
-	} else {
-		return currentPageInd
+	numPages, catalogRootPage, freePages := deserializeMetadata(metadata)
+	timeline, commitTime, lsn := readMetadataStamp(metadata)
+	fmt.Println("Num pages:", numPages)
+
+	pagesCapacity := MAX_PAGES_PER_TABLE
+	if numPages > pagesCapacity {
+		pagesCapacity = numPages
+	}
+
+	pager := &Pager{
+		filename:        filename,
+		Pages:           make([]IPage, numPages, pagesCapacity),
+		File:            file,
+		NumPages:        numPages,
+		CatalogRootPage: catalogRootPage,
+		FreePages:       freePages,
+		log:             log,
+		logSize:         logSize,
+		commits:         newGroupCommit(),
+		shadow:          shadow,
+		dirty:           make(map[uint32]bool),
+		history:         make(map[uint32][]pageVersion),
+		snapshots:       make(map[uint64]int),
+		commitTime:      commitTime,
+		lsn:             lsn,
+		timeline:        timeline,
 	}
+	pager.commits.start(lsn, logSize)
+
+	return pager, nil
 }
 
-func (p *Pager) findNodeToRead(currentPageInd uint32, key []byte) uint32 {
-	currentPage := p.GetPage(currentPageInd)
-	if currentPage.getType() != LEAF_NODE {
-		internalPage := currentPage.(*InternalPage)
-		keyInd, exists := internalPage.findIndexForKey(key)
-		var nextPageInd uint32
-		if exists {
-			nextPageInd = internalPage.getPointer(keyInd + 1)
+/**
+ * Returns the latest committed version of the page.
+ */
+func (p *Pager) GetPage(ind uint32) IPage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.headPage(ind, nil)
+}
+
+/**
+ * Returns the latest committed version of the page, counting the read
+ * in the stats of the pager and, if given, in the stats of the reader.
+ */
+func (p *Pager) headPage(ind uint32, reads *PageReadStats) IPage {
+	if ind < p.NumPages {
+		if p.Pages[ind] != nil {
+			p.readStats.CacheHits++
+			reads.countCacheHit()
 		} else {
-			nextPageInd = internalPage.getPointer(keyInd)
+			p.readStats.DiskReads++
+			reads.countDiskRead()
+			tempBytes := make([]byte, PAGE_SIZE)
+			p.File.ReadAt(tempBytes, p.fileOffset(ind))
+			p.Pages[ind] = decodePage(tempBytes)
 		}
-		return p.findNodeToRead(nextPageInd, key)
 	} else {
-		return currentPageInd
+		panic("Page index out of range!")
 	}
+	return p.Pages[ind]
 }
 
-func (p *Pager) AddNewData(key []byte, data []byte) {
-	if p.NumPages == 0 {
-		p.NumPages = 1
-		p.Pages = append(p.Pages, NewIPageWithParams(LEAF_NODE, true, 0, 0, 0))
-	}
+func (p *Pager) ReadStats() PageReadStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// root := p.GetPage(p.RootPage)
-	// var pageToInsert *Page
-
-	pageToInsertInd := p.findNodeToInsert(p.RootPage, key)
-	pageToInsert := p.GetPage(pageToInsertInd)
-
-	if !pageToInsert.hasSufficientSpace(uint16(len(data))) {
-		/**
-		 * This executes when root is full, in order to split it.
-		 * Currently works only when root was leaf, and should now
-		 * be split into two children with new root.
-		 * TODO: Remove hard coded parts
-		 */
-		newPage := NewIPageWithParams(LEAF_NODE, false, 0, 0, 0)
-		var parent IPage
-		var parentInd uint32
-		if pageToInsert.getIsRoot() {
-			parent = NewIPageWithParams(INTERNAL_NODE, true, 0, 0, 0)
-			parentInd = p.getNextPageInd()
-			p.insertNewPage(parent, parentInd)
-			p.RootPage = parentInd
-		} else {
-			parentInd = pageToInsert.getParent()
-			parent = p.GetPage(parentInd)
-		}
+	return p.readStats
+}
 
-		newRightChildInd := p.getNextPageInd()
-		p.insertNewPage(newPage, newRightChildInd)
+func (p *Pager) PageCount() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-		if pageToInsert.getIsRoot() {
-			pageToInsert.transferCells(parentInd, pageToInsertInd, newRightChildInd, parent, newPage)
-		} else {
-			pageToInsert.transferCellsNotRoot(parentInd, pageToInsertInd, newRightChildInd, parent, newPage)
-		}
+	return p.NumPages
+}
 
-		// The leftmost key in the right child decides which child the new key belongs to
-		decisionKey := newPage.getKey(0)
-
-		/**
-		 * Compare the decision key and the key of new data,
-		 * in order to decide which child gets the new element.
-		 * Should be implemented as recursive search through nodes.
-		 */
-		compareResult := bytes.Compare(decisionKey, key)
-		if compareResult == -1 {
-			pageToInsert = newPage
+/**
+ * Writes every committed page in memory and the metadata into the database
+ * file and closes it. The changes of an unfinished transaction are never
+ * among them. Once the file is synced, the log is no longer needed.
+ */
+func (p *Pager) ClearPager() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shadow != nil {
+		// Every committed page is already in the file
+		p.File.Close()
+		return
+	}
+
+	p.writeMetadata()
+
+	for ind, page := range p.Pages {
+		if page != nil {
+			n, _ := p.File.WriteAt(encodePage(page), pageOffset(uint32(ind)))
+			fmt.Println("Written", n, "bytes for the page")
 		}
 	}
 
-	index, _ := pageToInsert.findIndexForKey(key)
-	leafPage := pageToInsert.(*LeafPage)
-	leafPage.insertDataAtIndex(index, key, data)
+	if p.File.Sync() == nil && p.logPublished() {
+		p.truncateLog()
+	}
+	p.log.Close()
+	p.File.Close()
 }
 
-func (p *Pager) ReadAllPages() []byte {
-	/**
-	 * Reads all the pages in a sorted order.
-	 */
-	values := make([]byte, 0, p.NumPages*PAGE_SIZE)
-	p.ReadPageAtIndRec(p.RootPage, &values)
-	return values
+func (p *Pager) writeMetadata() error {
+	pagerMetadataBytesToWrite := make([]byte, PAGE_SIZE)
+	copy(pagerMetadataBytesToWrite, p.SerializeMetadata())
+	stampMetadata(pagerMetadataBytesToWrite, p.timeline, p.commitTime, p.lsn)
+	_, err := p.File.WriteAt(pagerMetadataBytesToWrite, 0)
+	return err
 }
 
-func (p *Pager) ReadPageAtIndRec(ind uint32, values *[]byte) {
-	currentPage := p.GetPage(ind)
-	if currentPage.getType() == LEAF_NODE {
-		leafPage := currentPage.(*LeafPage)
-		for i := 0; i < int(currentPage.getNumCells()); i++ {
-			*values = append(*values, leafPage.getData(uint16(i))...)
-		}
-	} else {
-		for i := 0; i <= int(currentPage.getNumCells()); i++ {
-			internalPage := currentPage.(*InternalPage)
-			p.ReadPageAtIndRec(internalPage.getPointer(uint16(i)), values)
-		}
+/**
+ * Returns the offset of the latest committed version of the page in the
+ * database file. In the shadow mode, the page table tells where it is.
+ */
+func (p *Pager) fileOffset(ind uint32) int64 {
+	if p.shadow != nil {
+		return slotOffset(p.shadow.head.slots[ind])
 	}
+	return pageOffset(ind)
 }
 
-func (p *Pager) ReadDataByKey(key []byte) []byte {
-	pageInd := p.findNodeToRead(p.RootPage, key)
-	page := p.GetPage(pageInd)
+/**
+ * Returns the offset of the page in the database file, which starts with the metadata page.
+ */
+func pageOffset(ind uint32) int64 {
+	return int64(ind+1) * PAGE_SIZE
+}
 
-	ind, _ := page.findIndexForKey(key)
-	data := (page.(*LeafPage)).getData(ind)
-	return data
+func encodePage(page IPage) []byte {
+	pageBytes := make([]byte, PAGE_SIZE)
+	copy(pageBytes, page.getHeader().Serialize())
+	copy(pageBytes[NODE_HEADER_SIZE:], page.getBody())
+	return pageBytes
 }
 
-func (p *Pager) GetPage(ind uint32) IPage {
-	if ind < p.NumPages {
-		if p.Pages[ind] == nil {
-			tempBytes := make([]byte, PAGE_SIZE)
-			p.File.ReadAt(tempBytes, int64((ind+1)*PAGE_SIZE))
-			nodeHeader := &NodeHeader{}
-			nodeHeader.Deserialize(tempBytes)
-			nodeBodyBytes := tempBytes[NODE_HEADER_SIZE:]
-
-			p.Pages[ind] = NewIPageWithParams(
-				nodeHeader.nodeType,
-				nodeHeader.isRoot,
-				nodeHeader.parent,
-				nodeHeader.numCells,
-				nodeHeader.totalBodySize,
-			)
-
-			p.Pages[ind].setNodeBody(nodeBodyBytes)
-		}
-	} else {
-		// newPages := make([]IPage, ind-p.NumPages+1)
-		// p.Pages = append(p.Pages, newPages...)
-		// p.Pages[ind] = NewPage()
-		// p.NumPages++
-		panic("Page index out of range!")
-	}
-	return p.Pages[ind]
+func decodePage(pageBytes []byte) IPage {
+	nodeHeader := &NodeHeader{}
+	nodeHeader.Deserialize(pageBytes)
+
+	page := NewIPageWithParams(
+		nodeHeader.nodeType,
+		nodeHeader.isRoot,
+		nodeHeader.parent,
+		nodeHeader.numCells,
+		nodeHeader.totalBodySize,
+		nodeHeader.keySize,
+	)
+	page.setNodeBody(pageBytes[NODE_HEADER_SIZE:])
+	return page
 }
 
-func (p *Pager) ClearPager() {
-	pagerMetadataBytesToWrite := make([]byte, PAGE_SIZE)
-	pagerMetadataBytes := p.SerializeMetadata()
-	copy(pagerMetadataBytesToWrite, pagerMetadataBytes)
-	p.File.WriteAt(pagerMetadataBytes, 0)
+/**
+ * Returns a copy of the page, which can be changed without affecting the original.
+ */
+func copyPage(page IPage) IPage {
+	return decodePage(encodePage(page))
+}
 
-	for ind, page := range p.Pages {
-		if page != nil {
-			pageBytes := make([]byte, PAGE_SIZE)
-			nodeBytes := page.getHeader().Serialize()
-			copy(pageBytes, nodeBytes)
+func (p *Pager) isFree(ind uint32) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-			copy(pageBytes[NODE_HEADER_SIZE:], page.getBody())
+	for _, freeInd := range p.FreePages {
+		if freeInd == ind {
+			return true
+		}
+	}
+	return false
+}
 
-			// n, _ := p.File.Write(pageBytes)
-			n, _ := p.File.WriteAt(pageBytes, int64((ind+1)*PAGE_SIZE))
-			fmt.Println("Written", n, "bytes for the page")
+func (p *Pager) PrintPages() {
+	for ind := uint32(0); ind < p.PageCount(); ind++ {
+		if p.isFree(ind) {
+			fmt.Println("Page", ind, "is free")
+			continue
 		}
+		page := p.GetPage(ind)
+		fmt.Print("Page ", ind, ": ")
+		page.getHeader().Print()
 	}
+}
 
-	p.File.Close()
+func (p *Pager) SerializeMetadata() []byte {
+	return serializeMetadata(p.NumPages, p.CatalogRootPage, p.FreePages)
 }
 
-func (p *Pager) updateParentOfChildren(newParentInd uint32) {
-	page := p.GetPage(newParentInd)
-	internalPage := page.(*InternalPage)
-	for i := 0; i <= int(page.getNumCells()); i++ {
-		childPage := p.GetPage(internalPage.getPointer(uint16(i)))
-		childPage.setParent(newParentInd)
+func deserializeMetadata(metadata []byte) (numPages uint32, catalogRootPage uint32, freePages []uint32) {
+	numPages = binary.LittleEndian.Uint32(metadata)
+	catalogRootPage = binary.LittleEndian.Uint32(metadata[4:])
+	numFreePages := binary.LittleEndian.Uint32(metadata[8:])
+	if numFreePages > MAX_FREE_PAGES {
+		numFreePages = MAX_FREE_PAGES
+	}
+	freePages = make([]uint32, 0, numFreePages)
+	for i := uint32(0); i < numFreePages; i++ {
+		freePages = append(freePages, binary.LittleEndian.Uint32(metadata[METADATA_HEADER_SIZE+i*4:]))
 	}
+	return numPages, catalogRootPage, freePages
 }
 
-func (p *Pager) PrintPages() {
-	for ind, page := range p.Pages {
-		if page == nil {
-			page = p.GetPage(uint32(ind))
-		}
-		//page.Print()
-		fmt.Println(page.getNumCells())
-		fmt.Println("Implement page printing")
+/**
+ * Records the timeline and the last commit in the metadata page.
+ */
+func stampMetadata(metadata []byte, timeline uint64, commitTime int64, lsn uint64) {
+	binary.LittleEndian.PutUint64(metadata[PAGE_SIZE-METADATA_TRAILER_SIZE:], timeline)
+	binary.LittleEndian.PutUint64(metadata[PAGE_SIZE-16:], uint64(commitTime))
+	binary.LittleEndian.PutUint64(metadata[PAGE_SIZE-8:], lsn)
+}
+
+func readMetadataStamp(metadata []byte) (timeline uint64, commitTime int64, lsn uint64) {
+	timeline = binary.LittleEndian.Uint64(metadata[PAGE_SIZE-METADATA_TRAILER_SIZE:])
+	commitTime = int64(binary.LittleEndian.Uint64(metadata[PAGE_SIZE-16:]))
+	lsn = binary.LittleEndian.Uint64(metadata[PAGE_SIZE-8:])
+	return timeline, commitTime, lsn
+}
+
+/**
+ * Returns the timeline to start after the given one. Timelines are taken
+ * from the clock, so the branches of one history made from different
+ * copies of the database do not share a timeline.
+ */
+func newTimeline(after uint64) uint64 {
+	timeline := uint64(time.Now().UnixNano())
+	if timeline <= after {
+		timeline = after + 1
 	}
+	return timeline
 }
 
-func (p *Pager) SerializeMetadata() []byte {
-	pagerMetadataBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint32(pagerMetadataBytes[0:4], p.NumPages)
-	binary.LittleEndian.PutUint32(pagerMetadataBytes[4:8], p.RootPage)
+func serializeMetadata(numPages uint32, catalogRootPage uint32, freePages []uint32) []byte {
+	pagerMetadataBytes := make([]byte, METADATA_HEADER_SIZE+len(freePages)*4)
+	binary.LittleEndian.PutUint32(pagerMetadataBytes[0:4], numPages)
+	binary.LittleEndian.PutUint32(pagerMetadataBytes[4:8], catalogRootPage)
+	binary.LittleEndian.PutUint32(pagerMetadataBytes[8:12], uint32(len(freePages)))
+	for i, freeInd := range freePages {
+		binary.LittleEndian.PutUint32(pagerMetadataBytes[METADATA_HEADER_SIZE+i*4:], freeInd)
+	}
 
 	return pagerMetadataBytes
 }
@@ -0,0 +1,250 @@
+package paging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Where a point-in-time recovery stops: after the last commit made at or
+ * before the time, and ending at or before the LSN. A zero value of either
+ * does not bound the recovery.
+ */
+type RecoveryTarget struct {
+	Time time.Time
+	LSN  uint64
+}
+
+func (rt RecoveryTarget) includes(commitTime int64, endLSN uint64) bool {
+	if !rt.Time.IsZero() && commitTime > rt.Time.UnixNano() {
+		return false
+	}
+	return rt.LSN == 0 || endLSN <= rt.LSN
+}
+
+/**
+ * A commit found in the log: the timeline it was made in, where its record
+ * starts and ends, when it was made and how many pages it changed.
+ */
+type LoggedCommit struct {
+	Segment  string
+	Timeline uint64
+	StartLSN uint64
+	EndLSN   uint64
+	Time     time.Time
+	Pages    uint32
+}
+
+type RecoveryResult struct {
+	BaseLSN  uint64
+	Replayed int
+	// The end of the last commit replayed, or of the base backup
+	LSN  uint64
+	Time time.Time
+	// The timeline of the backup, and the new one of the recovered database
+	BaseTimeline uint64
+	Timeline     uint64
+}
+
+/**
+ * Returns the log segments archived in the directory, oldest first.
+ */
+func ArchivedSegments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		stem := strings.TrimSuffix(name, SEGMENT_EXTENSION)
+		if entry.IsDir() || len(stem) != 32 || stem == name {
+			continue
+		}
+		if _, err := strconv.ParseUint(stem[:16], 16, 64); err != nil {
+			continue
+		}
+		if _, err := strconv.ParseUint(stem[16:], 16, 64); err != nil {
+			continue
+		}
+		segments = append(segments, filepath.Join(dir, name))
+	}
+	// The names are fixed width, so they sort by the timeline and the LSN
+	sort.Strings(segments)
+	return segments, nil
+}
+
+/**
+ * Calls the function with every complete record of the log files, in order.
+ * An archived segment must hold only records of the timeline in its header.
+ */
+func readLogFiles(logs []string, fn func(segment string, record *logRecord) (bool, error)) error {
+	for _, segment := range logs {
+		log, err := os.Open(segment)
+		if err != nil {
+			return err
+		}
+
+		timeline, _, archived := readSegmentHeader(log)
+		start := int64(0)
+		if archived {
+			start = SEGMENT_HEADER_SIZE
+		}
+		more := true
+		_, err = readLogRecords(log, start, func(record *logRecord) (bool, error) {
+			if archived && record.timeline() != timeline {
+				return false, fmt.Errorf("%s holds a record of timeline %x, not of timeline %x", segment, record.timeline(), timeline)
+			}
+			var fnErr error
+			more, fnErr = fn(segment, record)
+			return more, fnErr
+		})
+		log.Close()
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Lists the commits logged in the log files, e.g. to find the LSN
+ * to recover to.
+ */
+func ListLoggedCommits(logs []string) ([]LoggedCommit, error) {
+	commits := make([]LoggedCommit, 0)
+	err := readLogFiles(logs, func(segment string, record *logRecord) (bool, error) {
+		startLSN, commitTime, endLSN := record.stamp()
+		commits = append(commits, LoggedCommit{
+			Segment:  segment,
+			Timeline: record.timeline(),
+			StartLSN: startLSN,
+			EndLSN:   endLSN,
+			Time:     time.Unix(0, commitTime),
+			Pages:    record.numPages(),
+		})
+		return true, nil
+	})
+	return commits, err
+}
+
+/**
+ * Creates a database at the target path from a base backup, by replaying the
+ * commits of the log files made after the backup, up to the recovery target.
+ * The log files are archived segments, in order, possibly followed by the
+ * log of the database they were archived from. The commits must follow the
+ * backup without a gap, in the timeline of the backup: the commits of other
+ * timelines are skipped, and the recovery fails rather than go on in one.
+ * The recovered database starts a new timeline. Only backups of databases
+ * in the log mode can be recovered, since the shadow mode keeps no log.
+ */
+func RecoverToPoint(backupPath string, logs []string, targetPath string, target RecoveryTarget) (*RecoveryResult, error) {
+	for _, path := range []string{targetPath, logFilename(targetPath)} {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	err := ValidateDatabaseFile(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	temp := targetPath + ".tmp"
+	err = copyFile(backupPath, temp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp)
+
+	file, err := os.OpenFile(temp, os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if readSuperblocks(file) != nil {
+		return nil, errors.New("the backup is of a database in the shadow mode, which has no log")
+	}
+
+	metadata := make([]byte, PAGE_SIZE)
+	_, err = file.ReadAt(metadata, 0)
+	if err != nil {
+		return nil, err
+	}
+	timeline, commitTime, baseLSN := readMetadataStamp(metadata)
+	result := &RecoveryResult{
+		BaseLSN:      baseLSN,
+		LSN:          baseLSN,
+		Time:         time.Unix(0, commitTime),
+		BaseTimeline: timeline,
+	}
+
+	// The LSNs where the log goes on in another timeline, within the target
+	branches := make(map[uint64]uint64)
+	err = readLogFiles(logs, func(segment string, record *logRecord) (bool, error) {
+		startLSN, commitTime, endLSN := record.stamp()
+		if record.timeline() != timeline {
+			// Another history, whose LSNs may repeat the ones of the backup
+			if target.includes(commitTime, endLSN) {
+				branches[startLSN] = record.timeline()
+			}
+			return true, nil
+		}
+		if endLSN <= result.LSN {
+			// Included in the backup, or in a segment read before
+			return true, nil
+		}
+		if startLSN != result.LSN {
+			return false, fmt.Errorf("the commits between LSN %d and %d are missing", result.LSN, startLSN)
+		}
+		if !target.includes(commitTime, endLSN) {
+			return false, nil
+		}
+
+		err := record.apply(file)
+		if err != nil {
+			return false, err
+		}
+		result.Replayed++
+		result.LSN = endLSN
+		result.Time = time.Unix(0, commitTime)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if other, exists := branches[result.LSN]; exists {
+		return nil, fmt.Errorf("the log goes on from LSN %d in timeline %x, but the backup is of timeline %x", result.LSN, other, timeline)
+	}
+
+	// The recovered database starts a history of its own
+	_, err = file.ReadAt(metadata, 0)
+	if err != nil {
+		return nil, err
+	}
+	result.Timeline = newTimeline(timeline)
+	stampMetadata(metadata, result.Timeline, result.Time.UnixNano(), result.LSN)
+	_, err = file.WriteAt(metadata, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Sync()
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateDatabaseFile(temp)
+	if err != nil {
+		return nil, fmt.Errorf("the recovered database is invalid: %v", err)
+	}
+	err = renameSynced(temp, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
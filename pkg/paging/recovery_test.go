@@ -0,0 +1,198 @@
+package paging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Opens a new database in the log mode, archiving its log into a directory
+ * of the test, and commits an empty tree. Returns the pager, the root page
+ * of the tree and the archive directory.
+ */
+func newArchivingPager(t *testing.T) (*Pager, uint32, string) {
+	dir := t.TempDir()
+	pager, err := NewPagerInMode(filepath.Join(dir, "db"), PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pager.ClearPager)
+	archive := filepath.Join(dir, "archive")
+	err = pager.SetArchiveDir(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pager, commitTestTree(t, pager), archive
+}
+
+/**
+ * Commits every key in a transaction of its own, and archives the log after
+ * every few of them.
+ */
+func commitArchivedKeys(t *testing.T, pager *Pager, root uint32, keys []uint64, perSegment int) {
+	for i, key := range keys {
+		commitTestKeys(t, pager, root, []uint64{key})
+		if (i+1)%perSegment == 0 {
+			err := pager.Checkpoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func backupTestPager(t *testing.T, pager *Pager) string {
+	path := filepath.Join(t.TempDir(), "backup")
+	err := pager.Backup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loggedTestCommits(t *testing.T, archive string) ([]string, []LoggedCommit) {
+	segments, err := ArchivedSegments(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := ListLoggedCommits(segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments, commits
+}
+
+/**
+ * Recovers the backup into a new database, replaying the given number of
+ * commits, and checks that its tree holds exactly the keys.
+ */
+func checkRecovered(t *testing.T, backup string, segments []string, target RecoveryTarget, root uint32, replayed int, keys []uint64) *RecoveryResult {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "recovered")
+	result, err := RecoverToPoint(backup, segments, filename, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replayed != replayed {
+		t.Errorf("replayed %d commits, expected %d", result.Replayed, replayed)
+	}
+
+	pager, err := NewPagerInMode(filename, PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	if pager.timeline != result.Timeline || result.Timeline == result.BaseTimeline {
+		t.Errorf("the recovered database is in timeline %x, recovered %x from %x", pager.timeline, result.Timeline, result.BaseTimeline)
+	}
+	checkTestKeys(t, pager, root, keys)
+	return result
+}
+
+func TestRecoverToPoint(t *testing.T) {
+	pager, root, archive := newArchivingPager(t)
+	commitArchivedKeys(t, pager, root, []uint64{1, 2}, 2)
+	backup := backupTestPager(t, pager)
+	commitArchivedKeys(t, pager, root, keyRange(3, 8, 1), 2)
+
+	segments, commits := loggedTestCommits(t, archive)
+	if len(segments) != 4 {
+		t.Fatalf("the log was archived in %d segments, expected 4", len(segments))
+	}
+	// The tree and the keys before the backup
+	logged := commits[3:]
+
+	tests := []struct {
+		name   string
+		target RecoveryTarget
+		keys   []uint64
+	}{
+		{"to the end", RecoveryTarget{}, keyRange(3, 8, 1)},
+		{"to an LSN", RecoveryTarget{LSN: logged[2].EndLSN}, keyRange(3, 5, 1)},
+		{"to an LSN within a commit", RecoveryTarget{LSN: logged[2].EndLSN - 1}, keyRange(3, 4, 1)},
+		{"to the LSN of the backup", RecoveryTarget{LSN: logged[0].StartLSN}, []uint64{}},
+		{"to a time", RecoveryTarget{Time: logged[3].Time}, keyRange(3, 6, 1)},
+		{"to a time before a commit", RecoveryTarget{Time: logged[3].Time.Add(-1)}, keyRange(3, 5, 1)},
+		{"to a time and an LSN", RecoveryTarget{Time: logged[4].Time, LSN: logged[1].EndLSN}, keyRange(3, 4, 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := checkRecovered(t, backup, segments, test.target, root, len(test.keys), append([]uint64{1, 2}, test.keys...))
+			if len(test.keys) > 0 && result.LSN != logged[len(test.keys)-1].EndLSN {
+				t.Errorf("recovered to LSN %d, expected %d", result.LSN, logged[len(test.keys)-1].EndLSN)
+			}
+		})
+	}
+}
+
+func TestRecoverToPointWithGap(t *testing.T) {
+	pager, root, archive := newArchivingPager(t)
+	backup := backupTestPager(t, pager)
+	commitArchivedKeys(t, pager, root, keyRange(1, 6, 1), 2)
+
+	segments, _ := loggedTestCommits(t, archive)
+	err := os.Remove(segments[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, _ = loggedTestCommits(t, archive)
+
+	filename := filepath.Join(t.TempDir(), "recovered")
+	_, err = RecoverToPoint(backup, segments, filename, RecoveryTarget{})
+	if err == nil || !strings.Contains(err.Error(), "are missing") {
+		t.Fatalf("got %v, expected missing commits", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("the database was recovered despite the gap")
+	}
+}
+
+/**
+ * The database is restored from a backup, and goes on from the same LSN
+ * in a new timeline. Neither history may be replayed onto a backup of
+ * the other.
+ */
+func TestRecoverToPointAcrossRestore(t *testing.T) {
+	pager, root, archive := newArchivingPager(t)
+	before := backupTestPager(t, pager)
+	commitArchivedKeys(t, pager, root, []uint64{1, 2}, 2)
+	timeline := pager.timeline
+
+	err := pager.Restore(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pager.timeline == timeline {
+		t.Fatal("the restored database is in the old timeline")
+	}
+	commitArchivedKeys(t, pager, root, []uint64{10, 11}, 2)
+	after := backupTestPager(t, pager)
+	commitArchivedKeys(t, pager, root, []uint64{12}, 1)
+
+	segments, commits := loggedTestCommits(t, archive)
+	last := commits[len(commits)-1]
+	if last.Timeline != pager.timeline || !strings.HasPrefix(filepath.Base(last.Segment), fmt.Sprintf("%016x", pager.timeline)) {
+		t.Errorf("the last commit is in timeline %x of %s", last.Timeline, last.Segment)
+	}
+
+	filename := filepath.Join(t.TempDir(), "recovered")
+	_, err = RecoverToPoint(before, segments, filename, RecoveryTarget{})
+	if err == nil || !strings.Contains(err.Error(), "timeline") {
+		t.Fatalf("got %v, expected a refusal to change the timeline", err)
+	}
+
+	// Up to the restore, the old timeline can be recovered
+	var restoredAt uint64
+	for _, commit := range commits {
+		if commit.Timeline == timeline {
+			restoredAt = commit.EndLSN
+		}
+	}
+	checkRecovered(t, before, segments, RecoveryTarget{LSN: restoredAt}, root, 2, []uint64{1, 2})
+	// The backup of the new timeline skips the commits of the old one
+	checkRecovered(t, after, segments, RecoveryTarget{}, root, 1, []uint64{10, 11, 12})
+}
@@ -0,0 +1,298 @@
+package paging
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+/**
+ * How the pager makes commits durable. In the log mode, pages are written
+ * to the log at commit and into their place in the database file at
+ * a checkpoint. In the shadow mode, the file is never changed in place:
+ * a commit writes the pages it changed into free slots of the file, along
+ * with a new page table mapping the pages to their slots, and publishes
+ * the table by writing the superblock. The mode of a database is chosen
+ * when it is created.
+ */
+type PagerMode int8
+
+const (
+	PAGER_LOG PagerMode = iota
+	PAGER_SHADOW
+)
+
+/**
+ * Superblock outline (two copies, in slots 0 and 1 of the file):
+ * | magic (4B) | crc32 of the rest of the page (4B) | sequence (8B) | metadata slot (4B) | num pages (4B) | num table pages (4B) | table page slot (4B) * num table pages |
+ * A commit writes the superblock with the next sequence number into the
+ * copy not holding the current one, so a torn write leaves the current one
+ * intact. The valid copy with the highest sequence is the committed one.
+ * Table pages hold the slots of consecutive pages, 0 for a page without one.
+ */
+const SHADOW_MAGIC uint32 = 0x57444853
+const SUPERBLOCK_HEADER_SIZE = 4 + 4 + 8 + 4 + 4 + 4
+const SLOTS_PER_TABLE_PAGE = PAGE_SIZE / 4
+const MAX_TABLE_PAGES = (PAGE_SIZE - SUPERBLOCK_HEADER_SIZE) / 4
+const FIRST_PAGE_SLOT uint32 = 2
+
+/**
+ * The slots of the pages of a committed version: of every page,
+ * of the table pages and of the metadata page.
+ */
+type shadowTable struct {
+	sequence     uint64
+	metadataSlot uint32
+	slots        []uint32
+	tableSlots   []uint32
+}
+
+func (st *shadowTable) clone() *shadowTable {
+	return &shadowTable{
+		sequence:     st.sequence,
+		metadataSlot: st.metadataSlot,
+		slots:        append([]uint32(nil), st.slots...),
+		tableSlots:   append([]uint32(nil), st.tableSlots...),
+	}
+}
+
+/**
+ * The state of a pager in the shadow mode. The head table is the one of the
+ * latest published version, which the pages are read by. The slots not used
+ * by the latest durable table are free; the slots freed by a commit can be
+ * reused only once its superblock is durable. Only the writer allocates slots.
+ */
+type shadowState struct {
+	head     *shadowTable
+	free     []uint32
+	numSlots uint32
+}
+
+func newShadowState() *shadowState {
+	return &shadowState{
+		head:     &shadowTable{},
+		free:     make([]uint32, 0),
+		numSlots: FIRST_PAGE_SLOT,
+	}
+}
+
+func (s *shadowState) allocate() uint32 {
+	if len(s.free) > 0 {
+		slot := s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		return slot
+	}
+	slot := s.numSlots
+	s.numSlots++
+	return slot
+}
+
+func slotOffset(slot uint32) int64 {
+	return int64(slot) * PAGE_SIZE
+}
+
+func encodeSuperblock(table *shadowTable) []byte {
+	block := make([]byte, PAGE_SIZE)
+	binary.LittleEndian.PutUint32(block, SHADOW_MAGIC)
+	binary.LittleEndian.PutUint64(block[8:], table.sequence)
+	binary.LittleEndian.PutUint32(block[16:], table.metadataSlot)
+	binary.LittleEndian.PutUint32(block[20:], uint32(len(table.slots)))
+	binary.LittleEndian.PutUint32(block[24:], uint32(len(table.tableSlots)))
+	for i, slot := range table.tableSlots {
+		binary.LittleEndian.PutUint32(block[SUPERBLOCK_HEADER_SIZE+i*4:], slot)
+	}
+	binary.LittleEndian.PutUint32(block[4:], crc32.ChecksumIEEE(block[8:]))
+	return block
+}
+
+/**
+ * Returns the table of the valid superblock with the highest sequence,
+ * without the slots of the pages, or nil if there is none.
+ */
+func readSuperblocks(file *os.File) *shadowTable {
+	var current *shadowTable
+	block := make([]byte, PAGE_SIZE)
+	for copyInd := uint32(0); copyInd < FIRST_PAGE_SLOT; copyInd++ {
+		_, err := file.ReadAt(block, slotOffset(copyInd))
+		if err != nil ||
+			binary.LittleEndian.Uint32(block) != SHADOW_MAGIC ||
+			binary.LittleEndian.Uint32(block[4:]) != crc32.ChecksumIEEE(block[8:]) {
+			continue
+		}
+		numTablePages := binary.LittleEndian.Uint32(block[24:])
+		if numTablePages > MAX_TABLE_PAGES {
+			continue
+		}
+
+		table := &shadowTable{
+			sequence:     binary.LittleEndian.Uint64(block[8:]),
+			metadataSlot: binary.LittleEndian.Uint32(block[16:]),
+			slots:        make([]uint32, binary.LittleEndian.Uint32(block[20:])),
+			tableSlots:   make([]uint32, numTablePages),
+		}
+		for i := range table.tableSlots {
+			table.tableSlots[i] = binary.LittleEndian.Uint32(block[SUPERBLOCK_HEADER_SIZE+i*4:])
+		}
+		if current == nil || table.sequence > current.sequence {
+			current = table
+		}
+	}
+	return current
+}
+
+/**
+ * Opens the database file in the shadow mode: reads the committed page
+ * table and metadata page, and collects the free slots.
+ */
+func openShadow(file *os.File, table *shadowTable) (*shadowState, []byte, error) {
+	tablePage := make([]byte, PAGE_SIZE)
+	for i, slot := range table.tableSlots {
+		_, err := file.ReadAt(tablePage, slotOffset(slot))
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := 0; j < SLOTS_PER_TABLE_PAGE && i*SLOTS_PER_TABLE_PAGE+j < len(table.slots); j++ {
+			table.slots[i*SLOTS_PER_TABLE_PAGE+j] = binary.LittleEndian.Uint32(tablePage[j*4:])
+		}
+	}
+
+	metadata := make([]byte, PAGE_SIZE)
+	_, err := file.ReadAt(metadata, slotOffset(table.metadataSlot))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	state := &shadowState{
+		head:     table,
+		free:     make([]uint32, 0),
+		numSlots: uint32(stat.Size() / PAGE_SIZE),
+	}
+	if state.numSlots < FIRST_PAGE_SLOT {
+		state.numSlots = FIRST_PAGE_SLOT
+	}
+
+	used := make(map[uint32]bool)
+	used[table.metadataSlot] = true
+	for _, slot := range table.tableSlots {
+		used[slot] = true
+	}
+	for _, slot := range table.slots {
+		used[slot] = true
+	}
+	// The lowest slots are reused first
+	for slot := state.numSlots - 1; slot >= FIRST_PAGE_SLOT; slot-- {
+		if !used[slot] {
+			state.free = append(state.free, slot)
+		}
+	}
+
+	return state, metadata, nil
+}
+
+/**
+ * Writes the changed pages and the metadata into free slots, followed by
+ * the changed table pages, syncs them, and publishes the new table by
+ * writing the superblock. Returns the new table, which the pages are read
+ * by once the transaction is committed. If the superblock is not written,
+ * the file still holds the previous version.
+ */
+func (p *Pager) writeShadow(metadata []byte, pages map[uint32]IPage, numPages uint32, commitTime int64) (*shadowTable, error) {
+	s := p.shadow
+	table := s.head.clone()
+	for uint32(len(table.slots)) < numPages {
+		table.slots = append(table.slots, 0)
+	}
+
+	allocated := make([]uint32, 0, len(pages)+2)
+	freed := make([]uint32, 0, len(pages)+2)
+	write := func(data []byte, old uint32) (uint32, error) {
+		if old != 0 {
+			freed = append(freed, old)
+		}
+		slot := s.allocate()
+		allocated = append(allocated, slot)
+		_, err := p.File.WriteAt(data, slotOffset(slot))
+		return slot, err
+	}
+
+	var err error
+	changedTablePages := make(map[int]bool)
+	for ind, page := range pages {
+		changedTablePages[int(ind)/SLOTS_PER_TABLE_PAGE] = true
+		if page == nil {
+			if table.slots[ind] != 0 {
+				freed = append(freed, table.slots[ind])
+			}
+			table.slots[ind] = 0
+			continue
+		}
+		table.slots[ind], err = write(encodePage(page), table.slots[ind])
+		if err != nil {
+			return nil, p.abortShadow(allocated, err)
+		}
+	}
+
+	metadataPage := make([]byte, PAGE_SIZE)
+	copy(metadataPage, metadata)
+	stampMetadata(metadataPage, p.timeline, commitTime, 0)
+	table.metadataSlot, err = write(metadataPage, table.metadataSlot)
+	if err != nil {
+		return nil, p.abortShadow(allocated, err)
+	}
+
+	numTablePages := (len(table.slots) + SLOTS_PER_TABLE_PAGE - 1) / SLOTS_PER_TABLE_PAGE
+	if numTablePages > MAX_TABLE_PAGES {
+		return nil, p.abortShadow(allocated, errors.New("the page table is full"))
+	}
+	tablePages := make([]int, 0, len(changedTablePages))
+	for i := range changedTablePages {
+		tablePages = append(tablePages, i)
+	}
+	sort.Ints(tablePages)
+	for _, i := range tablePages {
+		tablePage := make([]byte, PAGE_SIZE)
+		for j := 0; j < SLOTS_PER_TABLE_PAGE && i*SLOTS_PER_TABLE_PAGE+j < len(table.slots); j++ {
+			binary.LittleEndian.PutUint32(tablePage[j*4:], table.slots[i*SLOTS_PER_TABLE_PAGE+j])
+		}
+
+		old := uint32(0)
+		if i < len(table.tableSlots) {
+			old = table.tableSlots[i]
+		} else {
+			table.tableSlots = append(table.tableSlots, 0)
+		}
+		table.tableSlots[i], err = write(tablePage, old)
+		if err != nil {
+			return nil, p.abortShadow(allocated, err)
+		}
+	}
+
+	err = p.File.Sync()
+	if err != nil {
+		return nil, p.abortShadow(allocated, err)
+	}
+
+	// If the superblock may have been written, its slots are never reused
+	table.sequence++
+	_, err = p.File.WriteAt(encodeSuperblock(table), slotOffset(uint32(table.sequence%2)))
+	if err == nil {
+		err = p.File.Sync()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.free = append(s.free, freed...)
+	return table, nil
+}
+
+func (p *Pager) abortShadow(allocated []uint32, err error) error {
+	p.shadow.free = append(p.shadow.free, allocated...)
+	return err
+}
@@ -0,0 +1,153 @@
+package paging
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShadowReopenAfterCommit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "db")
+	pager, err := NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commitTestTree(t, pager)
+	commitTestKeys(t, pager, root, keyRange(1, 200, 2))
+	commitTestKeys(t, pager, root, keyRange(2, 200, 2))
+
+	// Nothing is written after the commits
+	crashPager(pager)
+	pager, err = NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestKeys(t, pager, root, keyRange(1, 200, 1))
+
+	// The reopened database keeps committing
+	commitTestKeys(t, pager, root, []uint64{1000})
+	pager.ClearPager()
+	pager, err = NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	checkTestKeys(t, pager, root, append(keyRange(1, 200, 1), 1000))
+	if _, err := os.Stat(logFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("the database in the shadow mode has a log")
+	}
+}
+
+/**
+ * Returns the index of the copy of the superblock holding the committed
+ * table, the one with the higher sequence.
+ */
+func currentSuperblock(t *testing.T, filename string) uint32 {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	current := readSuperblocks(file)
+	block := make([]byte, PAGE_SIZE)
+	for copyInd := uint32(0); copyInd < FIRST_PAGE_SLOT; copyInd++ {
+		_, err := file.ReadAt(block, slotOffset(copyInd))
+		if err == nil && binary.LittleEndian.Uint64(block[8:]) == current.sequence {
+			return copyInd
+		}
+	}
+	t.Fatal("no superblock holds the committed table")
+	return 0
+}
+
+/**
+ * The write of the superblock of the last commit is torn, so the database
+ * is opened at the commit before, whose pages are still in place.
+ */
+func TestShadowTornSuperblock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "db")
+	pager, err := NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commitTestTree(t, pager)
+	commitTestKeys(t, pager, root, keyRange(1, 100, 1))
+	commitTestKeys(t, pager, root, keyRange(101, 200, 1))
+	crashPager(pager)
+
+	torn := currentSuperblock(t, filename)
+	file, err := os.OpenFile(filename, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the magic reached the disk; the rest of the page holds garbage
+	garbage := make([]byte, PAGE_SIZE-4)
+	for i := range garbage {
+		garbage[i] = byte(i)
+	}
+	_, err = file.WriteAt(garbage, slotOffset(torn)+4)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pager, err = NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pager.shadow == nil {
+		t.Fatal("the database is not opened in the shadow mode")
+	}
+	checkTestKeys(t, pager, root, keyRange(1, 100, 1))
+
+	// The next commit overwrites the torn copy
+	commitTestKeys(t, pager, root, []uint64{1000})
+	pager.ClearPager()
+	if current := currentSuperblock(t, filename); current != torn {
+		t.Errorf("the commit wrote the superblock into copy %d, not into the torn copy %d", current, torn)
+	}
+	pager, err = NewPagerInMode(filename, PAGER_SHADOW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	checkTestKeys(t, pager, root, append(keyRange(1, 100, 1), 1000))
+}
+
+func TestOpenPagerKeepsMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		created   PagerMode
+		requested PagerMode
+	}{
+		{"log opened as log", PAGER_LOG, PAGER_LOG},
+		{"log opened as shadow", PAGER_LOG, PAGER_SHADOW},
+		{"shadow opened as shadow", PAGER_SHADOW, PAGER_SHADOW},
+		{"shadow opened as log", PAGER_SHADOW, PAGER_LOG},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "db")
+			pager, err := NewPagerInMode(filename, test.created)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := commitTestTree(t, pager)
+			commitTestKeys(t, pager, root, keyRange(1, 50, 1))
+			pager.ClearPager()
+
+			pager, err = NewPagerInMode(filename, test.requested)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pager.ClearPager()
+			if shadow := pager.shadow != nil; shadow != (test.created == PAGER_SHADOW) {
+				t.Errorf("opened in the shadow mode: %v", shadow)
+			}
+			checkTestKeys(t, pager, root, keyRange(1, 50, 1))
+		})
+	}
+}
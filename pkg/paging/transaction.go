@@ -0,0 +1,436 @@
+package paging
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/**
+ * The changes of a write transaction: private copies of the pages it changed,
+ * the pages it allocated, and its own pager metadata. Committed pages are never
+ * changed in place, so snapshots are not affected by a transaction until it
+ * commits, and a rollback simply drops the copies. A freed page is kept in
+ * the map as nil. The copies kept by a savepoint are not changed in place
+ * either, so only the copies made since the last savepoint (owned) are.
+ * A transaction reads the version it started on (its base), so any number
+ * of transactions can change the pages at once. Besides the pages, it records
+ * the data it added to and removed from the trees: if another transaction
+ * committed since its base, the changes are made again on top of the latest
+ * version when it is prepared. The caller must make sure the transactions
+ * did not change the same keys.
+ */
+type Transaction struct {
+	pager           *Pager
+	base            *Snapshot
+	pages           map[uint32]IPage
+	owned           map[uint32]bool
+	numPages        uint32
+	catalogRootPage uint32
+	freePages       []uint32
+	changes         []treeChange
+	// Set once the transaction creates or destroys a tree, which cannot be made again on another version
+	treesChanged bool
+	start        *Savepoint
+	version      uint64
+	// The page table written by the transaction in the shadow mode
+	shadow *shadowTable
+	// The LSN of the end of the log record of the transaction
+	lsn uint64
+	// The LSN of the latest commit when the transaction started
+	baseLSN   uint64
+	preparing time.Time
+	// The time of the commit, in nanoseconds since the epoch
+	commitTime int64
+	prepared   bool
+	done       bool
+}
+
+/**
+ * Data added to or removed from the tree with the given root page.
+ */
+type treeChange struct {
+	root    uint32
+	key     []byte
+	data    []byte
+	removed bool
+}
+
+/**
+ * The state of a transaction at a savepoint.
+ */
+type Savepoint struct {
+	pages           map[uint32]IPage
+	numPages        uint32
+	catalogRootPage uint32
+	freePages       []uint32
+	changes         int
+}
+
+/**
+ * Starts a transaction on top of the latest committed version.
+ */
+func (p *Pager) Begin() (*Transaction, error) {
+	return p.BeginOn(p.Snapshot())
+}
+
+/**
+ * Starts a transaction on top of the version of the snapshot. The transaction
+ * takes the snapshot over, and releases it once it ends.
+ */
+func (p *Pager) BeginOn(base *Snapshot) (*Transaction, error) {
+	if base.pager != p || base.released {
+		return nil, errors.New("the snapshot cannot be used by the transaction")
+	}
+
+	p.mu.Lock()
+	p.writers++
+	p.mu.Unlock()
+
+	txn := &Transaction{
+		pager: p,
+		pages: make(map[uint32]IPage),
+		owned: make(map[uint32]bool),
+	}
+	txn.startOn(base)
+
+	return txn, nil
+}
+
+func (t *Transaction) startOn(base *Snapshot) {
+	t.base = base
+	t.pages = make(map[uint32]IPage)
+	t.owned = make(map[uint32]bool)
+	t.numPages = base.numPages
+	t.catalogRootPage = base.catalogRootPage
+	t.freePages = append([]uint32(nil), base.freePages...)
+	t.changes = nil
+	t.baseLSN = base.lsn
+	t.start = t.Savepoint()
+}
+
+/**
+ * Returns the version the transaction started on, or was last moved onto.
+ */
+func (t *Transaction) BaseVersion() uint64 {
+	return t.base.version
+}
+
+func (t *Transaction) getPage(ind uint32, reads *PageReadStats) IPage {
+	if page, changed := t.pages[ind]; changed {
+		reads.countCacheHit()
+		return page
+	}
+	if ind >= t.numPages {
+		panic("Page index out of range!")
+	}
+
+	return t.base.getPage(ind, reads)
+}
+
+func (t *Transaction) pageCount() uint32 {
+	return t.numPages
+}
+
+/**
+ * Returns the copy of the page owned by the transaction, making it
+ * the first time the page is changed.
+ */
+func (t *Transaction) writable(ind uint32) IPage {
+	if t.owned[ind] {
+		return t.pages[ind]
+	}
+
+	page := copyPage(t.getPage(ind, nil))
+	t.setPage(ind, page)
+	return page
+}
+
+/**
+ * Places the page at a free index, reusing pages released by dropped trees
+ * before growing the file.
+ */
+func (t *Transaction) allocatePage(page IPage) uint32 {
+	if len(t.freePages) > 0 {
+		ind := t.freePages[len(t.freePages)-1]
+		t.freePages = t.freePages[:len(t.freePages)-1]
+		t.setPage(ind, page)
+		return ind
+	}
+
+	ind := t.numPages
+	t.setPage(ind, page)
+	t.numPages++
+	return ind
+}
+
+func (t *Transaction) freePage(ind uint32) {
+	if len(t.freePages) >= MAX_FREE_PAGES {
+		// The free list is full, so the page is simply leaked
+		return
+	}
+
+	t.pages[ind] = nil
+	delete(t.owned, ind)
+	t.freePages = append(t.freePages, ind)
+}
+
+func (t *Transaction) setPage(ind uint32, page IPage) {
+	t.pages[ind] = page
+	t.owned[ind] = true
+}
+
+func (t *Transaction) recordChange(root uint32, key []byte, data []byte, removed bool) {
+	t.changes = append(t.changes, treeChange{
+		root:    root,
+		key:     append([]byte(nil), key...),
+		data:    append([]byte(nil), data...),
+		removed: removed,
+	})
+}
+
+/**
+ * Moves the transaction onto the latest committed version, by making its
+ * changes to the trees again on top of it.
+ */
+func (t *Transaction) rebase() error {
+	if t.treesChanged {
+		return errors.New("could not serialize access: the database was changed by another transaction since this one started")
+	}
+
+	changes := t.changes
+	t.base.Release()
+	t.startOn(t.pager.Snapshot())
+
+	context := NewContext()
+	context.SetView(t)
+	for _, change := range changes {
+		tree := NewTree(t.pager, context, change.root)
+		if change.removed {
+			_, err := tree.DeleteData(change.key)
+			if err != nil {
+				return err
+			}
+		} else {
+			tree.AddNewData(change.key, change.data)
+		}
+	}
+	return nil
+}
+
+/**
+ * Marks the current state of the transaction. From now on, the pages
+ * changed so far are copied again before they are changed.
+ */
+func (t *Transaction) Savepoint() *Savepoint {
+	savepoint := &Savepoint{
+		pages:           make(map[uint32]IPage, len(t.pages)),
+		numPages:        t.numPages,
+		catalogRootPage: t.catalogRootPage,
+		freePages:       append([]uint32(nil), t.freePages...),
+		changes:         len(t.changes),
+	}
+	for ind, page := range t.pages {
+		savepoint.pages[ind] = page
+	}
+	t.owned = make(map[uint32]bool)
+
+	return savepoint
+}
+
+/**
+ * Drops the changes made since the savepoint, or since the start of
+ * the transaction if the savepoint is nil. The savepoint stays valid.
+ */
+func (t *Transaction) RollbackTo(savepoint *Savepoint) {
+	if savepoint == nil {
+		savepoint = t.start
+	}
+
+	t.pages = make(map[uint32]IPage, len(savepoint.pages))
+	for ind, page := range savepoint.pages {
+		t.pages[ind] = page
+	}
+	t.owned = make(map[uint32]bool)
+	t.numPages = savepoint.numPages
+	t.catalogRootPage = savepoint.catalogRootPage
+	t.freePages = append([]uint32(nil), savepoint.freePages...)
+	t.changes = t.changes[:savepoint.changes]
+}
+
+func (t *Transaction) CatalogRootPage() uint32 {
+	return t.catalogRootPage
+}
+
+func (t *Transaction) SetCatalogRootPage(ind uint32) {
+	t.catalogRootPage = ind
+}
+
+/**
+ * Appends the changes to the log, without making them visible yet. They are
+ * durable once WaitDurable returns; after a crash, a durable transaction is
+ * committed by replaying the log. In the shadow mode, the changes are
+ * written into the database file instead, and are durable at once.
+ * A transaction started on an older version than the latest one is moved
+ * onto it first. Transactions are prepared and committed one at a time.
+ */
+func (t *Transaction) Prepare() error {
+	if t.done {
+		return errors.New("the transaction has already ended")
+	}
+	if t.prepared {
+		return nil
+	}
+
+	if t.base.version != t.pager.Version() {
+		err := t.rebase()
+		if err != nil {
+			return err
+		}
+	}
+
+	pages := make(map[uint32]IPage, len(t.pages))
+	for ind, page := range t.pages {
+		if page != nil {
+			pages[ind] = page
+		}
+	}
+	metadata := serializeMetadata(t.numPages, t.catalogRootPage, t.freePages)
+
+	t.preparing = time.Now()
+	t.commitTime = t.preparing.UnixNano()
+	if t.pager.shadow != nil {
+		table, err := t.pager.writeShadow(metadata, t.pages, t.numPages, t.commitTime)
+		if err != nil {
+			return fmt.Errorf("could not write the pages: %v", err)
+		}
+		t.shadow = table
+		t.prepared = true
+		return nil
+	}
+
+	lsn, err := t.pager.appendLogRecord(metadata, pages, t.commitTime)
+	if err != nil {
+		return fmt.Errorf("could not write the log: %v", err)
+	}
+	t.lsn = lsn
+	t.prepared = true
+	return nil
+}
+
+/**
+ * Publishes the changes of the prepared transaction as the latest committed
+ * version. The replaced pages are kept for the snapshots still reading them.
+ */
+func (t *Transaction) Commit() error {
+	err := t.Prepare()
+	if err != nil {
+		return err
+	}
+
+	p := t.pager
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t.base.version != p.version {
+		panic("Another transaction was committed between the prepare and the commit!")
+	}
+	version := p.version + 1
+	keepVersions := len(p.snapshots) > 0
+	for uint32(len(p.Pages)) < t.numPages {
+		p.Pages = append(p.Pages, nil)
+	}
+	for ind, page := range t.pages {
+		if keepVersions && ind < p.NumPages && p.Pages[ind] != nil {
+			p.history[ind] = append(p.history[ind], pageVersion{page: p.Pages[ind], until: version})
+		}
+		p.Pages[ind] = page
+		if p.shadow == nil {
+			p.dirty[ind] = true
+		}
+	}
+	if p.shadow != nil {
+		p.shadow.head = t.shadow
+	}
+
+	p.NumPages = t.numPages
+	p.CatalogRootPage = t.catalogRootPage
+	p.FreePages = t.freePages
+	p.version = version
+	p.commitTime = t.commitTime
+	if p.shadow == nil {
+		p.lsn = t.lsn
+	}
+	p.writers--
+	p.releaseSnapshot(t.base)
+	t.version = version
+	t.done = true
+
+	// The transaction is committed at this point, a failed checkpoint is retried after the next commit
+	if p.logSize >= CHECKPOINT_LOG_SIZE {
+		err = p.checkpoint()
+		if err != nil {
+			fmt.Println("Checkpoint failed:", err)
+		}
+	}
+	return nil
+}
+
+/**
+ * Waits until the log record of the committed transaction is synced, along
+ * with the records of the transactions committed before it. A transaction
+ * is visible to others as soon as it is committed, but it must not be
+ * reported as committed before it is durable. Since the log is synced in
+ * order, every transaction which changed the database after seeing it is
+ * lost with it in a crash. Reads wait for the commits they see to be
+ * durable instead, see WaitBaseDurable and Snapshot.WaitDurable.
+ */
+func (t *Transaction) WaitDurable() error {
+	err := t.pager.waitSynced(t.lsn)
+	if err != nil {
+		return fmt.Errorf("could not sync the log: %v", err)
+	}
+
+	gc := t.pager.commits
+	gc.mu.Lock()
+	gc.stats.Commits++
+	gc.stats.Latency.Add(uint64(time.Since(t.preparing).Microseconds()))
+	gc.mu.Unlock()
+	return nil
+}
+
+/**
+ * Returns the version the transaction was committed as.
+ */
+func (t *Transaction) Version() uint64 {
+	return t.version
+}
+
+/**
+ * Drops the changes of the transaction. A prepared transaction
+ * must be committed instead, since it is already in the log.
+ */
+func (t *Transaction) Rollback() {
+	if t.done {
+		return
+	}
+
+	t.pager.mu.Lock()
+	defer t.pager.mu.Unlock()
+
+	t.pager.writers--
+	t.pager.releaseSnapshot(t.base)
+	t.done = true
+}
+
+/**
+ * Waits until the commits the transaction started on top of are durable,
+ * so the rows it reads from them are not lost in a crash.
+ */
+func (t *Transaction) WaitBaseDurable() error {
+	err := t.pager.waitSynced(t.baseLSN)
+	if err != nil {
+		return fmt.Errorf("could not sync the log: %v", err)
+	}
+	return nil
+}
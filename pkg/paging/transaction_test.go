@@ -0,0 +1,88 @@
+package paging
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Two transactions start on the same version and change keys in the same
+ * leaves. The second one to commit is moved onto the version committed by
+ * the first one, so the changes of both are kept.
+ */
+func TestPrepareMovesOntoLaterCommits(t *testing.T) {
+	for _, mode := range []PagerMode{PAGER_LOG, PAGER_SHADOW} {
+		pager, err := NewPagerInMode(filepath.Join(t.TempDir(), "db"), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := commitTestTree(t, pager)
+		commitTestKeys(t, pager, root, keyRange(2, 200, 2))
+
+		first, err := pager.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := pager.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		firstContext, secondContext := NewContext(), NewContext()
+		firstContext.SetView(first)
+		secondContext.SetView(second)
+
+		insertKeys(NewTree(pager, firstContext, root), keyRange(1, 199, 2))
+		secondTree := NewTree(pager, secondContext, root)
+		insertKeys(secondTree, keyRange(201, 300, 1))
+		for _, key := range keyRange(4, 200, 4) {
+			if deleted, err := secondTree.DeleteData(testKey(key)); !deleted || err != nil {
+				t.Fatalf("key %d: deleted %v, err %v", key, deleted, err)
+			}
+		}
+		// Rolled back changes are not replayed
+		savepoint := second.Savepoint()
+		insertKeys(secondTree, []uint64{1000})
+		second.RollbackTo(savepoint)
+
+		for _, txn := range []*Transaction{first, second} {
+			err = txn.Commit()
+			if err == nil {
+				err = txn.WaitDurable()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := append(keyRange(1, 199, 2), keyRange(2, 198, 4)...)
+		expected = append(expected, keyRange(201, 300, 1)...)
+		checkTestKeys(t, pager, root, expected)
+		pager.ClearPager()
+	}
+}
+
+func TestPrepareRefusesMovingNewTrees(t *testing.T) {
+	pager, err := NewPagerInMode(filepath.Join(t.TempDir(), "db"), PAGER_LOG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.ClearPager()
+	root := commitTestTree(t, pager)
+
+	txn, err := pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := NewContext()
+	context.SetView(txn)
+	CreateTree(pager, context)
+
+	commitTestKeys(t, pager, root, []uint64{1})
+	err = txn.Prepare()
+	if err == nil || !strings.Contains(err.Error(), "could not serialize access") {
+		t.Fatalf("got %v, expected a serialization failure", err)
+	}
+	txn.Rollback()
+	checkTestKeys(t, pager, root, []uint64{1})
+}
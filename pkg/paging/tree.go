@@ -0,0 +1,423 @@
+package paging
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/**
+ * A B-tree stored in the pages of a pager. Several trees can share
+ * the same pager (and thus the same file).
+ * The root of a tree never moves: when the root is split, its contents
+ * are relocated to a new page, so the root page index can be safely
+ * recorded elsewhere (e.g. in the catalog).
+ */
+type Tree struct {
+	pager    *Pager
+	RootPage uint32
+	context  *Context
+}
+
+/**
+ * Opens the tree rooted at the given page. The tree reads and changes
+ * pages through the view of the context, so it is bound to whatever
+ * snapshot or transaction the context is switched to.
+ */
+func NewTree(pager *Pager, context *Context, rootPage uint32) *Tree {
+	tree := &Tree{
+		pager:    pager,
+		RootPage: rootPage,
+		context:  context,
+	}
+
+	return tree
+}
+
+func (t *Tree) page(ind uint32) IPage {
+	if t.context != nil && t.context.view != nil {
+		return t.context.view.getPage(ind, &t.context.reads)
+	}
+	return t.pager.GetPage(ind)
+}
+
+func (t *Tree) pageCount() uint32 {
+	if t.context != nil && t.context.view != nil {
+		return t.context.view.pageCount()
+	}
+	return t.pager.PageCount()
+}
+
+/**
+ * Returns the transaction the tree is changed in. Changing a tree
+ * outside of a transaction is a programming error.
+ */
+func (t *Tree) transaction() *Transaction {
+	if t.context != nil {
+		if txn, ok := t.context.view.(*Transaction); ok {
+			return txn
+		}
+	}
+	panic("The tree is changed outside of a transaction!")
+}
+
+/**
+ * Allocates an empty root leaf page and returns a tree rooted at it.
+ */
+func CreateTree(pager *Pager, context *Context) *Tree {
+	return CreateTreeWithKeySize(pager, context, KEY_SIZE)
+}
+
+/**
+ * Same as CreateTree, but the keys of the tree have the given size. The key
+ * size is recorded in the header of every page, so it does not have to be
+ * known when the tree is opened again.
+ */
+func CreateTreeWithKeySize(pager *Pager, context *Context, keySize uint16) *Tree {
+	tree := NewTree(pager, context, 0)
+	tree.transaction().treesChanged = true
+	tree.RootPage = tree.transaction().allocatePage(NewIPageWithParams(LEAF_NODE, true, 0, 0, 0, keySize))
+	return tree
+}
+
+/**
+ * Releases every page of the tree, including the root, back to the pager.
+ * The tree must not be used afterwards.
+ */
+func (t *Tree) Destroy() {
+	t.transaction().treesChanged = true
+	t.destroyPageRec(t.RootPage)
+}
+
+func (t *Tree) destroyPageRec(ind uint32) {
+	currentPage := t.page(ind)
+	if currentPage.getType() != LEAF_NODE {
+		internalPage := currentPage.(*InternalPage)
+		for i := 0; i <= int(currentPage.getNumCells()); i++ {
+			t.destroyPageRec(internalPage.getPointer(uint16(i)))
+		}
+	}
+	t.transaction().freePage(ind)
+}
+
+/**
+ * Splits the given page, moving half of its cells to a new page and
+ * the middle key to the parent. Returns the parent and the new (right) page.
+ * If the page is the root, its contents are first moved to a new page,
+ * and the root page becomes the new, empty parent. The page must be
+ * the copy owned by the transaction.
+ */
+func (t *Tree) splitPage(pageInd uint32, page IPage) (IPage, IPage) {
+	txn := t.transaction()
+	newPage := NewIPageWithParams(page.getType(), false, 0, 0, 0, page.getKeySize())
+
+	if page.getIsRoot() {
+		leftChildInd := txn.allocatePage(page)
+		if page.getType() != LEAF_NODE {
+			t.updateParentOfChildren(leftChildInd)
+		}
+
+		parent := NewIPageWithParams(INTERNAL_NODE, true, 0, 0, 0, page.getKeySize())
+		txn.setPage(pageInd, parent)
+
+		newRightChildInd := txn.allocatePage(newPage)
+		page.transferCells(pageInd, leftChildInd, newRightChildInd, parent, newPage)
+		if page.getType() != LEAF_NODE {
+			t.updateParentOfChildren(newRightChildInd)
+		}
+
+		return parent, newPage
+	}
+
+	parentInd := page.getParent()
+	parent := txn.writable(parentInd)
+
+	newRightChildInd := txn.allocatePage(newPage)
+	page.transferCellsNotRoot(parentInd, pageInd, newRightChildInd, parent, newPage)
+	if page.getType() != LEAF_NODE {
+		t.updateParentOfChildren(newRightChildInd)
+	}
+
+	return parent, newPage
+}
+
+func (t *Tree) updateParentOfChildren(newParentInd uint32) {
+	txn := t.transaction()
+	internalPage := txn.writable(newParentInd).(*InternalPage)
+	for i := 0; i <= int(internalPage.getNumCells()); i++ {
+		childInd := internalPage.getPointer(uint16(i))
+		txn.writable(childInd).setParent(newParentInd)
+	}
+}
+
+func (t *Tree) findNodeToInsert(currentPageInd uint32, key []byte) uint32 {
+	currentPage := t.page(currentPageInd)
+	if currentPage.getType() != LEAF_NODE {
+		if !currentPage.hasSufficientSpace(uint16(4 + len(key))) {
+			currentPage, _ = t.splitPage(currentPageInd, t.transaction().writable(currentPageInd))
+		}
+
+		internalPage := currentPage.(*InternalPage)
+		keyInd, exists := internalPage.findIndexForKey(key)
+		// equal keys are stored in the right subtree of the separator, e.g. a removed key added again
+		if exists {
+			keyInd++
+		}
+		nextPageInd := internalPage.getPointer(keyInd)
+		return t.findNodeToInsert(nextPageInd, key)
+	} else {
+		return currentPageInd
+	}
+}
+
+func (t *Tree) findNodeToRead(currentPageInd uint32, key []byte) (uint32, error) {
+	if numPages := t.pageCount(); currentPageInd >= numPages {
+		return 0, fmt.Errorf("page index %d out of range (%d pages)", currentPageInd, numPages)
+	}
+
+	currentPage := t.page(currentPageInd)
+	if currentPage.getType() != LEAF_NODE {
+		internalPage := currentPage.(*InternalPage)
+		keyInd, exists := internalPage.findIndexForKey(key)
+		var nextPageInd uint32
+		if exists {
+			nextPageInd = internalPage.getPointer(keyInd + 1)
+		} else {
+			nextPageInd = internalPage.getPointer(keyInd)
+		}
+		return t.findNodeToRead(nextPageInd, key)
+	} else {
+		return currentPageInd, nil
+	}
+}
+
+func (t *Tree) AddNewData(key []byte, data []byte) {
+	t.transaction().recordChange(t.RootPage, key, data, false)
+	pageToInsertInd := t.findNodeToInsert(t.RootPage, key)
+	pageToInsert := t.transaction().writable(pageToInsertInd)
+
+	if !pageToInsert.hasSufficientSpace(uint16(len(data))) {
+		_, newPage := t.splitPage(pageToInsertInd, pageToInsert)
+
+		// The leftmost key in the right child decides which child the new key belongs to
+		decisionKey := newPage.getKey(0)
+		compareResult := bytes.Compare(decisionKey, key)
+		if compareResult == -1 {
+			pageToInsert = newPage
+		}
+	}
+
+	index, _ := pageToInsert.findIndexForKey(key)
+	leafPage := pageToInsert.(*LeafPage)
+	leafPage.insertDataAtIndex(index, key, data)
+}
+
+/**
+ * Removes the data stored under the given key. Pages are not merged
+ * after a removal, so a leaf may be left with no cells.
+ */
+func (t *Tree) DeleteData(key []byte) (bool, error) {
+	pageInd, err := t.findNodeToRead(t.RootPage, key)
+	if err != nil {
+		return false, err
+	}
+
+	leafPage, ok := t.page(pageInd).(*LeafPage)
+	if !ok {
+		return false, fmt.Errorf("page %d is not a leaf page", pageInd)
+	}
+
+	ind, exists := leafPage.findIndexForKey(key)
+	if !exists {
+		return false, nil
+	}
+
+	leafPage = t.transaction().writable(pageInd).(*LeafPage)
+	leafPage.removeDataAtIndex(ind)
+	t.transaction().recordChange(t.RootPage, key, nil, true)
+	return true, nil
+}
+
+func (t *Tree) ReadAllPages() []byte {
+	/**
+	 * Reads all the pages in a sorted order.
+	 */
+	values := make([]byte, 0, PAGE_SIZE)
+	t.ReadPageAtIndRec(t.RootPage, &values)
+	return values
+}
+
+func (t *Tree) ReadPageAtIndRec(ind uint32, values *[]byte) {
+	currentPage := t.page(ind)
+	if currentPage.getType() == LEAF_NODE {
+		leafPage := currentPage.(*LeafPage)
+		for i := 0; i < int(currentPage.getNumCells()); i++ {
+			*values = append(*values, leafPage.getData(uint16(i))...)
+		}
+	} else {
+		for i := 0; i <= int(currentPage.getNumCells()); i++ {
+			internalPage := currentPage.(*InternalPage)
+			t.ReadPageAtIndRec(internalPage.getPointer(uint16(i)), values)
+		}
+	}
+}
+
+/**
+ * Reads all the values in a sorted order, each one in its own slice.
+ */
+func (t *Tree) ReadAllValues() [][]byte {
+	values := make([][]byte, 0)
+	t.readValuesAtIndRec(t.RootPage, &values)
+	return values
+}
+
+func (t *Tree) readValuesAtIndRec(ind uint32, values *[][]byte) {
+	currentPage := t.page(ind)
+	if currentPage.getType() == LEAF_NODE {
+		leafPage := currentPage.(*LeafPage)
+		for i := 0; i < int(currentPage.getNumCells()); i++ {
+			data := leafPage.getData(uint16(i))
+			value := make([]byte, len(data))
+			copy(value, data)
+			*values = append(*values, value)
+		}
+	} else {
+		internalPage := currentPage.(*InternalPage)
+		for i := 0; i <= int(currentPage.getNumCells()); i++ {
+			t.readValuesAtIndRec(internalPage.getPointer(uint16(i)), values)
+		}
+	}
+}
+
+/**
+ * Calls fn for every key in a sorted order, until fn returns false.
+ * The key and data slices point into the page and are only valid
+ * until fn returns.
+ */
+func (t *Tree) Scan(fn func(key []byte, data []byte) bool) {
+	t.scanPageAtIndRec(t.RootPage, fn)
+}
+
+func (t *Tree) scanPageAtIndRec(ind uint32, fn func(key []byte, data []byte) bool) bool {
+	currentPage := t.page(ind)
+	if currentPage.getType() == LEAF_NODE {
+		leafPage := currentPage.(*LeafPage)
+		for i := uint16(0); i < currentPage.getNumCells(); i++ {
+			if !fn(leafPage.getKey(i), leafPage.getData(i)) {
+				return false
+			}
+		}
+	} else {
+		internalPage := currentPage.(*InternalPage)
+		for i := uint16(0); i <= currentPage.getNumCells(); i++ {
+			if !t.scanPageAtIndRec(internalPage.getPointer(i), fn) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+/**
+ * Same as Scan, but visits the keys in a descending order.
+ */
+func (t *Tree) ScanReverse(fn func(key []byte, data []byte) bool) {
+	t.scanPageAtIndReverseRec(t.RootPage, fn)
+}
+
+func (t *Tree) scanPageAtIndReverseRec(ind uint32, fn func(key []byte, data []byte) bool) bool {
+	currentPage := t.page(ind)
+	if currentPage.getType() == LEAF_NODE {
+		leafPage := currentPage.(*LeafPage)
+		for i := int(currentPage.getNumCells()) - 1; i >= 0; i-- {
+			if !fn(leafPage.getKey(uint16(i)), leafPage.getData(uint16(i))) {
+				return false
+			}
+		}
+	} else {
+		internalPage := currentPage.(*InternalPage)
+		for i := int(currentPage.getNumCells()); i >= 0; i-- {
+			if !t.scanPageAtIndReverseRec(internalPage.getPointer(uint16(i)), fn) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+/**
+ * Returns the smallest key of the tree by descending to the leftmost leaf.
+ * Leaves emptied by deletions are skipped. The second return value is
+ * false if the tree is empty.
+ */
+func (t *Tree) FirstKey() ([]byte, bool) {
+	var first []byte
+	t.Scan(func(key []byte, data []byte) bool {
+		first = append([]byte{}, key...)
+		return false
+	})
+	return first, first != nil
+}
+
+/**
+ * Returns the largest key of the tree by descending to the rightmost leaf.
+ */
+func (t *Tree) LastKey() ([]byte, bool) {
+	var last []byte
+	t.ScanReverse(func(key []byte, data []byte) bool {
+		last = append([]byte{}, key...)
+		return false
+	})
+	return last, last != nil
+}
+
+/**
+ * Estimates the number of keys and leaves of the tree without reading all of
+ * it, by descending through the middle children to a leaf and assuming every
+ * page on a level is as full as the one on the path. Also returns the number
+ * of pages on the path, i.e. the pages read by a lookup.
+ */
+func (t *Tree) EstimateShape() (float64, float64, int) {
+	leaves := float64(1)
+	depth := 1
+	pageInd := t.RootPage
+	for {
+		page := t.page(pageInd)
+		numCells := page.getNumCells()
+		if page.getType() == LEAF_NODE {
+			return leaves * float64(numCells), leaves, depth
+		}
+
+		leaves *= float64(numCells) + 1
+		depth++
+		pageInd = page.(*InternalPage).getPointer(numCells / 2)
+	}
+}
+
+/**
+ * Looks up the data stored under the given key. The second return value
+ * reports whether the key exists in the tree; when it is false the returned
+ * data is nil. An error is returned only if the tree itself is inconsistent.
+ */
+func (t *Tree) ReadDataByKey(key []byte) ([]byte, bool, error) {
+	pageInd, err := t.findNodeToRead(t.RootPage, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	leafPage, ok := t.page(pageInd).(*LeafPage)
+	if !ok {
+		return nil, false, fmt.Errorf("page %d is not a leaf page", pageInd)
+	}
+
+	ind, exists := leafPage.findIndexForKey(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	data := leafPage.getData(ind)
+	value := make([]byte, len(data))
+	copy(value, data)
+	return value, true, nil
+}
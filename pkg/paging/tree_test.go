@@ -0,0 +1,243 @@
+package paging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Creates a tree in a new database, inside a transaction which is
+ * rolled back when the test ends.
+ */
+func newTestTree(t *testing.T) *Tree {
+	pager := NewPager(filepath.Join(t.TempDir(), "db"))
+	txn, err := pager.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := NewContext()
+	context.SetView(txn)
+	t.Cleanup(func() {
+		txn.Rollback()
+		pager.ClearPager()
+	})
+
+	return CreateTree(pager, context)
+}
+
+func testKey(key uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, key)
+}
+
+/**
+ * Returns the data stored under the key, which differs from the data of
+ * other keys in every byte, so no part of it can be lost unnoticed.
+ */
+func testData(key uint64) []byte {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(key + uint64(i))
+	}
+	copy(data, fmt.Sprintf("value %d;", key))
+	return data
+}
+
+func insertKeys(tree *Tree, keys []uint64) {
+	for _, key := range keys {
+		tree.AddNewData(testKey(key), testData(key))
+	}
+}
+
+func keyRange(from uint64, to uint64, step uint64) []uint64 {
+	keys := make([]uint64, 0)
+	for key := from; key <= to; key += step {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+/**
+ * Returns the indexes of the leaves of the tree, from left to right.
+ */
+func leafPages(tree *Tree, ind uint32) []uint32 {
+	page := tree.page(ind)
+	if page.getType() == LEAF_NODE {
+		return []uint32{ind}
+	}
+
+	leaves := make([]uint32, 0)
+	internalPage := page.(*InternalPage)
+	for i := 0; i <= int(page.getNumCells()); i++ {
+		leaves = append(leaves, leafPages(tree, internalPage.getPointer(uint16(i)))...)
+	}
+	return leaves
+}
+
+func TestReadDataByKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		inserted []uint64
+		key      uint64
+		found    bool
+	}{
+		{"empty tree", nil, 7, false},
+		{"the only key", []uint64{7}, 7, true},
+		{"key between the cells", keyRange(2, 10, 2), 7, false},
+		{"key before the first cell", keyRange(2, 10, 2), 1, false},
+		{"key beyond the last cell", keyRange(2, 10, 2), 11, false},
+		{"key in the first leaf", keyRange(2, 1000, 2), 4, true},
+		{"key in a different leaf", keyRange(2, 1000, 2), 902, true},
+		{"missing key in a different leaf", keyRange(2, 1000, 2), 901, false},
+		{"key beyond the last leaf", keyRange(2, 1000, 2), 1002, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			insertKeys(tree, test.inserted)
+
+			data, found, err := tree.ReadDataByKey(testKey(test.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != test.found {
+				t.Fatalf("found %v, expected %v", found, test.found)
+			}
+			if found && !bytes.Equal(data, testData(test.key)) {
+				t.Fatalf("read %q", data)
+			}
+			if !found && data != nil {
+				t.Fatalf("read %q for a missing key", data)
+			}
+		})
+	}
+}
+
+func TestReadDataByKeyInDifferentLeaves(t *testing.T) {
+	tree := newTestTree(t)
+	insertKeys(tree, keyRange(2, 1000, 2))
+
+	leaves := leafPages(tree, tree.RootPage)
+	if len(leaves) < 3 {
+		t.Fatalf("expected several leaves, got %d", len(leaves))
+	}
+	// Every key of every leaf is found, and the keys just past it are not
+	for _, ind := range leaves {
+		leaf := tree.page(ind)
+		for i := uint16(0); i < leaf.getNumCells(); i++ {
+			key := binary.BigEndian.Uint64(leaf.getKey(i))
+			if _, found, _ := tree.ReadDataByKey(testKey(key)); !found {
+				t.Errorf("key %d of leaf %d not found", key, ind)
+			}
+			if _, found, _ := tree.ReadDataByKey(testKey(key + 1)); found {
+				t.Errorf("missing key %d found", key+1)
+			}
+		}
+	}
+}
+
+func TestLeafSplits(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []uint64
+	}{
+		{"ascending", keyRange(1, 2000, 1)},
+		{"descending", func() []uint64 {
+			keys := keyRange(1, 2000, 1)
+			for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+				keys[i], keys[j] = keys[j], keys[i]
+			}
+			return keys
+		}()},
+		{"random", func() []uint64 {
+			keys := keyRange(1, 2000, 1)
+			rand.New(rand.NewSource(1)).Shuffle(len(keys), func(i, j int) {
+				keys[i], keys[j] = keys[j], keys[i]
+			})
+			return keys
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			insertKeys(tree, test.keys)
+
+			// The root split first, and the leaves below it split again
+			if tree.page(tree.RootPage).getType() == LEAF_NODE {
+				t.Fatal("the root was not split")
+			}
+			leaves := leafPages(tree, tree.RootPage)
+			if len(leaves) < 3 {
+				t.Fatalf("expected the leaves to split again, got %d leaves", len(leaves))
+			}
+
+			// Every key is kept once, in order, across the leaves
+			expected := uint64(1)
+			for _, ind := range leaves {
+				leaf := tree.page(ind)
+				if leaf.getIsRoot() {
+					t.Fatalf("leaf %d is a root", ind)
+				}
+				for i := uint16(0); i < leaf.getNumCells(); i++ {
+					key := binary.BigEndian.Uint64(leaf.getKey(i))
+					if key != expected {
+						t.Fatalf("leaf %d holds key %d, expected %d", ind, key, expected)
+					}
+					expected++
+				}
+			}
+			if expected != 2001 {
+				t.Fatalf("the leaves hold %d keys", expected-1)
+			}
+
+			for _, key := range test.keys {
+				data, found, err := tree.ReadDataByKey(testKey(key))
+				if err != nil || !found || !bytes.Equal(data, testData(key)) {
+					t.Fatalf("key %d: found %v, err %v, read %q", key, found, err, data)
+				}
+			}
+		})
+	}
+}
+
+/**
+ * A key equal to a separator of an internal page lives in the right subtree
+ * of the separator, also when it is removed and added again, as an update
+ * of a row does.
+ */
+func TestReAddSeparatorKeys(t *testing.T) {
+	tree := newTestTree(t)
+	insertKeys(tree, keyRange(1, 1000, 1))
+
+	root := tree.page(tree.RootPage).(*InternalPage)
+	if root.getNumCells() == 0 {
+		t.Fatal("the root was not split")
+	}
+	separators := make([]uint64, root.getNumCells())
+	for i := range separators {
+		separators[i] = binary.BigEndian.Uint64(root.getKey(uint16(i)))
+	}
+
+	for _, key := range separators {
+		if found, err := tree.DeleteData(testKey(key)); !found || err != nil {
+			t.Fatalf("removing key %d: found %v, err %v", key, found, err)
+		}
+		tree.AddNewData(testKey(key), testData(key))
+	}
+
+	for _, key := range separators {
+		data, found, err := tree.ReadDataByKey(testKey(key))
+		if err != nil || !found || !bytes.Equal(data, testData(key)) {
+			t.Errorf("separator key %d: found %v, err %v", key, found, err)
+		}
+		cursor := tree.NewCursor()
+		if !cursor.Seek(testKey(key)) || binary.BigEndian.Uint64(cursor.Key()) != key {
+			t.Errorf("seeking separator key %d failed", key)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package paging
+
+import (
+	"fmt"
+)
+
+/**
+ * A consistent state of the pages: the pages of a committed version
+ * (a snapshot), or the pages of a transaction, i.e. the committed pages
+ * with the changes of the transaction.
+ */
+type View interface {
+	// Counts the read in the given stats, unless they are nil
+	getPage(ind uint32, reads *PageReadStats) IPage
+	pageCount() uint32
+}
+
+/**
+ * The view through which the trees of a connection read and change pages.
+ * The connection switches it to the snapshot or the transaction of the
+ * statement it executes, so the trees it opened once can be used with
+ * any of them. Without a view, the trees see the latest committed pages.
+ * The context counts the pages its trees read, so the reads of a statement
+ * can be told apart from those of other connections.
+ */
+type Context struct {
+	view  View
+	reads PageReadStats
+}
+
+func NewContext() *Context {
+	return &Context{}
+}
+
+func (c *Context) SetView(view View) {
+	c.view = view
+}
+
+/**
+ * Returns the numbers of pages read through the context so far.
+ */
+func (c *Context) ReadStats() PageReadStats {
+	return c.reads
+}
+
+/**
+ * A version of a page replaced by a commit. It is seen by the snapshots
+ * taken before that commit, i.e. with a version lower than until.
+ */
+type pageVersion struct {
+	page  IPage
+	until uint64
+}
+
+/**
+ * A committed version of the pages, which does not change while it is held,
+ * however many transactions commit in the meantime. The versions of pages
+ * replaced by later commits are kept until no snapshot can see them anymore.
+ */
+type Snapshot struct {
+	pager           *Pager
+	version         uint64
+	numPages        uint32
+	catalogRootPage uint32
+	freePages       []uint32
+	commitTime      int64
+	lsn             uint64
+	timeline        uint64
+	released        bool
+}
+
+/**
+ * Takes a snapshot of the latest committed version. The snapshot must be released.
+ */
+func (p *Pager) Snapshot() *Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := &Snapshot{
+		pager:           p,
+		version:         p.version,
+		numPages:        p.NumPages,
+		catalogRootPage: p.CatalogRootPage,
+		freePages:       p.FreePages,
+		commitTime:      p.commitTime,
+		lsn:             p.lsn,
+		timeline:        p.timeline,
+	}
+	p.snapshots[p.version]++
+
+	return snapshot
+}
+
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+/**
+ * Waits until the commits seen by the snapshot are durable. A commit is
+ * visible before its log record is synced, so the rows read from the
+ * snapshot must not reach a client before then: a crash would lose them.
+ * In the shadow mode, commits are durable once they are visible.
+ */
+func (s *Snapshot) WaitDurable() error {
+	err := s.pager.waitSynced(s.lsn)
+	if err != nil {
+		return fmt.Errorf("could not sync the log: %v", err)
+	}
+	return nil
+}
+
+func (s *Snapshot) Release() {
+	p := s.pager
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.releaseSnapshot(s)
+}
+
+func (p *Pager) releaseSnapshot(s *Snapshot) {
+	if s.released {
+		return
+	}
+	s.released = true
+
+	p.snapshots[s.version]--
+	if p.snapshots[s.version] == 0 {
+		delete(p.snapshots, s.version)
+	}
+	p.collectVersions()
+}
+
+func (s *Snapshot) getPage(ind uint32, reads *PageReadStats) IPage {
+	p := s.pager
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, version := range p.history[ind] {
+		if version.until > s.version {
+			reads.countCacheHit()
+			return version.page
+		}
+	}
+	return p.headPage(ind, reads)
+}
+
+func (s *Snapshot) pageCount() uint32 {
+	return s.numPages
+}
+
+/**
+ * Drops the page versions which are not seen by any snapshot, i.e. replaced
+ * before the oldest snapshot was taken.
+ */
+func (p *Pager) collectVersions() {
+	oldest := p.version
+	for version := range p.snapshots {
+		if version < oldest {
+			oldest = version
+		}
+	}
+
+	for ind, versions := range p.history {
+		kept := 0
+		for kept < len(versions) && versions[kept].until <= oldest {
+			kept++
+		}
+		if kept == len(versions) {
+			delete(p.history, ind)
+		} else if kept > 0 {
+			p.history[ind] = versions[kept:]
+		}
+	}
+}
+
+/**
+ * Returns the number of page versions kept for the snapshots.
+ */
+func (p *Pager) VersionCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	for _, versions := range p.history {
+		count += len(versions)
+	}
+	return count
+}
+
+/**
+ * Returns the latest committed version.
+ */
+func (p *Pager) Version() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.version
+}
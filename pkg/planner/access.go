@@ -0,0 +1,555 @@
+package planner
+
+import (
+	"math"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * Splits a condition into the expressions joined by its top level ANDs.
+ */
+func splitConjuncts(expr sql.Expr) []sql.Expr {
+	if expr == nil {
+		return nil
+	}
+
+	if binaryExpr, ok := expr.(*sql.BinaryExpr); ok && binaryExpr.Operator == "AND" {
+		return append(splitConjuncts(binaryExpr.Left), splitConjuncts(binaryExpr.Right)...)
+	}
+	return []sql.Expr{expr}
+}
+
+/**
+ * Joins the expressions with ANDs; returns nil for no expressions.
+ */
+func combineConjuncts(exprs []sql.Expr) sql.Expr {
+	var combined sql.Expr
+	for _, expr := range exprs {
+		if combined == nil {
+			combined = expr
+		} else {
+			combined = &sql.BinaryExpr{Operator: "AND", Left: combined, Right: expr}
+		}
+	}
+	return combined
+}
+
+/**
+ * Reports whether the expression references the primary key column of the scope.
+ */
+func isPrimaryKey(expr sql.Expr, scope *eval.Scope, t *table.Table) bool {
+	ref, ok := expr.(*sql.ColumnRef)
+	if !ok {
+		return false
+	}
+	ind, err := scope.Resolve(ref)
+	return err == nil && ind == t.Schema.PrimaryKeyIndex
+}
+
+/**
+ * Returns the value of the expression if it is an int constant.
+ */
+func intConstant(expr sql.Expr) (int64, bool) {
+	if containsColumn(expr) || containsParameter(expr) {
+		return 0, false
+	}
+	value, err := eval.EvaluateConstant(expr)
+	if err != nil || value.Type != row.TYPE_INT {
+		return 0, false
+	}
+	return value.Int, true
+}
+
+/**
+ * Reports whether the expression references any column.
+ */
+func containsColumn(expr sql.Expr) bool {
+	found := false
+	sql.WalkExpr(expr, func(e sql.Expr) bool {
+		if _, ok := e.(*sql.ColumnRef); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+/**
+ * Reports whether the expression references any parameter.
+ */
+func containsParameter(expr sql.Expr) bool {
+	found := false
+	sql.WalkExpr(expr, func(e sql.Expr) bool {
+		if _, ok := e.(*sql.Parameter); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+/**
+ * Reports whether the expression is known only when the plan is executed:
+ * it references parameters, but no columns.
+ */
+func isParameterized(expr sql.Expr) bool {
+	return !containsColumn(expr) && containsParameter(expr)
+}
+
+var flippedOperators = map[string]string{
+	"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+/**
+ * Narrows the key range by a comparison of the primary key with a constant.
+ * Returns false if the comparison is not of that form.
+ */
+func narrowByComparison(keyRange *executor.KeyRange, e *sql.BinaryExpr, scope *eval.Scope, t *table.Table) bool {
+	operator, ok := flippedOperators[e.Operator]
+	if !ok {
+		return false
+	}
+
+	column, other := e.Left, e.Right
+	if !isPrimaryKey(column, scope, t) {
+		column, other = e.Right, e.Left
+		operator = flippedOperators[operator]
+	} else {
+		operator = e.Operator
+	}
+	if !isPrimaryKey(column, scope, t) {
+		return false
+	}
+
+	value, ok := intConstant(other)
+	if !ok {
+		return false
+	}
+
+	switch operator {
+	case "=":
+		raiseLow(keyRange, value)
+		lowerHigh(keyRange, value)
+	case "<":
+		if value == math.MinInt64 {
+			*keyRange = executor.KeyRange{Low: math.MaxInt64, High: math.MinInt64}
+		} else {
+			lowerHigh(keyRange, value-1)
+		}
+	case "<=":
+		lowerHigh(keyRange, value)
+	case ">":
+		if value == math.MaxInt64 {
+			*keyRange = executor.KeyRange{Low: math.MaxInt64, High: math.MinInt64}
+		} else {
+			raiseLow(keyRange, value+1)
+		}
+	case ">=":
+		raiseLow(keyRange, value)
+	}
+
+	return true
+}
+
+func raiseLow(keyRange *executor.KeyRange, low int64) {
+	if low > keyRange.Low {
+		keyRange.Low = low
+	}
+}
+
+func lowerHigh(keyRange *executor.KeyRange, high int64) {
+	if high < keyRange.High {
+		keyRange.High = high
+	}
+}
+
+/**
+ * Extracts the range of primary keys the conditions restrict the rows to.
+ * Returns the range and the conditions which are not implied by it.
+ */
+func primaryKeyRange(conjuncts []sql.Expr, scope *eval.Scope, t *table.Table) (executor.KeyRange, []sql.Expr) {
+	keyRange := executor.NewFullKeyRange()
+	remaining := make([]sql.Expr, 0, len(conjuncts))
+
+	for _, conjunct := range conjuncts {
+		switch e := conjunct.(type) {
+		case *sql.BinaryExpr:
+			if narrowByComparison(&keyRange, e, scope, t) {
+				continue
+			}
+		case *sql.BetweenExpr:
+			if !e.Not && isPrimaryKey(e.Operand, scope, t) {
+				low, lowOk := intConstant(e.Low)
+				high, highOk := intConstant(e.High)
+				if lowOk && highOk {
+					raiseLow(&keyRange, low)
+					lowerHigh(&keyRange, high)
+					continue
+				}
+			}
+		}
+		remaining = append(remaining, conjunct)
+	}
+
+	return keyRange, remaining
+}
+
+/**
+ * Finds an equality of the primary key with an expression over parameters,
+ * which fixes the key to a single value once the parameters are bound.
+ * Returns the expression and the other conditions.
+ */
+func parameterizedSeek(conjuncts []sql.Expr, scope *eval.Scope, t *table.Table) (sql.Expr, []sql.Expr, bool) {
+	for i, conjunct := range conjuncts {
+		e, ok := conjunct.(*sql.BinaryExpr)
+		if !ok || e.Operator != "=" {
+			continue
+		}
+
+		key := e.Right
+		if !isPrimaryKey(e.Left, scope, t) {
+			key = e.Left
+			if !isPrimaryKey(e.Right, scope, t) {
+				continue
+			}
+		}
+		if !isParameterized(key) {
+			continue
+		}
+
+		remaining := make([]sql.Expr, 0, len(conjuncts)-1)
+		remaining = append(remaining, conjuncts[:i]...)
+		remaining = append(remaining, conjuncts[i+1:]...)
+		return key, remaining, true
+	}
+
+	return nil, nil, false
+}
+
+/**
+ * Reports whether the order by items are satisfied by reading the table in
+ * primary key order, i.e. if there are none or the first one is the primary key
+ * (items after it cannot change the order, since the key is unique), and
+ * whether the key order has to be descending.
+ */
+func primaryKeyOrder(orderBy []sql.OrderItem, scope *eval.Scope, t *table.Table) (bool, bool) {
+	if len(orderBy) == 0 {
+		return false, true
+	}
+	if !isPrimaryKey(orderBy[0].Expr, scope, t) {
+		return false, false
+	}
+	return orderBy[0].Desc, true
+}
+
+/**
+ * The conditions a scan of a secondary index enforces: equalities fixing
+ * its leading columns, and bounds of the column after them.
+ */
+type indexRange struct {
+	index    *table.Index
+	equal    []sql.Expr
+	low      *executor.IndexBound
+	high     *executor.IndexBound
+	consumed []sql.Expr
+}
+
+/**
+ * Returns the position of the indexed column the expression references, or -1.
+ */
+func indexColumn(expr sql.Expr, scope *eval.Scope, ix *table.Index) int {
+	ref, ok := expr.(*sql.ColumnRef)
+	if !ok {
+		return -1
+	}
+	ind, err := scope.Resolve(ref)
+	if err != nil {
+		return -1
+	}
+	for i, column := range ix.Columns {
+		if column == ind {
+			return i
+		}
+	}
+	return -1
+}
+
+/**
+ * Matches the conditions with the columns of the index: an equality for each
+ * leading column, as long as there are any, then comparisons or a between
+ * bounding the next column. The other side of every matched condition has to
+ * be a constant the column can be compared with, or an expression over
+ * parameters. Returns the conditions which
+ * are not matched, and false if none are.
+ */
+func matchIndex(ix *table.Index, conjuncts []sql.Expr, scope *eval.Scope) (indexRange, []sql.Expr, bool) {
+	match := indexRange{
+		index:    ix,
+		equal:    make([]sql.Expr, 0, len(ix.Columns)),
+		consumed: make([]sql.Expr, 0),
+	}
+	used := make([]bool, len(conjuncts))
+
+	// the constant or parameterized other side of a comparison with the i-th column
+	operand := func(expr sql.Expr, i int) bool {
+		if isParameterized(expr) {
+			return true
+		}
+		value, ok := constant(expr)
+		return ok && ix.Accepts(i, value)
+	}
+
+	for len(match.equal) < len(ix.Columns) {
+		i := len(match.equal)
+		found := false
+		for j, conjunct := range conjuncts {
+			e, ok := conjunct.(*sql.BinaryExpr)
+			if used[j] || !ok || e.Operator != "=" {
+				continue
+			}
+			other := e.Right
+			if indexColumn(e.Left, scope, ix) != i {
+				other = e.Left
+				if indexColumn(e.Right, scope, ix) != i {
+					continue
+				}
+			}
+			if operand(other, i) {
+				match.equal = append(match.equal, other)
+				match.consumed = append(match.consumed, conjunct)
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	if next := len(match.equal); next < len(ix.Columns) {
+		for j, conjunct := range conjuncts {
+			if used[j] {
+				continue
+			}
+			switch e := conjunct.(type) {
+			case *sql.BinaryExpr:
+				operator, ok := flippedOperators[e.Operator]
+				if !ok || e.Operator == "=" {
+					continue
+				}
+				other := e.Left
+				if indexColumn(e.Left, scope, ix) == next {
+					operator, other = e.Operator, e.Right
+				} else if indexColumn(e.Right, scope, ix) != next {
+					continue
+				}
+				if !operand(other, next) {
+					continue
+				}
+
+				bound := &executor.IndexBound{Expr: other, Inclusive: operator == "<=" || operator == ">="}
+				if operator == "<" || operator == "<=" {
+					if match.high != nil {
+						continue
+					}
+					match.high = bound
+				} else {
+					if match.low != nil {
+						continue
+					}
+					match.low = bound
+				}
+			case *sql.BetweenExpr:
+				if e.Not || match.low != nil || match.high != nil || indexColumn(e.Operand, scope, ix) != next {
+					continue
+				}
+				if !operand(e.Low, next) || !operand(e.High, next) {
+					continue
+				}
+				match.low = &executor.IndexBound{Expr: e.Low, Inclusive: true}
+				match.high = &executor.IndexBound{Expr: e.High, Inclusive: true}
+			default:
+				continue
+			}
+			match.consumed = append(match.consumed, conjunct)
+			used[j] = true
+		}
+	}
+
+	remaining := make([]sql.Expr, 0, len(conjuncts))
+	for j, conjunct := range conjuncts {
+		if !used[j] {
+			remaining = append(remaining, conjunct)
+		}
+	}
+
+	return match, remaining, len(match.consumed) > 0
+}
+
+/**
+ * How the rows of a table matching its conditions are read: the key range
+ * of the scan or the range of a secondary index, the conditions left for
+ * a filter, and whether the rows come in the order requested by the order
+ * by items. The rows are estimated before and after the filter, and the
+ * cost includes the filter.
+ */
+type accessChoice struct {
+	keyRange  executor.KeyRange
+	seek      sql.Expr
+	index     *indexRange
+	remaining []sql.Expr
+	reverse   bool
+	ordered   bool
+	scanRows  float64
+	rows      float64
+	cost      float64
+}
+
+/**
+ * Chooses the cheapest way to read the rows of a table matching the conditions:
+ * a full scan, a range scan of the primary keys the conditions restrict the rows
+ * to, a seek if they fix the key to a single value, or a scan of a secondary
+ * index the conditions match, reading every row it finds by its key (a page
+ * per row, as the upper levels of the tree stay cached). Unless the rows come
+ * in the requested order, the cost of sorting them is added before comparing.
+ */
+func (b *builder) chooseAccess(info *tableInfo, alias string, conjuncts []sql.Expr, orderBy []sql.OrderItem) accessChoice {
+	t := info.table
+	scope := eval.NewTableScope(alias, t.Schema)
+	reverse, ordered := primaryKeyOrder(orderBy, scope, t)
+
+	candidates := make([]accessChoice, 0, 2)
+	candidates = append(candidates, accessChoice{
+		keyRange:  executor.NewFullKeyRange(),
+		remaining: conjuncts,
+		reverse:   reverse,
+		ordered:   ordered,
+		scanRows:  info.rows,
+		cost:      info.leaves*PAGE_COST + info.rows*ROW_COST,
+	})
+
+	keyRange, remaining := primaryKeyRange(conjuncts, scope, t)
+	if !keyRange.IsFull() {
+		candidate := accessChoice{
+			keyRange:  keyRange,
+			remaining: remaining,
+			reverse:   reverse,
+			ordered:   ordered,
+		}
+		if keyRange.Low == keyRange.High {
+			candidate.seek = &sql.Literal{Value: row.NewIntValue(keyRange.Low)}
+			candidate.scanRows = math.Min(1, info.rows)
+			candidate.ordered = true
+			candidate.cost = float64(info.depth)*PAGE_COST + ROW_COST
+		} else {
+			fraction := keyRangeSelectivity(info, keyRange)
+			candidate.scanRows = info.rows * fraction
+			candidate.cost = float64(info.depth)*PAGE_COST + fraction*info.leaves*PAGE_COST + candidate.scanRows*ROW_COST
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if seek, remaining, ok := parameterizedSeek(conjuncts, scope, t); ok {
+		candidates = append(candidates, accessChoice{
+			keyRange:  executor.NewFullKeyRange(),
+			seek:      seek,
+			remaining: remaining,
+			ordered:   true,
+			scanRows:  math.Min(1, info.rows),
+			cost:      float64(info.depth)*PAGE_COST + ROW_COST,
+		})
+	}
+
+	for _, ix := range t.Indexes {
+		match, remaining, ok := matchIndex(ix, conjuncts, scope)
+		if !ok {
+			continue
+		}
+
+		fraction := b.selectivity(combineConjuncts(match.consumed), scope)
+		if ix.Unique && len(match.equal) == len(ix.Columns) {
+			fraction = math.Min(fraction, 1/math.Max(info.rows, 1))
+		}
+		_, leaves, depth := ix.Tree.EstimateShape()
+		scanRows := info.rows * fraction
+		candidates = append(candidates, accessChoice{
+			keyRange:  executor.NewFullKeyRange(),
+			index:     &match,
+			remaining: remaining,
+			ordered:   len(orderBy) == 0,
+			scanRows:  scanRows,
+			cost:      float64(depth)*PAGE_COST + fraction*leaves*PAGE_COST + scanRows*(PAGE_COST+ROW_COST),
+		})
+	}
+
+	var best accessChoice
+	bestCost := math.Inf(1)
+	for _, candidate := range candidates {
+		candidate.rows = candidate.scanRows
+		if len(candidate.remaining) > 0 {
+			candidate.rows *= b.selectivity(combineConjuncts(candidate.remaining), scope)
+			candidate.cost += candidate.scanRows * ROW_COST
+		}
+
+		cost := candidate.cost
+		if !candidate.ordered {
+			cost += sortCost(candidate.rows)
+		}
+		if cost < bestCost {
+			best, bestCost = candidate, cost
+		}
+	}
+
+	return best
+}
+
+/**
+ * Builds the cheapest access path reading the rows of a table matching the
+ * where clause, with a filter for the conditions not implied by it. The second
+ * return value reports whether the rows are produced in the order requested
+ * by the order by items.
+ */
+func accessPath(b *builder, t *table.Table, alias string, where sql.Expr, orderBy []sql.OrderItem) (executor.Operator, bool, error) {
+	info := b.bind(alias, t)
+	choice := b.chooseAccess(info, alias, splitConjuncts(where), orderBy)
+	scanCost := choice.cost
+	if len(choice.remaining) > 0 {
+		scanCost -= choice.scanRows * ROW_COST
+	}
+
+	var op executor.Operator
+	if choice.index != nil {
+		match := choice.index
+		scan, err := executor.NewIndexScan(t, alias, match.index, match.equal, match.low, match.high, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		op = b.add(scan, choice.scanRows, scanCost)
+	} else if choice.seek != nil {
+		seek, err := executor.NewIndexSeek(t, alias, choice.seek, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		op = b.add(seek, choice.scanRows, scanCost)
+		if len(choice.remaining) == 0 {
+			b.lookup = seek
+		}
+	} else {
+		op = b.add(executor.NewRangeScan(t, alias, choice.keyRange, choice.reverse), choice.scanRows, scanCost)
+	}
+
+	if len(choice.remaining) > 0 {
+		filter, err := executor.NewFilter(op, combineConjuncts(choice.remaining))
+		if err != nil {
+			return nil, false, err
+		}
+		op = b.add(filter, choice.rows, choice.cost)
+	}
+
+	return op, choice.ordered, nil
+}
@@ -0,0 +1,385 @@
+package planner
+
+import (
+	"math"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/statistics"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * The fractions of rows assumed to satisfy a condition of each kind
+ * when the column it tests has no statistics.
+ */
+const (
+	EQUALITY_SELECTIVITY = 0.1
+	RANGE_SELECTIVITY    = 1.0 / 3
+	BETWEEN_SELECTIVITY  = 0.25
+	LIKE_SELECTIVITY     = 0.25
+	NULL_SELECTIVITY     = 0.1
+	DEFAULT_SELECTIVITY  = 0.5
+)
+
+/**
+ * The fraction of groups assumed to remain when rows are grouped
+ * by expressions without statistics.
+ */
+const GROUPING_RATIO = 0.1
+
+/**
+ * The cost model, in units of reading a page: processing a row, and
+ * inserting a row into or probing a hash table.
+ */
+const (
+	PAGE_COST       = 1.0
+	ROW_COST        = 0.01
+	HASH_BUILD_COST = 0.02
+	HASH_PROBE_COST = 0.01
+)
+
+/**
+ * What the planner knows about the size of a table: its rows, the leaves of
+ * its tree and the depth of a lookup, and the statistics collected by ANALYZE.
+ * The analyzed row count is scaled by how much the tree has grown since.
+ */
+type tableInfo struct {
+	table  *table.Table
+	stats  *statistics.TableStats
+	rows   float64
+	leaves float64
+	depth  int
+}
+
+/**
+ * Records the estimates of every operator while a plan is built. If it has
+ * a context, the builder also wraps every operator to measure its execution
+ * by the pages read through the context.
+ */
+type builder struct {
+	db        *database.Database
+	context   *paging.Context
+	estimates map[executor.Operator]executor.Estimate
+	tables    map[string]*tableInfo
+	bindings  map[string]*tableInfo
+	// The seek of the last access path that looks up a single key with no other condition
+	lookup *executor.IndexSeek
+}
+
+func newBuilder(db *database.Database, context *paging.Context) *builder {
+	b := &builder{
+		db:        db,
+		context:   context,
+		estimates: make(map[executor.Operator]executor.Estimate),
+		tables:    make(map[string]*tableInfo),
+		bindings:  make(map[string]*tableInfo),
+	}
+
+	return b
+}
+
+/**
+ * Adds an operator to the plan; the returned operator must be used in its place.
+ * An operator which may produce rows is estimated to produce at least one.
+ * The cost includes the cost of the operator's children.
+ */
+func (b *builder) add(op executor.Operator, rows float64, cost float64) executor.Operator {
+	if rows > 0 && rows < 1 {
+		rows = 1
+	}
+	if b.context != nil {
+		op = executor.NewInstrumented(op, b.context)
+	}
+	b.estimates[op] = executor.Estimate{Rows: rows, Cost: cost}
+	return op
+}
+
+func (b *builder) rows(op executor.Operator) float64 {
+	return b.estimates[op].Rows
+}
+
+func (b *builder) cost(op executor.Operator) float64 {
+	return b.estimates[op].Cost
+}
+
+func (b *builder) tableInfo(t *table.Table) *tableInfo {
+	if info, ok := b.tables[t.Name]; ok {
+		return info
+	}
+
+	rows, leaves, depth := t.Tree.EstimateShape()
+	info := &tableInfo{
+		table:  t,
+		rows:   rows,
+		leaves: leaves,
+		depth:  depth,
+	}
+	if b.db != nil {
+		if stats, ok := b.db.Statistics(t.Name); ok {
+			info.stats = stats
+			info.rows = stats.RowCount
+			if stats.LeafPages > 0 {
+				info.rows *= leaves / stats.LeafPages
+			}
+		}
+	}
+
+	b.tables[t.Name] = info
+	return info
+}
+
+/**
+ * Makes the statistics of the table available to the estimates
+ * of conditions referencing it by the binding.
+ */
+func (b *builder) bind(binding string, t *table.Table) *tableInfo {
+	info := b.tableInfo(t)
+	b.bindings[binding] = info
+	return info
+}
+
+/**
+ * Returns the table of the referenced column, and the statistics of the
+ * column if the table is analyzed.
+ */
+func (b *builder) columnStats(expr sql.Expr, scope *eval.Scope) (*statistics.ColumnStats, *tableInfo) {
+	ref, ok := expr.(*sql.ColumnRef)
+	if !ok {
+		return nil, nil
+	}
+	ind, err := scope.Resolve(ref)
+	if err != nil {
+		return nil, nil
+	}
+
+	binding := scope.Columns[ind]
+	info, ok := b.bindings[binding.Table]
+	if !ok {
+		return nil, nil
+	}
+	column, ok := info.table.Schema.ColumnIndex(binding.Name)
+	if !ok || info.stats == nil || column >= len(info.stats.Columns) {
+		return nil, info
+	}
+	return info.stats.Columns[column], info
+}
+
+/**
+ * Estimates the number of distinct values of the expression. Without
+ * statistics, only the values of a primary key are known to be unique.
+ */
+func (b *builder) distinctCount(expr sql.Expr, scope *eval.Scope) (float64, bool) {
+	stats, info := b.columnStats(expr, scope)
+	if stats != nil && stats.DistinctCount > 0 {
+		return stats.DistinctCount, true
+	}
+	if info != nil && expr.(*sql.ColumnRef).Name == info.table.Schema.PrimaryKeyColumn().Name {
+		return math.Max(info.rows, 1), true
+	}
+	return 0, false
+}
+
+/**
+ * Returns the value of the expression if it is a constant. Parameters are
+ * not constants, since a plan is reused with different values bound to them.
+ */
+func constant(expr sql.Expr) (row.Value, bool) {
+	if containsColumn(expr) || containsParameter(expr) {
+		return row.Value{}, false
+	}
+	value, err := eval.EvaluateConstant(expr)
+	return value, err == nil
+}
+
+/**
+ * Estimates the fraction of rows of the scope satisfying the condition.
+ * Comparisons of analyzed columns with constants are estimated from their
+ * histograms and distinct counts, and equalities of two columns from their
+ * distinct counts. Anything else falls back to the fixed selectivities.
+ */
+func (b *builder) selectivity(expr sql.Expr, scope *eval.Scope) float64 {
+	switch e := expr.(type) {
+	case nil:
+		return 1
+	case *sql.BinaryExpr:
+		switch e.Operator {
+		case "AND":
+			return b.selectivity(e.Left, scope) * b.selectivity(e.Right, scope)
+		case "OR":
+			left, right := b.selectivity(e.Left, scope), b.selectivity(e.Right, scope)
+			return left + right - left*right
+		case "=", "<>", "<", "<=", ">", ">=":
+			return b.comparisonSelectivity(e, scope)
+		}
+	case *sql.UnaryExpr:
+		if e.Operator == "NOT" {
+			return 1 - b.selectivity(e.Operand, scope)
+		}
+	case *sql.BetweenExpr:
+		between := BETWEEN_SELECTIVITY
+		stats, _ := b.columnStats(e.Operand, scope)
+		low, lowOk := constant(e.Low)
+		high, highOk := constant(e.High)
+		if stats != nil && lowOk && highOk && !low.IsNull() && !high.IsNull() {
+			between = math.Max(stats.LessFraction(high, true)-stats.LessFraction(low, false), 0)
+		}
+		if e.Not {
+			return 1 - between
+		}
+		return between
+	case *sql.LikeExpr:
+		if e.Not {
+			return 1 - LIKE_SELECTIVITY
+		}
+		return LIKE_SELECTIVITY
+	case *sql.IsNullExpr:
+		null := NULL_SELECTIVITY
+		if stats, _ := b.columnStats(e.Operand, scope); stats != nil {
+			null = stats.NullFraction
+		}
+		if e.Not {
+			return 1 - null
+		}
+		return null
+	case *sql.InExpr:
+		in := math.Min(EQUALITY_SELECTIVITY*float64(len(e.List)), DEFAULT_SELECTIVITY)
+		if stats, _ := b.columnStats(e.Operand, scope); stats != nil {
+			in = math.Min(stats.EqualFraction()*float64(len(e.List)), 1-stats.NullFraction)
+		}
+		if e.Not {
+			return 1 - in
+		}
+		return in
+	}
+
+	return DEFAULT_SELECTIVITY
+}
+
+func (b *builder) comparisonSelectivity(e *sql.BinaryExpr, scope *eval.Scope) float64 {
+	if e.Operator == "=" && containsColumn(e.Left) && containsColumn(e.Right) {
+		left, leftOk := b.distinctCount(e.Left, scope)
+		right, rightOk := b.distinctCount(e.Right, scope)
+		if leftOk || rightOk {
+			return 1 / math.Max(math.Max(left, right), 1)
+		}
+		return EQUALITY_SELECTIVITY
+	}
+
+	operator, column, other := e.Operator, e.Left, e.Right
+	if _, ok := column.(*sql.ColumnRef); !ok {
+		column, other = e.Right, e.Left
+		if flipped, ok := flippedOperators[e.Operator]; ok {
+			operator = flipped
+		}
+	}
+
+	stats, _ := b.columnStats(column, scope)
+	value, ok := constant(other)
+	if stats == nil || !ok {
+		switch operator {
+		case "=":
+			if stats != nil {
+				return stats.EqualFraction()
+			}
+			return EQUALITY_SELECTIVITY
+		case "<>":
+			return 1 - EQUALITY_SELECTIVITY
+		}
+		return RANGE_SELECTIVITY
+	}
+	if value.IsNull() {
+		return 0
+	}
+
+	nonNull := 1 - stats.NullFraction
+	switch operator {
+	case "=":
+		return stats.EqualFraction()
+	case "<>":
+		return math.Max(nonNull-stats.EqualFraction(), 0)
+	case "<":
+		return stats.LessFraction(value, false)
+	case "<=":
+		return stats.LessFraction(value, true)
+	case ">":
+		return math.Max(nonNull-stats.LessFraction(value, true), 0)
+	default:
+		return math.Max(nonNull-stats.LessFraction(value, false), 0)
+	}
+}
+
+/**
+ * Estimates the fraction of the rows of the table whose keys fall into the
+ * range: from the histogram of the primary key if the table is analyzed, and
+ * otherwise assuming the keys are spread evenly between the smallest and the
+ * largest one.
+ */
+func keyRangeSelectivity(info *tableInfo, keyRange executor.KeyRange) float64 {
+	if keyRange.IsFull() {
+		return 1
+	}
+	if keyRange.IsEmpty() {
+		return 0
+	}
+
+	t := info.table
+	if info.stats != nil && t.Schema.PrimaryKeyIndex < len(info.stats.Columns) {
+		stats := info.stats.Columns[t.Schema.PrimaryKeyIndex]
+		if stats != nil && len(stats.Histogram) > 0 {
+			high := stats.LessFraction(row.NewIntValue(keyRange.High), true)
+			low := stats.LessFraction(row.NewIntValue(keyRange.Low), false)
+			return math.Max(high-low, 0)
+		}
+	}
+
+	minKey, ok := t.MinKey()
+	if !ok {
+		return 0
+	}
+	maxKey, _ := t.MaxKey()
+
+	low := math.Max(float64(keyRange.Low), float64(minKey))
+	high := math.Min(float64(keyRange.High), float64(maxKey))
+	if low > high {
+		return 0
+	}
+	return (high - low + 1) / (float64(maxKey) - float64(minKey) + 1)
+}
+
+/**
+ * Estimates the number of groups: the product of the distinct counts of the
+ * grouped columns, or a fixed fraction of the rows if any of them is unknown.
+ */
+func (b *builder) groupCount(groupBy []sql.Expr, scope *eval.Scope, rows float64) float64 {
+	if len(groupBy) == 0 {
+		return 1
+	}
+
+	groups := float64(1)
+	for _, expr := range groupBy {
+		stats, _ := b.columnStats(expr, scope)
+		if stats == nil || stats.DistinctCount < 1 {
+			return math.Max(1, rows*GROUPING_RATIO)
+		}
+		groups *= stats.DistinctCount
+		if stats.NullFraction > 0 {
+			groups++
+		}
+	}
+	return math.Max(1, math.Min(groups, rows))
+}
+
+/**
+ * The cost of sorting the rows.
+ */
+func sortCost(rows float64) float64 {
+	if rows < 2 {
+		return 0
+	}
+	return rows * math.Log2(rows) * ROW_COST
+}
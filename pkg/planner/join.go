@@ -0,0 +1,686 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+const MAX_JOINED_TABLES = 64
+
+/**
+ * A table of the from clause, together with the join which added it.
+ * The first table is added by an inner join without a condition.
+ */
+type fromTable struct {
+	table    *table.Table
+	binding  string
+	scope    *eval.Scope
+	joinType sql.JoinType
+	on       sql.Expr
+}
+
+/**
+ * A set of tables of the from clause, as a bit mask of their positions.
+ */
+type tableSet uint64
+
+func tableSetOf(ind int) tableSet {
+	return tableSet(1) << uint(ind)
+}
+
+func (s tableSet) isSubsetOf(other tableSet) bool {
+	return s&^other == 0
+}
+
+/**
+ * The tables of a select statement, in the order they are joined.
+ */
+type fromClause struct {
+	tables []*fromTable
+}
+
+func newFromClause(db *database.Database, stmt *sql.SelectStatement) (*fromClause, error) {
+	refs := make([]sql.Join, 0, len(stmt.Joins)+1)
+	refs = append(refs, sql.Join{Type: sql.JOIN_INNER, Table: stmt.From})
+	refs = append(refs, stmt.Joins...)
+	if len(refs) > MAX_JOINED_TABLES {
+		return nil, fmt.Errorf("a select can join at most %d tables", MAX_JOINED_TABLES)
+	}
+
+	from := &fromClause{
+		tables: make([]*fromTable, len(refs)),
+	}
+	bindings := make(map[string]bool)
+	for i, ref := range refs {
+		t, err := db.GetTable(ref.Table.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		binding := ref.Table.Binding()
+		if bindings[binding] {
+			return nil, fmt.Errorf("table name %s is specified more than once", binding)
+		}
+		bindings[binding] = true
+
+		from.tables[i] = &fromTable{
+			table:    t,
+			binding:  binding,
+			scope:    eval.NewTableScope(binding, t.Schema),
+			joinType: ref.Type,
+			on:       ref.On,
+		}
+	}
+
+	return from, nil
+}
+
+/**
+ * The scope of the joined rows: the columns of all the tables, in order.
+ */
+func (f *fromClause) scope() *eval.Scope {
+	columns := make([]eval.ColumnBinding, 0)
+	for _, t := range f.tables {
+		columns = append(columns, t.scope.Columns...)
+	}
+	return eval.NewScope(columns)
+}
+
+/**
+ * Returns the set of tables whose columns the expression references.
+ */
+func (f *fromClause) references(expr sql.Expr) (tableSet, error) {
+	var refs tableSet
+	var resolveErr error
+	sql.WalkExpr(expr, func(e sql.Expr) bool {
+		ref, ok := e.(*sql.ColumnRef)
+		if !ok {
+			return true
+		}
+
+		found := -1
+		for i, t := range f.tables {
+			if _, err := t.scope.Resolve(ref); err != nil {
+				continue
+			}
+			if found >= 0 {
+				resolveErr = fmt.Errorf("column reference %s is ambiguous", ref)
+				return false
+			}
+			found = i
+		}
+		if found < 0 {
+			resolveErr = fmt.Errorf("column %s does not exist", ref)
+			return false
+		}
+
+		refs |= tableSetOf(found)
+		return true
+	})
+
+	return refs, resolveErr
+}
+
+/**
+ * Plans the rows of the from clause matched by the where clause. A single table
+ * is read by its access path. Joins are planned left-deep: the tables before the
+ * first left join are joined in the cheapest order found by joinOrder, and the
+ * rest in the order of the from clause. The conditions of the where clause and
+ * of inner joins are pooled: conditions on a single table are pushed down into
+ * its access path, and the others are evaluated by the first join at which all
+ * the tables they reference are available. Conditions are never pushed into the
+ * inner side of a left join, since they must also see the NULL padded rows.
+ * The second return value reports whether the rows are produced in the order
+ * requested by the order by items.
+ */
+func (f *fromClause) plan(b *builder, where sql.Expr, orderBy []sql.OrderItem) (executor.Operator, bool, error) {
+	for _, t := range f.tables {
+		b.bind(t.binding, t.table)
+	}
+	if len(f.tables) == 1 {
+		return accessPath(b, f.tables[0].table, f.tables[0].binding, where, orderBy)
+	}
+
+	conditions := splitConjuncts(where)
+	for i, t := range f.tables {
+		if t.joinType != sql.JOIN_INNER || t.on == nil {
+			continue
+		}
+		for _, condition := range splitConjuncts(t.on) {
+			refs, err := f.references(condition)
+			if err != nil {
+				return nil, false, err
+			}
+			if !refs.isSubsetOf(tableSetOf(i+1) - 1) {
+				return nil, false, fmt.Errorf("the join condition of %s references a table joined after it", t.binding)
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+
+	references := make([]tableSet, len(conditions))
+	for i, condition := range conditions {
+		var err error
+		references[i], err = f.references(condition)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	applied := make([]bool, len(conditions))
+
+	// takes the conditions which can be evaluated over the available tables
+	take := func(available tableSet) []sql.Expr {
+		taken := make([]sql.Expr, 0)
+		for i, condition := range conditions {
+			if !applied[i] && references[i].isSubsetOf(available) {
+				applied[i] = true
+				taken = append(taken, condition)
+			}
+		}
+		return taken
+	}
+
+	order := f.joinOrder(b, conditions, references)
+	first := f.tables[order[0]]
+	op, _, err := accessPath(b, first.table, first.binding, combineConjuncts(take(tableSetOf(order[0]))), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	available := tableSetOf(order[0])
+	for _, ind := range order[1:] {
+		right := f.tables[ind]
+		rightSet := tableSetOf(ind)
+
+		var onConditions []sql.Expr
+		if right.joinType == sql.JOIN_LEFT {
+			onConditions = splitConjuncts(right.on)
+		} else {
+			onConditions = take(available | rightSet)
+		}
+
+		rightConditions := make([]sql.Expr, 0)
+		joinConditions := make([]sql.Expr, 0)
+		for _, condition := range onConditions {
+			refs, err := f.references(condition)
+			if err != nil {
+				return nil, false, err
+			}
+			if !refs.isSubsetOf(available | rightSet) {
+				return nil, false, fmt.Errorf("the join condition of %s references a table joined after it", right.binding)
+			}
+
+			if refs == rightSet {
+				rightConditions = append(rightConditions, condition)
+			} else {
+				joinConditions = append(joinConditions, condition)
+			}
+		}
+
+		op, err = f.planJoin(b, op, available, ind, rightConditions, joinConditions)
+		if err != nil {
+			return nil, false, err
+		}
+		available |= rightSet
+
+		if right.joinType == sql.JOIN_LEFT {
+			if after := take(available); len(after) > 0 {
+				condition := combineConjuncts(after)
+				filter, err := executor.NewFilter(op, condition)
+				if err != nil {
+					return nil, false, err
+				}
+				rows := b.rows(op)
+				op = b.add(filter, rows*b.selectivity(condition, f.scope()), b.cost(op)+rows*ROW_COST)
+			}
+		}
+	}
+
+	return op, len(orderBy) == 0, nil
+}
+
+/**
+ * Up to this many tables are reordered by searching all the join orders;
+ * more are ordered greedily.
+ */
+const MAX_EXHAUSTIVE_JOIN_TABLES = 10
+
+/**
+ * A partial join order: the order of a set of tables, the estimated
+ * number of rows of their join and the cost of producing them.
+ */
+type joinPrefix struct {
+	order []int
+	rows  float64
+	cost  float64
+}
+
+/**
+ * Returns the order in which the tables are joined. The tables before the first
+ * left join can be joined in any order, so they are ordered by the estimated
+ * cost of the left-deep plan: by dynamic programming over the sets of tables
+ * (as in System R), or greedily if there are too many of them. A table sharing
+ * a condition with the tables joined before it is preferred to one forming a
+ * cross product. The tables from the first left join on keep their order.
+ */
+func (f *fromClause) joinOrder(b *builder, conditions []sql.Expr, references []tableSet) []int {
+	reorderable := 0
+	for reorderable < len(f.tables) && f.tables[reorderable].joinType != sql.JOIN_LEFT {
+		reorderable++
+	}
+
+	order := make([]int, 0, len(f.tables))
+	if reorderable > 1 {
+		scope := f.scope()
+		access := make([]accessChoice, reorderable)
+		for i := range access {
+			local := make([]sql.Expr, 0)
+			for j, condition := range conditions {
+				if references[j] == tableSetOf(i) {
+					local = append(local, condition)
+				}
+			}
+			t := f.tables[i]
+			access[i] = b.chooseAccess(b.tableInfo(t.table), t.binding, local, nil)
+		}
+
+		selectivities := make([]float64, len(conditions))
+		for i, condition := range conditions {
+			selectivities[i] = b.selectivity(condition, scope)
+		}
+
+		// joins the prefix with table ind, using the cheapest join method
+		extend := func(prefix *joinPrefix, set tableSet, ind int) *joinPrefix {
+			rightSet := tableSetOf(ind)
+			rows := prefix.rows * access[ind].rows
+			joinConditions := make([]sql.Expr, 0)
+			for i, condition := range conditions {
+				refs := references[i]
+				if refs&rightSet != 0 && refs != rightSet && refs.isSubsetOf(set|rightSet) {
+					joinConditions = append(joinConditions, condition)
+					rows *= selectivities[i]
+				}
+			}
+
+			keys := f.splitJoinConditions(joinConditions, set, ind)
+			_, cost := b.joinCost(b.tableInfo(f.tables[ind].table), prefix.rows, access[ind], keys, scope)
+			extended := &joinPrefix{
+				order: append(append(make([]int, 0, len(prefix.order)+1), prefix.order...), ind),
+				rows:  rows,
+				cost:  prefix.cost + cost + rows*ROW_COST,
+			}
+			return extended
+		}
+
+		// reports whether a condition connects the table with the set
+		connected := func(set tableSet, ind int) bool {
+			for _, refs := range references {
+				if refs&tableSetOf(ind) != 0 && refs&set != 0 && refs.isSubsetOf(set|tableSetOf(ind)) {
+					return true
+				}
+			}
+			return false
+		}
+
+		// the tables worth joining to the set next: those connected to it, if any
+		candidates := func(set tableSet) []int {
+			all, linked := make([]int, 0), make([]int, 0)
+			for ind := 0; ind < reorderable; ind++ {
+				if set&tableSetOf(ind) != 0 {
+					continue
+				}
+				all = append(all, ind)
+				if connected(set, ind) {
+					linked = append(linked, ind)
+				}
+			}
+			if len(linked) > 0 {
+				return linked
+			}
+			return all
+		}
+
+		full := tableSetOf(reorderable) - 1
+		var best *joinPrefix
+		if reorderable <= MAX_EXHAUSTIVE_JOIN_TABLES {
+			prefixes := make(map[tableSet]*joinPrefix)
+			for ind := 0; ind < reorderable; ind++ {
+				prefixes[tableSetOf(ind)] = &joinPrefix{order: []int{ind}, rows: access[ind].rows, cost: access[ind].cost}
+			}
+			// every set is extended only after all of its subsets
+			for set := tableSet(1); set < full; set++ {
+				prefix, ok := prefixes[set]
+				if !ok {
+					continue
+				}
+				for _, ind := range candidates(set) {
+					extended := extend(prefix, set, ind)
+					if current, ok := prefixes[set|tableSetOf(ind)]; !ok || extended.cost < current.cost {
+						prefixes[set|tableSetOf(ind)] = extended
+					}
+				}
+			}
+			best = prefixes[full]
+		} else {
+			for ind := 0; ind < reorderable; ind++ {
+				if best == nil || access[ind].rows < best.rows {
+					best = &joinPrefix{order: []int{ind}, rows: access[ind].rows, cost: access[ind].cost}
+				}
+			}
+			set := tableSetOf(best.order[0])
+			for set != full {
+				var next *joinPrefix
+				for _, ind := range candidates(set) {
+					if extended := extend(best, set, ind); next == nil || extended.cost < next.cost {
+						next = extended
+					}
+				}
+				best = next
+				set |= tableSetOf(best.order[len(best.order)-1])
+			}
+		}
+		order = append(order, best.order...)
+	} else {
+		order = append(order, 0)
+		reorderable = 1
+	}
+
+	for ind := reorderable; ind < len(f.tables); ind++ {
+		order = append(order, ind)
+	}
+	return order
+}
+
+type joinMethod int8
+
+const (
+	SEEK_JOIN joinMethod = iota
+	INDEX_JOIN
+	HASH_JOIN
+	NESTED_LOOP_JOIN
+)
+
+/**
+ * The join conditions split by how a join can evaluate them: the sides of the
+ * equalities between the left side and the joined table, the index of the
+ * equality whose right side is the primary key of the joined table (or -1),
+ * the secondary index of the joined table whose leading columns the most
+ * equalities fix, with the indexes of those equalities in column order,
+ * and the residual conditions.
+ */
+type joinKeys struct {
+	left      []sql.Expr
+	right     []sql.Expr
+	seek      int
+	index     *table.Index
+	indexKeys []int
+	residual  []sql.Expr
+}
+
+func (f *fromClause) splitJoinConditions(joinConditions []sql.Expr, leftSet tableSet, ind int) joinKeys {
+	right := f.tables[ind]
+	keys := joinKeys{
+		left:     make([]sql.Expr, 0),
+		right:    make([]sql.Expr, 0),
+		seek:     -1,
+		residual: make([]sql.Expr, 0),
+	}
+
+	for _, condition := range joinConditions {
+		leftKey, rightKey, ok := f.equiJoinKeys(condition, leftSet, tableSetOf(ind))
+		if !ok {
+			keys.residual = append(keys.residual, condition)
+			continue
+		}
+
+		if keys.seek < 0 && isPrimaryKey(rightKey, right.scope, right.table) {
+			keys.seek = len(keys.left)
+		}
+		keys.left = append(keys.left, leftKey)
+		keys.right = append(keys.right, rightKey)
+	}
+
+	for _, ix := range right.table.Indexes {
+		indexKeys := make([]int, 0, len(ix.Columns))
+		for len(indexKeys) < len(ix.Columns) {
+			found := -1
+			for i, rightKey := range keys.right {
+				if indexColumn(rightKey, right.scope, ix) == len(indexKeys) {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				break
+			}
+			indexKeys = append(indexKeys, found)
+		}
+		if len(indexKeys) > len(keys.indexKeys) {
+			keys.index, keys.indexKeys = ix, indexKeys
+		}
+	}
+
+	return keys
+}
+
+/**
+ * The equalities between the left side and the joined table used to look up
+ * its rows in the secondary index of the keys.
+ */
+func (keys joinKeys) indexConditions() []sql.Expr {
+	conditions := make([]sql.Expr, len(keys.indexKeys))
+	for i, key := range keys.indexKeys {
+		conditions[i] = &sql.BinaryExpr{Operator: "=", Left: keys.left[key], Right: keys.right[key]}
+	}
+	return conditions
+}
+
+/**
+ * Estimates the rows of the joined table a lookup in the secondary index
+ * of the keys finds for a left row, and the cost of the lookup.
+ */
+func (b *builder) indexLookup(info *tableInfo, keys joinKeys, scope *eval.Scope) (float64, float64) {
+	fraction := b.selectivity(combineConjuncts(keys.indexConditions()), scope)
+	if keys.index.Unique && len(keys.indexKeys) == len(keys.index.Columns) {
+		fraction = math.Min(fraction, 1/math.Max(info.rows, 1))
+	}
+	_, leaves, depth := keys.index.Tree.EstimateShape()
+	rows := info.rows * fraction
+	return rows, float64(depth)*PAGE_COST + fraction*leaves*PAGE_COST + rows*(PAGE_COST+ROW_COST)
+}
+
+/**
+ * Chooses the cheapest method of joining the left rows with a table read by
+ * the access choice, and returns its cost, excluding the cost of the left side:
+ * seeking the primary key for every left row, looking its rows up in a secondary
+ * index for every left row, building a hash table of the table and probing it
+ * with every left row, or scanning the table for every left row.
+ */
+func (b *builder) joinCost(info *tableInfo, leftRows float64, inner accessChoice, keys joinKeys, scope *eval.Scope) (joinMethod, float64) {
+	method := NESTED_LOOP_JOIN
+	cost := math.Max(leftRows, 1) * inner.cost
+
+	if len(keys.left) > 0 {
+		hashCost := inner.cost + inner.rows*HASH_BUILD_COST + leftRows*HASH_PROBE_COST
+		if hashCost < cost {
+			method, cost = HASH_JOIN, hashCost
+		}
+	}
+	if keys.seek >= 0 {
+		seekCost := leftRows * (float64(info.depth)*PAGE_COST + ROW_COST)
+		if len(inner.remaining) > 0 {
+			seekCost += leftRows * ROW_COST
+		}
+		if seekCost < cost {
+			method, cost = SEEK_JOIN, seekCost
+		}
+	}
+	if keys.index != nil && method != SEEK_JOIN {
+		rows, lookupCost := b.indexLookup(info, keys, scope)
+		indexCost := leftRows * lookupCost
+		if len(inner.remaining) > 0 {
+			indexCost += leftRows * rows * ROW_COST
+		}
+		if indexCost < cost {
+			method, cost = INDEX_JOIN, indexCost
+		}
+	}
+
+	return method, cost
+}
+
+/**
+ * Joins the rows of the left side with the table at position ind. The right
+ * conditions reference only the joined table, and the join conditions reference
+ * both sides. The join method is chosen by joinCost: if an equality compares the
+ * primary key of the joined table with an expression over the left side, the
+ * table can be the inner side of a nested loop join seeking the key for every
+ * left row, and if equalities fix the leading columns of a secondary index,
+ * one looking its rows up in the index. Equalities between the sides can be
+ * evaluated by a hash join, and
+ * a nested loop join scanning the table for every left row handles anything.
+ */
+func (f *fromClause) planJoin(b *builder, left executor.Operator, leftSet tableSet, ind int, rightConditions []sql.Expr, joinConditions []sql.Expr) (executor.Operator, error) {
+	right := f.tables[ind]
+	leftOuter := right.joinType == sql.JOIN_LEFT
+	info := b.tableInfo(right.table)
+
+	keys := f.splitJoinConditions(joinConditions, leftSet, ind)
+	access := b.chooseAccess(info, right.binding, rightConditions, nil)
+	method, cost := b.joinCost(info, b.rows(left), access, keys, f.scope())
+
+	leftRows := b.rows(left)
+	rows := joinRows(leftRows*access.rows*b.selectivity(combineConjuncts(joinConditions), f.scope()), leftRows, leftOuter)
+	cost += b.cost(left) + rows*ROW_COST
+
+	switch method {
+	case SEEK_JOIN:
+		seek, err := executor.NewIndexSeek(right.table, right.binding, keys.left[keys.seek], left.Scope())
+		if err != nil {
+			return nil, err
+		}
+		seekCost := float64(info.depth)*PAGE_COST + ROW_COST
+		inner := b.add(seek, math.Min(1, info.rows), seekCost)
+		if len(rightConditions) > 0 {
+			condition := combineConjuncts(rightConditions)
+			filter, err := executor.NewFilter(inner, condition)
+			if err != nil {
+				return nil, err
+			}
+			inner = b.add(filter, b.rows(inner)*b.selectivity(condition, right.scope), seekCost+ROW_COST)
+		}
+
+		conditions := make([]sql.Expr, 0, len(joinConditions))
+		for i := range keys.left {
+			if i != keys.seek {
+				conditions = append(conditions, &sql.BinaryExpr{Operator: "=", Left: keys.left[i], Right: keys.right[i]})
+			}
+		}
+		conditions = append(conditions, keys.residual...)
+
+		join, err := executor.NewNestedLoopJoin(left, inner, combineConjuncts(conditions), leftOuter)
+		if err != nil {
+			return nil, err
+		}
+		return b.add(join, rows, cost), nil
+	case INDEX_JOIN:
+		equal := make([]sql.Expr, len(keys.indexKeys))
+		used := make(map[int]bool, len(keys.indexKeys))
+		for i, key := range keys.indexKeys {
+			equal[i] = keys.left[key]
+			used[key] = true
+		}
+		scan, err := executor.NewIndexScan(right.table, right.binding, keys.index, equal, nil, nil, left.Scope())
+		if err != nil {
+			return nil, err
+		}
+		lookupRows, lookupCost := b.indexLookup(info, keys, f.scope())
+		inner := b.add(scan, lookupRows, lookupCost)
+		if len(rightConditions) > 0 {
+			condition := combineConjuncts(rightConditions)
+			filter, err := executor.NewFilter(inner, condition)
+			if err != nil {
+				return nil, err
+			}
+			inner = b.add(filter, lookupRows*b.selectivity(condition, right.scope), lookupCost+lookupRows*ROW_COST)
+		}
+
+		conditions := make([]sql.Expr, 0, len(joinConditions))
+		for i := range keys.left {
+			if !used[i] {
+				conditions = append(conditions, &sql.BinaryExpr{Operator: "=", Left: keys.left[i], Right: keys.right[i]})
+			}
+		}
+		conditions = append(conditions, keys.residual...)
+
+		join, err := executor.NewNestedLoopJoin(left, inner, combineConjuncts(conditions), leftOuter)
+		if err != nil {
+			return nil, err
+		}
+		return b.add(join, rows, cost), nil
+	}
+
+	inner, _, err := accessPath(b, right.table, right.binding, combineConjuncts(rightConditions), nil)
+	if err != nil {
+		return nil, err
+	}
+	condition := combineConjuncts(keys.residual)
+
+	if method == HASH_JOIN {
+		join, err := executor.NewHashJoin(left, inner, keys.left, keys.right, condition, leftOuter)
+		if err != nil {
+			return nil, err
+		}
+		return b.add(join, rows, cost), nil
+	}
+
+	join, err := executor.NewNestedLoopJoin(left, inner, combineConjuncts(joinConditions), leftOuter)
+	if err != nil {
+		return nil, err
+	}
+	return b.add(join, rows, cost), nil
+}
+
+/**
+ * A left outer join returns at least every row of its left side.
+ */
+func joinRows(rows float64, leftRows float64, leftOuter bool) float64 {
+	if leftOuter {
+		return math.Max(rows, leftRows)
+	}
+	return rows
+}
+
+/**
+ * Returns the sides of an equality between an expression over the left
+ * tables and an expression over the right table.
+ */
+func (f *fromClause) equiJoinKeys(condition sql.Expr, leftSet tableSet, rightSet tableSet) (sql.Expr, sql.Expr, bool) {
+	binaryExpr, ok := condition.(*sql.BinaryExpr)
+	if !ok || binaryExpr.Operator != "=" {
+		return nil, nil, false
+	}
+
+	leftRefs, err := f.references(binaryExpr.Left)
+	if err != nil {
+		return nil, nil, false
+	}
+	rightRefs, err := f.references(binaryExpr.Right)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	switch {
+	case leftRefs != 0 && leftRefs.isSubsetOf(leftSet) && rightRefs == rightSet:
+		return binaryExpr.Left, binaryExpr.Right, true
+	case rightRefs != 0 && rightRefs.isSubsetOf(leftSet) && leftRefs == rightSet:
+		return binaryExpr.Right, binaryExpr.Left, true
+	}
+	return nil, nil, false
+}
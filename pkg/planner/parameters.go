@@ -0,0 +1,166 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Infers the types of the parameters of a prepared statement, starting from
+ * the declared ones: a parameter takes the type of the column or value it is
+ * compared with or computed with, the type of the column it is inserted into
+ * or assigned to, text in LIKE, and int in LIMIT and OFFSET. A parameter whose
+ * type cannot be inferred is left as TYPE_NULL and accepts any value.
+ */
+func ParameterTypes(db *database.Database, statement sql.Statement, count int, declared []row.ColumnType) ([]row.ColumnType, error) {
+	if len(declared) > count {
+		count = len(declared)
+	}
+	inference := &typeInference{
+		types: make([]row.ColumnType, count),
+	}
+	copy(inference.types, declared)
+
+	switch s := statement.(type) {
+	case *sql.SelectStatement:
+		from, err := newFromClause(db, s)
+		if err != nil {
+			return nil, err
+		}
+		sql.WalkStatement(s, inference.visitor(from.scope()))
+		inference.assign(s.Limit, row.TYPE_INT)
+		inference.assign(s.Offset, row.TYPE_INT)
+	case *sql.InsertStatement:
+		t, err := db.GetTable(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		scope := eval.NewScope(nil)
+		for _, values := range s.Rows {
+			for i, expr := range values {
+				ind, ok := i, i < len(t.Schema.Columns)
+				if s.Columns != nil {
+					ok = false
+					if i < len(s.Columns) {
+						ind, ok = t.Schema.ColumnIndex(s.Columns[i])
+					}
+				}
+				if ok {
+					inference.assign(expr, t.Schema.Columns[ind].Type)
+				}
+				inference.infer(expr, scope)
+			}
+		}
+	case *sql.UpdateStatement:
+		t, err := db.GetTable(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		scope := eval.NewTableScope(t.Name, t.Schema)
+		for _, assignment := range s.Assignments {
+			if ind, ok := t.Schema.ColumnIndex(assignment.Column); ok {
+				inference.assign(assignment.Value, t.Schema.Columns[ind].Type)
+			}
+			inference.infer(assignment.Value, scope)
+		}
+		inference.infer(s.Where, scope)
+	case *sql.DeleteStatement:
+		t, err := db.GetTable(s.Table)
+		if err != nil {
+			return nil, err
+		}
+		inference.infer(s.Where, eval.NewTableScope(t.Name, t.Schema))
+	}
+
+	if inference.err != nil {
+		return nil, inference.err
+	}
+	return inference.types, nil
+}
+
+type typeInference struct {
+	types []row.ColumnType
+	err   error
+}
+
+/**
+ * Gives the type to the expression if it is a parameter. A parameter
+ * cannot be used as values of two different types.
+ */
+func (ti *typeInference) assign(expr sql.Expr, columnType row.ColumnType) {
+	parameter, ok := expr.(*sql.Parameter)
+	if !ok || columnType == row.TYPE_NULL || ti.err != nil {
+		return
+	}
+
+	current := ti.types[parameter.Index-1]
+	if current == row.TYPE_NULL {
+		ti.types[parameter.Index-1] = columnType
+	} else if current != columnType {
+		ti.err = fmt.Errorf("parameter %s is used as both %s and %s", parameter, current, columnType)
+	}
+}
+
+/**
+ * Returns the type of the expression if it is a column, a parameter of
+ * a known type or a literal, and TYPE_NULL otherwise.
+ */
+func (ti *typeInference) typeOf(expr sql.Expr, scope *eval.Scope) row.ColumnType {
+	switch e := expr.(type) {
+	case *sql.ColumnRef:
+		ind, err := scope.Resolve(e)
+		if err == nil {
+			return scope.Columns[ind].Type
+		}
+	case *sql.Parameter:
+		return ti.types[e.Index-1]
+	case *sql.Literal:
+		return e.Value.Type
+	}
+	return row.TYPE_NULL
+}
+
+func (ti *typeInference) infer(expr sql.Expr, scope *eval.Scope) {
+	sql.WalkExpr(expr, ti.visitor(scope))
+}
+
+func (ti *typeInference) visitor(scope *eval.Scope) func(sql.Expr) bool {
+	return func(e sql.Expr) bool {
+		switch e := e.(type) {
+		case *sql.BinaryExpr:
+			switch e.Operator {
+			case "AND", "OR":
+				ti.assign(e.Left, row.TYPE_BOOL)
+				ti.assign(e.Right, row.TYPE_BOOL)
+			case "||":
+				ti.assign(e.Left, row.TYPE_TEXT)
+				ti.assign(e.Right, row.TYPE_TEXT)
+			default:
+				ti.assign(e.Left, ti.typeOf(e.Right, scope))
+				ti.assign(e.Right, ti.typeOf(e.Left, scope))
+			}
+		case *sql.BetweenExpr:
+			operandType := ti.typeOf(e.Operand, scope)
+			ti.assign(e.Low, operandType)
+			ti.assign(e.High, operandType)
+			ti.assign(e.Operand, ti.typeOf(e.Low, scope))
+		case *sql.InExpr:
+			operandType := ti.typeOf(e.Operand, scope)
+			for _, item := range e.List {
+				ti.assign(item, operandType)
+			}
+		case *sql.LikeExpr:
+			ti.assign(e.Operand, row.TYPE_TEXT)
+			ti.assign(e.Pattern, row.TYPE_TEXT)
+		case *sql.UnaryExpr:
+			if e.Operator == "NOT" {
+				ti.assign(e.Operand, row.TYPE_BOOL)
+			}
+		}
+		return true
+	}
+}
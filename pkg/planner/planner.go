@@ -0,0 +1,392 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/database"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/eval"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/executor"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sorting"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * The operator tree producing the rows of a statement, the names of the
+ * columns it produces, and the number of rows each operator is expected
+ * to produce and at what cost. A plan producing the row with a given
+ * primary key, if there is one, and nothing else, keeps the seek looking
+ * it up, so that a missing key can be told apart from an empty result.
+ */
+type Plan struct {
+	Root      executor.Operator
+	Columns   []string
+	Estimates map[executor.Operator]executor.Estimate
+	Lookup    *executor.IndexSeek
+}
+
+/**
+ * Instrumented plans measure the execution of every operator, for EXPLAIN ANALYZE.
+ */
+type Options struct {
+	Instrument bool
+}
+
+/**
+ * Compiles a select statement into a tree of operators: an access path reading
+ * the matching rows, an aggregation and a having filter if the statement groups,
+ * a sort unless the rows are already read in the requested order, a limit, and
+ * finally the projection of the selected columns.
+ */
+func PlanSelect(db *database.Database, stmt *sql.SelectStatement, options Options) (*Plan, error) {
+	b := newBuilder(db, nil)
+	if options.Instrument {
+		b = newBuilder(db, db.Context())
+	}
+
+	from, err := newFromClause(db, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.Where != nil && eval.ContainsAggregate(stmt.Where) {
+		return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+	}
+
+	columns, exprs, err := projection(stmt, from.scope())
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := resolveOrderBy(stmt, columns, exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregate := isAggregate(stmt, exprs, orderBy)
+	var op executor.Operator
+	if aggregate {
+		op, exprs, orderBy, err = planAggregate(b, stmt, from, exprs, orderBy)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var ordered bool
+		op, ordered, err = from.plan(b, stmt.Where, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		if ordered {
+			orderBy = nil
+		}
+	}
+
+	if len(orderBy) > 0 {
+		sort, err := executor.NewSort(op, orderBy, sorting.DEFAULT_MEMORY_BUDGET)
+		if err != nil {
+			return nil, err
+		}
+		op = b.add(sort, b.rows(op), b.cost(op)+sortCost(b.rows(op)))
+	}
+
+	if stmt.Limit != nil || stmt.Offset != nil {
+		limit, err := executor.NewLimit(op, stmt.Limit, stmt.Offset)
+		if err != nil {
+			return nil, err
+		}
+		op = b.add(limit, limitedRows(stmt, b.rows(op)), b.cost(op))
+	}
+
+	project, err := executor.NewProject(op, exprs, columns)
+	if err != nil {
+		return nil, err
+	}
+	op = b.add(project, b.rows(op), b.cost(op)+b.rows(op)*ROW_COST)
+
+	plan := &Plan{
+		Root:      op,
+		Columns:   columns,
+		Estimates: b.estimates,
+	}
+	if len(from.tables) == 1 && !aggregate && stmt.Limit == nil && stmt.Offset == nil {
+		plan.Lookup = b.lookup
+	}
+
+	return plan, nil
+}
+
+/**
+ * Returns the operator producing the rows of the table matched by the where
+ * clause. Used to find the rows to update or delete.
+ */
+func PlanRows(db *database.Database, t *table.Table, where sql.Expr) (*Plan, error) {
+	b := newBuilder(db, nil)
+	op, _, err := accessPath(b, t, t.Name, where, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(t.Schema.Columns))
+	for i, column := range t.Schema.Columns {
+		columns[i] = column.Name
+	}
+
+	plan := &Plan{
+		Root:      op,
+		Columns:   columns,
+		Estimates: b.estimates,
+	}
+
+	return plan, nil
+}
+
+/**
+ * Returns the names and expressions of the selected columns, with * expanded
+ * to all the columns of the from clause, and t.* to all the columns of table t.
+ * An unaliased column is named after the column it references, or after the
+ * expression computing it. The names are made unique, see uniqueNames.
+ */
+func projection(stmt *sql.SelectStatement, scope *eval.Scope) ([]string, []sql.Expr, error) {
+	columns := make([]string, 0, len(stmt.Items))
+	exprs := make([]sql.Expr, 0, len(stmt.Items))
+	// The names of the columns with their tables, for unaliased table columns
+	qualified := make([]string, 0, len(stmt.Items))
+	for _, item := range stmt.Items {
+		if item.Star {
+			expanded := false
+			for _, column := range scope.Columns {
+				if item.Table != "" && column.Table != item.Table {
+					continue
+				}
+				columns = append(columns, column.Name)
+				exprs = append(exprs, &sql.ColumnRef{Table: column.Table, Name: column.Name})
+				qualified = append(qualified, column.Table+"."+column.Name)
+				expanded = true
+			}
+			if !expanded {
+				return nil, nil, fmt.Errorf("table %s is not in the FROM clause", item.Table)
+			}
+			continue
+		}
+
+		name := item.Alias
+		qualifiedName := ""
+		if name == "" {
+			switch e := item.Expr.(type) {
+			case *sql.ColumnRef:
+				name = e.Name
+				if e.Table != "" {
+					qualifiedName = e.Table + "." + e.Name
+				}
+			case *sql.BinaryExpr:
+				name = strings.TrimSuffix(strings.TrimPrefix(e.String(), "("), ")")
+			default:
+				name = e.String()
+			}
+		}
+		columns = append(columns, name)
+		exprs = append(exprs, item.Expr)
+		qualified = append(qualified, qualifiedName)
+	}
+
+	return uniqueNames(columns, qualified), exprs, nil
+}
+
+/**
+ * Makes the names of the selected columns unique, since a row is returned
+ * as an object keyed by them. A column named like another one is named
+ * after its table as well, if it has a qualified name, as a.id and b.id
+ * do, and a name still taken is numbered, as in id and id_2.
+ */
+func uniqueNames(columns []string, qualified []string) []string {
+	counts := make(map[string]int, len(columns))
+	for _, name := range columns {
+		counts[name]++
+	}
+
+	names := make([]string, len(columns))
+	taken := make(map[string]bool, len(columns))
+	for i, name := range columns {
+		if counts[name] > 1 && qualified[i] != "" {
+			name = qualified[i]
+		}
+		unique := name
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		taken[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+/**
+ * Resolves the order by items: a positive int literal refers to a selected column
+ * by its position, and an unqualified name matching a selected column's alias
+ * refers to that column. Anything else is an expression over the table.
+ */
+func resolveOrderBy(stmt *sql.SelectStatement, columns []string, exprs []sql.Expr) ([]sql.OrderItem, error) {
+	items := make([]sql.OrderItem, len(stmt.OrderBy))
+	for i, item := range stmt.OrderBy {
+		items[i] = item
+
+		switch e := item.Expr.(type) {
+		case *sql.Literal:
+			if e.Value.Type != row.TYPE_INT {
+				continue
+			}
+			if e.Value.Int < 1 || e.Value.Int > int64(len(exprs)) {
+				return nil, fmt.Errorf("order by position %d is out of range, %d columns are selected", e.Value.Int, len(exprs))
+			}
+			items[i].Expr = exprs[e.Value.Int-1]
+		case *sql.ColumnRef:
+			if e.Table != "" {
+				continue
+			}
+			for j, column := range columns {
+				if column == e.Name && isAlias(stmt, column) {
+					items[i].Expr = exprs[j]
+					break
+				}
+			}
+		}
+	}
+
+	return items, nil
+}
+
+func isAlias(stmt *sql.SelectStatement, name string) bool {
+	for _, item := range stmt.Items {
+		if !item.Star && item.Alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Estimates the rows left of the given ones by the limit and the offset.
+ * A parameter may be bound to any value, so it does not limit the estimate.
+ */
+func limitedRows(stmt *sql.SelectStatement, rows float64) float64 {
+	if offset, ok := intConstant(stmt.Offset); ok {
+		rows = math.Max(rows-float64(offset), 0)
+	}
+	if limit, ok := intConstant(stmt.Limit); ok {
+		rows = math.Min(rows, math.Max(float64(limit), 0))
+	}
+	return rows
+}
+
+/**
+ * A select statement aggregates if it groups, has a having clause,
+ * or calls aggregate functions in the select list or the order by.
+ */
+func isAggregate(stmt *sql.SelectStatement, exprs []sql.Expr, orderBy []sql.OrderItem) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return true
+	}
+
+	for _, expr := range exprs {
+		if eval.ContainsAggregate(expr) {
+			return true
+		}
+	}
+	for _, item := range orderBy {
+		if eval.ContainsAggregate(item.Expr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+ * Plans the aggregation of the rows matched by the where clause, followed by
+ * a filter for the having clause. Returns the selected and order by expressions
+ * rewritten to read the aggregated rows.
+ */
+func planAggregate(b *builder, stmt *sql.SelectStatement, from *fromClause, exprs []sql.Expr, orderBy []sql.OrderItem) (executor.Operator, []sql.Expr, []sql.OrderItem, error) {
+	grouping, err := eval.NewGrouping(stmt.GroupBy, from.scope())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rewrittenExprs := make([]sql.Expr, len(exprs))
+	for i, expr := range exprs {
+		rewrittenExprs[i], err = grouping.Rewrite(expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	rewrittenOrderBy := make([]sql.OrderItem, len(orderBy))
+	for i, item := range orderBy {
+		rewrittenOrderBy[i].Desc = item.Desc
+		rewrittenOrderBy[i].Expr, err = grouping.Rewrite(item.Expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var having sql.Expr
+	if stmt.Having != nil {
+		having, err = grouping.Rewrite(stmt.Having)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var op executor.Operator
+	if functions, ok := keyExtremeFunctions(stmt, from, grouping); ok {
+		info := b.tableInfo(from.tables[0].table)
+		op = b.add(executor.NewKeyExtremes(info.table, functions, grouping.Scope()), 1, float64(2*info.depth)*PAGE_COST)
+	} else {
+		op, _, err = from.plan(b, stmt.Where, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		rows := b.rows(op)
+		groups := b.groupCount(grouping.GroupBy, from.scope(), rows)
+		op = b.add(executor.NewAggregate(op, grouping), groups, b.cost(op)+rows*HASH_BUILD_COST)
+	}
+
+	if having != nil {
+		filter, err := executor.NewFilter(op, having)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		op = b.add(filter, b.rows(op)*b.selectivity(having, grouping.Scope()), b.cost(op)+b.rows(op)*ROW_COST)
+	}
+
+	return op, rewrittenExprs, rewrittenOrderBy, nil
+}
+
+/**
+ * Returns the aggregate functions if the aggregation consists only of min and
+ * max of the primary key over the whole table, so it can be answered from the
+ * ends of the tree without scanning it.
+ */
+func keyExtremeFunctions(stmt *sql.SelectStatement, from *fromClause, grouping *eval.Grouping) ([]string, bool) {
+	if len(from.tables) > 1 || stmt.Where != nil || len(grouping.GroupBy) > 0 || len(grouping.Aggregates) == 0 {
+		return nil, false
+	}
+
+	t, scope := from.tables[0].table, from.tables[0].scope
+	functions := make([]string, len(grouping.Aggregates))
+	for i, call := range grouping.Aggregates {
+		if call.Name != eval.AGGREGATE_MIN && call.Name != eval.AGGREGATE_MAX || len(call.Args) != 1 {
+			return nil, false
+		}
+		if !isPrimaryKey(call.Args[0], scope, t) {
+			return nil, false
+		}
+		functions[i] = call.Name
+	}
+
+	return functions, true
+}
@@ -0,0 +1,72 @@
+package row
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func compareOrdered[T int64 | float64 | string](a T, b T) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+/**
+ * Compares two non-NULL values, returning -1, 0 or 1. Ints and floats are
+ * compared numerically, and text is converted to a timestamp when compared
+ * with one. Other values can only be compared with values of the same type.
+ */
+func CompareValues(a Value, b Value) (int, error) {
+	if a.IsNull() || b.IsNull() {
+		return 0, fmt.Errorf("cannot compare NULL values")
+	}
+
+	if a.Type != b.Type {
+		switch {
+		case a.Type == TYPE_INT && b.Type == TYPE_FLOAT:
+			return compareOrdered(float64(a.Int), b.Float), nil
+		case a.Type == TYPE_FLOAT && b.Type == TYPE_INT:
+			return compareOrdered(a.Float, float64(b.Int)), nil
+		case a.Type == TYPE_TEXT && b.Type == TYPE_TIMESTAMP:
+			converted, err := CoerceValue(a, TYPE_TIMESTAMP)
+			if err != nil {
+				return 0, err
+			}
+			return CompareValues(converted, b)
+		case a.Type == TYPE_TIMESTAMP && b.Type == TYPE_TEXT:
+			converted, err := CoerceValue(b, TYPE_TIMESTAMP)
+			if err != nil {
+				return 0, err
+			}
+			return CompareValues(a, converted)
+		default:
+			return 0, fmt.Errorf("cannot compare %s and %s values", a.Type, b.Type)
+		}
+	}
+
+	switch a.Type {
+	case TYPE_INT:
+		return compareOrdered(a.Int, b.Int), nil
+	case TYPE_FLOAT:
+		return compareOrdered(a.Float, b.Float), nil
+	case TYPE_TEXT:
+		return strings.Compare(a.Text, b.Text), nil
+	case TYPE_BLOB:
+		return bytes.Compare(a.Blob, b.Blob), nil
+	case TYPE_BOOL:
+		if a.Bool == b.Bool {
+			return 0, nil
+		} else if !a.Bool {
+			return -1, nil
+		}
+		return 1, nil
+	case TYPE_TIMESTAMP:
+		return a.Time.Compare(b.Time), nil
+	default:
+		return 0, fmt.Errorf("cannot compare %s values", a.Type)
+	}
+}
@@ -0,0 +1,41 @@
+package row
+
+import (
+	"fmt"
+	"net/mail"
+)
+
+/**
+ * A named check that can be attached to a column with "check <name>".
+ * Checks are only called for non-NULL values.
+ */
+type CheckFunc func(v Value) error
+
+var checks = map[string]CheckFunc{
+	"email": checkEmail,
+}
+
+var checkTypes = map[string]ColumnType{
+	"email": TYPE_TEXT,
+}
+
+func checkEmail(v Value) error {
+	address, err := mail.ParseAddress(v.Text)
+	if err != nil || address.Address != v.Text {
+		return fmt.Errorf("%q is not a valid email address", v.Text)
+	}
+
+	return nil
+}
+
+func validateCheck(column Column) error {
+	checkType, ok := checkTypes[column.Check]
+	if !ok {
+		return fmt.Errorf("unknown check %s on column %s", column.Check, column.Name)
+	}
+	if checkType != column.Type {
+		return fmt.Errorf("check %s requires column %s to be of type %s", column.Check, column.Name, checkType)
+	}
+
+	return nil
+}
@@ -2,37 +2,105 @@ package row
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
 )
 
-const USERNAME_LEN uint32 = 32
-const EMAIL_LEN uint32 = 256
-
 type Row struct {
-	Id       uint32             `json:"id"`
-	Username [USERNAME_LEN]byte `json:"username"`
-	Email    [EMAIL_LEN]byte    `json:"email"`
+	Values []Value
 }
 
+func NewRow(values []Value) *Row {
+	r := &Row{
+		Values: values,
+	}
+
+	return r
+}
+
+/**
+ * A row rendered for a client; columns keep their schema order
+ * when marshalled to JSON.
+ */
 type RowDTO struct {
-	Id       uint32 `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	columns []string
+	values  []any
 }
 
-func (r *Row) ToString() string {
-	return fmt.Sprintf("ID: %d, Username: %s, Email: %s", r.Id, string(r.Username[:]), string(r.Email[:]))
+func NewRowDTO(columns []string, values []Value) *RowDTO {
+	dto := &RowDTO{
+		columns: columns,
+		values:  make([]any, len(values)),
+	}
+
+	for i, value := range values {
+		dto.values[i] = value.ToDTO()
+	}
+
+	return dto
+}
+
+func (dto *RowDTO) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range dto.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		columnBytes, _ := json.Marshal(column)
+		b.Write(columnBytes)
+		b.WriteByte(':')
+
+		valueBytes, err := json.Marshal(dto.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(valueBytes)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
 }
 
-func (r *Row) ToRowDTO() *RowDTO {
-	usernameBefore, _, _ := bytes.Cut(r.Username[:], []byte{0})
-	emailBefore, _, _ := bytes.Cut(r.Email[:], []byte{0})
+func (r *Row) ToString() string {
+	parts := make([]string, len(r.Values))
+	for i, value := range r.Values {
+		parts[i] = value.ToString()
+	}
 
+	return strings.Join(parts, ", ")
+}
+
+func (r *Row) ToRowDTO(schema *Schema) *RowDTO {
 	ret := &RowDTO{
-		Id:       r.Id,
-		Username: string(usernameBefore),
-		Email:    string(emailBefore),
+		columns: make([]string, len(schema.Columns)),
+		values:  make([]any, len(schema.Columns)),
+	}
+
+	for i, column := range schema.Columns {
+		ret.columns[i] = column.Name
+		ret.values[i] = r.Values[i].ToDTO()
 	}
 
 	return ret
 }
+
+func (r *Row) Key(schema *Schema) []byte {
+	return EncodeKey(r.Values[schema.PrimaryKeyIndex].Int)
+}
+
+/**
+ * Encodes an int key so that the byte order of encoded keys
+ * matches the numeric order of the keys.
+ */
+func EncodeKey(key int64) []byte {
+	keyBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(keyBytes, uint64(key)^(1<<63))
+	return keyBytes
+}
+
+func DecodeKey(keyBytes []byte) int64 {
+	return int64(binary.BigEndian.Uint64(keyBytes) ^ (1 << 63))
+}
@@ -0,0 +1,164 @@
+package row
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+type Column struct {
+	Name       string
+	Type       ColumnType
+	PrimaryKey bool
+	NotNull    bool
+	// Maximum length of text values in characters, or of blob values in bytes; 0 means unlimited
+	MaxLength int
+	// Name of a check from the checks registry; empty means no check
+	Check string
+}
+
+/**
+ * Describes the columns of a table, in the order in which
+ * their values are stored in each row.
+ */
+type Schema struct {
+	Columns         []Column
+	PrimaryKeyIndex int
+}
+
+func NewSchema(columns []Column) (*Schema, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("a table must have at least one column")
+	}
+
+	schema := &Schema{
+		Columns:         columns,
+		PrimaryKeyIndex: -1,
+	}
+
+	names := make(map[string]bool)
+	for i, column := range columns {
+		if names[column.Name] {
+			return nil, fmt.Errorf("duplicate column name %s", column.Name)
+		}
+		names[column.Name] = true
+
+		if column.MaxLength < 0 {
+			return nil, fmt.Errorf("invalid maximum length of column %s", column.Name)
+		}
+		if column.MaxLength > 0 && column.Type != TYPE_TEXT && column.Type != TYPE_BLOB {
+			return nil, fmt.Errorf("column %s of type %s cannot have a maximum length", column.Name, column.Type)
+		}
+		if column.Check != "" {
+			err := validateCheck(column)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if column.PrimaryKey {
+			if schema.PrimaryKeyIndex >= 0 {
+				return nil, fmt.Errorf("a table can have only one primary key column")
+			}
+			if column.Type != TYPE_INT {
+				return nil, fmt.Errorf("primary key column %s must be of type int", column.Name)
+			}
+			schema.PrimaryKeyIndex = i
+		}
+	}
+
+	if schema.PrimaryKeyIndex < 0 {
+		return nil, fmt.Errorf("a table must have a primary key column")
+	}
+
+	return schema, nil
+}
+
+func (s *Schema) ColumnIndex(name string) (int, bool) {
+	for i, column := range s.Columns {
+		if column.Name == name {
+			return i, true
+		}
+	}
+
+	return -1, false
+}
+
+func (s *Schema) PrimaryKeyColumn() Column {
+	return s.Columns[s.PrimaryKeyIndex]
+}
+
+/**
+ * Parses the textual values of a new row, one per column.
+ */
+func (s *Schema) ParseRow(inputs []string) (*Row, error) {
+	if len(inputs) != len(s.Columns) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(s.Columns), len(inputs))
+	}
+
+	values := make([]Value, len(inputs))
+	for i, input := range inputs {
+		value, err := ParseValue(input, s.Columns[i].Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", s.Columns[i].Name, err)
+		}
+		values[i] = value
+	}
+
+	r := NewRow(values)
+	return r, s.Validate(r)
+}
+
+/**
+ * Checks that the row matches the schema.
+ */
+func (s *Schema) Validate(r *Row) error {
+	if len(r.Values) != len(s.Columns) {
+		return fmt.Errorf("expected %d values, got %d", len(s.Columns), len(r.Values))
+	}
+
+	for i, value := range r.Values {
+		err := validateValue(s.Columns[i], value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateValue(column Column, value Value) error {
+	if value.IsNull() {
+		if column.PrimaryKey || column.NotNull {
+			return fmt.Errorf("column %s cannot be null", column.Name)
+		}
+		return nil
+	}
+
+	if value.Type != column.Type {
+		return fmt.Errorf("column %s expects a value of type %s, got %s", column.Name, column.Type, value.Type)
+	}
+
+	switch value.Type {
+	case TYPE_TEXT:
+		if !utf8.ValidString(value.Text) {
+			return fmt.Errorf("column %s: value is not valid UTF-8", column.Name)
+		}
+		length := utf8.RuneCountInString(value.Text)
+		if column.MaxLength > 0 && length > column.MaxLength {
+			return fmt.Errorf("column %s: value has %d characters, at most %d allowed", column.Name, length, column.MaxLength)
+		}
+	case TYPE_BLOB:
+		if column.MaxLength > 0 && len(value.Blob) > column.MaxLength {
+			return fmt.Errorf("column %s: value has %d bytes, at most %d allowed", column.Name, len(value.Blob), column.MaxLength)
+		}
+	}
+
+	if column.Check != "" {
+		err := checks[column.Check](value)
+		if err != nil {
+			return fmt.Errorf("column %s: %v", column.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package row
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ColumnType uint8
+
+const (
+	TYPE_NULL ColumnType = iota
+	TYPE_INT
+	TYPE_FLOAT
+	TYPE_TEXT
+	TYPE_BLOB
+	TYPE_BOOL
+	TYPE_TIMESTAMP
+)
+
+const NULL_LITERAL string = "null"
+const BLOB_PREFIX string = "0x"
+
+var columnTypeNames = map[ColumnType]string{
+	TYPE_NULL:      "null",
+	TYPE_INT:       "int",
+	TYPE_FLOAT:     "float",
+	TYPE_TEXT:      "text",
+	TYPE_BLOB:      "blob",
+	TYPE_BOOL:      "bool",
+	TYPE_TIMESTAMP: "timestamp",
+}
+
+var columnTypeAliases = map[string]ColumnType{
+	"int":       TYPE_INT,
+	"integer":   TYPE_INT,
+	"int64":     TYPE_INT,
+	"float":     TYPE_FLOAT,
+	"float64":   TYPE_FLOAT,
+	"real":      TYPE_FLOAT,
+	"double":    TYPE_FLOAT,
+	"text":      TYPE_TEXT,
+	"string":    TYPE_TEXT,
+	"varchar":   TYPE_TEXT,
+	"blob":      TYPE_BLOB,
+	"bool":      TYPE_BOOL,
+	"boolean":   TYPE_BOOL,
+	"timestamp": TYPE_TIMESTAMP,
+}
+
+/**
+ * The accepted forms of timestamps: RFC 3339, and the form of SQL timestamp
+ * literals, which separates the date and the time with a space. Fractional
+ * seconds are accepted in all of them.
+ */
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func (ct ColumnType) String() string {
+	return columnTypeNames[ct]
+}
+
+func ParseColumnType(name string) (ColumnType, error) {
+	columnType, ok := columnTypeAliases[strings.ToLower(name)]
+	if !ok {
+		return TYPE_NULL, fmt.Errorf("unknown column type %s", name)
+	}
+
+	return columnType, nil
+}
+
+/**
+ * A single typed value. Only the field matching the type is meaningful;
+ * a value of type TYPE_NULL represents SQL NULL.
+ */
+type Value struct {
+	Type  ColumnType
+	Int   int64
+	Float float64
+	Text  string
+	Blob  []byte
+	Bool  bool
+	Time  time.Time
+}
+
+func NewNullValue() Value {
+	return Value{Type: TYPE_NULL}
+}
+
+func NewIntValue(i int64) Value {
+	return Value{Type: TYPE_INT, Int: i}
+}
+
+func NewFloatValue(f float64) Value {
+	return Value{Type: TYPE_FLOAT, Float: f}
+}
+
+func NewTextValue(s string) Value {
+	return Value{Type: TYPE_TEXT, Text: s}
+}
+
+func NewBlobValue(b []byte) Value {
+	return Value{Type: TYPE_BLOB, Blob: b}
+}
+
+func NewBoolValue(b bool) Value {
+	return Value{Type: TYPE_BOOL, Bool: b}
+}
+
+func NewTimestampValue(t time.Time) Value {
+	return Value{Type: TYPE_TIMESTAMP, Time: t.UTC()}
+}
+
+func (v Value) IsNull() bool {
+	return v.Type == TYPE_NULL
+}
+
+/**
+ * Parses the textual form of a value, as typed by a client,
+ * into a value of the given column type.
+ */
+func ParseValue(input string, columnType ColumnType) (Value, error) {
+	if strings.ToLower(input) == NULL_LITERAL {
+		return NewNullValue(), nil
+	}
+
+	switch columnType {
+	case TYPE_INT:
+		i, err := strconv.ParseInt(input, 10, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid int value %s", input)
+		}
+		return NewIntValue(i), nil
+	case TYPE_FLOAT:
+		f, err := strconv.ParseFloat(input, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid float value %s", input)
+		}
+		return NewFloatValue(f), nil
+	case TYPE_TEXT:
+		return NewTextValue(input), nil
+	case TYPE_BLOB:
+		b, err := hex.DecodeString(strings.TrimPrefix(input, BLOB_PREFIX))
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid blob value %s, expected hex digits", input)
+		}
+		return NewBlobValue(b), nil
+	case TYPE_BOOL:
+		b, err := strconv.ParseBool(input)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid bool value %s", input)
+		}
+		return NewBoolValue(b), nil
+	case TYPE_TIMESTAMP:
+		for _, layout := range timestampLayouts {
+			t, err := time.Parse(layout, input)
+			if err == nil {
+				return NewTimestampValue(t), nil
+			}
+		}
+		return Value{}, fmt.Errorf("invalid timestamp value %s", input)
+	default:
+		return Value{}, fmt.Errorf("cannot parse a value of type %s", columnType)
+	}
+}
+
+/**
+ * Converts the value to the given column type, if the conversion is lossless
+ * or the value is a textual form of a timestamp. NULL converts to any type.
+ */
+func CoerceValue(v Value, columnType ColumnType) (Value, error) {
+	if v.IsNull() || v.Type == columnType {
+		return v, nil
+	}
+
+	if v.Type == TYPE_INT && columnType == TYPE_FLOAT {
+		return NewFloatValue(float64(v.Int)), nil
+	}
+	if v.Type == TYPE_TEXT && columnType == TYPE_TIMESTAMP {
+		return ParseValue(v.Text, TYPE_TIMESTAMP)
+	}
+
+	return Value{}, fmt.Errorf("cannot use a %s value as %s", v.Type, columnType)
+}
+
+/**
+ * Returns the value in the form used for JSON responses.
+ */
+func (v Value) ToDTO() any {
+	switch v.Type {
+	case TYPE_INT:
+		return v.Int
+	case TYPE_FLOAT:
+		return v.Float
+	case TYPE_TEXT:
+		return v.Text
+	case TYPE_BLOB:
+		return BLOB_PREFIX + hex.EncodeToString(v.Blob)
+	case TYPE_BOOL:
+		return v.Bool
+	case TYPE_TIMESTAMP:
+		return v.Time.Format(time.RFC3339Nano)
+	default:
+		return nil
+	}
+}
+
+func (v Value) ToString() string {
+	if v.IsNull() {
+		return "NULL"
+	}
+
+	return fmt.Sprint(v.ToDTO())
+}
@@ -0,0 +1,42 @@
+package row
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+		valid    bool
+	}{
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), true},
+		{"2024-01-02T03:04:05.25+02:00", time.Date(2024, 1, 2, 1, 4, 5, 250000000, time.UTC), true},
+		{"2024-01-02T03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), true},
+		{"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), true},
+		{"2024-01-02 03:04:05.123456", time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC), true},
+		{"2024-01-02 03:04:05-05:00", time.Date(2024, 1, 2, 8, 4, 5, 0, time.UTC), true},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true},
+		{"2024-01-02 03:04", time.Time{}, false},
+		{"2024-13-02 03:04:05", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		value, err := ParseValue(test.input, TYPE_TIMESTAMP)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error %v", test.input, err)
+			continue
+		}
+		if test.valid && (value.Type != TYPE_TIMESTAMP || !value.Time.Equal(test.expected)) {
+			t.Errorf("%s: parsed %v, expected %v", test.input, value.Time, test.expected)
+		}
+
+		// A text literal inserted into a timestamp column
+		coerced, err := CoerceValue(NewTextValue(test.input), TYPE_TIMESTAMP)
+		if (err == nil) != test.valid || (test.valid && !coerced.Time.Equal(test.expected)) {
+			t.Errorf("%s: coerced to %v, error %v", test.input, coerced.Time, err)
+		}
+	}
+}
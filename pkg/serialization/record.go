@@ -0,0 +1,228 @@
+package serialization
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+/**
+ * Record outline:
+ * | column count (uvarint) | NULL bitmap (ceil(column count / 8) B) | values of non-NULL columns |
+ * - bit i of the NULL bitmap is set if the value of column i is NULL;
+ * NULL values take no space in the values list
+ * - int, float and timestamp values are 8 bytes each (timestamps are
+ * stored as nanoseconds since the Unix epoch), bool values are 1 byte
+ * - text and blob values are a length (uvarint) followed by the bytes
+ */
+
+const FIXED_VALUE_SIZE = 8
+
+func nullBitmapSize(numColumns int) int {
+	return (numColumns + 7) / 8
+}
+
+/**
+ * Appends the record form of the row to dst and returns the extended slice.
+ */
+func AppendRecord(dst []byte, schema *row.Schema, r *row.Row) []byte {
+	numColumns := len(schema.Columns)
+	dst = binary.AppendUvarint(dst, uint64(numColumns))
+
+	bitmapStart := len(dst)
+	for i := 0; i < nullBitmapSize(numColumns); i++ {
+		dst = append(dst, 0)
+	}
+
+	for i, column := range schema.Columns {
+		value := r.Values[i]
+		if value.IsNull() {
+			dst[bitmapStart+i/8] |= 1 << (i % 8)
+			continue
+		}
+
+		switch column.Type {
+		case row.TYPE_INT:
+			dst = binary.LittleEndian.AppendUint64(dst, uint64(value.Int))
+		case row.TYPE_FLOAT:
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(value.Float))
+		case row.TYPE_TIMESTAMP:
+			dst = binary.LittleEndian.AppendUint64(dst, uint64(value.Time.UnixNano()))
+		case row.TYPE_BOOL:
+			if value.Bool {
+				dst = append(dst, 1)
+			} else {
+				dst = append(dst, 0)
+			}
+		case row.TYPE_TEXT:
+			dst = binary.AppendUvarint(dst, uint64(len(value.Text)))
+			dst = append(dst, value.Text...)
+		case row.TYPE_BLOB:
+			dst = binary.AppendUvarint(dst, uint64(len(value.Blob)))
+			dst = append(dst, value.Blob...)
+		}
+	}
+
+	return dst
+}
+
+func EncodeRecord(schema *row.Schema, r *row.Row) []byte {
+	return AppendRecord(make([]byte, 0, 64), schema, r)
+}
+
+/**
+ * A read-only view over an encoded record. Values are read directly from the
+ * record bytes, so a single Record can be reset and reused for every record of
+ * a scan without allocating.
+ */
+type Record struct {
+	schema  *row.Schema
+	data    []byte
+	bitmap  []byte
+	offsets []int
+}
+
+func NewRecord(schema *row.Schema) *Record {
+	record := &Record{
+		schema:  schema,
+		offsets: make([]int, len(schema.Columns)),
+	}
+
+	return record
+}
+
+/**
+ * Points the view at new record bytes. The bytes must not be modified
+ * while the view is in use.
+ */
+func (rec *Record) Reset(data []byte) error {
+	numColumns, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("corrupt record: invalid column count")
+	}
+	if int(numColumns) != len(rec.schema.Columns) {
+		return fmt.Errorf("corrupt record: %d columns, schema has %d", numColumns, len(rec.schema.Columns))
+	}
+
+	bitmapEnd := n + nullBitmapSize(int(numColumns))
+	if bitmapEnd > len(data) {
+		return fmt.Errorf("corrupt record: truncated NULL bitmap")
+	}
+
+	rec.data = data
+	rec.bitmap = data[n:bitmapEnd]
+
+	offset := bitmapEnd
+	for i, column := range rec.schema.Columns {
+		rec.offsets[i] = offset
+		if rec.IsNull(i) {
+			continue
+		}
+
+		switch column.Type {
+		case row.TYPE_INT, row.TYPE_FLOAT, row.TYPE_TIMESTAMP:
+			offset += FIXED_VALUE_SIZE
+		case row.TYPE_BOOL:
+			offset += 1
+		case row.TYPE_TEXT, row.TYPE_BLOB:
+			if offset > len(data) {
+				return fmt.Errorf("corrupt record: truncated column %s", column.Name)
+			}
+			length, n := binary.Uvarint(data[offset:])
+			if n <= 0 || length > uint64(len(data)-offset-n) {
+				return fmt.Errorf("corrupt record: invalid length of column %s", column.Name)
+			}
+			offset += n + int(length)
+		}
+
+		if offset > len(data) {
+			return fmt.Errorf("corrupt record: truncated column %s", column.Name)
+		}
+	}
+
+	return nil
+}
+
+func (rec *Record) IsNull(i int) bool {
+	return rec.bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+func (rec *Record) Int(i int) int64 {
+	return int64(binary.LittleEndian.Uint64(rec.data[rec.offsets[i]:]))
+}
+
+func (rec *Record) Float(i int) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(rec.data[rec.offsets[i]:]))
+}
+
+func (rec *Record) Bool(i int) bool {
+	return rec.data[rec.offsets[i]] != 0
+}
+
+func (rec *Record) Time(i int) time.Time {
+	return time.Unix(0, rec.Int(i)).UTC()
+}
+
+/**
+ * Returns the bytes of a text or blob value. The slice aliases the record.
+ */
+func (rec *Record) Bytes(i int) []byte {
+	length, n := binary.Uvarint(rec.data[rec.offsets[i]:])
+	start := rec.offsets[i] + n
+	return rec.data[start : start+int(length)]
+}
+
+func (rec *Record) Value(i int) row.Value {
+	if rec.IsNull(i) {
+		return row.NewNullValue()
+	}
+
+	switch rec.schema.Columns[i].Type {
+	case row.TYPE_INT:
+		return row.NewIntValue(rec.Int(i))
+	case row.TYPE_FLOAT:
+		return row.NewFloatValue(rec.Float(i))
+	case row.TYPE_TIMESTAMP:
+		return row.NewTimestampValue(rec.Time(i))
+	case row.TYPE_BOOL:
+		return row.NewBoolValue(rec.Bool(i))
+	case row.TYPE_TEXT:
+		return row.NewTextValue(string(rec.Bytes(i)))
+	case row.TYPE_BLOB:
+		blob := make([]byte, len(rec.Bytes(i)))
+		copy(blob, rec.Bytes(i))
+		return row.NewBlobValue(blob)
+	default:
+		return row.NewNullValue()
+	}
+}
+
+/**
+ * Decodes the record into dst, reusing the capacity of dst.Values.
+ * Text and blob values are copied out of the record.
+ */
+func (rec *Record) DecodeInto(dst *row.Row) {
+	if cap(dst.Values) < len(rec.schema.Columns) {
+		dst.Values = make([]row.Value, len(rec.schema.Columns))
+	}
+	dst.Values = dst.Values[:len(rec.schema.Columns)]
+
+	for i := range rec.schema.Columns {
+		dst.Values[i] = rec.Value(i)
+	}
+}
+
+func DecodeRecord(schema *row.Schema, data []byte) (*row.Row, error) {
+	rec := NewRecord(schema)
+	err := rec.Reset(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &row.Row{}
+	rec.DecodeInto(r)
+	return r, nil
+}
@@ -0,0 +1,292 @@
+package serialization
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+/**
+ * Returns a schema with columns of the types. Records do not depend on
+ * the constraints of the columns, so the schema is not validated.
+ */
+func newTestSchema(types ...row.ColumnType) *row.Schema {
+	columns := make([]row.Column, len(types))
+	for i, columnType := range types {
+		columns[i] = row.Column{Name: fmt.Sprintf("c%d", i), Type: columnType}
+	}
+	return &row.Schema{Columns: columns, PrimaryKeyIndex: -1}
+}
+
+/**
+ * The six-column row the record format was sized with.
+ */
+func sampleRow() (*row.Schema, *row.Row) {
+	schema := newTestSchema(row.TYPE_INT, row.TYPE_TEXT, row.TYPE_TEXT, row.TYPE_FLOAT, row.TYPE_BOOL, row.TYPE_TIMESTAMP)
+	r := row.NewRow([]row.Value{
+		row.NewIntValue(42),
+		row.NewTextValue("Ada Lovelace"),
+		row.NewTextValue("ada@example.com"),
+		row.NewFloatValue(97.5),
+		row.NewBoolValue(true),
+		row.NewTimestampValue(time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)),
+	})
+	return schema, r
+}
+
+func valuesEqual(a row.Value, b row.Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case row.TYPE_NULL:
+		return true
+	case row.TYPE_INT:
+		return a.Int == b.Int
+	case row.TYPE_FLOAT:
+		return a.Float == b.Float
+	case row.TYPE_BOOL:
+		return a.Bool == b.Bool
+	case row.TYPE_TEXT:
+		return a.Text == b.Text
+	case row.TYPE_BLOB:
+		return bytes.Equal(a.Blob, b.Blob)
+	case row.TYPE_TIMESTAMP:
+		return a.Time.Equal(b.Time)
+	}
+	return false
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	null := row.NewNullValue()
+	manyTypes := make([]row.ColumnType, 11)
+	manyValues := make([]row.Value, 11)
+	for i := range manyTypes {
+		manyTypes[i] = row.TYPE_INT
+		manyValues[i] = row.NewIntValue(int64(i))
+		if i%3 == 0 {
+			manyValues[i] = null
+		}
+	}
+
+	tests := []struct {
+		name   string
+		types  []row.ColumnType
+		values []row.Value
+	}{
+		{
+			name:   "every type",
+			types:  []row.ColumnType{row.TYPE_INT, row.TYPE_FLOAT, row.TYPE_BOOL, row.TYPE_TEXT, row.TYPE_BLOB, row.TYPE_TIMESTAMP},
+			values: []row.Value{row.NewIntValue(-7), row.NewFloatValue(3.25), row.NewBoolValue(false), row.NewTextValue("héllo"), row.NewBlobValue([]byte{0, 1, 255}), row.NewTimestampValue(time.Unix(1700000000, 123))},
+		},
+		{
+			name:   "extreme values",
+			types:  []row.ColumnType{row.TYPE_INT, row.TYPE_INT, row.TYPE_FLOAT, row.TYPE_TIMESTAMP},
+			values: []row.Value{row.NewIntValue(-1 << 63), row.NewIntValue(1<<63 - 1), row.NewFloatValue(-0.5e300), row.NewTimestampValue(time.Unix(0, 0))},
+		},
+		{
+			name:   "empty text and blob",
+			types:  []row.ColumnType{row.TYPE_TEXT, row.TYPE_BLOB, row.TYPE_INT},
+			values: []row.Value{row.NewTextValue(""), row.NewBlobValue([]byte{}), row.NewIntValue(1)},
+		},
+		{
+			name:   "long text",
+			types:  []row.ColumnType{row.TYPE_TEXT},
+			values: []row.Value{row.NewTextValue(string(bytes.Repeat([]byte("x"), 300)))},
+		},
+		{
+			name:   "NULLs between values",
+			types:  []row.ColumnType{row.TYPE_INT, row.TYPE_TEXT, row.TYPE_BOOL, row.TYPE_BLOB},
+			values: []row.Value{null, row.NewTextValue("kept"), null, row.NewBlobValue([]byte("also kept"))},
+		},
+		{
+			name:   "only NULLs",
+			types:  []row.ColumnType{row.TYPE_TEXT, row.TYPE_TIMESTAMP},
+			values: []row.Value{null, null},
+		},
+		{
+			name:   "NULL bitmap of two bytes",
+			types:  manyTypes,
+			values: manyValues,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := newTestSchema(test.types...)
+			data := EncodeRecord(schema, row.NewRow(test.values))
+
+			decoded, err := DecodeRecord(schema, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Values) != len(test.values) {
+				t.Fatalf("decoded %d values", len(decoded.Values))
+			}
+			for i, value := range test.values {
+				if !valuesEqual(decoded.Values[i], value) {
+					t.Errorf("column %d: decoded %v, expected %v", i, decoded.Values[i], value)
+				}
+			}
+
+			// The view reads the same values without decoding the row
+			record := NewRecord(schema)
+			if err := record.Reset(data); err != nil {
+				t.Fatal(err)
+			}
+			for i, value := range test.values {
+				if record.IsNull(i) != value.IsNull() {
+					t.Errorf("column %d: IsNull %v", i, record.IsNull(i))
+				}
+			}
+		})
+	}
+}
+
+func TestRecordNullBitmap(t *testing.T) {
+	schema := newTestSchema(row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT, row.TYPE_INT)
+	values := make([]row.Value, 9)
+	for i := range values {
+		values[i] = row.NewIntValue(int64(i))
+	}
+	values[0], values[7], values[8] = row.NewNullValue(), row.NewNullValue(), row.NewNullValue()
+
+	data := EncodeRecord(schema, row.NewRow(values))
+	// The column count, two bitmap bytes, and the six non-NULL ints
+	if len(data) != 1+2+6*FIXED_VALUE_SIZE {
+		t.Fatalf("record of %d bytes", len(data))
+	}
+	if data[1] != 0b10000001 || data[2] != 0b00000001 {
+		t.Fatalf("NULL bitmap %08b %08b", data[1], data[2])
+	}
+}
+
+func TestRecordSize(t *testing.T) {
+	schema, r := sampleRow()
+	data := EncodeRecord(schema, r)
+
+	// The column count, the bitmap, an int, two texts with their lengths, a float, a bool and a timestamp
+	expected := 1 + 1 + 8 + (1 + 12) + (1 + 15) + 8 + 1 + 8
+	if len(data) != expected {
+		t.Fatalf("record of %d bytes, expected %d", len(data), expected)
+	}
+	gob := Serialize(r)
+	if len(data)*4 > len(gob) {
+		t.Fatalf("record of %d bytes is not much smaller than its gob encoding of %d", len(data), len(gob))
+	}
+	t.Logf("record %d bytes, gob %d bytes", len(data), len(gob))
+}
+
+func TestRecordCorrupt(t *testing.T) {
+	schema, r := sampleRow()
+	valid := EncodeRecord(schema, r)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"invalid column count", bytes.Repeat([]byte{0xff}, 11)},
+		{"wrong column count", append([]byte{5}, valid[1:]...)},
+		{"missing NULL bitmap", valid[:1]},
+		// The length of the first text claims more bytes than the record has
+		{"text longer than the record", append(append([]byte(nil), valid[:10]...), 0x7f, 'A')},
+		// A length of 2^64-1 wraps around to -1, so the rest of the record would seem to follow it
+		{"text length wrapping around", append(append(append([]byte(nil), valid[:10]...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 'A'), make([]byte, 17)...)},
+	}
+	// Every record cut short is corrupt, since every column has a value
+	for end := 1; end < len(valid); end++ {
+		tests = append(tests, struct {
+			name string
+			data []byte
+		}{fmt.Sprintf("truncated to %d bytes", end), valid[:end]})
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := NewRecord(schema).Reset(test.data); err == nil {
+				t.Fatal("corrupt record accepted")
+			}
+			if _, err := DecodeRecord(schema, test.data); err == nil {
+				t.Fatal("corrupt record decoded")
+			}
+		})
+	}
+}
+
+/**
+ * Reading the values of a scan through a reused view must not allocate.
+ */
+func TestRecordResetDoesNotAllocate(t *testing.T) {
+	schema, r := sampleRow()
+	data := EncodeRecord(schema, r)
+	record := NewRecord(schema)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if record.Reset(data) != nil || record.Int(0) != 42 || len(record.Bytes(1)) != 12 {
+			t.Fatal("the record was not read")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("%v allocations per record", allocs)
+	}
+}
+
+func BenchmarkAppendRecord(b *testing.B) {
+	schema, r := sampleRow()
+	dst := make([]byte, 0, 64)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		dst = AppendRecord(dst[:0], schema, r)
+	}
+	b.ReportMetric(float64(len(dst)), "bytes/row")
+}
+
+func BenchmarkGobSerialize(b *testing.B) {
+	_, r := sampleRow()
+	var data []byte
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		data = Serialize(r)
+	}
+	b.ReportMetric(float64(len(data)), "bytes/row")
+}
+
+/**
+ * Reads the values of a record the way a scan filters rows, through
+ * a reused view.
+ */
+func BenchmarkRecordReset(b *testing.B) {
+	schema, r := sampleRow()
+	data := EncodeRecord(schema, r)
+	record := NewRecord(schema)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		err := record.Reset(data)
+		if err != nil || record.Int(0) != 42 || len(record.Bytes(1)) == 0 {
+			b.Fatal("the record was not read")
+		}
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	schema, r := sampleRow()
+	data := EncodeRecord(schema, r)
+	record := NewRecord(schema)
+	decoded := &row.Row{}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		err := record.Reset(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		record.DecodeInto(decoded)
+	}
+}
@@ -0,0 +1,120 @@
+package serialization
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+/**
+ * Tuple outline:
+ * | value count (uvarint) | values |
+ * - every value is its type (1 B) followed by its payload, so a tuple
+ * can be decoded without a schema (e.g. computed values spilled to disk)
+ * - payloads are encoded as in records; NULL values have no payload
+ */
+
+/**
+ * Appends the tuple form of the values to dst and returns the extended slice.
+ */
+func AppendTuple(dst []byte, values []row.Value) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(values)))
+
+	for _, value := range values {
+		dst = append(dst, byte(value.Type))
+
+		switch value.Type {
+		case row.TYPE_INT:
+			dst = binary.LittleEndian.AppendUint64(dst, uint64(value.Int))
+		case row.TYPE_FLOAT:
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(value.Float))
+		case row.TYPE_TIMESTAMP:
+			dst = binary.LittleEndian.AppendUint64(dst, uint64(value.Time.UnixNano()))
+		case row.TYPE_BOOL:
+			if value.Bool {
+				dst = append(dst, 1)
+			} else {
+				dst = append(dst, 0)
+			}
+		case row.TYPE_TEXT:
+			dst = binary.AppendUvarint(dst, uint64(len(value.Text)))
+			dst = append(dst, value.Text...)
+		case row.TYPE_BLOB:
+			dst = binary.AppendUvarint(dst, uint64(len(value.Blob)))
+			dst = append(dst, value.Blob...)
+		}
+	}
+
+	return dst
+}
+
+/**
+ * Decodes a tuple, copying every value out of data.
+ */
+func DecodeTuple(data []byte) ([]row.Value, error) {
+	numValues, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("corrupt tuple: invalid value count")
+	}
+	if numValues > uint64(len(data)) {
+		return nil, fmt.Errorf("corrupt tuple: %d values in %d bytes", numValues, len(data))
+	}
+
+	values := make([]row.Value, numValues)
+	offset := n
+	for i := range values {
+		if offset >= len(data) {
+			return nil, fmt.Errorf("corrupt tuple: truncated value %d", i)
+		}
+		valueType := row.ColumnType(data[offset])
+		offset++
+
+		switch valueType {
+		case row.TYPE_NULL:
+			values[i] = row.NewNullValue()
+		case row.TYPE_INT, row.TYPE_FLOAT, row.TYPE_TIMESTAMP:
+			if offset+FIXED_VALUE_SIZE > len(data) {
+				return nil, fmt.Errorf("corrupt tuple: truncated value %d", i)
+			}
+			bits := binary.LittleEndian.Uint64(data[offset:])
+			offset += FIXED_VALUE_SIZE
+
+			switch valueType {
+			case row.TYPE_INT:
+				values[i] = row.NewIntValue(int64(bits))
+			case row.TYPE_FLOAT:
+				values[i] = row.NewFloatValue(math.Float64frombits(bits))
+			default:
+				values[i] = row.NewTimestampValue(time.Unix(0, int64(bits)).UTC())
+			}
+		case row.TYPE_BOOL:
+			if offset+1 > len(data) {
+				return nil, fmt.Errorf("corrupt tuple: truncated value %d", i)
+			}
+			values[i] = row.NewBoolValue(data[offset] != 0)
+			offset++
+		case row.TYPE_TEXT, row.TYPE_BLOB:
+			length, n := binary.Uvarint(data[offset:])
+			if n <= 0 || offset+n+int(length) > len(data) {
+				return nil, fmt.Errorf("corrupt tuple: truncated value %d", i)
+			}
+			payload := data[offset+n : offset+n+int(length)]
+			offset += n + int(length)
+
+			if valueType == row.TYPE_TEXT {
+				values[i] = row.NewTextValue(string(payload))
+			} else {
+				blob := make([]byte, len(payload))
+				copy(blob, payload)
+				values[i] = row.NewBlobValue(blob)
+			}
+		default:
+			return nil, fmt.Errorf("corrupt tuple: unknown type %d of value %d", valueType, i)
+		}
+	}
+
+	return values, nil
+}
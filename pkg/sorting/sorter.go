@@ -0,0 +1,421 @@
+package sorting
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unsafe"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+)
+
+/**
+ * How many bytes of tuples a sorter keeps in memory before
+ * spilling them to a temporary file as a sorted run.
+ */
+const DEFAULT_MEMORY_BUDGET int = 4 * 1024 * 1024
+
+/**
+ * How many runs are kept at once; when a sorter spills this many runs,
+ * they are merged into a single longer run.
+ */
+const MAX_MERGE_FAN_IN int = 64
+
+const RUN_FILE_PATTERN string = "my-simple-db-sort-*.run"
+
+var valueOverhead = int(unsafe.Sizeof(row.Value{}))
+
+type SortKey struct {
+	Index int
+	Desc  bool
+}
+
+/**
+ * Compares two tuples by the given keys. NULLs sort before every other
+ * value in an ascending order, and after every other value in a descending one.
+ */
+func CompareTuples(a []row.Value, b []row.Value, keys []SortKey) (int, error) {
+	for _, key := range keys {
+		l := a[key.Index]
+		r := b[key.Index]
+
+		var cmp int
+		switch {
+		case l.IsNull() && r.IsNull():
+			cmp = 0
+		case l.IsNull():
+			cmp = -1
+		case r.IsNull():
+			cmp = 1
+		default:
+			var err error
+			cmp, err = row.CompareValues(l, r)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if key.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func tupleSize(values []row.Value) int {
+	size := int(unsafe.Sizeof(values))
+	for _, value := range values {
+		size += valueOverhead + len(value.Text) + len(value.Blob)
+	}
+	return size
+}
+
+/**
+ * An external merge sort of tuples. Tuples are buffered in memory until the
+ * memory budget is exceeded; the buffer is then sorted and written to a
+ * temporary file as a run. Sorting merges the runs and whatever is left in
+ * the buffer. The sort is stable.
+ */
+type Sorter struct {
+	keys         []SortKey
+	memoryBudget int
+	buffer       [][]row.Value
+	bufferSize   int
+	runs         []*os.File
+	spilledRuns  int
+}
+
+func NewSorter(keys []SortKey, memoryBudget int) *Sorter {
+	sorter := &Sorter{
+		keys:         keys,
+		memoryBudget: memoryBudget,
+		buffer:       make([][]row.Value, 0),
+		runs:         make([]*os.File, 0),
+	}
+
+	return sorter
+}
+
+func (s *Sorter) Add(values []row.Value) error {
+	s.buffer = append(s.buffer, values)
+	s.bufferSize += tupleSize(values)
+
+	if s.bufferSize > s.memoryBudget {
+		return s.spill()
+	}
+	return nil
+}
+
+/**
+ * The number of runs written to disk so far.
+ */
+func (s *Sorter) SpilledRuns() int {
+	return s.spilledRuns
+}
+
+func (s *Sorter) sortBuffer() error {
+	var err error
+	sort.SliceStable(s.buffer, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		cmp, cmpErr := CompareTuples(s.buffer[i], s.buffer[j], s.keys)
+		if cmpErr != nil {
+			err = cmpErr
+		}
+		return cmp < 0
+	})
+
+	return err
+}
+
+func (s *Sorter) spill() error {
+	err := s.sortBuffer()
+	if err != nil {
+		return err
+	}
+
+	run, err := s.writeRun(&sliceSource{tuples: s.buffer})
+	if err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, run)
+	s.buffer = s.buffer[:0]
+	s.bufferSize = 0
+
+	// keep the number of open runs bounded by merging them into one longer run
+	if len(s.runs) >= MAX_MERGE_FAN_IN {
+		merged, err := s.writeRun(newMerger(fileSources(s.runs), s.keys))
+		closeRuns(s.runs)
+		s.runs = s.runs[:0]
+		if err != nil {
+			return err
+		}
+		s.runs = append(s.runs, merged)
+	}
+
+	return nil
+}
+
+/**
+ * Writes every tuple of the source to a new temporary file, each one
+ * prefixed by its length, and rewinds the file for reading.
+ */
+func (s *Sorter) writeRun(source tupleSource) (*os.File, error) {
+	file, err := os.CreateTemp("", RUN_FILE_PATTERN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a sort run: %v", err)
+	}
+	os.Remove(file.Name())
+	s.spilledRuns++
+
+	writer := bufio.NewWriter(file)
+	tuple := make([]byte, 0, 256)
+	lengthBytes := make([]byte, 0, binary.MaxVarintLen64)
+	for {
+		values, ok, err := source.next()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		tuple = serialization.AppendTuple(tuple[:0], values)
+		lengthBytes = binary.AppendUvarint(lengthBytes[:0], uint64(len(tuple)))
+		_, err = writer.Write(lengthBytes)
+		if err == nil {
+			_, err = writer.Write(tuple)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write a sort run: %v", err)
+		}
+	}
+
+	err = writer.Flush()
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write a sort run: %v", err)
+	}
+
+	return file, nil
+}
+
+/**
+ * Finishes the input and returns an iterator over the sorted tuples.
+ * The iterator must be closed to release the runs.
+ */
+func (s *Sorter) Sort() (*Iterator, error) {
+	err := s.sortBuffer()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	sources := append(fileSources(s.runs), &sliceSource{tuples: s.buffer})
+	iterator := &Iterator{
+		sorter: s,
+		source: newMerger(sources, s.keys),
+	}
+
+	return iterator, nil
+}
+
+/**
+ * Releases the runs written so far.
+ */
+func (s *Sorter) Close() {
+	closeRuns(s.runs)
+	s.runs = nil
+	s.buffer = nil
+}
+
+func closeRuns(runs []*os.File) {
+	for _, run := range runs {
+		run.Close()
+	}
+}
+
+type Iterator struct {
+	sorter *Sorter
+	source tupleSource
+}
+
+/**
+ * Returns the next tuple in the sorted order; the second return
+ * value is false when all the tuples have been returned.
+ */
+func (it *Iterator) Next() ([]row.Value, bool, error) {
+	return it.source.next()
+}
+
+func (it *Iterator) Close() {
+	it.sorter.Close()
+}
+
+type tupleSource interface {
+	next() ([]row.Value, bool, error)
+}
+
+type sliceSource struct {
+	tuples [][]row.Value
+	pos    int
+}
+
+func (src *sliceSource) next() ([]row.Value, bool, error) {
+	if src.pos >= len(src.tuples) {
+		return nil, false, nil
+	}
+	src.pos++
+	return src.tuples[src.pos-1], true, nil
+}
+
+type fileSource struct {
+	reader *bufio.Reader
+	tuple  []byte
+}
+
+func fileSources(runs []*os.File) []tupleSource {
+	sources := make([]tupleSource, len(runs))
+	for i, run := range runs {
+		sources[i] = &fileSource{reader: bufio.NewReader(run)}
+	}
+	return sources
+}
+
+func (src *fileSource) next() ([]row.Value, bool, error) {
+	length, err := binary.ReadUvarint(src.reader)
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read a sort run: %v", err)
+	}
+
+	if cap(src.tuple) < int(length) {
+		src.tuple = make([]byte, length)
+	}
+	src.tuple = src.tuple[:length]
+	_, err = io.ReadFull(src.reader, src.tuple)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read a sort run: %v", err)
+	}
+
+	values, err := serialization.DecodeTuple(src.tuple)
+	if err != nil {
+		return nil, false, err
+	}
+	return values, true, nil
+}
+
+/**
+ * Merges sorted sources into one sorted stream. Equal tuples are taken
+ * from the earlier source first, which keeps the merge stable.
+ */
+type merger struct {
+	sources []tupleSource
+	heads   mergeHeap
+	started bool
+}
+
+type mergeHead struct {
+	values []row.Value
+	source int
+}
+
+type mergeHeap struct {
+	items []mergeHead
+	keys  []SortKey
+	err   error
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	cmp, err := CompareTuples(h.items[i].values, h.items[j].values, h.keys)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return h.items[i].source < h.items[j].source
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	h.items = append(h.items, x.(mergeHead))
+}
+
+func (h *mergeHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func newMerger(sources []tupleSource, keys []SortKey) *merger {
+	m := &merger{
+		sources: sources,
+		heads:   mergeHeap{items: make([]mergeHead, 0, len(sources)), keys: keys},
+	}
+
+	return m
+}
+
+func (m *merger) next() ([]row.Value, bool, error) {
+	if !m.started {
+		m.started = true
+		for i, source := range m.sources {
+			values, ok, err := source.next()
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				m.heads.items = append(m.heads.items, mergeHead{values: values, source: i})
+			}
+		}
+		heap.Init(&m.heads)
+	} else if len(m.heads.items) > 0 {
+		// replace the tuple returned last with the next one from the same source
+		top := m.heads.items[0]
+		values, ok, err := m.sources[top.source].next()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			m.heads.items[0].values = values
+			heap.Fix(&m.heads, 0)
+		} else {
+			heap.Pop(&m.heads)
+		}
+	}
+
+	if m.heads.err != nil {
+		return nil, false, m.heads.err
+	}
+	if len(m.heads.items) == 0 {
+		return nil, false, nil
+	}
+
+	return m.heads.items[0].values, true, nil
+}
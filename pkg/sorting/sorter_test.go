@@ -0,0 +1,167 @@
+package sorting_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sorting"
+)
+
+/**
+ * Returns the tuples (sequence, key, text, float): the keys repeat, and
+ * some of them and of the floats are NULL. The sequence tells the tuples
+ * apart, so the order of equal keys can be checked.
+ */
+func testTuples(count int) [][]row.Value {
+	random := rand.New(rand.NewSource(1))
+	tuples := make([][]row.Value, count)
+	for i := range tuples {
+		key := row.NewIntValue(int64(random.Intn(20)))
+		if i%7 == 0 {
+			key = row.NewNullValue()
+		}
+		float := row.NewFloatValue(float64(random.Intn(5)) / 2)
+		if i%5 == 0 {
+			float = row.NewNullValue()
+		}
+		tuples[i] = []row.Value{
+			row.NewIntValue(int64(i)),
+			key,
+			row.NewTextValue(fmt.Sprintf("text %d", random.Intn(10))),
+			float,
+		}
+	}
+	return tuples
+}
+
+/**
+ * Sorts the tuples and returns their sequences in the sorted order,
+ * along with the number of runs spilled.
+ */
+func sortTuples(t *testing.T, tuples [][]row.Value, keys []sorting.SortKey, memoryBudget int) ([]int64, int) {
+	t.Helper()
+	sorter := sorting.NewSorter(keys, memoryBudget)
+	for _, tuple := range tuples {
+		err := sorter.Add(tuple)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	iterator, err := sorter.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iterator.Close()
+
+	sequences := make([]int64, 0, len(tuples))
+	for {
+		values, ok, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		original := tuples[values[0].Int]
+		for i := range values {
+			if cmp, err := sorting.CompareTuples(values, original, []sorting.SortKey{{Index: i}}); err != nil || cmp != 0 || values[i].Type != original[i].Type {
+				t.Fatalf("tuple %d came back as %v, not %v", values[0].Int, values, original)
+			}
+		}
+		sequences = append(sequences, values[0].Int)
+	}
+	return sequences, sorter.SpilledRuns()
+}
+
+/**
+ * Returns the sequences of the tuples sorted stably in memory.
+ */
+func expectedOrder(t *testing.T, tuples [][]row.Value, keys []sorting.SortKey) []int64 {
+	sorted := append([][]row.Value(nil), tuples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		cmp, err := sorting.CompareTuples(sorted[i], sorted[j], keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmp < 0
+	})
+	sequences := make([]int64, len(sorted))
+	for i, tuple := range sorted {
+		sequences[i] = tuple[0].Int
+	}
+	return sequences
+}
+
+func TestSortSpills(t *testing.T) {
+	orders := []struct {
+		name string
+		keys []sorting.SortKey
+	}{
+		{"ascending", []sorting.SortKey{{Index: 1}}},
+		{"descending", []sorting.SortKey{{Index: 1, Desc: true}}},
+		{"by two keys", []sorting.SortKey{{Index: 3}, {Index: 2, Desc: true}}},
+		{"by a key with NULLs and one without", []sorting.SortKey{{Index: 1, Desc: true}, {Index: 3}}},
+	}
+	budgets := []struct {
+		name         string
+		memoryBudget int
+		spills       bool
+	}{
+		{"a run per tuple", 0, true},
+		{"a few tuples per run", 500, true},
+		{"in memory", sorting.DEFAULT_MEMORY_BUDGET, false},
+	}
+	// More runs than are merged at once, so they are merged while spilling
+	tuples := testTuples(3 * sorting.MAX_MERGE_FAN_IN)
+
+	for _, order := range orders {
+		expected := expectedOrder(t, tuples, order.keys)
+		for _, budget := range budgets {
+			t.Run(order.name+", "+budget.name, func(t *testing.T) {
+				sequences, spilled := sortTuples(t, tuples, order.keys, budget.memoryBudget)
+				if spilled > 0 != budget.spills {
+					t.Errorf("spilled %d runs", spilled)
+				}
+				if fmt.Sprint(sequences) != fmt.Sprint(expected) {
+					t.Errorf("got %v, expected %v", sequences, expected)
+				}
+			})
+		}
+	}
+}
+
+func TestSortNullsOrder(t *testing.T) {
+	tuples := [][]row.Value{
+		{row.NewIntValue(0), row.NewIntValue(2)},
+		{row.NewIntValue(1), row.NewNullValue()},
+		{row.NewIntValue(2), row.NewIntValue(-1)},
+		{row.NewIntValue(3), row.NewNullValue()},
+		{row.NewIntValue(4), row.NewIntValue(2)},
+	}
+
+	tests := []struct {
+		desc     bool
+		expected string
+	}{
+		{false, "[1 3 2 0 4]"},
+		{true, "[0 4 2 1 3]"},
+	}
+	for _, test := range tests {
+		sequences, _ := sortTuples(t, tuples, []sorting.SortKey{{Index: 1, Desc: test.desc}}, 0)
+		if actual := fmt.Sprint(sequences); actual != test.expected {
+			t.Errorf("desc %v: got %s, expected %s", test.desc, actual, test.expected)
+		}
+	}
+}
+
+func TestSortNothing(t *testing.T) {
+	for _, memoryBudget := range []int{0, sorting.DEFAULT_MEMORY_BUDGET} {
+		sequences, spilled := sortTuples(t, nil, []sorting.SortKey{{Index: 0}}, memoryBudget)
+		if len(sequences) != 0 || spilled != 0 {
+			t.Errorf("budget %d: got %v after %d runs", memoryBudget, sequences, spilled)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+type Statement interface {
+	statementNode()
+}
+
+type Expr interface {
+	exprNode()
+	String() string
+}
+
+type Literal struct {
+	Value row.Value
+}
+
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+type BinaryExpr struct {
+	Operator string
+	Left     Expr
+	Right    Expr
+}
+
+type UnaryExpr struct {
+	Operator string
+	Operand  Expr
+}
+
+type IsNullExpr struct {
+	Operand Expr
+	Not     bool
+}
+
+type LikeExpr struct {
+	Operand Expr
+	Pattern Expr
+	Not     bool
+}
+
+type InExpr struct {
+	Operand Expr
+	List    []Expr
+	Not     bool
+}
+
+type BetweenExpr struct {
+	Operand Expr
+	Low     Expr
+	High    Expr
+	Not     bool
+}
+
+/**
+ * A call of a function, e.g. an aggregate. Star is set for count(*),
+ * which has no arguments.
+ */
+type FunctionCall struct {
+	Name string
+	Args []Expr
+	Star bool
+}
+
+/**
+ * A positional parameter of a prepared statement, $1 being the first.
+ * Value is the value bound by the latest execution of the statement.
+ */
+type Parameter struct {
+	Index int
+	Value row.Value
+}
+
+func (*Literal) exprNode()      {}
+func (*Parameter) exprNode()    {}
+func (*ColumnRef) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*UnaryExpr) exprNode()    {}
+func (*IsNullExpr) exprNode()   {}
+func (*LikeExpr) exprNode()     {}
+func (*InExpr) exprNode()       {}
+func (*BetweenExpr) exprNode()  {}
+func (*FunctionCall) exprNode() {}
+
+func (e *Literal) String() string {
+	switch e.Value.Type {
+	case row.TYPE_TEXT:
+		return "'" + strings.ReplaceAll(e.Value.Text, "'", "''") + "'"
+	case row.TYPE_BLOB:
+		return "x'" + strings.TrimPrefix(e.Value.ToString(), row.BLOB_PREFIX) + "'"
+	default:
+		return e.Value.ToString()
+	}
+}
+
+func (e *Parameter) String() string {
+	return fmt.Sprintf("$%d", e.Index)
+}
+
+func (e *ColumnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+func (e *BinaryExpr) String() string {
+	return "(" + e.Left.String() + " " + e.Operator + " " + e.Right.String() + ")"
+}
+
+func (e *UnaryExpr) String() string {
+	if e.Operator == "NOT" {
+		return "(NOT " + e.Operand.String() + ")"
+	}
+	return "(" + e.Operator + e.Operand.String() + ")"
+}
+
+func notPrefix(not bool) string {
+	if not {
+		return "NOT "
+	}
+	return ""
+}
+
+func (e *IsNullExpr) String() string {
+	return "(" + e.Operand.String() + " IS " + notPrefix(e.Not) + "NULL)"
+}
+
+func (e *LikeExpr) String() string {
+	return "(" + e.Operand.String() + " " + notPrefix(e.Not) + "LIKE " + e.Pattern.String() + ")"
+}
+
+func (e *InExpr) String() string {
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	return "(" + e.Operand.String() + " " + notPrefix(e.Not) + "IN (" + strings.Join(items, ", ") + "))"
+}
+
+func (e *BetweenExpr) String() string {
+	return "(" + e.Operand.String() + " " + notPrefix(e.Not) + "BETWEEN " + e.Low.String() + " AND " + e.High.String() + ")"
+}
+
+func (e *FunctionCall) String() string {
+	if e.Star {
+		return e.Name + "(*)"
+	}
+
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return e.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+/**
+ * A single item of a select list. Star items select all columns,
+ * or all columns of Table if it is set.
+ */
+type SelectItem struct {
+	Star  bool
+	Table string
+	Expr  Expr
+	Alias string
+}
+
+/**
+ * A table in the from clause. Its columns are qualified by the alias if
+ * there is one, and by the table name otherwise.
+ */
+type TableRef struct {
+	Name  string
+	Alias string
+}
+
+func (t TableRef) Binding() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Name
+}
+
+type JoinType int8
+
+const (
+	JOIN_INNER JoinType = iota
+	JOIN_LEFT
+	JOIN_CROSS
+)
+
+/**
+ * A table joined to the tables before it. On is nil for cross joins.
+ */
+type Join struct {
+	Type  JoinType
+	Table TableRef
+	On    Expr
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+/**
+ * The locks a select takes on the rows it reads, until the end of
+ * the transaction: none, shared (for share) or exclusive (for update).
+ */
+type RowLocking int8
+
+const (
+	LOCKING_NONE RowLocking = iota
+	LOCKING_FOR_SHARE
+	LOCKING_FOR_UPDATE
+)
+
+/**
+ * Limit and Offset are nil when the statement has no limit or offset.
+ */
+type SelectStatement struct {
+	Items   []SelectItem
+	From    TableRef
+	Joins   []Join
+	Where   Expr
+	GroupBy []Expr
+	Having  Expr
+	OrderBy []OrderItem
+	Limit   Expr
+	Offset  Expr
+	Locking RowLocking
+}
+
+type InsertStatement struct {
+	Table   string
+	Columns []string
+	Rows    [][]Expr
+}
+
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+type UpdateStatement struct {
+	Table       string
+	Assignments []Assignment
+	Where       Expr
+}
+
+type DeleteStatement struct {
+	Table string
+	Where Expr
+}
+
+type CreateTableStatement struct {
+	Name        string
+	IfNotExists bool
+	Columns     []row.Column
+}
+
+type DropTableStatement struct {
+	Name     string
+	IfExists bool
+}
+
+/**
+ * Creates a secondary index on the columns of the table.
+ */
+type CreateIndexStatement struct {
+	Name        string
+	Table       string
+	Columns     []string
+	Unique      bool
+	IfNotExists bool
+}
+
+type DropIndexStatement struct {
+	Name     string
+	IfExists bool
+}
+
+/**
+ * Shows the plan of the statement; with Analyze, the statement is also
+ * executed and the plan shows the measured execution.
+ */
+type ExplainStatement struct {
+	Analyze   bool
+	Statement Statement
+}
+
+/**
+ * Collects the statistics of the table, or of all tables if Table is empty.
+ */
+type AnalyzeStatement struct {
+	Table string
+}
+
+/**
+ * Stores the statement under the name, to be executed with the values of its
+ * parameters. Types holds the declared types of the first parameters, and
+ * NumParameters the highest parameter number used by the statement.
+ */
+type PrepareStatement struct {
+	Name          string
+	Types         []row.ColumnType
+	Statement     Statement
+	NumParameters int
+}
+
+type ExecuteStatement struct {
+	Name string
+	Args []Expr
+}
+
+/**
+ * Removes the prepared statement, or all of them if All is set.
+ */
+type DeallocateStatement struct {
+	Name string
+	All  bool
+}
+
+/**
+ * Starts a transaction on the connection.
+ */
+type BeginStatement struct{}
+
+/**
+ * Makes the changes of the transaction durable and ends it.
+ */
+type CommitStatement struct{}
+
+/**
+ * Undoes the changes of the transaction and ends it. With a savepoint,
+ * undoes only the changes made since the savepoint, and the transaction
+ * goes on.
+ */
+type RollbackStatement struct {
+	Savepoint string
+}
+
+/**
+ * Marks the state of the transaction, so the changes made after it can be
+ * undone. Savepoints nest, and a newer savepoint hides an older one
+ * with the same name.
+ */
+type SavepointStatement struct {
+	Name string
+}
+
+/**
+ * Forgets the savepoint and the savepoints made after it, keeping the changes.
+ */
+type ReleaseStatement struct {
+	Savepoint string
+}
+
+func (*SelectStatement) statementNode()      {}
+func (*InsertStatement) statementNode()      {}
+func (*UpdateStatement) statementNode()      {}
+func (*DeleteStatement) statementNode()      {}
+func (*CreateTableStatement) statementNode() {}
+func (*DropTableStatement) statementNode()   {}
+func (*CreateIndexStatement) statementNode() {}
+func (*DropIndexStatement) statementNode()   {}
+func (*ExplainStatement) statementNode()     {}
+func (*AnalyzeStatement) statementNode()     {}
+func (*PrepareStatement) statementNode()     {}
+func (*ExecuteStatement) statementNode()     {}
+func (*DeallocateStatement) statementNode()  {}
+func (*BeginStatement) statementNode()       {}
+func (*CommitStatement) statementNode()      {}
+func (*RollbackStatement) statementNode()    {}
+func (*SavepointStatement) statementNode()   {}
+func (*ReleaseStatement) statementNode()     {}
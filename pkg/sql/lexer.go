@@ -0,0 +1,242 @@
+package sql
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Lexer struct {
+	input  string
+	pos    int
+	tokens []Token
+}
+
+func NewLexer(input string) *Lexer {
+	lexer := &Lexer{
+		input:  input,
+		tokens: make([]Token, 0),
+	}
+
+	return lexer
+}
+
+/**
+ * Splits the input into tokens. The last token is always TOKEN_EOF.
+ */
+func Tokenize(input string) ([]Token, error) {
+	return NewLexer(input).Tokenize()
+}
+
+func (l *Lexer) Tokenize() ([]Token, error) {
+	for {
+		err := l.skipWhitespaceAndComments()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.pos >= len(l.input) {
+			l.emit(TOKEN_EOF, "", l.pos)
+			return l.tokens, nil
+		}
+
+		err = l.nextToken()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *Lexer) emit(tokenType TokenType, text string, pos int) {
+	l.tokens = append(l.tokens, Token{Type: tokenType, Text: text, Pos: pos})
+}
+
+func (l *Lexer) errorAt(pos int, message string) error {
+	return newSyntaxError(l.input, pos, message)
+}
+
+func (l *Lexer) peekByte(offset int) byte {
+	if l.pos+offset < len(l.input) {
+		return l.input[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *Lexer) skipWhitespaceAndComments() error {
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			l.pos++
+		} else if c == '-' && l.peekByte(1) == '-' {
+			// line comment, until the end of the line
+			end := strings.IndexByte(l.input[l.pos:], '\n')
+			if end < 0 {
+				l.pos = len(l.input)
+			} else {
+				l.pos += end + 1
+			}
+		} else if c == '/' && l.peekByte(1) == '*' {
+			// block comment
+			end := strings.Index(l.input[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorAt(l.pos, "unterminated comment")
+			}
+			l.pos += 2 + end + 2
+		} else {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (l *Lexer) nextToken() error {
+	start := l.pos
+	c := l.input[l.pos]
+
+	switch {
+	case (c == 'x' || c == 'X') && l.peekByte(1) == '\'':
+		l.pos++
+		text, err := l.readQuoted('\'')
+		if err != nil {
+			return err
+		}
+		l.emit(TOKEN_BLOB, text, start)
+	case isIdentifierStart(l.input[l.pos:]):
+		for l.pos < len(l.input) && isIdentifierPart(l.input[l.pos:]) {
+			_, size := utf8.DecodeRuneInString(l.input[l.pos:])
+			l.pos += size
+		}
+		l.emit(TOKEN_IDENTIFIER, l.input[start:l.pos], start)
+	case isDigit(c) || (c == '.' && isDigit(l.peekByte(1))):
+		return l.readNumber()
+	case c == '$':
+		l.pos++
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+		if l.pos == start+1 {
+			return l.errorAt(start, "expected a parameter number after '$'")
+		}
+		l.emit(TOKEN_PARAMETER, l.input[start:l.pos], start)
+	case c == '\'' || c == '"':
+		text, err := l.readQuoted(c)
+		if err != nil {
+			return err
+		}
+		l.emit(TOKEN_STRING, text, start)
+	case c == '`':
+		text, err := l.readQuoted(c)
+		if err != nil {
+			return err
+		}
+		l.emit(TOKEN_QUOTED_IDENTIFIER, text, start)
+	case c == ',':
+		l.pos++
+		l.emit(TOKEN_COMMA, ",", start)
+	case c == '.':
+		l.pos++
+		l.emit(TOKEN_DOT, ".", start)
+	case c == '(':
+		l.pos++
+		l.emit(TOKEN_LEFT_PAREN, "(", start)
+	case c == ')':
+		l.pos++
+		l.emit(TOKEN_RIGHT_PAREN, ")", start)
+	case c == ';':
+		l.pos++
+		l.emit(TOKEN_SEMICOLON, ";", start)
+	default:
+		return l.readOperator()
+	}
+
+	return nil
+}
+
+/**
+ * Reads a literal enclosed in the given quote character. A quote
+ * character is escaped by doubling it.
+ */
+func (l *Lexer) readQuoted(quote byte) (string, error) {
+	start := l.pos
+	l.pos++
+
+	var b strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == quote {
+			if l.peekByte(1) == quote {
+				b.WriteByte(quote)
+				l.pos += 2
+				continue
+			}
+			l.pos++
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+
+	return "", l.errorAt(start, "unterminated quoted literal")
+}
+
+func (l *Lexer) readNumber() error {
+	start := l.pos
+	for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.peekByte(0) == '.' {
+		l.pos++
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+	}
+	if c := l.peekByte(0); c == 'e' || c == 'E' {
+		exponentStart := l.pos
+		l.pos++
+		if c := l.peekByte(0); c == '+' || c == '-' {
+			l.pos++
+		}
+		if !isDigit(l.peekByte(0)) {
+			return l.errorAt(exponentStart, "invalid number exponent")
+		}
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.input) && isIdentifierStart(l.input[l.pos:]) {
+		return l.errorAt(start, "invalid number "+l.input[start:l.pos+1])
+	}
+
+	l.emit(TOKEN_NUMBER, l.input[start:l.pos], start)
+	return nil
+}
+
+var operators = []string{"<>", "!=", "<=", ">=", "||", "=", "<", ">", "+", "-", "*", "/", "%"}
+
+func (l *Lexer) readOperator() error {
+	for _, operator := range operators {
+		if strings.HasPrefix(l.input[l.pos:], operator) {
+			l.emit(TOKEN_OPERATOR, operator, l.pos)
+			l.pos += len(operator)
+			return nil
+		}
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+	return l.errorAt(l.pos, "unexpected character '"+string(r)+"'")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentifierPart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
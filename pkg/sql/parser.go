@@ -0,0 +1,1360 @@
+package sql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+)
+
+const MAX_PARAMETERS = 256
+
+/**
+ * A recursive-descent parser producing one statement from the input.
+ * Every parse method consumes the tokens of its construct and leaves
+ * the parser at the first token after it.
+ */
+type Parser struct {
+	input      string
+	tokens     []Token
+	pos        int
+	prepared   bool
+	parameters int
+}
+
+func NewParser(input string) (*Parser, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &Parser{
+		input:  input,
+		tokens: tokens,
+	}
+
+	return parser, nil
+}
+
+/**
+ * Parses a single statement, optionally followed by a semicolon.
+ */
+func Parse(input string) (Statement, error) {
+	parser, err := NewParser(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.ParseStatement()
+}
+
+func (p *Parser) ParseStatement() (Statement, error) {
+	statement, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().Type == TOKEN_SEMICOLON {
+		p.advance()
+	}
+	if p.peek().Type != TOKEN_EOF {
+		return nil, p.errorUnexpected("end of statement")
+	}
+
+	return statement, nil
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
+	token := p.peek()
+	switch {
+	case token.IsKeyword("select"):
+		return p.parseSelect()
+	case token.IsKeyword("insert"):
+		return p.parseInsert()
+	case token.IsKeyword("update"):
+		return p.parseUpdate()
+	case token.IsKeyword("delete"):
+		return p.parseDelete()
+	case token.IsKeyword("create"):
+		return p.parseCreate()
+	case token.IsKeyword("drop"):
+		return p.parseDrop()
+	case token.IsKeyword("explain"):
+		return p.parseExplain()
+	case token.IsKeyword("analyze"):
+		return p.parseAnalyze()
+	case token.IsKeyword("prepare"):
+		return p.parsePrepare()
+	case token.IsKeyword("execute"):
+		return p.parseExecute()
+	case token.IsKeyword("deallocate"):
+		return p.parseDeallocate()
+	case token.IsKeyword("begin"), token.IsKeyword("start"):
+		return p.parseBegin()
+	case token.IsKeyword("commit"), token.IsKeyword("end"):
+		return p.parseCommit()
+	case token.IsKeyword("rollback"):
+		return p.parseRollback()
+	case token.IsKeyword("savepoint"):
+		return p.parseSavepoint()
+	case token.IsKeyword("release"):
+		return p.parseRelease()
+	default:
+		return nil, p.errorUnexpected("a statement")
+	}
+}
+
+func (p *Parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *Parser) peekAt(offset int) Token {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *Parser) advance() Token {
+	token := p.tokens[p.pos]
+	if token.Type != TOKEN_EOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *Parser) errorAt(token Token, message string) error {
+	return newSyntaxError(p.input, token.Pos, message)
+}
+
+func (p *Parser) errorUnexpected(expected string) error {
+	return p.errorAt(p.peek(), fmt.Sprintf("expected %s, found %s", expected, p.peek()))
+}
+
+func (p *Parser) acceptKeyword(keyword string) bool {
+	if p.peek().IsKeyword(keyword) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorUnexpected(strings.ToUpper(keyword))
+	}
+	return nil
+}
+
+func (p *Parser) accept(tokenType TokenType) bool {
+	if p.peek().Type == tokenType {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expect(tokenType TokenType) error {
+	if !p.accept(tokenType) {
+		return p.errorUnexpected(tokenType.String())
+	}
+	return nil
+}
+
+func (p *Parser) acceptOperator(operator string) bool {
+	if p.peek().Type == TOKEN_OPERATOR && p.peek().Text == operator {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) parseIdentifier(what string) (string, error) {
+	token := p.peek()
+	if token.Type == TOKEN_QUOTED_IDENTIFIER || (token.Type == TOKEN_IDENTIFIER && !isReservedWord(token.Text)) {
+		p.advance()
+		return token.Text, nil
+	}
+	return "", p.errorUnexpected(what)
+}
+
+func (p *Parser) parseExplain() (Statement, error) {
+	p.advance()
+
+	statement := &ExplainStatement{
+		Analyze: p.acceptKeyword("analyze"),
+	}
+
+	var err error
+	statement.Statement, err = p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+func (p *Parser) parseAnalyze() (Statement, error) {
+	p.advance()
+
+	statement := &AnalyzeStatement{}
+	if token := p.peek(); token.Type != TOKEN_EOF && token.Type != TOKEN_SEMICOLON {
+		var err error
+		statement.Table, err = p.parseIdentifier("a table name")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "prepare <name> [(<type>, ...)] as <statement>", where the statement
+ * is a select, insert, update or delete, which may use parameters
+ */
+func (p *Parser) parsePrepare() (Statement, error) {
+	p.advance()
+	if p.prepared {
+		return nil, p.errorUnexpected("a statement which can be prepared")
+	}
+
+	name, err := p.parseIdentifier("a statement name")
+	if err != nil {
+		return nil, err
+	}
+	statement := &PrepareStatement{
+		Name:  name,
+		Types: make([]row.ColumnType, 0),
+	}
+
+	if p.accept(TOKEN_LEFT_PAREN) {
+		for {
+			typeToken := p.peek()
+			if typeToken.Type != TOKEN_IDENTIFIER {
+				return nil, p.errorUnexpected("a parameter type")
+			}
+			columnType, err := row.ParseColumnType(typeToken.Text)
+			if err != nil {
+				return nil, p.errorAt(typeToken, err.Error())
+			}
+			p.advance()
+			statement.Types = append(statement.Types, columnType)
+
+			if p.accept(TOKEN_RIGHT_PAREN) {
+				break
+			}
+			if err = p.expect(TOKEN_COMMA); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = p.expectKeyword("as"); err != nil {
+		return nil, err
+	}
+
+	token := p.peek()
+	if !token.IsKeyword("select") && !token.IsKeyword("insert") && !token.IsKeyword("update") && !token.IsKeyword("delete") {
+		return nil, p.errorUnexpected("a SELECT, INSERT, UPDATE or DELETE statement")
+	}
+
+	p.prepared = true
+	statement.Statement, err = p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	statement.NumParameters = p.parameters
+
+	return statement, nil
+}
+
+/**
+ * Parses "execute <name> [(<value>, ...)]"
+ */
+func (p *Parser) parseExecute() (Statement, error) {
+	p.advance()
+
+	name, err := p.parseIdentifier("a statement name")
+	if err != nil {
+		return nil, err
+	}
+	statement := &ExecuteStatement{
+		Name: name,
+		Args: make([]Expr, 0),
+	}
+
+	if p.accept(TOKEN_LEFT_PAREN) && !p.accept(TOKEN_RIGHT_PAREN) {
+		statement.Args, err = p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "deallocate [prepare] <name>" or "deallocate [prepare] all"
+ */
+func (p *Parser) parseDeallocate() (Statement, error) {
+	p.advance()
+	p.acceptKeyword("prepare")
+
+	if p.acceptKeyword("all") {
+		return &DeallocateStatement{All: true}, nil
+	}
+
+	name, err := p.parseIdentifier("a statement name")
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeallocateStatement{Name: name}, nil
+}
+
+/**
+ * Parses "begin [transaction | work]" or "start transaction"
+ */
+func (p *Parser) parseBegin() (Statement, error) {
+	if p.advance().IsKeyword("start") {
+		err := p.expectKeyword("transaction")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.acceptTransaction()
+	}
+
+	return &BeginStatement{}, nil
+}
+
+/**
+ * Parses "commit [transaction | work]" or "end [transaction | work]"
+ */
+func (p *Parser) parseCommit() (Statement, error) {
+	p.advance()
+	p.acceptTransaction()
+
+	return &CommitStatement{}, nil
+}
+
+/**
+ * Parses "rollback [transaction | work] [to [savepoint] name]"
+ */
+func (p *Parser) parseRollback() (Statement, error) {
+	p.advance()
+	p.acceptTransaction()
+
+	statement := &RollbackStatement{}
+	if p.acceptKeyword("to") {
+		p.acceptKeyword("savepoint")
+
+		var err error
+		statement.Savepoint, err = p.parseIdentifier("a savepoint name")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "savepoint name"
+ */
+func (p *Parser) parseSavepoint() (Statement, error) {
+	p.advance()
+
+	name, err := p.parseIdentifier("a savepoint name")
+	if err != nil {
+		return nil, err
+	}
+
+	return &SavepointStatement{Name: name}, nil
+}
+
+/**
+ * Parses "release [savepoint] name"
+ */
+func (p *Parser) parseRelease() (Statement, error) {
+	p.advance()
+	p.acceptKeyword("savepoint")
+
+	name, err := p.parseIdentifier("a savepoint name")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReleaseStatement{Savepoint: name}, nil
+}
+
+func (p *Parser) acceptTransaction() {
+	if !p.acceptKeyword("transaction") {
+		p.acceptKeyword("work")
+	}
+}
+
+func (p *Parser) parseSelect() (Statement, error) {
+	p.advance()
+
+	statement := &SelectStatement{}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		statement.Items = append(statement.Items, item)
+
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+
+	err := p.expectKeyword("from")
+	if err != nil {
+		return nil, err
+	}
+
+	statement.From, err = p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+
+	statement.Joins, err = p.parseJoins()
+	if err != nil {
+		return nil, err
+	}
+
+	statement.Where, err = p.parseOptionalWhere()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("group") {
+		err = p.expectKeyword("by")
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			statement.GroupBy = append(statement.GroupBy, expr)
+
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("having") {
+		statement.Having, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("order") {
+		statement.OrderBy, err = p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("limit") {
+		statement.Limit, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("offset") {
+		statement.Offset, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("for") {
+		if p.acceptKeyword("update") {
+			statement.Locking = LOCKING_FOR_UPDATE
+		} else {
+			err = p.expectKeyword("share")
+			if err != nil {
+				return nil, err
+			}
+			statement.Locking = LOCKING_FOR_SHARE
+		}
+	}
+
+	return statement, nil
+}
+
+func (p *Parser) parseOrderBy() ([]OrderItem, error) {
+	err := p.expectKeyword("by")
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]OrderItem, 0)
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		item := OrderItem{Expr: expr}
+		if p.acceptKeyword("desc") {
+			item.Desc = true
+		} else {
+			p.acceptKeyword("asc")
+		}
+		items = append(items, item)
+
+		if !p.accept(TOKEN_COMMA) {
+			return items, nil
+		}
+	}
+}
+
+func (p *Parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptOperator("*") {
+		return SelectItem{Star: true}, nil
+	}
+
+	if next := p.peekAt(2); p.peekAt(1).Type == TOKEN_DOT && next.Type == TOKEN_OPERATOR && next.Text == "*" {
+		table, err := p.parseIdentifier("a table name")
+		if err != nil {
+			return SelectItem{}, err
+		}
+		p.advance()
+		p.advance()
+		return SelectItem{Star: true, Table: table}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+
+	item := SelectItem{Expr: expr}
+	if p.acceptKeyword("as") {
+		item.Alias, err = p.parseIdentifier("an alias")
+		if err != nil {
+			return SelectItem{}, err
+		}
+	} else if token := p.peek(); token.Type == TOKEN_QUOTED_IDENTIFIER || (token.Type == TOKEN_IDENTIFIER && !isReservedWord(token.Text)) {
+		item.Alias = token.Text
+		p.advance()
+	}
+
+	return item, nil
+}
+
+/**
+ * Parses a table name, optionally followed by an alias.
+ */
+func (p *Parser) parseTableRef() (TableRef, error) {
+	name, err := p.parseIdentifier("a table name")
+	if err != nil {
+		return TableRef{}, err
+	}
+
+	ref := TableRef{Name: name}
+	if p.acceptKeyword("as") {
+		ref.Alias, err = p.parseIdentifier("an alias")
+		if err != nil {
+			return TableRef{}, err
+		}
+	} else if token := p.peek(); token.Type == TOKEN_QUOTED_IDENTIFIER || (token.Type == TOKEN_IDENTIFIER && !isReservedWord(token.Text)) {
+		ref.Alias = token.Text
+		p.advance()
+	}
+
+	return ref, nil
+}
+
+/**
+ * Parses the joins following the first table of the from clause. A comma
+ * and cross join join every pair of rows; inner and left joins need an on
+ * condition.
+ */
+func (p *Parser) parseJoins() ([]Join, error) {
+	joins := make([]Join, 0)
+	for {
+		var join Join
+		switch {
+		case p.accept(TOKEN_COMMA):
+			join.Type = JOIN_CROSS
+		case p.acceptKeyword("cross"):
+			join.Type = JOIN_CROSS
+			err := p.expectKeyword("join")
+			if err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("left"):
+			join.Type = JOIN_LEFT
+			p.acceptKeyword("outer")
+			err := p.expectKeyword("join")
+			if err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("inner"):
+			join.Type = JOIN_INNER
+			err := p.expectKeyword("join")
+			if err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("join"):
+			join.Type = JOIN_INNER
+		default:
+			return joins, nil
+		}
+
+		var err error
+		join.Table, err = p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+
+		if join.Type != JOIN_CROSS {
+			err = p.expectKeyword("on")
+			if err != nil {
+				return nil, err
+			}
+			join.On, err = p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		joins = append(joins, join)
+	}
+}
+
+func (p *Parser) parseOptionalWhere() (Expr, error) {
+	if !p.acceptKeyword("where") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+func (p *Parser) parseInsert() (Statement, error) {
+	p.advance()
+
+	err := p.expectKeyword("into")
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &InsertStatement{}
+	statement.Table, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept(TOKEN_LEFT_PAREN) {
+		statement.Columns, err = p.parseIdentifierList("a column name")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.expectKeyword("values")
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err = p.expect(TOKEN_LEFT_PAREN)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		statement.Rows = append(statement.Rows, values)
+
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses a comma separated list of identifiers, closed by a right parenthesis.
+ */
+func (p *Parser) parseIdentifierList(what string) ([]string, error) {
+	identifiers := make([]string, 0)
+	for {
+		identifier, err := p.parseIdentifier(what)
+		if err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, identifier)
+
+		if p.accept(TOKEN_RIGHT_PAREN) {
+			return identifiers, nil
+		}
+		err = p.expect(TOKEN_COMMA)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+/**
+ * Parses a comma separated list of expressions, closed by a right parenthesis.
+ */
+func (p *Parser) parseExprList() ([]Expr, error) {
+	exprs := make([]Expr, 0)
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if p.accept(TOKEN_RIGHT_PAREN) {
+			return exprs, nil
+		}
+		err = p.expect(TOKEN_COMMA)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) parseUpdate() (Statement, error) {
+	p.advance()
+
+	statement := &UpdateStatement{}
+	var err error
+	statement.Table, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expectKeyword("set")
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		column, err := p.parseIdentifier("a column name")
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.acceptOperator("=") {
+			return nil, p.errorUnexpected("'='")
+		}
+
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		statement.Assignments = append(statement.Assignments, Assignment{Column: column, Value: value})
+
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+
+	statement.Where, err = p.parseOptionalWhere()
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+func (p *Parser) parseDelete() (Statement, error) {
+	p.advance()
+
+	err := p.expectKeyword("from")
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &DeleteStatement{}
+	statement.Table, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	statement.Where, err = p.parseOptionalWhere()
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+func (p *Parser) parseCreate() (Statement, error) {
+	p.advance()
+
+	if p.peek().IsKeyword("index") || p.peek().IsKeyword("unique") {
+		return p.parseCreateIndex()
+	}
+
+	err := p.expectKeyword("table")
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &CreateTableStatement{}
+	if p.acceptKeyword("if") {
+		if err = p.expectKeyword("not"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("exists"); err != nil {
+			return nil, err
+		}
+		statement.IfNotExists = true
+	}
+
+	statement.Name, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expect(TOKEN_LEFT_PAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		column, err := p.parseColumnDefinition()
+		if err != nil {
+			return nil, err
+		}
+		statement.Columns = append(statement.Columns, column)
+
+		if p.accept(TOKEN_RIGHT_PAREN) {
+			break
+		}
+		err = p.expect(TOKEN_COMMA)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "[unique] index [if not exists] <name> on <table> (<column> {, <column>})",
+ * following "create"
+ */
+func (p *Parser) parseCreateIndex() (Statement, error) {
+	statement := &CreateIndexStatement{
+		Unique: p.acceptKeyword("unique"),
+	}
+
+	err := p.expectKeyword("index")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("if") {
+		if err = p.expectKeyword("not"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("exists"); err != nil {
+			return nil, err
+		}
+		statement.IfNotExists = true
+	}
+
+	statement.Name, err = p.parseIdentifier("an index name")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	statement.Table, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expect(TOKEN_LEFT_PAREN)
+	if err != nil {
+		return nil, err
+	}
+	statement.Columns, err = p.parseIdentifierList("a column name")
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "<column> <type>[(<max length>)] [<constraint> ...]",
+ * where a constraint is one of "primary key", "not null" or "check <name>"
+ */
+func (p *Parser) parseColumnDefinition() (row.Column, error) {
+	name, err := p.parseIdentifier("a column name")
+	if err != nil {
+		return row.Column{}, err
+	}
+	column := row.Column{Name: name}
+
+	typeToken := p.peek()
+	if typeToken.Type != TOKEN_IDENTIFIER {
+		return row.Column{}, p.errorUnexpected("a column type")
+	}
+	column.Type, err = row.ParseColumnType(typeToken.Text)
+	if err != nil {
+		return row.Column{}, p.errorAt(typeToken, err.Error())
+	}
+	p.advance()
+
+	if p.accept(TOKEN_LEFT_PAREN) {
+		lengthToken := p.peek()
+		maxLength, err := strconv.Atoi(lengthToken.Text)
+		if lengthToken.Type != TOKEN_NUMBER || err != nil || maxLength <= 0 {
+			return row.Column{}, p.errorUnexpected("a positive maximum length")
+		}
+		p.advance()
+		column.MaxLength = maxLength
+
+		err = p.expect(TOKEN_RIGHT_PAREN)
+		if err != nil {
+			return row.Column{}, err
+		}
+	}
+
+	for {
+		switch {
+		case p.acceptKeyword("primary"):
+			if err = p.expectKeyword("key"); err != nil {
+				return row.Column{}, err
+			}
+			column.PrimaryKey = true
+		case p.acceptKeyword("not"):
+			if err = p.expectKeyword("null"); err != nil {
+				return row.Column{}, err
+			}
+			column.NotNull = true
+		case p.acceptKeyword("check"):
+			checkToken := p.peek()
+			if checkToken.Type != TOKEN_IDENTIFIER {
+				return row.Column{}, p.errorUnexpected("a check name")
+			}
+			p.advance()
+			column.Check = strings.ToLower(checkToken.Text)
+		default:
+			return column, nil
+		}
+	}
+}
+
+func (p *Parser) parseDrop() (Statement, error) {
+	p.advance()
+
+	if p.acceptKeyword("index") {
+		return p.parseDropIndex()
+	}
+
+	err := p.expectKeyword("table")
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &DropTableStatement{}
+	if p.acceptKeyword("if") {
+		if err = p.expectKeyword("exists"); err != nil {
+			return nil, err
+		}
+		statement.IfExists = true
+	}
+
+	statement.Name, err = p.parseIdentifier("a table name")
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+/**
+ * Parses "[if exists] <name>", following "drop index"
+ */
+func (p *Parser) parseDropIndex() (Statement, error) {
+	statement := &DropIndexStatement{}
+	if p.acceptKeyword("if") {
+		if err := p.expectKeyword("exists"); err != nil {
+			return nil, err
+		}
+		statement.IfExists = true
+	}
+
+	var err error
+	statement.Name, err = p.parseIdentifier("an index name")
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+/**
+ * Expression grammar, from the lowest to the highest precedence:
+ * expr           := or
+ * or             := and { OR and }
+ * and            := not { AND not }
+ * not            := NOT not | comparison
+ * comparison     := additive [ ( = | <> | != | < | <= | > | >= ) additive
+ *                   | IS [ NOT ] NULL
+ *                   | [ NOT ] LIKE additive
+ *                   | [ NOT ] IN ( expr { , expr } )
+ *                   | [ NOT ] BETWEEN additive AND additive ]
+ * additive       := multiplicative { ( + | - | || ) multiplicative }
+ * multiplicative := unary { ( * | / | % ) unary }
+ * unary          := ( - | + ) unary | primary
+ * primary        := literal | column | table.column | ( expr )
+ */
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *Parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Operator: "OR", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Operator: "AND", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Operator: "NOT", Operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+var comparisonOperators = map[string]string{
+	"=":  "=",
+	"<>": "<>",
+	"!=": "<>",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+func (p *Parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	token := p.peek()
+	if operator, ok := comparisonOperators[token.Text]; ok && token.Type == TOKEN_OPERATOR {
+		p.advance()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Operator: operator, Left: left, Right: right}, nil
+	}
+
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		err = p.expectKeyword("null")
+		if err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Operand: left, Not: not}, nil
+	}
+
+	not := false
+	if token.IsKeyword("not") {
+		next := p.peekAt(1)
+		if !next.IsKeyword("like") && !next.IsKeyword("in") && !next.IsKeyword("between") {
+			return left, nil
+		}
+		p.advance()
+		not = true
+	}
+
+	switch {
+	case p.acceptKeyword("like"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Operand: left, Pattern: pattern, Not: not}, nil
+	case p.acceptKeyword("in"):
+		err = p.expect(TOKEN_LEFT_PAREN)
+		if err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{Operand: left, List: list, Not: not}, nil
+	case p.acceptKeyword("between"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expectKeyword("and")
+		if err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Operand: left, Low: low, High: high, Not: not}, nil
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := p.peek()
+		if token.Type != TOKEN_OPERATOR || (token.Text != "+" && token.Text != "-" && token.Text != "||") {
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Operator: token.Text, Left: left, Right: right}
+	}
+}
+
+func (p *Parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := p.peek()
+		if token.Type != TOKEN_OPERATOR || (token.Text != "*" && token.Text != "/" && token.Text != "%") {
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Operator: token.Text, Left: left, Right: right}
+	}
+}
+
+func (p *Parser) parseUnary() (Expr, error) {
+	token := p.peek()
+	if token.Type == TOKEN_OPERATOR && (token.Text == "-" || token.Text == "+") {
+		p.advance()
+
+		// the magnitude of the smallest int does not fit in an int, so a
+		// negative int literal is parsed together with its sign
+		number := p.peek()
+		if token.Text == "-" && number.Type == TOKEN_NUMBER && !strings.ContainsAny(number.Text, ".eE") {
+			if i, err := strconv.ParseInt("-"+number.Text, 10, 64); err == nil {
+				p.advance()
+				return &Literal{Value: row.NewIntValue(i)}, nil
+			}
+		}
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		// fold signs into numeric literals, so that e.g. -5 stays a literal
+		if literal, ok := operand.(*Literal); ok {
+			if token.Text == "+" && (literal.Value.Type == row.TYPE_INT || literal.Value.Type == row.TYPE_FLOAT) {
+				return literal, nil
+			}
+			if literal.Value.Type == row.TYPE_INT {
+				return &Literal{Value: row.NewIntValue(-literal.Value.Int)}, nil
+			}
+			if literal.Value.Type == row.TYPE_FLOAT {
+				return &Literal{Value: row.NewFloatValue(-literal.Value.Float)}, nil
+			}
+		}
+		return &UnaryExpr{Operator: token.Text, Operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *Parser) parsePrimary() (Expr, error) {
+	token := p.peek()
+
+	switch token.Type {
+	case TOKEN_NUMBER:
+		p.advance()
+		return p.parseNumber(token)
+	case TOKEN_STRING:
+		p.advance()
+		return &Literal{Value: row.NewTextValue(token.Text)}, nil
+	case TOKEN_PARAMETER:
+		return p.parseParameter()
+	case TOKEN_BLOB:
+		p.advance()
+		blob, err := hex.DecodeString(token.Text)
+		if err != nil {
+			return nil, p.errorAt(token, "invalid blob literal, expected hex digits")
+		}
+		return &Literal{Value: row.NewBlobValue(blob)}, nil
+	case TOKEN_LEFT_PAREN:
+		p.advance()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(TOKEN_RIGHT_PAREN)
+		if err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case TOKEN_IDENTIFIER, TOKEN_QUOTED_IDENTIFIER:
+		if token.IsKeyword("null") {
+			p.advance()
+			return &Literal{Value: row.NewNullValue()}, nil
+		}
+		if token.IsKeyword("true") || token.IsKeyword("false") {
+			p.advance()
+			return &Literal{Value: row.NewBoolValue(token.IsKeyword("true"))}, nil
+		}
+
+		if token.Type == TOKEN_IDENTIFIER && !isReservedWord(token.Text) && p.peekAt(1).Type == TOKEN_LEFT_PAREN {
+			return p.parseFunctionCall()
+		}
+
+		return p.parseColumnRef()
+	default:
+		return nil, p.errorUnexpected("an expression")
+	}
+}
+
+func (p *Parser) parseNumber(token Token) (Expr, error) {
+	if !strings.ContainsAny(token.Text, ".eE") {
+		i, err := strconv.ParseInt(token.Text, 10, 64)
+		if err == nil {
+			return &Literal{Value: row.NewIntValue(i)}, nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(token.Text, 64)
+	if err != nil {
+		return nil, p.errorAt(token, "invalid number "+token.Text)
+	}
+	return &Literal{Value: row.NewFloatValue(f)}, nil
+}
+
+func (p *Parser) parseParameter() (Expr, error) {
+	token := p.advance()
+	if !p.prepared {
+		return nil, p.errorAt(token, "parameters can only be used in prepared statements")
+	}
+
+	index, err := strconv.Atoi(token.Text[1:])
+	if err != nil || index < 1 || index > MAX_PARAMETERS {
+		return nil, p.errorAt(token, fmt.Sprintf("parameter numbers must be between 1 and %d", MAX_PARAMETERS))
+	}
+	if index > p.parameters {
+		p.parameters = index
+	}
+
+	return &Parameter{Index: index, Value: row.NewNullValue()}, nil
+}
+
+func (p *Parser) parseFunctionCall() (Expr, error) {
+	call := &FunctionCall{Name: strings.ToLower(p.advance().Text)}
+	p.advance()
+
+	if p.acceptOperator("*") {
+		call.Star = true
+		return call, p.expect(TOKEN_RIGHT_PAREN)
+	}
+
+	if p.accept(TOKEN_RIGHT_PAREN) {
+		return call, nil
+	}
+
+	var err error
+	call.Args, err = p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+
+	return call, nil
+}
+
+func (p *Parser) parseColumnRef() (Expr, error) {
+	name, err := p.parseIdentifier("a column name")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept(TOKEN_DOT) {
+		column, err := p.parseIdentifier("a column name")
+		if err != nil {
+			return nil, err
+		}
+		return &ColumnRef{Table: name, Name: column}, nil
+	}
+
+	return &ColumnRef{Name: name}, nil
+}
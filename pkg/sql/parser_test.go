@@ -0,0 +1,156 @@
+package sql_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/sql"
+)
+
+/**
+ * Parses the expression as the where clause of a select.
+ */
+func parseExpr(t *testing.T, input string) sql.Expr {
+	statement, err := sql.Parse("select * from t where " + input)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return statement.(*sql.SelectStatement).Where
+}
+
+func sameValue(a row.Value, b row.Value) bool {
+	compared, err := row.CompareValues(a, b)
+	return err == nil && a.Type == b.Type && compared == 0
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a or b and c", "(a OR (b AND c))"},
+		{"a and b or c", "((a AND b) OR c)"},
+		{"not a = 1 and b", "((NOT (a = 1)) AND b)"},
+		{"not a is null", "(NOT (a IS NULL))"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"4 / 2 % 3", "((4 / 2) % 3)"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"-a * b", "((-a) * b)"},
+		{"2 - -3", "(2 - -3)"},
+		{"a || b || c", "((a || b) || c)"},
+		{"a + 1 < b * 2", "((a + 1) < (b * 2))"},
+		{"a = 1 and b between 1 and 2 or c in (1, null)", "(((a = 1) AND (b BETWEEN 1 AND 2)) OR (c IN (1, NULL)))"},
+		{"a not between b + 1 and c", "(a NOT BETWEEN (b + 1) AND c)"},
+		{"x not like 'a%' or y is not null", "((x NOT LIKE 'a%') OR (y IS NOT NULL))"},
+	}
+
+	for _, test := range tests {
+		if actual := parseExpr(t, test.input).String(); actual != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected row.Value
+	}{
+		{"0", row.NewIntValue(0)},
+		{"-5", row.NewIntValue(-5)},
+		{"- -5", row.NewIntValue(5)},
+		{"+5", row.NewIntValue(5)},
+		{"-(5)", row.NewIntValue(-5)},
+		{"9223372036854775807", row.NewIntValue(math.MaxInt64)},
+		{"-9223372036854775807", row.NewIntValue(-math.MaxInt64)},
+		{"-9223372036854775808", row.NewIntValue(math.MinInt64)},
+		{"- 9223372036854775808", row.NewIntValue(math.MinInt64)},
+		{"9223372036854775808", row.NewFloatValue(9223372036854775808)},
+		{"-9223372036854775809", row.NewFloatValue(-9223372036854775809)},
+		{"-1.5", row.NewFloatValue(-1.5)},
+		{"-1e3", row.NewFloatValue(-1000)},
+	}
+
+	for _, test := range tests {
+		literal, ok := parseExpr(t, test.input).(*sql.Literal)
+		if !ok {
+			t.Errorf("%s: not parsed as a literal", test.input)
+			continue
+		}
+		if !sameValue(literal.Value, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.input, literal.Value, test.expected)
+		}
+	}
+}
+
+func TestInsertSmallestInt(t *testing.T) {
+	statement, err := sql.Parse("insert into t values (-9223372036854775808)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := statement.(*sql.InsertStatement).Rows[0][0]
+	if literal, ok := value.(*sql.Literal); !ok || !sameValue(literal.Value, row.NewIntValue(math.MinInt64)) {
+		t.Errorf("got %s, expected the smallest int", value)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"select * from t -- everything\nwhere a = 1", "(a = 1)"},
+		{"select * from t where a = 1 -- to the end", "(a = 1)"},
+		{"select * from t where /* a block */ a = 1", "(a = 1)"},
+		{"select * from t where a /* spanning\nlines */ = 1", "(a = 1)"},
+		{"-- first\n-- second\nselect * from t where a = '-- not a comment'", "(a = '-- not a comment')"},
+		{"select * from t where a = '/* not a comment */'", "(a = '/* not a comment */')"},
+	}
+
+	for _, test := range tests {
+		statement, err := sql.Parse(test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if actual := statement.(*sql.SelectStatement).Where.String(); actual != test.expected {
+			t.Errorf("%q: got %s, expected %s", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestSyntaxErrorPositions(t *testing.T) {
+	tests := []struct {
+		input   string
+		line    int
+		column  int
+		message string
+	}{
+		{"selec * from t", 1, 1, "expected a statement, found 'selec'"},
+		{"select * from", 1, 14, "expected a table name, found end of input"},
+		{"select * from t where", 1, 22, "expected an expression, found end of input"},
+		{"select * from t where x = 1 2", 1, 29, "expected end of statement, found '2'"},
+		{"select *\nfrom t\nwhere a = = 1", 3, 11, "expected an expression, found '='"},
+		{"insert into t values (1, 2", 1, 27, "expected ',', found end of input"},
+		{"select @ from t", 1, 8, "unexpected character '@'"},
+		{"select 'abc", 1, 8, "unterminated quoted literal"},
+		{"select /* x", 1, 8, "unterminated comment"},
+		{"select * -- comment\nfrom t where", 2, 13, "expected an expression, found end of input"},
+	}
+
+	for _, test := range tests {
+		_, err := sql.Parse(test.input)
+		var syntaxError *sql.SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("%q: expected a syntax error, got %v", test.input, err)
+			continue
+		}
+		if syntaxError.Line != test.line || syntaxError.Column != test.column || syntaxError.Message != test.message {
+			t.Errorf("%q: got %d:%d %s, expected %d:%d %s", test.input, syntaxError.Line, syntaxError.Column, syntaxError.Message, test.line, test.column, test.message)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TokenType int8
+
+const (
+	TOKEN_EOF TokenType = iota
+	TOKEN_IDENTIFIER
+	TOKEN_QUOTED_IDENTIFIER
+	TOKEN_STRING
+	TOKEN_BLOB
+	TOKEN_NUMBER
+	TOKEN_PARAMETER
+	TOKEN_OPERATOR
+	TOKEN_COMMA
+	TOKEN_DOT
+	TOKEN_LEFT_PAREN
+	TOKEN_RIGHT_PAREN
+	TOKEN_SEMICOLON
+)
+
+var tokenTypeNames = map[TokenType]string{
+	TOKEN_EOF:               "end of input",
+	TOKEN_IDENTIFIER:        "identifier",
+	TOKEN_QUOTED_IDENTIFIER: "quoted identifier",
+	TOKEN_STRING:            "string",
+	TOKEN_BLOB:              "blob",
+	TOKEN_NUMBER:            "number",
+	TOKEN_PARAMETER:         "parameter",
+	TOKEN_OPERATOR:          "operator",
+	TOKEN_COMMA:             "','",
+	TOKEN_DOT:               "'.'",
+	TOKEN_LEFT_PAREN:        "'('",
+	TOKEN_RIGHT_PAREN:       "')'",
+	TOKEN_SEMICOLON:         "';'",
+}
+
+func (tt TokenType) String() string {
+	return tokenTypeNames[tt]
+}
+
+/**
+ * A single token of the input. Pos is the byte offset of the first
+ * character of the token. For strings and quoted identifiers Text holds
+ * the unquoted value; for blobs it holds the hex digits.
+ */
+type Token struct {
+	Type TokenType
+	Text string
+	Pos  int
+}
+
+func (t Token) String() string {
+	switch t.Type {
+	case TOKEN_EOF:
+		return t.Type.String()
+	case TOKEN_STRING:
+		return fmt.Sprintf("string '%s'", t.Text)
+	default:
+		return fmt.Sprintf("'%s'", t.Text)
+	}
+}
+
+/**
+ * Reports whether the token is the given keyword. Keywords are
+ * unquoted identifiers and are matched case-insensitively.
+ */
+func (t Token) IsKeyword(keyword string) bool {
+	return t.Type == TOKEN_IDENTIFIER && strings.EqualFold(t.Text, keyword)
+}
+
+/**
+ * Words that cannot be used as unquoted aliases, since they
+ * can follow an expression or a table name.
+ */
+var reservedWords = map[string]bool{
+	"select": true, "from": true, "where": true, "insert": true, "into": true,
+	"values": true, "update": true, "set": true, "delete": true, "create": true,
+	"drop": true, "table": true, "and": true, "or": true, "not": true,
+	"null": true, "true": true, "false": true, "as": true, "is": true,
+	"like": true, "in": true, "between": true, "order": true, "by": true,
+	"asc": true, "desc": true, "limit": true, "offset": true, "group": true,
+	"having": true, "join": true, "inner": true, "left": true, "outer": true,
+	"cross": true, "on": true, "for": true,
+}
+
+func isReservedWord(word string) bool {
+	return reservedWords[strings.ToLower(word)]
+}
+
+/**
+ * An error in the input, annotated with the position at which it was found.
+ */
+type SyntaxError struct {
+	Message string
+	Pos     int
+	Line    int
+	Column  int
+}
+
+func newSyntaxError(input string, pos int, message string) *SyntaxError {
+	line := 1
+	column := 1
+	for i, c := range input {
+		if i >= pos {
+			break
+		}
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return &SyntaxError{
+		Message: message,
+		Pos:     pos,
+		Line:    line,
+		Column:  column,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
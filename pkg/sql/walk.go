@@ -0,0 +1,170 @@
+package sql
+
+import "github.com/petarTrifunovic98/my-simple-db/pkg/row"
+
+/**
+ * Calls fn for the expression and, while fn returns true, for its subexpressions
+ * (in a pre-order).
+ */
+func WalkExpr(expr Expr, fn func(expr Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+
+	for _, child := range children(expr) {
+		WalkExpr(child, fn)
+	}
+}
+
+/**
+ * Calls WalkExpr with fn for every expression of the statement.
+ */
+func WalkStatement(statement Statement, fn func(expr Expr) bool) {
+	for _, expr := range statementExprs(statement) {
+		WalkExpr(expr, fn)
+	}
+}
+
+func statementExprs(statement Statement) []Expr {
+	exprs := make([]Expr, 0)
+	switch s := statement.(type) {
+	case *SelectStatement:
+		for _, item := range s.Items {
+			exprs = append(exprs, item.Expr)
+		}
+		for _, join := range s.Joins {
+			exprs = append(exprs, join.On)
+		}
+		exprs = append(exprs, s.Where)
+		exprs = append(exprs, s.GroupBy...)
+		exprs = append(exprs, s.Having)
+		for _, item := range s.OrderBy {
+			exprs = append(exprs, item.Expr)
+		}
+		exprs = append(exprs, s.Limit, s.Offset)
+	case *InsertStatement:
+		for _, values := range s.Rows {
+			exprs = append(exprs, values...)
+		}
+	case *UpdateStatement:
+		for _, assignment := range s.Assignments {
+			exprs = append(exprs, assignment.Value)
+		}
+		exprs = append(exprs, s.Where)
+	case *DeleteStatement:
+		exprs = append(exprs, s.Where)
+	case *ExplainStatement:
+		exprs = append(exprs, statementExprs(s.Statement)...)
+	case *ExecuteStatement:
+		exprs = append(exprs, s.Args...)
+	}
+	return exprs
+}
+
+/**
+ * Binds the values to the parameters of the statement, the first value to $1.
+ */
+func BindParameters(statement Statement, values []row.Value) {
+	WalkStatement(statement, func(expr Expr) bool {
+		if parameter, ok := expr.(*Parameter); ok {
+			parameter.Value = values[parameter.Index-1]
+		}
+		return true
+	})
+}
+
+func children(expr Expr) []Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return []Expr{e.Left, e.Right}
+	case *UnaryExpr:
+		return []Expr{e.Operand}
+	case *IsNullExpr:
+		return []Expr{e.Operand}
+	case *LikeExpr:
+		return []Expr{e.Operand, e.Pattern}
+	case *InExpr:
+		return append([]Expr{e.Operand}, e.List...)
+	case *BetweenExpr:
+		return []Expr{e.Operand, e.Low, e.High}
+	case *FunctionCall:
+		return e.Args
+	default:
+		return nil
+	}
+}
+
+/**
+ * Returns a copy of the expression in which subexpressions are replaced by fn.
+ * fn is called in a pre-order; when it reports a replacement, the replacement
+ * is used as is and the subexpression's own children are not visited.
+ * The original expression is not modified.
+ */
+func TransformExpr(expr Expr, fn func(expr Expr) (Expr, bool, error)) (Expr, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	replacement, replaced, err := fn(expr)
+	if err != nil || replaced {
+		return replacement, err
+	}
+
+	transformAll := func(exprs []Expr) ([]Expr, error) {
+		transformed := make([]Expr, len(exprs))
+		for i, child := range exprs {
+			transformed[i], err = TransformExpr(child, fn)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return transformed, nil
+	}
+
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		c, err := transformAll([]Expr{e.Left, e.Right})
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Operator: e.Operator, Left: c[0], Right: c[1]}, nil
+	case *UnaryExpr:
+		c, err := transformAll([]Expr{e.Operand})
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Operator: e.Operator, Operand: c[0]}, nil
+	case *IsNullExpr:
+		c, err := transformAll([]Expr{e.Operand})
+		if err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Operand: c[0], Not: e.Not}, nil
+	case *LikeExpr:
+		c, err := transformAll([]Expr{e.Operand, e.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Operand: c[0], Pattern: c[1], Not: e.Not}, nil
+	case *InExpr:
+		c, err := transformAll(append([]Expr{e.Operand}, e.List...))
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{Operand: c[0], List: c[1:], Not: e.Not}, nil
+	case *BetweenExpr:
+		c, err := transformAll([]Expr{e.Operand, e.Low, e.High})
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Operand: c[0], Low: c[1], High: c[2], Not: e.Not}, nil
+	case *FunctionCall:
+		c, err := transformAll(e.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionCall{Name: e.Name, Args: c, Star: e.Star}, nil
+	default:
+		return expr, nil
+	}
+}
@@ -0,0 +1,295 @@
+package statistics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/table"
+)
+
+/**
+ * At most this many rows of a table are kept as the sample the column
+ * statistics are computed from.
+ */
+const SAMPLE_SIZE = 10000
+
+/**
+ * The number of buckets of a histogram. Fewer are kept if the
+ * statistics of a column do not fit into a catalog record.
+ */
+const HISTOGRAM_BUCKETS = 16
+
+/**
+ * Text and blob bounds of a histogram are cut to this many bytes,
+ * so that long values do not blow up the catalog record.
+ */
+const MAX_BOUND_SIZE = 32
+
+/**
+ * The distribution of the values of a column. The histogram is equi-depth:
+ * its bounds split the sorted non-NULL values into buckets holding the same
+ * number of values, so Histogram[0] is the smallest value and the last bound
+ * is the largest one.
+ */
+type ColumnStats struct {
+	NullFraction  float64
+	DistinctCount float64
+	Histogram     []row.Value
+}
+
+/**
+ * The statistics of a table, collected by ANALYZE. LeafPages is the number of
+ * leaves of the table tree at the time, so the row count can be scaled as the
+ * table grows. Columns are indexed like the columns of the schema.
+ */
+type TableStats struct {
+	RowCount   float64
+	LeafPages  float64
+	SampleSize int
+	Columns    []*ColumnStats
+}
+
+/**
+ * Reads every row of the table once, keeping a uniform sample of at most
+ * SAMPLE_SIZE rows (reservoir sampling), and computes the statistics of
+ * every column from the sample.
+ */
+func Collect(t *table.Table) (*TableStats, error) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sample := make([][]row.Value, 0)
+	seen := 0
+
+	current := &row.Row{}
+	err := t.Scan(func(rec *serialization.Record) bool {
+		seen++
+
+		ind := len(sample)
+		if ind >= SAMPLE_SIZE {
+			ind = random.Intn(seen)
+			if ind >= SAMPLE_SIZE {
+				return true
+			}
+		}
+
+		rec.DecodeInto(current)
+		values := make([]row.Value, len(current.Values))
+		copy(values, current.Values)
+		if ind == len(sample) {
+			sample = append(sample, values)
+		} else {
+			sample[ind] = values
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, leaves, _ := t.Tree.EstimateShape()
+	stats := &TableStats{
+		RowCount:   float64(seen),
+		LeafPages:  leaves,
+		SampleSize: len(sample),
+		Columns:    make([]*ColumnStats, len(t.Schema.Columns)),
+	}
+
+	for i := range t.Schema.Columns {
+		stats.Columns[i], err = collectColumn(sample, i, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+func collectColumn(sample [][]row.Value, column int, total int) (*ColumnStats, error) {
+	values := make([]row.Value, 0, len(sample))
+	for _, r := range sample {
+		if !r[column].IsNull() {
+			values = append(values, r[column])
+		}
+	}
+
+	stats := &ColumnStats{}
+	if len(sample) == 0 {
+		return stats, nil
+	}
+	stats.NullFraction = 1 - float64(len(values))/float64(len(sample))
+
+	var sortErr error
+	sort.SliceStable(values, func(i, j int) bool {
+		cmp, err := row.CompareValues(values[i], values[j])
+		if err != nil {
+			sortErr = err
+		}
+		return cmp < 0
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	stats.DistinctCount = estimateDistinct(values, len(sample), total)
+	stats.Histogram = histogram(values, HISTOGRAM_BUCKETS)
+	return stats, nil
+}
+
+/**
+ * Estimates the number of distinct values in the whole column from the sorted
+ * non-NULL values of the sample. If the sample is the whole table the count is
+ * exact; otherwise it is scaled with the Haas-Stokes estimator, based on how
+ * many values occur in the sample only once.
+ */
+func estimateDistinct(values []row.Value, sampleSize int, total int) float64 {
+	distinct, once := 0, 0
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) {
+			cmp, _ := row.CompareValues(values[i], values[j])
+			if cmp != 0 {
+				break
+			}
+			j++
+		}
+
+		distinct++
+		if j-i == 1 {
+			once++
+		}
+		i = j
+	}
+
+	if sampleSize >= total || distinct == 0 {
+		return float64(distinct)
+	}
+
+	n, N := float64(sampleSize), float64(total)
+	estimate := n * float64(distinct) / (n - float64(once) + float64(once)*n/N)
+	return math.Min(math.Max(estimate, float64(distinct)), N)
+}
+
+/**
+ * Returns the bounds of an equi-depth histogram of the sorted values.
+ */
+func histogram(values []row.Value, buckets int) []row.Value {
+	if len(values) == 0 {
+		return nil
+	}
+	if buckets > len(values)-1 {
+		buckets = len(values) - 1
+	}
+	if buckets < 1 {
+		return []row.Value{truncateBound(values[0])}
+	}
+
+	bounds := make([]row.Value, buckets+1)
+	for i := 0; i <= buckets; i++ {
+		bounds[i] = truncateBound(values[i*(len(values)-1)/buckets])
+	}
+	return bounds
+}
+
+func truncateBound(v row.Value) row.Value {
+	switch {
+	case v.Type == row.TYPE_TEXT && len(v.Text) > MAX_BOUND_SIZE:
+		return row.NewTextValue(v.Text[:MAX_BOUND_SIZE])
+	case v.Type == row.TYPE_BLOB && len(v.Blob) > MAX_BOUND_SIZE:
+		return row.NewBlobValue(v.Blob[:MAX_BOUND_SIZE])
+	}
+	return v
+}
+
+/**
+ * Halves the number of buckets of the histogram, keeping both ends.
+ */
+func (c *ColumnStats) Coarsen() bool {
+	buckets := len(c.Histogram) - 1
+	if buckets < 2 {
+		return false
+	}
+
+	coarser := make([]row.Value, 0, buckets/2+1)
+	for i := 0; i < buckets; i += 2 {
+		coarser = append(coarser, c.Histogram[i])
+	}
+	c.Histogram = append(coarser, c.Histogram[buckets])
+	return true
+}
+
+/**
+ * Estimates the fraction of rows whose value equals the given non-NULL value.
+ */
+func (c *ColumnStats) EqualFraction() float64 {
+	if c.DistinctCount < 1 {
+		return 0
+	}
+	return (1 - c.NullFraction) / c.DistinctCount
+}
+
+/**
+ * Estimates the fraction of rows whose value is less than the given value
+ * (or equal to it, if inclusive is set). Within a bucket, numbers are assumed
+ * to be spread evenly; for other types the value is assumed to be in the middle.
+ */
+func (c *ColumnStats) LessFraction(v row.Value, inclusive bool) float64 {
+	if len(c.Histogram) == 0 {
+		return 0
+	}
+
+	nonNull := 1 - c.NullFraction
+	if cmp, err := row.CompareValues(v, c.Histogram[0]); err != nil || cmp < 0 {
+		return 0
+	}
+	last := c.Histogram[len(c.Histogram)-1]
+	if cmp, _ := row.CompareValues(v, last); cmp > 0 {
+		return nonNull
+	}
+
+	var fraction float64
+	buckets := len(c.Histogram) - 1
+	if buckets == 0 {
+		fraction = 0
+	} else {
+		// the first bucket whose upper bound is not below the value
+		bucket := sort.Search(buckets, func(i int) bool {
+			cmp, _ := row.CompareValues(c.Histogram[i+1], v)
+			return cmp >= 0
+		})
+		fraction = (float64(bucket) + positionInBucket(c.Histogram[bucket], c.Histogram[bucket+1], v)) / float64(buckets)
+	}
+
+	fraction *= nonNull
+	if inclusive {
+		fraction += c.EqualFraction()
+	}
+	return math.Min(fraction, nonNull)
+}
+
+func positionInBucket(low row.Value, high row.Value, v row.Value) float64 {
+	l, lok := numeric(low)
+	h, hok := numeric(high)
+	x, xok := numeric(v)
+	if !lok || !hok || !xok {
+		return 0.5
+	}
+	if h <= l {
+		return 0.5
+	}
+	return math.Min(math.Max((x-l)/(h-l), 0), 1)
+}
+
+func numeric(v row.Value) (float64, bool) {
+	switch v.Type {
+	case row.TYPE_INT:
+		return float64(v.Int), true
+	case row.TYPE_FLOAT:
+		return v.Float, true
+	case row.TYPE_TIMESTAMP:
+		return float64(v.Time.UnixNano()), true
+	}
+	return 0, false
+}
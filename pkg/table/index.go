@@ -0,0 +1,356 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+
+	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
+)
+
+/**
+ * Every indexed value is represented in the key of an index entry by
+ * an order preserving prefix of this many bytes.
+ */
+const VALUE_PREFIX_SIZE = 8
+
+/**
+ * Index entry outline:
+ * | key: value prefix (8 B) per column | primary key (8 B) | data: tuple of the values |
+ * - the prefixes sort like the values they represent, except that text and blob
+ * values sharing their first 8 bytes (and NULLs and the smallest values) share
+ * prefixes; the exact values in the data decide between them
+ * - the primary key makes the keys of rows with equal values distinct
+ */
+
+/**
+ * A secondary index: a B-tree mapping the values of some columns of a table
+ * to the primary keys of the rows holding them. A unique index does not allow
+ * two rows with the same non-NULL values.
+ */
+type Index struct {
+	Name    string
+	Columns []int
+	Unique  bool
+	Tree    *paging.Tree
+	schema  *row.Schema
+}
+
+func NewIndex(name string, columns []int, unique bool, schema *row.Schema, tree *paging.Tree) *Index {
+	index := &Index{
+		Name:    name,
+		Columns: columns,
+		Unique:  unique,
+		Tree:    tree,
+		schema:  schema,
+	}
+
+	return index
+}
+
+/**
+ * The size of the keys of an index on the given number of columns.
+ */
+func IndexKeySize(numColumns int) uint16 {
+	return uint16(numColumns*VALUE_PREFIX_SIZE) + paging.KEY_SIZE
+}
+
+/**
+ * Names the indexed columns, e.g. "email" or "last_name, first_name".
+ */
+func (ix *Index) ColumnNames() string {
+	names := make([]string, len(ix.Columns))
+	for i, column := range ix.Columns {
+		names[i] = ix.schema.Columns[column].Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (ix *Index) ColumnType(i int) row.ColumnType {
+	return ix.schema.Columns[ix.Columns[i]].Type
+}
+
+func (ix *Index) values(r *row.Row) []row.Value {
+	values := make([]row.Value, len(ix.Columns))
+	for i, column := range ix.Columns {
+		values[i] = r.Values[column]
+	}
+	return values
+}
+
+/**
+ * Returns the value, with -0.0 replaced by 0.0: the two compare equal, so
+ * they must be encoded alike in the keys of the index and of its locks.
+ */
+func normalizeZero(v row.Value) row.Value {
+	if v.Type == row.TYPE_FLOAT && v.Float == 0 {
+		return row.NewFloatValue(0)
+	}
+	return v
+}
+
+func (ix *Index) key(values []row.Value, pk int64) []byte {
+	key := make([]byte, 0, IndexKeySize(len(ix.Columns)))
+	for _, value := range values {
+		key = append(key, valuePrefix(value)...)
+	}
+	return append(key, row.EncodeKey(pk)...)
+}
+
+/**
+ * Encodes the value so that the byte order of the encodings follows the order of
+ * the values: ints and timestamps with the sign bit flipped, floats with all the
+ * bits flipped if negative and the sign bit set otherwise, and text and blobs as
+ * their first bytes, padded with zeros. NULL is encoded as zeros, and -0.0
+ * as 0.0.
+ */
+func valuePrefix(v row.Value) []byte {
+	v = normalizeZero(v)
+	prefix := make([]byte, VALUE_PREFIX_SIZE)
+	switch v.Type {
+	case row.TYPE_INT:
+		binary.BigEndian.PutUint64(prefix, uint64(v.Int)^(1<<63))
+	case row.TYPE_TIMESTAMP:
+		binary.BigEndian.PutUint64(prefix, uint64(v.Time.UnixNano())^(1<<63))
+	case row.TYPE_FLOAT:
+		bits := math.Float64bits(v.Float)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		binary.BigEndian.PutUint64(prefix, bits)
+	case row.TYPE_BOOL:
+		if v.Bool {
+			prefix[0] = 1
+		}
+	case row.TYPE_TEXT:
+		copy(prefix, v.Text)
+	case row.TYPE_BLOB:
+		copy(prefix, v.Blob)
+	}
+	return prefix
+}
+
+/**
+ * Adds the entry of the row. The uniqueness must be checked beforehand.
+ */
+func (ix *Index) insert(r *row.Row, pk int64) {
+	values := ix.values(r)
+	ix.Tree.AddNewData(ix.key(values, pk), serialization.AppendTuple(nil, values))
+}
+
+func (ix *Index) remove(r *row.Row, pk int64) error {
+	_, err := ix.Tree.DeleteData(ix.key(ix.values(r), pk))
+	return err
+}
+
+/**
+ * Returns the key standing for the values of the row in the locks of
+ * a unique index: a hash of the values, so different values may share
+ * a key. The second return value is false if the values cannot collide
+ * with those of other rows.
+ */
+func (ix *Index) lockKey(r *row.Row) (int64, bool) {
+	if !ix.Unique {
+		return 0, false
+	}
+
+	values := ix.values(r)
+	for i, value := range values {
+		if value.IsNull() {
+			return 0, false
+		}
+		values[i] = normalizeZero(value)
+	}
+
+	hash := fnv.New64a()
+	hash.Write(serialization.AppendTuple(nil, values))
+	return int64(hash.Sum64()), true
+}
+
+/**
+ * Fails if the index is unique and a row other than the one with the given
+ * primary key holds the same values. Rows with NULL values never collide.
+ */
+func (ix *Index) checkUnique(r *row.Row, pk int64) error {
+	if !ix.Unique {
+		return nil
+	}
+
+	values := ix.values(r)
+	for _, value := range values {
+		if value.IsNull() {
+			return nil
+		}
+	}
+
+	duplicate := false
+	err := ix.Scan(values, nil, nil, func(other int64) bool {
+		duplicate = other != pk
+		return !duplicate
+	})
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		return fmt.Errorf("duplicate value of (%s) in unique index %s", ix.ColumnNames(), ix.Name)
+	}
+	return nil
+}
+
+/**
+ * A bound of a range of values of an indexed column.
+ */
+type Bound struct {
+	Value     row.Value
+	Inclusive bool
+}
+
+/**
+ * Calls fn with the primary key of every row whose values of the leading
+ * columns of the index equal the given values and whose value of the next
+ * column lies between the bounds (nil bounds are open), until fn returns
+ * false. The rows are visited in the order of the index. NULL never matches.
+ */
+func (ix *Index) Scan(equal []row.Value, low *Bound, high *Bound, fn func(pk int64) bool) error {
+	if len(equal) > len(ix.Columns) || len(equal) == len(ix.Columns) && (low != nil || high != nil) {
+		return fmt.Errorf("index %s has only %d columns", ix.Name, len(ix.Columns))
+	}
+
+	keySize := int(IndexKeySize(len(ix.Columns)))
+	lowKey := make([]byte, 0, keySize)
+	highKey := make([]byte, 0, keySize)
+	for i, value := range equal {
+		lowPrefix, highPrefix, err := ix.boundPrefix(i, value)
+		if err != nil || value.IsNull() {
+			return err
+		}
+		lowKey = append(lowKey, lowPrefix...)
+		highKey = append(highKey, highPrefix...)
+	}
+	if low != nil {
+		prefix, _, err := ix.boundPrefix(len(equal), low.Value)
+		if err != nil || low.Value.IsNull() {
+			return err
+		}
+		lowKey = append(lowKey, prefix...)
+	}
+	if high != nil {
+		_, prefix, err := ix.boundPrefix(len(equal), high.Value)
+		if err != nil || high.Value.IsNull() {
+			return err
+		}
+		highKey = append(highKey, prefix...)
+	}
+	lowKey = append(lowKey, make([]byte, keySize-len(lowKey))...)
+	highKey = append(highKey, bytes.Repeat([]byte{0xff}, keySize-len(highKey))...)
+
+	cursor := ix.Tree.NewCursor()
+	var scanErr error
+	for ok := cursor.Seek(lowKey); ok && bytes.Compare(cursor.Key(), highKey) <= 0; ok = cursor.Next() {
+		values, err := serialization.DecodeTuple(cursor.Data())
+		if err != nil {
+			return err
+		}
+
+		matches, err := matchesBounds(values, equal, low, high)
+		if err != nil {
+			scanErr = err
+			break
+		}
+		if !matches {
+			continue
+		}
+
+		key := cursor.Key()
+		if !fn(row.DecodeKey(key[len(key)-int(paging.KEY_SIZE):])) {
+			break
+		}
+	}
+
+	return scanErr
+}
+
+/**
+ * Returns the smallest and the largest prefix of the values of the column
+ * which can compare equal to the value, e.g. the prefixes of 2 and 3 for 2.5
+ * in an int column.
+ */
+func (ix *Index) boundPrefix(i int, value row.Value) ([]byte, []byte, error) {
+	if value.IsNull() {
+		return nil, nil, nil
+	}
+
+	columnType := ix.ColumnType(i)
+	if columnType == row.TYPE_INT && value.Type == row.TYPE_FLOAT {
+		low := row.NewIntValue(clampToInt(math.Floor(value.Float)))
+		high := row.NewIntValue(clampToInt(math.Ceil(value.Float)))
+		return valuePrefix(low), valuePrefix(high), nil
+	}
+
+	coerced, err := row.CoerceValue(value, columnType)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := valuePrefix(coerced)
+	return prefix, prefix, nil
+}
+
+/**
+ * Reports whether the values of the i-th column can be compared with the value
+ * through the index.
+ */
+func (ix *Index) Accepts(i int, value row.Value) bool {
+	_, _, err := ix.boundPrefix(i, value)
+	return err == nil
+}
+
+func clampToInt(f float64) int64 {
+	switch {
+	case f <= math.MinInt64:
+		return math.MinInt64
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(f)
+}
+
+func matchesBounds(values []row.Value, equal []row.Value, low *Bound, high *Bound) (bool, error) {
+	for i, value := range equal {
+		if values[i].IsNull() {
+			return false, nil
+		}
+		cmp, err := row.CompareValues(values[i], value)
+		if err != nil || cmp != 0 {
+			return false, err
+		}
+	}
+
+	next := len(equal)
+	if low != nil {
+		if values[next].IsNull() {
+			return false, nil
+		}
+		cmp, err := row.CompareValues(values[next], low.Value)
+		if err != nil || cmp < 0 || cmp == 0 && !low.Inclusive {
+			return false, err
+		}
+	}
+	if high != nil {
+		if values[next].IsNull() {
+			return false, nil
+		}
+		cmp, err := row.CompareValues(values[next], high.Value)
+		if err != nil || cmp > 0 || cmp == 0 && !high.Inclusive {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -2,47 +2,365 @@ package table
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/petarTrifunovic98/my-simple-db/pkg/paging"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/row"
+	"github.com/petarTrifunovic98/my-simple-db/pkg/serialization"
 )
 
-type Page struct {
-	SerializedRows bytes.Buffer
+/**
+ * Locks the rows of a table with primary keys in an inclusive range, for the
+ * transaction reading or changing them. Rows are locked for reading only if
+ * the transaction asked for it, e.g. by a select for update.
+ */
+type RowLocker interface {
+	LockRows(table string, low int64, high int64, write bool) error
 }
 
+/**
+ * A table is the tree of its rows, keyed by the primary key, and the trees
+ * of its secondary indexes, which are kept up to date by every modification.
+ * Without a locker, the rows are not locked.
+ */
 type Table struct {
-	NumRows uint32
-	Pager   *paging.Pager
+	Id      uint32
+	Name    string
+	Schema  *row.Schema
+	Tree    *paging.Tree
+	Indexes []*Index
+	Locker  RowLocker
 }
 
-func NewTable() *Table {
+func NewTable(id uint32, name string, schema *row.Schema, tree *paging.Tree) *Table {
 	table := &Table{
-		NumRows: 0,
-		Pager:   paging.NewPager("./db"),
+		Id:      id,
+		Name:    name,
+		Schema:  schema,
+		Tree:    tree,
+		Indexes: make([]*Index, 0),
 	}
 
 	return table
 }
 
-func (t *Table) Insert(key []byte, data []byte) {
-	t.Pager.AddNewData(key, data)
+/**
+ * Fills the (empty) index with the entries of all rows and starts maintaining it.
+ * Fails if the index is unique and two rows hold the same values.
+ */
+func (t *Table) AddIndex(ix *Index) error {
+	var err error
+	current := &row.Row{}
+	scanErr := t.Scan(func(rec *serialization.Record) bool {
+		rec.DecodeInto(current)
+		pk := current.Values[t.Schema.PrimaryKeyIndex].Int
+		err = ix.checkUnique(current, pk)
+		if err != nil {
+			return false
+		}
+		ix.insert(current, pk)
+		return true
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		return err
+	}
+
+	t.Indexes = append(t.Indexes, ix)
+	return nil
+}
+
+/**
+ * Stops maintaining the index with the given name. Returns the removed index.
+ */
+func (t *Table) RemoveIndex(name string) (*Index, bool) {
+	for i, ix := range t.Indexes {
+		if ix.Name == name {
+			t.Indexes = append(t.Indexes[:i], t.Indexes[i+1:]...)
+			return ix, true
+		}
+	}
+	return nil, false
+}
+
+func (t *Table) GetIndex(name string) (*Index, bool) {
+	for _, ix := range t.Indexes {
+		if ix.Name == name {
+			return ix, true
+		}
+	}
+	return nil, false
+}
+
+/**
+ * Locks the rows with primary keys in the range for reading them.
+ */
+func (t *Table) LockRange(low int64, high int64) error {
+	if t.Locker == nil {
+		return nil
+	}
+	return t.Locker.LockRows(t.Name, low, high, false)
+}
+
+/**
+ * Locks the row with the primary key for changing it. The row does not
+ * have to exist, so inserting it is locked out as well.
+ */
+func (t *Table) lockKey(key int64) error {
+	if t.Locker == nil {
+		return nil
+	}
+	return t.Locker.LockRows(t.Name, key, key, true)
+}
+
+/**
+ * Fails if the values of the row collide with those of another row in
+ * a unique index. The values are locked first, so no other transaction
+ * can add them until this one ends.
+ */
+func (t *Table) checkUnique(r *row.Row, pk int64) error {
+	for _, ix := range t.Indexes {
+		if key, ok := ix.lockKey(r); ok && t.Locker != nil {
+			err := t.Locker.LockRows("index "+ix.Name, key, key, true)
+			if err != nil {
+				return err
+			}
+		}
+		err := ix.checkUnique(r, pk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) addIndexEntries(r *row.Row, pk int64) {
+	for _, ix := range t.Indexes {
+		ix.insert(r, pk)
+	}
+}
+
+func (t *Table) removeIndexEntries(r *row.Row, pk int64) error {
+	for _, ix := range t.Indexes {
+		err := ix.remove(r, pk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) Insert(r *row.Row) error {
+	err := t.Schema.Validate(r)
+	if err != nil {
+		return err
+	}
+
+	keyBytes := r.Key(t.Schema)
+	err = t.lockKey(row.DecodeKey(keyBytes))
+	if err != nil {
+		return err
+	}
+	_, exists, err := t.Tree.ReadDataByKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("duplicate primary key %d", row.DecodeKey(keyBytes))
+	}
+
+	data := serialization.EncodeRecord(t.Schema, r)
+	if len(data) > paging.MAX_DATA_SIZE {
+		return fmt.Errorf("row too large: %d bytes, at most %d allowed", len(data), paging.MAX_DATA_SIZE)
+	}
+
+	key := row.DecodeKey(keyBytes)
+	err = t.checkUnique(r, key)
+	if err != nil {
+		return err
+	}
+
+	t.Tree.AddNewData(keyBytes, data)
+	t.addIndexEntries(r, key)
+	return nil
 }
 
-func (t *Table) Select() []byte {
-	// values := t.Pager.ReadWholeCurrentPage()
-	values := t.Pager.ReadAllPages()
-	return values
+/**
+ * Calls fn for every row in primary key order, until fn returns false.
+ * The same record view is reused for all rows and is only valid until fn returns.
+ */
+func (t *Table) Scan(fn func(rec *serialization.Record) bool) error {
+	rec := serialization.NewRecord(t.Schema)
+	var err error
+	t.Tree.Scan(func(key []byte, data []byte) bool {
+		err = rec.Reset(data)
+		if err != nil {
+			return false
+		}
+		return fn(rec)
+	})
+
+	return err
 }
 
-func (t *Table) SelectOne(key []byte) []byte {
-	value := t.Pager.ReadDataByKey(key)
-	return value
+/**
+ * Same as Scan, but visits the rows in a descending primary key order.
+ */
+func (t *Table) ScanReverse(fn func(rec *serialization.Record) bool) error {
+	rec := serialization.NewRecord(t.Schema)
+	var err error
+	t.Tree.ScanReverse(func(key []byte, data []byte) bool {
+		err = rec.Reset(data)
+		if err != nil {
+			return false
+		}
+		return fn(rec)
+	})
+
+	return err
 }
 
-func (t *Table) PrintInternalStructure() {
-	t.Pager.PrintPages()
+/**
+ * Returns the smallest primary key in the table; the second return
+ * value is false if the table is empty.
+ */
+func (t *Table) MinKey() (int64, bool) {
+	key, ok := t.Tree.FirstKey()
+	if !ok {
+		return 0, false
+	}
+	return row.DecodeKey(key), true
 }
 
-func (t *Table) DestroyTable() {
-	t.Pager.ClearPager()
+func (t *Table) MaxKey() (int64, bool) {
+	key, ok := t.Tree.LastKey()
+	if !ok {
+		return 0, false
+	}
+	return row.DecodeKey(key), true
+}
+
+/**
+ * Estimates the number of rows in the table from the shape of its tree.
+ */
+func (t *Table) EstimateRowCount() float64 {
+	rows, _, _ := t.Tree.EstimateShape()
+	return rows
+}
+
+func (t *Table) Select() ([]*row.Row, error) {
+	rows := make([]*row.Row, 0)
+	err := t.Scan(func(rec *serialization.Record) bool {
+		r := &row.Row{}
+		rec.DecodeInto(r)
+		rows = append(rows, r)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (t *Table) SelectOne(key int64) (*row.Row, bool, error) {
+	value, found, err := t.Tree.ReadDataByKey(row.EncodeKey(key))
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	r, err := serialization.DecodeRecord(t.Schema, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return r, true, nil
+}
+
+/**
+ * Replaces the row stored under the given key. The new row may have
+ * a different primary key, as long as it does not collide with another row.
+ * Its index entries replace those of the old row.
+ */
+func (t *Table) Update(key int64, r *row.Row) error {
+	err := t.Schema.Validate(r)
+	if err != nil {
+		return err
+	}
+
+	data := serialization.EncodeRecord(t.Schema, r)
+	if len(data) > paging.MAX_DATA_SIZE {
+		return fmt.Errorf("row too large: %d bytes, at most %d allowed", len(data), paging.MAX_DATA_SIZE)
+	}
+
+	oldKeyBytes := row.EncodeKey(key)
+	newKeyBytes := r.Key(t.Schema)
+	err = t.lockKey(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(oldKeyBytes, newKeyBytes) {
+		err = t.lockKey(row.DecodeKey(newKeyBytes))
+		if err != nil {
+			return err
+		}
+
+		_, exists, err := t.Tree.ReadDataByKey(newKeyBytes)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("duplicate primary key %d", row.DecodeKey(newKeyBytes))
+		}
+	}
+
+	old, found, err := t.SelectOne(key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("row with primary key %d does not exist", key)
+	}
+
+	err = t.checkUnique(r, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.Tree.DeleteData(oldKeyBytes)
+	if err != nil {
+		return err
+	}
+	err = t.removeIndexEntries(old, key)
+	if err != nil {
+		return err
+	}
+
+	t.Tree.AddNewData(newKeyBytes, data)
+	t.addIndexEntries(r, row.DecodeKey(newKeyBytes))
+	return nil
+}
+
+func (t *Table) Delete(key int64) (bool, error) {
+	err := t.lockKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if len(t.Indexes) == 0 {
+		return t.Tree.DeleteData(row.EncodeKey(key))
+	}
+
+	old, found, err := t.SelectOne(key)
+	if err != nil || !found {
+		return false, err
+	}
+
+	err = t.removeIndexEntries(old, key)
+	if err != nil {
+		return false, err
+	}
+	return t.Tree.DeleteData(row.EncodeKey(key))
 }